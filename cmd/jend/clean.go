@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/darkprince558/jend/internal/audit"
+	"github.com/darkprince558/jend/internal/core"
+	"github.com/spf13/cobra"
+)
+
+var cleanDryRun bool
+
+var cleanCmd = &cobra.Command{
+	Use:   "clean [dir]",
+	Short: "Remove leftover partial downloads",
+	Long:  "Find the .partial, .parallel.part and .parallel.meta files that interrupted transfers leave behind, and delete them.",
+	Example: `  jend clean
+  jend clean ~/Downloads --dry-run`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := "."
+		if len(args) == 1 {
+			dir = args[0]
+		}
+
+		partials, err := core.FindPartials(dir)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(partials) == 0 {
+			fmt.Println("No partial downloads found.")
+			return
+		}
+
+		var total int64
+		for _, p := range partials {
+			progress := "unknown"
+			if p.Percent >= 0 {
+				progress = fmt.Sprintf("%.0f%% done", p.Percent)
+			}
+			age := time.Since(p.ModTime).Round(time.Minute)
+			fmt.Printf("%-40s %10s  %-10s  idle %s\n", p.Name, audit.FormatBytes(p.Size), progress, age)
+
+			if !cleanDryRun {
+				if err := core.RemovePartial(p); err != nil {
+					fmt.Printf("  Error removing: %v\n", err)
+					continue
+				}
+			}
+			total += p.Size
+		}
+
+		if cleanDryRun {
+			fmt.Printf("\nWould free %s (--dry-run, nothing deleted).\n", audit.FormatBytes(total))
+		} else {
+			fmt.Printf("\nFreed %s.\n", audit.FormatBytes(total))
+		}
+	},
+}
+
+func init() {
+	cleanCmd.Flags().BoolVar(&cleanDryRun, "dry-run", false, "List what would be removed without deleting anything")
+	rootCmd.AddCommand(cleanCmd)
+}
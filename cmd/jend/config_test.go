@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/darkprince558/jend/internal/config"
+	"github.com/darkprince558/jend/internal/core"
+	"github.com/darkprince558/jend/internal/transport"
+)
+
+func TestResolveArgonParams(t *testing.T) {
+	auto := core.AutoArgonParams()
+	tests := []struct {
+		name      string
+		saved     core.ArgonParams
+		kdfMemory string
+		kdfTime   int
+		want      core.ArgonParams
+		wantErr   bool
+	}{
+		{name: "nothing saved", want: auto},
+		{name: "saved calibration", saved: core.ArgonParams{Time: 3, Memory: 32 * 1024}, want: core.ArgonParams{Time: 3, Memory: 32 * 1024}},
+		{name: "saved out of range", saved: core.ArgonParams{Time: 3, Memory: 1}, want: auto},
+		{name: "flag over saved", saved: core.ArgonParams{Time: 3, Memory: 32 * 1024}, kdfTime: 2, want: core.ArgonParams{Time: 2, Memory: 32 * 1024}},
+		{name: "flags over bad saved", saved: core.ArgonParams{Time: 3, Memory: 1}, kdfMemory: "16MB", want: core.ArgonParams{Time: auto.Time, Memory: 16 * 1024}},
+		{name: "flag out of range", kdfMemory: "1KB", wantErr: true},
+		{name: "memory past 32 bits", kdfMemory: "4194312M", wantErr: true}, // 2^32 + 8192 KiB, a valid 8 MB once truncated
+		{name: "negative time", kdfTime: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			if tt.saved != (core.ArgonParams{}) {
+				if err := config.Save(&config.Config{ArgonTime: tt.saved.Time, ArgonMemory: tt.saved.Memory}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := resolveArgonParams(tt.kdfMemory, tt.kdfTime)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("resolveArgonParams(%q, %d) = %+v, %v; want %+v (error %v)", tt.kdfMemory, tt.kdfTime, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolveICEConfig(t *testing.T) {
+	saved := &config.Config{
+		StunServers: []string{"stun:saved.example:3478"},
+		RelayURL:    "turn:saved.example:3478", RelayUser: "saved-user", RelayPass: "saved-pass",
+	}
+	savedTurn := &transport.CustomTurnConfig{URL: "turn:saved.example:3478", Username: "saved-user", Password: "saved-pass"}
+	envTurn := &transport.CustomTurnConfig{URL: "turn:env.example:3478", Username: "env-user", Password: "env-pass"}
+	flagTurn := &transport.CustomTurnConfig{URL: "turn:flag.example:3478", Username: "flag-user", Password: "flag-pass"}
+
+	tests := []struct {
+		name  string
+		saved *config.Config
+		env   bool
+		flags bool
+		want  *transport.ICEConfig
+	}{
+		{name: "defaults", want: &transport.ICEConfig{}},
+		{name: "config", saved: saved, want: &transport.ICEConfig{STUNServers: saved.StunServers, Turn: savedTurn}},
+		// NewICEAgent reads JEND_STUN_SERVERS itself, so STUN is left empty
+		{name: "env over config", saved: saved, env: true, want: &transport.ICEConfig{Turn: envTurn}},
+		{name: "flags over env", saved: saved, env: true, flags: true, want: &transport.ICEConfig{STUNServers: []string{"stun:flag.example:3478"}, Turn: flagTurn}},
+		{name: "flags over config", saved: saved, flags: true, want: &transport.ICEConfig{STUNServers: []string{"stun:flag.example:3478"}, Turn: flagTurn}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			for _, name := range []string{transport.EnvStunServers, transport.EnvTurnURI, transport.EnvTurnUser, transport.EnvTurnPass} {
+				t.Setenv(name, "")
+			}
+			if tt.saved != nil {
+				if err := config.Save(tt.saved); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.env {
+				t.Setenv(transport.EnvStunServers, "stun:env.example:3478")
+				t.Setenv(transport.EnvTurnURI, envTurn.URL)
+				t.Setenv(transport.EnvTurnUser, envTurn.Username)
+				t.Setenv(transport.EnvTurnPass, envTurn.Password)
+			}
+			var stun []string
+			var turnURL, turnUser, turnPass string
+			if tt.flags {
+				stun = []string{"stun:flag.example:3478"}
+				turnURL, turnUser, turnPass = flagTurn.URL, flagTurn.Username, flagTurn.Password
+			}
+
+			if got := resolveICEConfig(stun, turnURL, turnUser, turnPass); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveICEConfig = %+v (turn %+v), want %+v (turn %+v)", got, got.Turn, tt.want, tt.want.Turn)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/darkprince558/jend/internal/config"
+	"github.com/darkprince558/jend/internal/doctor"
+	"github.com/darkprince558/jend/internal/transport"
+	"github.com/darkprince558/jend/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var (
+	initNonInteractive bool
+	initSkipChecks     bool
+	initRegistryURL    string
+	initSTUN           []string
+	initRelayURL       string
+	initRelayUser      string
+	initRelayPass      string
+)
+
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Set up the registry, STUN and TURN relay step by step",
+	Long: `Ask for the discovery registry URL, STUN servers and TURN relay (with its
+credentials) one at a time, check each one answers, and save them. Leave an
+answer empty for JEND's default. With --non-interactive the values come from
+flags instead, for scripts; settings not given keep their saved value.`,
+	Example: `  jend config init
+  jend config init --non-interactive --registry-url https://api.example.com --relay-url turn:relay.example.com:3478 --relay-user me --relay-pass secret`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.Load()
+		if err != nil {
+			fmt.Printf("Error loading config: %v\n", err)
+			os.Exit(1)
+		}
+
+		if initNonInteractive {
+			if cmd.Flags().Changed("registry-url") {
+				cfg.RegistryURL = initRegistryURL
+			}
+			if cmd.Flags().Changed("stun") {
+				cfg.StunServers = initSTUN
+			}
+			if cmd.Flags().Changed("relay-url") {
+				cfg.RelayURL = initRelayURL
+			}
+			if cmd.Flags().Changed("relay-user") {
+				cfg.RelayUser = initRelayUser
+			}
+			if cmd.Flags().Changed("relay-pass") {
+				cfg.RelayPass = initRelayPass
+			}
+			if !initSkipChecks && !runInitChecks(cfg) {
+				fmt.Println("\nNothing saved. Fix the settings above, or pass --skip-checks to save them anyway.")
+				os.Exit(1)
+			}
+		} else {
+			form := ui.NewForm("JEND Setup", []ui.Field{
+				{Label: "Discovery registry URL", Help: "Where senders register their code. Empty: the public JEND registry.", Value: cfg.RegistryURL, Check: checkRegistryURL},
+				{Label: "STUN servers", Help: "Comma-separated, e.g. stun:stun.example.com:3478. Empty: the default Google server.", Value: strings.Join(cfg.StunServers, ", "), Check: checkSTUNServers},
+				{Label: "TURN relay URL", Help: "e.g. turn:relay.example.com:3478. Empty: JEND's relay.", Value: cfg.RelayURL, Check: checkRelayURL},
+				{Label: "TURN relay username", Help: "Empty if the relay needs none.", Value: cfg.RelayUser},
+				{Label: "TURN relay password", Help: "Empty if the relay needs none.", Value: cfg.RelayPass, Secret: true},
+			})
+			final, err := tea.NewProgram(form).Run()
+			if err != nil {
+				fmt.Printf("Error: %v (use --non-interactive without a terminal)\n", err)
+				os.Exit(1)
+			}
+			form = final.(ui.Form)
+			if !form.Done {
+				fmt.Println("Setup cancelled, nothing saved.")
+				return
+			}
+			cfg.RegistryURL = form.Fields[0].Value
+			cfg.StunServers = splitList(form.Fields[1].Value)
+			cfg.RelayURL, cfg.RelayUser, cfg.RelayPass = form.Fields[2].Value, form.Fields[3].Value, form.Fields[4].Value
+		}
+		if cfg.RelayURL == "" {
+			// Credentials for the default relay come from its API
+			cfg.RelayUser, cfg.RelayPass = "", ""
+		}
+
+		if err := config.Save(cfg); err != nil {
+			fmt.Printf("Error saving config: %v\n", err)
+			os.Exit(1)
+		}
+		path, _ := config.GetConfigPath()
+		fmt.Printf("Configuration saved to %s. Run `jend doctor` to check every path.\n", path)
+	},
+}
+
+// runInitChecks checks each setting cfg gives, as the wizard does, and
+// reports like `jend doctor`. It returns false if any failed.
+func runInitChecks(cfg *config.Config) bool {
+	ok := true
+	check := func(name, value string, fn func(string) error) {
+		if value == "" {
+			return
+		}
+		if err := fn(value); err != nil {
+			ok = false
+			fmt.Printf("[FAIL] %s %s: %v\n", name, value, err)
+			return
+		}
+		fmt.Printf("[ OK ] %s %s\n", name, value)
+	}
+	check("Registry", cfg.RegistryURL, checkRegistryURL)
+	for _, s := range cfg.StunServers {
+		check("STUN", s, checkSTUNServers)
+	}
+	check("TURN relay", cfg.RelayURL, func(value string) error {
+		// Every setting is known here, so the relay login is checked too
+		creds := &transport.TurnCredentials{Username: cfg.RelayUser, Password: cfg.RelayPass}
+		return doctor.CheckRelay(context.Background(), value, creds).Err
+	})
+	return ok
+}
+
+func checkRegistryURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("not an http(s) URL")
+	}
+	return doctor.CheckRegistry(value).Err
+}
+
+func checkSTUNServers(value string) error {
+	for _, s := range splitList(value) {
+		if r := doctor.CheckSTUN(context.Background(), s); r.Err != nil {
+			return fmt.Errorf("%s: %v", s, r.Err)
+		}
+	}
+	return nil
+}
+
+func checkRelayURL(value string) error {
+	return doctor.CheckRelay(context.Background(), value, nil).Err
+}
+
+// splitList splits a comma- or space-separated answer.
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+func init() {
+	configInitCmd.Flags().BoolVar(&initNonInteractive, "non-interactive", false, "Take the settings from flags instead of asking")
+	configInitCmd.Flags().BoolVar(&initSkipChecks, "skip-checks", false, "With --non-interactive, save without checking the servers answer")
+	configInitCmd.Flags().StringVar(&initRegistryURL, "registry-url", "", "Discovery registry URL (empty: the public one)")
+	configInitCmd.Flags().StringSliceVar(&initSTUN, "stun", nil, "STUN server (repeatable; empty: the default)")
+	configInitCmd.Flags().StringVar(&initRelayURL, "relay-url", "", "TURN relay URL (empty: JEND's relay)")
+	configInitCmd.Flags().StringVar(&initRelayUser, "relay-user", "", "TURN relay username")
+	configInitCmd.Flags().StringVar(&initRelayPass, "relay-pass", "", "TURN relay password")
+	configCmd.AddCommand(configInitCmd)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/darkprince558/jend/internal/config"
+)
+
+func TestRunInitChecks(t *testing.T) {
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound) // Any lookup of a made-up code
+	}))
+	defer registry.Close()
+
+	tests := []struct {
+		name string
+		cfg  config.Config
+		want bool
+	}{
+		{name: "nothing set", want: true},
+		{name: "reachable registry", cfg: config.Config{RegistryURL: registry.URL}, want: true},
+		{name: "not a URL", cfg: config.Config{RegistryURL: "registry.example.com"}, want: false},
+		{name: "bad STUN server", cfg: config.Config{RegistryURL: registry.URL, StunServers: []string{"not-a-stun-url"}}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runInitChecks(&tt.cfg); got != tt.want {
+				t.Errorf("runInitChecks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/darkprince558/jend/internal/core"
+	"github.com/darkprince558/jend/internal/doctor"
+	"github.com/darkprince558/jend/internal/transport"
+	"github.com/spf13/cobra"
+)
+
+var (
+	doctorPort      int
+	doctorLANOnly   bool
+	doctorSTUN      []string
+	doctorRelayURL  string
+	doctorRelayUser string
+	doctorRelayPass string
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the network paths transfers depend on",
+	Long: `Check each way JEND finds and reaches a peer: the listen port, mDNS on the
+local network, the cloud registry, STUN, TURN relays and signaling. Each
+failed check comes with a hint on what it breaks and what to try.`,
+	Example: `  jend doctor
+  jend doctor --port 9100 --lan-only
+  jend doctor --relay-url "turn:my.relay.click:3478" --relay-user foo --relay-pass bar`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		opts := doctor.Options{
+			Port:    doctorPort,
+			ICE:     resolveICEConfig(doctorSTUN, doctorRelayURL, doctorRelayUser, doctorRelayPass),
+			LANOnly: doctorLANOnly,
+			AuthURL: transport.TurnAuthURL(),
+		}
+
+		failed := 0
+		ok := doctor.Run(ctx, opts, func(r doctor.Result) {
+			switch {
+			case r.Skipped:
+				fmt.Printf("[SKIP] %s (%s)\n", r.Name, r.Detail)
+			case r.OK():
+				fmt.Printf("[ OK ] %s: %s\n", r.Name, r.Detail)
+			default:
+				failed++
+				fmt.Printf("[FAIL] %s: %v\n", r.Name, r.Err)
+				fmt.Printf("       %s\n", r.Hint)
+			}
+		})
+
+		if ok {
+			fmt.Println("\nAll checks passed.")
+			return
+		}
+		fmt.Printf("\n%d check(s) failed.\n", failed)
+		os.Exit(1)
+	},
+}
+
+func init() {
+	doctorCmd.Flags().IntVar(&doctorPort, "port", core.DefaultPort, "UDP port to check, as given to send --port")
+	doctorCmd.Flags().BoolVar(&doctorLANOnly, "lan-only", false, "Only check the local network (port and mDNS)")
+	doctorCmd.Flags().StringSliceVar(&doctorSTUN, "stun", nil, "STUN server to check instead of the configured ones (repeatable)")
+	doctorCmd.Flags().StringVar(&doctorRelayURL, "relay-url", "", "Check this TURN relay instead of fetching credentials for the default one (alias --turn)")
+	doctorCmd.Flags().StringVar(&doctorRelayUser, "relay-user", "", "TURN Relay Username (alias --turn-user)")
+	doctorCmd.Flags().StringVar(&doctorRelayPass, "relay-pass", "", "TURN Relay Password (alias --turn-pass)")
+
+	doctorCmd.Flags().SetNormalizeFunc(turnFlagAliases)
+	rootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/darkprince558/jend/internal/audit"
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyClear  bool
+	historyJSON   bool
+	historySince  string
+	historyUntil  string
+	historyStatus string
+	exportCSVPath string
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history [code]",
+	Short: "View transfer history",
+	Example: `  jend history
+  jend history partial-red-panda
+  jend history --since 7d --status failed
+  jend history --since 2024-01-01 --until 2024-02-01 --json
+  jend history export --csv transfers.csv
+  jend history --clear`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if historyClear {
+			if err := audit.ClearHistory(); err != nil && !os.IsNotExist(err) {
+				fmt.Printf("Error clearing history: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println("History cleared.")
+			return
+		}
+
+		if len(args) == 1 {
+			audit.ShowDetail(args[0])
+			return
+		}
+		filter, err := historyFilter()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		audit.ShowHistory(filter, historyJSON)
+	},
+}
+
+var historyExportCmd = &cobra.Command{
+	Use:   "export --csv <file>",
+	Short: "Export transfer history to CSV",
+	Example: `  jend history export --csv transfers.csv
+  jend history export --csv - --since 30d | less`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if exportCSVPath == "" {
+			fmt.Println("Error: --csv <file> is required (use - for stdout)")
+			os.Exit(1)
+		}
+		filter, err := historyFilter()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		entries, err := audit.LoadHistory()
+		if err != nil {
+			fmt.Printf("Error loading history: %v\n", err)
+			os.Exit(1)
+		}
+		entries = filter.Apply(entries)
+
+		if exportCSVPath == "-" {
+			if err := audit.ExportCSV(os.Stdout, entries); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		f, err := os.Create(exportCSVPath)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := audit.ExportCSV(f, entries); err != nil {
+			f.Close()
+			fmt.Printf("Error writing %s: %v\n", exportCSVPath, err)
+			os.Exit(1)
+		}
+		if err := f.Close(); err != nil {
+			fmt.Printf("Error writing %s: %v\n", exportCSVPath, err)
+			os.Exit(1)
+		}
+		if len(entries) == 0 {
+			fmt.Printf("No transfers to export; wrote an empty table to %s.\n", exportCSVPath)
+			return
+		}
+		fmt.Printf("Exported %d transfers to %s.\n", len(entries), exportCSVPath)
+	},
+}
+
+// historyFilter builds the display filter from the --since/--until/--status flags.
+func historyFilter() (audit.Filter, error) {
+	var filter audit.Filter
+	now := time.Now()
+	var err error
+	if historySince != "" {
+		if filter.Since, err = audit.ParseSince(historySince, now); err != nil {
+			return filter, err
+		}
+	}
+	if historyUntil != "" {
+		if filter.Until, err = audit.ParseUntil(historyUntil, now); err != nil {
+			return filter, err
+		}
+	}
+	switch strings.ToLower(historyStatus) {
+	case "":
+	case "success", "failed":
+		filter.Status = strings.ToLower(historyStatus)
+	default:
+		return filter, fmt.Errorf("invalid --status %q (use success or failed)", historyStatus)
+	}
+	return filter, nil
+}
+
+func init() {
+	historyCmd.Flags().BoolVar(&historyClear, "clear", false, "Delete all transfer history")
+	historyCmd.Flags().BoolVar(&historyJSON, "json", false, "Print the (filtered) history as JSON")
+	historyCmd.PersistentFlags().StringVar(&historySince, "since", "", "Only transfers since a date (YYYY-MM-DD) or age (7d, 24h)")
+	historyCmd.PersistentFlags().StringVar(&historyUntil, "until", "", "Only transfers up to a date (inclusive) or age")
+	historyCmd.PersistentFlags().StringVar(&historyStatus, "status", "", "Only transfers with this status: success or failed")
+	historyExportCmd.Flags().StringVar(&exportCSVPath, "csv", "", "CSV file to write (- for stdout)")
+	historyCmd.AddCommand(historyExportCmd)
+	rootCmd.AddCommand(historyCmd)
+}
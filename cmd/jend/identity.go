@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"os"
+
+	"github.com/darkprince558/jend/internal/identity"
+	"github.com/spf13/cobra"
+)
+
+var identityCmd = &cobra.Command{
+	Use:   "identity",
+	Short: "Print this device's key fingerprint",
+	Long: `Print the fingerprint of this device's identity key. As a sender, jend signs
+every handshake with it and publishes the public key through discovery, so a
+receiver can insist on you with receive --expect-sender. As a receiver, it is
+what a sender's send --allow list names.
+
+The key is created in ~/.jend/identity.key on first use; keep it private, and
+copy it to keep the same fingerprint on a new machine.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		printFingerprint()
+	},
+}
+
+// printFingerprint prints this device's fingerprint, creating its key if needed.
+func printFingerprint() {
+	key, err := identity.Load()
+	if err != nil {
+		fmt.Printf("Error loading identity: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(identity.Fingerprint(key.Public().(ed25519.PublicKey)))
+}
+
+func init() {
+	rootCmd.AddCommand(identityCmd)
+}
@@ -1,5 +1,15 @@
 package main
 
+import "os"
+
 func main() {
 	Execute()
 }
+
+// exitOnError ends a headless run with status 1 when the transfer failed, so
+// scripts can tell. The error itself was already printed by the transfer.
+func exitOnError(err error) {
+	if err != nil {
+		os.Exit(1)
+	}
+}
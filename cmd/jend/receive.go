@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/darkprince558/jend/internal/core"
+	"github.com/darkprince558/jend/internal/discovery"
+	"github.com/darkprince558/jend/internal/identity"
+	"github.com/darkprince558/jend/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var (
+	recvDir         string
+	recvHeadless    bool
+	recvUnzip       bool
+	recvNoClipboard bool
+	recvNoHistory   bool
+	recvIncognito   bool
+	recvConcurrency int
+	recvFresh       bool
+	recvMaxAttempts int
+	recvStdout      bool
+	recvParallelMin string
+	recvLANOnly     bool
+	recvPreferIPv4  bool
+	recvPreferIPv6  bool
+	recvSTUN        []string
+	recvRelayURL    string
+	recvRelayUser   string
+	recvRelayPass   string
+	recvRate        string
+	recvOutput      string
+	recvForce       bool
+	recvYes         bool
+	recvMaxSize     string
+	recvNoPreserve  bool
+	recvCipher      string
+	recvProgress    string
+	recvJSON        bool
+	recvExpect      string
+	recvTextLimit   string
+	recvDelta       bool
+	recvHardlink    bool
+)
+
+var receiveCmd = &cobra.Command{
+	Use:   "receive [code]",
+	Short: "Receive a file using a code",
+	Long:  "Receive a file from a sender using the 3-word code they provided, or the jend:// link they shared (or their QR code). A link with the sender's address is dialed directly before falling back to discovery.",
+	Example: `  jend receive happy-delta-seven
+  jend receive "jend://happy-delta-seven?ip=192.168.1.20&port=9000"
+  jend receive --dir ~/Downloads --concurrency 16 happy-delta-seven
+  jend receive --stdout happy-delta-seven | tar xz
+  jend receive --output report.pdf --force happy-delta-seven
+  jend receive --expect-sender SHA256:Qm7p... happy-delta-seven
+  jend receive --relay-url "turn:my.relay.click" ...`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		applyConfigDefaults(cmd)
+
+		link, err := discovery.ParseLink(args[0])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		code := link.Code
+
+		if recvIncognito {
+			recvNoHistory = true
+			recvNoClipboard = true
+		}
+		if recvConcurrency < 1 {
+			fmt.Println("Error: --concurrency must be at least 1")
+			os.Exit(1)
+		}
+		parallelThreshold, err := core.ParseByteSize(recvParallelMin)
+		if err != nil {
+			fmt.Printf("Error: --parallel-threshold: %v\n", err)
+			os.Exit(1)
+		}
+		rate, err := core.ParseByteSize(recvRate)
+		if err != nil {
+			fmt.Printf("Error: --rate: %v\n", err)
+			os.Exit(1)
+		}
+		outputName := ""
+		switch {
+		case recvOutput == "-":
+			recvStdout = true
+		case recvOutput != "":
+			if recvStdout {
+				fmt.Println("Error: --output cannot be combined with --stdout")
+				os.Exit(1)
+			}
+			if dir := filepath.Dir(recvOutput); dir != "." {
+				if cmd.Flags().Changed("dir") {
+					fmt.Println("Error: --output with a directory cannot be combined with --dir")
+					os.Exit(1)
+				}
+				recvDir = dir
+			}
+			outputName = filepath.Base(recvOutput)
+		}
+		maxSize, err := core.ParseByteSize(recvMaxSize)
+		if err != nil {
+			fmt.Printf("Error: --max-size: %v\n", err)
+			os.Exit(1)
+		}
+		textLimit, err := core.ParseByteSize(recvTextLimit)
+		if err != nil {
+			fmt.Printf("Error: --text-limit: %v\n", err)
+			os.Exit(1)
+		}
+		if recvStdout && recvUnzip {
+			fmt.Println("Error: --stdout cannot be combined with --unzip")
+			os.Exit(1)
+		}
+		if recvMaxAttempts < 0 {
+			fmt.Println("Error: --max-attempts cannot be negative")
+			os.Exit(1)
+		}
+
+		ipPref := discovery.PreferAny
+		switch {
+		case recvPreferIPv4:
+			ipPref = discovery.PreferIPv4
+		case recvPreferIPv6:
+			ipPref = discovery.PreferIPv6
+		}
+
+		progressInterval, err := time.ParseDuration(recvProgress)
+		if err != nil || progressInterval < 0 {
+			fmt.Printf("Error: invalid --progress-interval %q (use e.g. 5s, 1m, or 0 for none)\n", recvProgress)
+			os.Exit(1)
+		}
+
+		cipher, err := parseCipher(recvCipher)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if recvExpect != "" {
+			if _, err := identity.ParseFingerprint(recvExpect); err != nil {
+				fmt.Printf("Error: --expect-sender: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		recvOpts := core.ReceiveOptions{
+			Code:              code,
+			Hint:              link.Addr(),
+			OutputDir:         recvDir,
+			OutputName:        outputName,
+			Force:             recvForce,
+			NoPreserve:        recvNoPreserve,
+			Unzip:             recvUnzip,
+			NoClipboard:       recvNoClipboard,
+			Stdout:            recvStdout,
+			NoHistory:         recvNoHistory,
+			Fresh:             recvFresh,
+			Delta:             recvDelta,
+			Hardlink:          recvHardlink,
+			Concurrency:       recvConcurrency,
+			ParallelThreshold: parallelThreshold,
+			MaxAttempts:       recvMaxAttempts,
+			Rate:              rate,
+			MaxSize:           maxSize,
+			TextLimit:         textLimit,
+			ICE:               resolveICEConfig(recvSTUN, recvRelayURL, recvRelayUser, recvRelayPass),
+			LANOnly:           recvLANOnly,
+			IPPref:            ipPref,
+			Cipher:            cipher,
+			ExpectSender:      recvExpect,
+		}
+
+		if recvHeadless || recvJSON {
+			// Ctrl-C tells the sender to stop before we exit
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			stopFallback := context.AfterFunc(ctx, func() {
+				// A second Ctrl-C, or a stuck dial, still ends it
+				stop()
+				time.AfterFunc(5*time.Second, func() { os.Exit(1) })
+			})
+			// With --stdout the payload owns stdout; everything else goes to stderr
+			var logOut io.Writer = os.Stdout
+			if recvStdout {
+				logOut = os.Stderr
+			}
+			var printer core.Notifier = &core.Printer{W: logOut, Interval: progressInterval}
+			if recvJSON {
+				printer = &core.JSONPrinter{W: logOut, Interval: progressInterval}
+			}
+			err := core.RunReceiver(ctx, printer, recvOpts)
+			stopFallback()
+			stop()
+			exitOnError(err)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var opts []tea.ProgramOption
+		if recvStdout {
+			// Keep the UI off the piped payload
+			opts = append(opts, tea.WithOutput(os.Stderr))
+		}
+		recvOpts.Confirm = !recvYes // Only the TUI can ask
+		p := tea.NewProgram(ui.NewModel(ui.RoleReceiver, "", code), opts...)
+		received := make(chan struct{})
+		go func() {
+			defer close(received)
+			core.RunReceiver(ctx, p, recvOpts)
+		}()
+
+		final, err := p.Run()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if m, ok := final.(ui.Model); ok && m.Declined {
+			// Let the receiver tell the sender before we exit
+			<-received
+			fmt.Println("Transfer declined.")
+		} else if ok && m.Exit {
+			// Ctrl-C: tell the sender to stop, rather than leave it writing into a dead connection
+			cancel()
+			select {
+			case <-received:
+			case <-time.After(2 * time.Second):
+			}
+		}
+	},
+}
+
+func init() {
+	receiveCmd.Flags().StringVar(&recvDir, "dir", ".", "Output directory")
+	receiveCmd.Flags().BoolVar(&recvHeadless, "headless", false, "Run in headless mode (no TUI)")
+	receiveCmd.Flags().BoolVar(&recvJSON, "json-events", false, "Print newline-delimited JSON events instead of status lines, for scripts (implies --headless)")
+	receiveCmd.Flags().StringVar(&recvProgress, "progress-interval", core.DefaultProgressInterval.String(), "With --headless, print a progress line at most this often during a transfer (0 = none)")
+	receiveCmd.Flags().BoolVar(&recvUnzip, "unzip", false, "Automatically unzip received archives")
+	receiveCmd.Flags().BoolVar(&recvNoClipboard, "no-clipboard", false, "Disable clipboard copy")
+	receiveCmd.Flags().BoolVar(&recvNoPreserve, "no-preserve", false, "Don't restore the sender's file permissions and modification time")
+	receiveCmd.Flags().BoolVar(&recvNoHistory, "no-history", false, "Disable audit logging")
+	receiveCmd.Flags().BoolVar(&recvIncognito, "incognito", false, "Enable incognito mode (no history, no clipboard)")
+	receiveCmd.Flags().IntVar(&recvConcurrency, "concurrency", 4, "Number of parallel download streams")
+	receiveCmd.Flags().StringVar(&recvParallelMin, "parallel-threshold", "100M", "Files larger than this download over --concurrency streams (e.g. 50M, 1G)")
+	receiveCmd.Flags().BoolVar(&recvFresh, "fresh", false, "Discard any partial download and start from zero")
+	receiveCmd.Flags().StringVar(&recvOutput, "output", "", "Save as this file name instead of the sender's (\"-\" = stdout)")
+	receiveCmd.Flags().BoolVar(&recvForce, "force", false, "Overwrite existing files instead of saving as \"name (1)\"")
+	receiveCmd.Flags().BoolVar(&recvYes, "yes", false, "Accept the offer without asking (headless never asks)")
+	receiveCmd.Flags().BoolVar(&recvDelta, "delta", false, "If the file being received is already in the output directory, get only what changed (add --force to update it in place)")
+	receiveCmd.Flags().BoolVar(&recvHardlink, "hardlink", false, "Save files with the same content as another in the session as hard links to it instead of copies")
+	receiveCmd.Flags().BoolVar(&recvStdout, "stdout", false, "Write the received data to stdout instead of a file (no resume)")
+	receiveCmd.Flags().StringVar(&recvRate, "rate", "0", "Cap download bandwidth in bytes/sec, e.g. 5M (0 = unlimited)")
+	receiveCmd.Flags().StringVar(&recvMaxSize, "max-size", "1024G", "Refuse transfers larger than this, e.g. 20G (0 = no limit)")
+	receiveCmd.Flags().StringVar(&recvTextLimit, "text-limit", "1M", "Refuse text snippets larger than this, e.g. 10M (0 = no limit); text is held in memory")
+	receiveCmd.Flags().StringVar(&recvCipher, "cipher", "auto", "Cipher to ask for: aes-gcm, chacha20, or auto (AES-GCM with hardware AES, else ChaCha20)")
+	receiveCmd.Flags().StringVar(&recvExpect, "expect-sender", "", "Only accept a sender proving this key fingerprint, from their jend identity")
+	receiveCmd.Flags().IntVar(&recvMaxAttempts, "max-attempts", 10, "Connection attempts before giving up (0 = retry forever)")
+	receiveCmd.Flags().BoolVar(&recvLANOnly, "lan-only", false, "Local network only: no cloud registry, signaling or relay (mDNS and direct connections)")
+	receiveCmd.Flags().BoolVar(&recvPreferIPv4, "prefer-ipv4", false, "Dial the sender's IPv4 addresses first")
+	receiveCmd.Flags().BoolVar(&recvPreferIPv6, "prefer-ipv6", false, "Dial the sender's IPv6 addresses first")
+	receiveCmd.MarkFlagsMutuallyExclusive("prefer-ipv4", "prefer-ipv6")
+	receiveCmd.Flags().StringSliceVar(&recvSTUN, "stun", nil, "STUN server to use instead of the default (repeatable, e.g. stun:stun.example.com:3478)")
+	receiveCmd.Flags().StringVar(&recvRelayURL, "relay-url", "", "Custom TURN Relay URL (e.g. turn:host:port; alias --turn)")
+	receiveCmd.Flags().StringVar(&recvRelayUser, "relay-user", "", "TURN Relay Username (alias --turn-user)")
+	receiveCmd.Flags().StringVar(&recvRelayPass, "relay-pass", "", "TURN Relay Password (alias --turn-pass)")
+
+	receiveCmd.Flags().SetNormalizeFunc(turnFlagAliases)
+	rootCmd.AddCommand(receiveCmd)
+}
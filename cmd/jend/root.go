@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// Build information (injected by goreleaser via -ldflags)
+var (
+	version = "dev"
+	commit  = "none"
+	date    = "unknown"
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "jend",
+	Short: "JEND is a secure, direct file transfer tool.",
+	Long: `JEND is a secure, direct file transfer tool.
+
+Files move peer-to-peer over QUIC, authenticated with a short code (PAKE)
+and encrypted end-to-end. Works on the same LAN or across NATs via ICE.`,
+	Version: version,
+}
+
+// Execute runs the root command
+func Execute() {
+	rootCmd.SetVersionTemplate(fmt.Sprintf("JEND v%s\nCommit: %s\nBuilt: %s\n", version, commit, date))
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
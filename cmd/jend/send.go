@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/atotto/clipboard"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/darkprince558/jend/internal/core"
+	"github.com/darkprince558/jend/internal/discovery"
+	"github.com/darkprince558/jend/internal/identity"
+	"github.com/darkprince558/jend/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var (
+	sendText        string
+	sendClipboard   bool
+	sendHeadless    bool
+	sendTimeout     string
+	sendForceTar    bool
+	sendForceZip    bool
+	sendNoHistory   bool
+	sendNoClipboard bool
+	sendIncognito   bool
+	sendFollow      bool
+	sendSinceOffset int64
+	sendChunkSize   string
+	sendCompress    int
+	sendFollowLinks bool
+	sendExclude     []string
+	sendGitignore   bool
+	sendReproduce   bool
+	sendKDFMemory   string
+	sendKDFTime     int
+	sendLANOnly     bool
+	sendSTUN        []string
+	sendRelayURL    string
+	sendRelayUser   string
+	sendRelayPass   string
+	sendRate        string
+	sendMaxDuration string
+	sendDryRun      bool
+	sendPort        int
+	sendBind        string
+	sendQR          bool
+	sendCode        string
+	sendWords       int
+	sendOnce        bool
+	sendAllow       []string
+	sendNoTCP       bool
+	sendCipher      string
+	sendSaveSession bool
+	sendResume      string
+	sendProgress    string
+	sendJSON        bool
+)
+
+var sendCmd = &cobra.Command{
+	Use:   "send [file... | -]",
+	Short: "Send files, a directory, or a text snippet",
+	Example: `  jend send report.pdf
+  jend send a.txt b.txt photo.jpg
+  jend send ./project --zip
+  jend send --text "https://example.com"
+  jend send --clipboard
+  jend send --incognito secret.txt
+  jend send --follow app.log
+  jend send ./project --dry-run
+  jend send --qr photo.jpg
+  jend send --words 4 secrets.tar
+  jend send --once contract.pdf
+  jend send --allow SHA256:Jm3x... payroll.xlsx
+  jend send --save-session dataset.tar
+  jend send --resume 7-happy-delta-seven
+  tar cz ./project | jend send -
+  jend send --relay-url "turn:my.relay.click:3478" --relay-user foo --relay-pass bar data.iso`,
+	Args: cobra.ArbitraryArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		applyConfigDefaults(cmd)
+
+		// A resumed session brings its own files, code and payload options
+		var session *core.SenderSession
+		if sendResume != "" {
+			for _, name := range []string{"text", "clipboard", "code", "words", "tar", "zip", "compress-level", "follow-symlinks", "exclude", "respect-gitignore", "reproducible", "since-offset", "follow", "save-session", "dry-run"} {
+				if cmd.Flags().Changed(name) {
+					fmt.Printf("Error: --resume takes the files, code and archive options from the saved session; drop --%s\n", name)
+					os.Exit(1)
+				}
+			}
+			if len(args) > 0 {
+				fmt.Println("Error: --resume takes the files from the saved session; don't list any")
+				os.Exit(1)
+			}
+			var err error
+			if session, err = core.LoadSenderSession(sendResume); err != nil {
+				fmt.Printf("Error: --resume: %v\n", err)
+				os.Exit(1)
+			}
+			args = session.Files
+			sendForceTar, sendForceZip = session.Tar, session.Zip
+			sendCompress, sendFollowLinks = session.CompressLevel, session.FollowSymlinks
+			sendExclude, sendGitignore = session.Exclude, session.RespectGitignore
+			sendReproduce = session.Reproducible
+			sendSinceOffset = session.SinceOffset
+			sendOnce = sendOnce || session.Once
+			if !cmd.Flags().Changed("port") {
+				sendPort = session.Port
+			}
+		}
+
+		if sendClipboard {
+			if sendText != "" || len(args) > 0 {
+				fmt.Println("Error: --clipboard sends the clipboard; don't add --text or files")
+				os.Exit(1)
+			}
+			text, err := core.ReadClipboard()
+			if err != nil {
+				fmt.Printf("Error: --clipboard: %v\n", err)
+				os.Exit(1)
+			}
+			sendText = text
+		}
+		isText := sendText != ""
+		if !isText && len(args) == 0 {
+			fmt.Println("Error: provide a file to send or use --text or --clipboard")
+			os.Exit(1)
+		}
+
+		timeout, err := time.ParseDuration(sendTimeout)
+		if err != nil {
+			fmt.Printf("Invalid timeout format: %v\n", err)
+			os.Exit(1)
+		}
+		maxDuration, err := time.ParseDuration(sendMaxDuration)
+		if err != nil || maxDuration < 0 {
+			fmt.Printf("Error: invalid --max-duration %q (use e.g. 30m, 2h)\n", sendMaxDuration)
+			os.Exit(1)
+		}
+		progressInterval, err := time.ParseDuration(sendProgress)
+		if err != nil || progressInterval < 0 {
+			fmt.Printf("Error: invalid --progress-interval %q (use e.g. 5s, 1m, or 0 for none)\n", sendProgress)
+			os.Exit(1)
+		}
+
+		chunkSize, err := core.ParseChunkSize(sendChunkSize)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		rate, err := core.ParseByteSize(sendRate)
+		if err != nil {
+			fmt.Printf("Error: --rate: %v\n", err)
+			os.Exit(1)
+		}
+
+		if sendPort < 0 || sendPort > 65535 {
+			fmt.Println("Error: --port must be between 0 and 65535")
+			os.Exit(1)
+		}
+
+		if sendBind != "" && net.ParseIP(sendBind) == nil {
+			fmt.Printf("Error: --bind %q is not an IP address\n", sendBind)
+			os.Exit(1)
+		}
+
+		if sendJSON {
+			if sendQR {
+				fmt.Println("Error: --qr cannot be combined with --json-events")
+				os.Exit(1)
+			}
+			sendHeadless = true
+		}
+
+		if sendCompress < -1 || sendCompress > 9 {
+			fmt.Println("Error: --compress-level must be between 0 and 9, or -1 for the default")
+			os.Exit(1)
+		}
+		if err := core.ValidateExcludes(sendExclude); err != nil {
+			fmt.Printf("Error: --exclude: %v\n", err)
+			os.Exit(1)
+		}
+		compress := core.CompressOptions{Level: sendCompress, FollowSymlinks: sendFollowLinks, Exclude: sendExclude, RespectGitignore: sendGitignore, Reproducible: sendReproduce}
+
+		if sendIncognito {
+			sendNoHistory = true
+			sendNoClipboard = true
+		}
+
+		var filePaths []string
+		var filePath string
+		displayName := "Text Snippet"
+		if !isText {
+			filePaths = args
+			filePath = args[0]
+			displayName = filepath.Base(filePath)
+			if filePath == "-" {
+				displayName = "stdin"
+			}
+			if len(args) > 1 {
+				displayName = fmt.Sprintf("%d files", len(args))
+			}
+		}
+		if len(sendExclude) > 0 || sendGitignore {
+			if info, err := os.Stat(filePath); isText || len(filePaths) > 1 || err != nil || !info.IsDir() {
+				fmt.Println("Error: --exclude and --respect-gitignore only apply when sending a directory")
+				os.Exit(1)
+			}
+		}
+
+		argon, err := resolveArgonParams(sendKDFMemory, sendKDFTime)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		cipher, err := parseCipher(sendCipher)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		code := sendCode
+		switch {
+		case session != nil:
+			code = session.Code
+		case sendCode != "":
+			if cmd.Flags().Changed("words") {
+				fmt.Println("Error: --words cannot be combined with --code")
+				os.Exit(1)
+			}
+			if err := core.ValidateCode(sendCode); err != nil {
+				fmt.Printf("Error: --code: %v\n", err)
+				os.Exit(1)
+			}
+		case sendWords < core.MinCodeWords || sendWords > core.MaxCodeWords:
+			fmt.Printf("Error: --words must be between %d and %d\n", core.MinCodeWords, core.MaxCodeWords)
+			os.Exit(1)
+		default:
+			code = core.GenerateCode(sendWords)
+		}
+		for _, fp := range sendAllow {
+			if _, err := identity.ParseFingerprint(fp); err != nil {
+				fmt.Printf("Error: --allow: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		iceCfg := resolveICEConfig(sendSTUN, sendRelayURL, sendRelayUser, sendRelayPass)
+
+		if sendSaveSession {
+			if sendDryRun {
+				fmt.Println("Error: --save-session cannot be combined with --dry-run")
+				os.Exit(1)
+			}
+			if session, err = core.NewSenderSession(code, filePaths, isText, sendFollow); err != nil {
+				fmt.Printf("Error: --save-session: %v\n", err)
+				os.Exit(1)
+			}
+			session.Tar, session.Zip = sendForceTar, sendForceZip
+			session.CompressLevel, session.FollowSymlinks = sendCompress, sendFollowLinks
+			session.Exclude, session.RespectGitignore = sendExclude, sendGitignore
+			session.Reproducible = sendReproduce
+			session.SinceOffset, session.Port, session.Once = sendSinceOffset, sendPort, sendOnce
+		}
+
+		sendOpts := core.SendOptions{
+			Paths:       filePaths,
+			Text:        sendText,
+			IsText:      isText,
+			Code:        code,
+			Timeout:     timeout,
+			MaxDuration: maxDuration,
+			ForceTar:    sendForceTar,
+			ForceZip:    sendForceZip,
+			Compress:    compress,
+			Follow:      sendFollow,
+			SinceOffset: sendSinceOffset,
+			ChunkSize:   chunkSize,
+			NoHistory:   sendNoHistory,
+			Rate:        rate,
+			DryRun:      sendDryRun,
+			Port:        sendPort,
+			Bind:        sendBind,
+			NoTCP:       sendNoTCP,
+			Once:        sendOnce,
+			ICE:         iceCfg,
+			LANOnly:     sendLANOnly,
+			Argon:       argon,
+			Cipher:      cipher,
+			Allow:       sendAllow,
+			Session:     session,
+		}
+
+		// The headless output: lines for people, or JSON for scripts
+		var headlessOut core.Notifier = &core.Printer{W: os.Stdout, QR: sendQR, Interval: progressInterval}
+		if sendJSON {
+			headlessOut = &core.JSONPrinter{W: os.Stdout, Interval: progressInterval}
+		}
+
+		if sendDryRun {
+			// Nothing to wait for, so no TUI and no code to share
+			err := core.RunSender(context.Background(), headlessOut, sendOpts)
+			exitOnError(err)
+			return
+		}
+
+		if !sendNoClipboard {
+			clipboard.WriteAll(code)
+		}
+
+		if sendHeadless {
+			if events, ok := headlessOut.(*core.JSONPrinter); ok {
+				events.Code(code)
+			} else {
+				fmt.Printf("Code: %s\n", code)
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+
+			// The QR code follows the "Link:" line, once the address is known
+			err := core.RunSender(ctx, headlessOut, sendOpts)
+			stop()
+			exitOnError(err)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var opts []tea.ProgramOption
+		if filePath == "-" {
+			// Stdin carries the payload; read keys from the terminal instead
+			opts = append(opts, tea.WithInputTTY())
+		}
+		model := ui.NewModel(ui.RoleSender, displayName, code)
+		if sendQR {
+			// Code only until the sender's link with its address arrives
+			model.QR, _ = ui.ViewQR(discovery.Link{Code: code}.String())
+		}
+		p := tea.NewProgram(model, opts...)
+		senderDone := make(chan struct{})
+		go func() {
+			core.RunSender(ctx, p, sendOpts)
+			close(senderDone)
+		}()
+
+		_, err = p.Run()
+		if session != nil {
+			// Quitting ends the session, as Ctrl-C does in headless mode; RunSender
+			// may not get to clean up before we exit
+			core.RemoveSenderSession(code)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if sendFollow {
+			// Ctrl-C in follow mode means "finish": flush the tail to the receiver first
+			fmt.Println("Finishing stream...")
+			cancel()
+			select {
+			case <-senderDone:
+			case <-time.After(10 * time.Second):
+			}
+		}
+	},
+}
+
+func init() {
+	sendCmd.Flags().StringVar(&sendText, "text", "", "Send text content directly")
+	sendCmd.Flags().BoolVar(&sendClipboard, "clipboard", false, "Send the clipboard's text")
+	sendCmd.Flags().BoolVar(&sendHeadless, "headless", false, "Run in headless mode (no TUI)")
+	sendCmd.Flags().BoolVar(&sendJSON, "json-events", false, "Print newline-delimited JSON events instead of status lines, for scripts (implies --headless)")
+	sendCmd.Flags().StringVar(&sendProgress, "progress-interval", core.DefaultProgressInterval.String(), "With --headless, print a progress line at most this often during a transfer (0 = none)")
+	sendCmd.Flags().StringVar(&sendTimeout, "timeout", "10m", "How long to wait for a receiver (e.g. 30s, 5m)")
+	sendCmd.Flags().StringVar(&sendMaxDuration, "max-duration", "0", "Abort a transfer still running after this long, e.g. 2h (0 = no limit)")
+	sendCmd.Flags().BoolVar(&sendForceTar, "tar", false, "Force tar.gz compression")
+	sendCmd.Flags().BoolVar(&sendForceZip, "zip", false, "Force zip compression")
+	sendCmd.Flags().BoolVar(&sendNoHistory, "no-history", false, "Disable audit logging")
+	sendCmd.Flags().StringVar(&sendCode, "code", "", "Use this code instead of a generated one (at least 8 characters; pick something hard to guess)")
+	sendCmd.Flags().IntVar(&sendWords, "words", core.DefaultCodeWords, "Number of words in the generated code; each adds about 8 bits of entropy")
+	sendCmd.Flags().BoolVar(&sendSaveSession, "save-session", false, "Save the code and files to ~/.jend/sessions so `send --resume CODE` can serve them again if this sender dies")
+	sendCmd.Flags().StringVar(&sendResume, "resume", "", "Serve a saved session (see --save-session) again under its code, after the sender died")
+	sendCmd.Flags().BoolVar(&sendOnce, "once", false, "Exit after the first complete transfer instead of waiting for more receivers (a resumed transfer counts once; not with --follow)")
+	sendCmd.Flags().StringSliceVar(&sendAllow, "allow", nil, "Only send to receivers with this key fingerprint, from their jend identity (repeatable)")
+	sendCmd.Flags().BoolVar(&sendQR, "qr", false, "Also show the code as a QR code (a jend:// link) for another device to scan")
+	sendCmd.Flags().BoolVar(&sendNoClipboard, "no-clipboard", false, "Disable clipboard copy of code")
+	sendCmd.Flags().BoolVar(&sendIncognito, "incognito", false, "Enable incognito mode (no history, no clipboard)")
+	sendCmd.Flags().BoolVar(&sendFollow, "follow", false, "Keep streaming the file as it grows, like tail -f (Ctrl-C to finish)")
+	sendCmd.Flags().Int64Var(&sendSinceOffset, "since-offset", 0, "Only send bytes from this offset onward (advanced/testing)")
+	sendCmd.Flags().BoolVar(&sendDryRun, "dry-run", false, "Show the name, size, checksum and compression of what would be sent, then exit")
+	sendCmd.Flags().BoolVar(&sendFollowLinks, "follow-symlinks", false, "Archive what symlinks in a directory point to, instead of the links")
+	sendCmd.Flags().StringArrayVar(&sendExclude, "exclude", nil, "Leave files and directories matching this glob out of a directory, e.g. node_modules or '*.log' (repeatable; also read from .jendignore)")
+	sendCmd.Flags().BoolVar(&sendGitignore, "respect-gitignore", false, "Leave out of a directory .git and what its .gitignore files (nested ones too) ignore")
+	sendCmd.Flags().BoolVar(&sendReproduce, "reproducible", false, "Archive a directory with fixed mtimes, owners and permissions, so the same files always give the same hash")
+	sendCmd.Flags().IntVar(&sendCompress, "compress-level", -1, "gzip/zip level for directories, 0 (store) to 9 (smallest); -1 is the default")
+	sendCmd.Flags().StringVar(&sendRate, "rate", "0", "Cap upload bandwidth in bytes/sec, e.g. 5M (0 = unlimited)")
+	sendCmd.Flags().StringVar(&sendChunkSize, "chunk-size", "64k", "Data frame size, 4k to 4M (larger for fast LANs, smaller for lossy links)")
+	sendCmd.Flags().StringVar(&sendKDFMemory, "kdf-memory", "", "Argon2 memory per handshake, 8M to 1G (default: 64M, less on low-memory hosts)")
+	sendCmd.Flags().IntVar(&sendKDFTime, "kdf-time", 0, "Argon2 iterations per handshake (default: 3)")
+	sendCmd.Flags().StringVar(&sendCipher, "cipher", "auto", "Cipher to ask for: aes-gcm, chacha20, or auto (AES-GCM with hardware AES, else ChaCha20)")
+	sendCmd.Flags().IntVar(&sendPort, "port", core.DefaultPort, "UDP port to listen on for direct connections (0 = any free port)")
+	sendCmd.Flags().BoolVar(&sendNoTCP, "no-tcp", false, "Don't also listen on TCP (same port) for receivers whose network blocks UDP")
+	sendCmd.Flags().StringVar(&sendBind, "bind", "", "Listen on this IP only and advertise it (default: every interface)")
+	sendCmd.Flags().BoolVar(&sendLANOnly, "lan-only", false, "Local network only: no cloud registry, signaling or relay (mDNS and direct connections)")
+	sendCmd.Flags().StringSliceVar(&sendSTUN, "stun", nil, "STUN server to use instead of the default (repeatable, e.g. stun:stun.example.com:3478)")
+	sendCmd.Flags().StringVar(&sendRelayURL, "relay-url", "", "Custom TURN Relay URL (e.g. turn:host:port; alias --turn)")
+	sendCmd.Flags().StringVar(&sendRelayUser, "relay-user", "", "TURN Relay Username (alias --turn-user)")
+	sendCmd.Flags().StringVar(&sendRelayPass, "relay-pass", "", "TURN Relay Password (alias --turn-pass)")
+
+	sendCmd.Flags().SetNormalizeFunc(turnFlagAliases)
+	rootCmd.AddCommand(sendCmd)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/darkprince558/jend/internal/audit"
+	"github.com/darkprince558/jend/internal/core"
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify <id>",
+	Short: "Re-check a transferred file against its recorded hash",
+	Long:  "Look up a transfer in the history (by ID or ID prefix), rehash the file at its recorded path and report whether it still matches. Detects bit-rot or tampering after the fact.",
+	Example: `  jend verify partial-red-panda
+  jend verify partial`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		entry, err := audit.GetEntry(args[0])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if entry.FileHash == "" || entry.FilePath == "" {
+			fmt.Println("Error: this transfer has no recorded file to verify (failed, text, stdin, directory or --since-offset transfers, or logged by an older version)")
+			os.Exit(1)
+		}
+
+		fmt.Printf("Verifying %s...\n", entry.FilePath)
+		hash, err := core.HashFile(entry.FilePath)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if hash != entry.FileHash {
+			fmt.Println("MISMATCH: the file has changed since the transfer.")
+			fmt.Printf("  Recorded: %s\n  Current:  %s\n", entry.FileHash, hash)
+			os.Exit(1)
+		}
+		fmt.Println("OK: the file matches the transferred hash.")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -44,7 +45,8 @@ type RegistryItem struct {
 	Port      int      `json:"port" dynamodbav:"port"`
 	Endpoints []string `json:"endpoints,omitempty" dynamodbav:"endpoints,omitempty"` // For candidates
 	PublicKey string   `json:"public_key,omitempty" dynamodbav:"public_key,omitempty"`
-	ExpiresAt int64    `json:"expires_at" dynamodbav:"expires_at"` // TTL
+	Nonce     string   `json:"nonce,omitempty" dynamodbav:"nonce,omitempty"` // Sender session nonce, never returned by lookup
+	ExpiresAt int64    `json:"expires_at" dynamodbav:"expires_at"`           // TTL
 }
 
 // Handler handles the API Gateway requests
@@ -87,8 +89,13 @@ func handleRegister(ctx context.Context, body string, sourceIP string) (events.A
 		item.IP = sourceIP
 	}
 
+	if item.Nonce == "" {
+		return errorResponse(400, "Nonce is required"), nil
+	}
+
 	// Set TTL to 10 minutes from now (configurable)
-	item.ExpiresAt = time.Now().Add(10 * time.Minute).Unix()
+	now := time.Now()
+	item.ExpiresAt = now.Add(10 * time.Minute).Unix()
 
 	av, err := attributevalue.MarshalMap(item)
 	if err != nil {
@@ -96,11 +103,28 @@ func handleRegister(ctx context.Context, body string, sourceIP string) (events.A
 		return errorResponse(500, "Internal Server Error"), nil
 	}
 
+	// Only take the code if it's free, stale (DynamoDB TTL deletion lags), or already ours.
+	// A retry of a request that timed out but succeeded carries the same nonce and
+	// just refreshes the entry; a different sender with the same code gets a 409.
 	_, err = svc.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName: aws.String(tableName),
-		Item:      av,
+		TableName:           aws.String(tableName),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(#code) OR #expires < :now OR #nonce = :nonce"),
+		ExpressionAttributeNames: map[string]string{
+			"#code":    "code",
+			"#expires": "expires_at",
+			"#nonce":   "nonce",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now":   &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", now.Unix())},
+			":nonce": &types.AttributeValueMemberS{Value: item.Nonce},
+		},
 	})
 
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		return errorResponse(409, "Code already registered by another sender"), nil
+	}
 	if err != nil {
 		log.Printf("Failed to put item into DynamoDB: %v", err)
 		return errorResponse(500, "Failed to save record"), nil
@@ -135,6 +159,7 @@ func handleLookup(ctx context.Context, code string) (events.APIGatewayV2HTTPResp
 		return errorResponse(500, "Internal Server Error"), nil
 	}
 
+	item.Nonce = "" // Knowing the nonce would let anyone overwrite the registration
 	responseBody, _ := json.Marshal(item)
 	return events.APIGatewayV2HTTPResponse{
 		StatusCode: 200,
@@ -20,6 +20,8 @@ type TurnCredentials struct {
 	Password string   `json:"password"`
 	TTL      int      `json:"ttl"`
 	URIs     []string `json:"uris"`
+	// SHA-256 of the relay's self-signed TLS cert; clients pin turns: to it
+	Fingerprint string `json:"fingerprint,omitempty"`
 }
 
 func handleRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
@@ -61,6 +63,12 @@ func handleRequest(ctx context.Context, request events.APIGatewayV2HTTPRequest)
 			"turn:" + os.Getenv("TURN_URI") + "?transport=tcp",
 		},
 	}
+	// TLS-wrapped TURN for networks that DPI-block plain TURN (coturn tls-listening-port).
+	// Only offered with the cert fingerprint, as clients can't verify it otherwise.
+	if fp := os.Getenv("TURN_CERT_SHA256"); fp != "" {
+		creds.URIs = append(creds.URIs, "turns:"+os.Getenv("TURN_URI")+":5349?transport=tcp")
+		creds.Fingerprint = fp
+	}
 
 	body, _ := json.Marshal(creds)
 
@@ -5,10 +5,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -162,21 +166,34 @@ func TestLargeFileTransfer(t *testing.T) {
 		}
 	}()
 
-	// Scan for Code
-	var code string
-	scanner := bufio.NewScanner(senderReader)
-	for scanner.Scan() {
-		line := scanner.Text()
-		t.Logf("[Sender] %s", line)
-		if strings.Contains(line, "Code:") {
-			parts := strings.Split(line, ":")
-			if len(parts) > 1 {
-				code = strings.TrimSpace(parts[1])
-				break
+	// Scan for Code, then keep draining so the sender never blocks on stdout.
+	// Each parallel range is logged by the sender as its own worker.
+	codeCh := make(chan string, 1)
+	workerLines := make(chan struct{}, 64)
+	go func() {
+		scanner := bufio.NewScanner(senderReader)
+		for scanner.Scan() {
+			line := scanner.Text()
+			t.Logf("[Sender] %s", line)
+			if strings.HasPrefix(line, "Code:") {
+				select {
+				case codeCh <- strings.TrimSpace(strings.TrimPrefix(line, "Code:")):
+				default:
+				}
+			}
+			if strings.Contains(line, "Parallel worker sending bytes") {
+				select {
+				case workerLines <- struct{}{}:
+				default:
+				}
 			}
 		}
-	}
-	if code == "" {
+	}()
+
+	var code string
+	select {
+	case code = <-codeCh:
+	case <-time.After(5 * time.Second):
 		t.Fatal("Failed to get code from sender")
 	}
 
@@ -201,6 +218,11 @@ func TestLargeFileTransfer(t *testing.T) {
 		t.Fatalf("Size mismatch. Want %d, Got %d", size, info.Size())
 	}
 
+	// The receiver defaults to 4 streams above the 100MB threshold
+	if n := len(workerLines); n < 2 {
+		t.Errorf("Expected multiple parallel range streams, sender served %d", n)
+	}
+
 	// Kill Sender (it loops)
 	if senderCmd.Process != nil {
 		senderCmd.Process.Signal(os.Interrupt)
@@ -214,6 +236,7 @@ func TestAuditLog(t *testing.T) {
 	srcFile := "test_data/audit_payload.txt"
 	os.WriteFile(srcFile, []byte("Audit"), 0644)
 	outDir := "output/audit_test"
+	os.RemoveAll(outDir) // A leftover copy would make the receiver save "audit_payload (1).txt"
 
 	// Sender
 	senderCmd := exec.Command(binaryPath, "send", srcFile, "--headless")
@@ -253,6 +276,7 @@ func TestAuditLog(t *testing.T) {
 
 	// Look for our specific file in the logs (JSONL parsing)
 	found := false
+	var receiverEntry *audit.LogEntry
 	lines := bytes.Split(data, []byte("\n"))
 	for _, line := range lines {
 		if len(line) == 0 {
@@ -262,15 +286,23 @@ func TestAuditLog(t *testing.T) {
 		if err := json.Unmarshal(line, &entry); err != nil {
 			continue
 		}
+		if entry.Role == "receiver" && entry.Code == code {
+			receiverEntry = &entry
+		}
 		if entry.FileName == "audit_payload.txt" && entry.Status == "success" {
 			found = true
-			break
 		}
 	}
 
 	if !found {
 		t.Error("Audit log entry for 'audit_payload.txt' not found or not successful")
 	}
+	if receiverEntry == nil {
+		t.Fatalf("No receiver audit entry for code %s", code)
+	}
+	if receiverEntry.FileName != "audit_payload.txt" {
+		t.Errorf("Receiver entry should record the received file name, got %q", receiverEntry.FileName)
+	}
 }
 
 // TestResumeSupport verifies that the sender stays alive for multiple connections
@@ -322,31 +354,42 @@ func TestResumeSupport(t *testing.T) {
 	// Step 1: Start Receiver, let it run briefly then kill it to simulate failure
 	// We can't easily control exactly how many bytes...
 	// But we can start it asynchronously and kill it after 100ms.
-	receiverCmd1 := exec.Command(binaryPath, "receive", code, "--dir", outDir, "--headless")
-	receiverCmd1.Stdout = os.Stdout
+	receiverCmd1 := exec.Command(binaryPath, "receive", code, "--dir", outDir, "--headless", "--progress-interval", "100ms")
+	receiverOut1, err := receiverCmd1.StdoutPipe()
+	if err != nil {
+		t.Fatalf("Failed to get receiver stdout: %v", err)
+	}
 	receiverCmd1.Stderr = os.Stderr
 	if err := receiverCmd1.Start(); err != nil {
 		t.Fatalf("Receiver 1 failed to start: %v", err)
 	}
 
-	// Let transfer start - Wait for partial file to ensure we are in data phase
-	partialPath := filepath.Join(outDir, "large_payload.bin.partial")
-	deadline := time.Now().Add(15 * time.Second)
-	found := false
-	for time.Now().Before(deadline) {
-		if _, err := os.Stat(partialPath); err == nil {
-			found = true
-			break
+	// Let transfer start - the first progress line means data is being written
+	progressing := make(chan bool, 1)
+	go func() {
+		scanner := bufio.NewScanner(receiverOut1)
+		for scanner.Scan() {
+			line := scanner.Text()
+			fmt.Println(line)
+			if strings.HasPrefix(line, "Progress: ") {
+				progressing <- true
+				break
+			}
 		}
-		time.Sleep(50 * time.Millisecond)
-	}
-	if !found {
-		t.Log("Partial file not created in time, checking if transfer completed already?")
-		// Might have completed? Check final file
-		if _, err := os.Stat(filepath.Join(outDir, "large_payload.bin")); err == nil {
-			t.Fatal("Transfer completed too fast! Increase file size or kill sooner.")
+		close(progressing)
+		io.Copy(os.Stdout, receiverOut1)
+	}()
+	partialPath := filepath.Join(outDir, "large_payload.bin.partial")
+	select {
+	case ok := <-progressing:
+		if !ok {
+			if _, err := os.Stat(filepath.Join(outDir, "large_payload.bin")); err == nil {
+				t.Fatal("Transfer completed too fast! Increase file size or kill sooner.")
+			}
+			t.Fatal("Receiver 1 exited before reporting progress")
 		}
-		t.Fatal("Partial file not created in time")
+	case <-time.After(15 * time.Second):
+		t.Fatal("No progress reported in time")
 	}
 	time.Sleep(200 * time.Millisecond) // Allow some data to be written
 	receiverCmd1.Process.Kill()
@@ -902,3 +945,164 @@ func TestNoHistory(t *testing.T) {
 		t.Errorf("History changed! Initial lines: %d, Final lines: %d. Diff: \n%s", initialLines, finalLines, histOut2.String())
 	}
 }
+
+// TestLANOnly checks that --lan-only transfers without contacting the registry,
+// the TURN credential API or the signaling network.
+func TestLANOnly(t *testing.T) {
+	var hits atomic.Int32
+	cloud := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		t.Errorf("Unexpected cloud request in LAN-only mode: %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer cloud.Close()
+	env := append(os.Environ(),
+		"JEND_REGISTRY_URL="+cloud.URL,
+		"JEND_TURN_AUTH_URL="+cloud.URL+"/turn-auth",
+		"JEND_IOT_ENDPOINT="+strings.TrimPrefix(cloud.URL, "http://"),
+	)
+
+	srcFile := "test_data/lan_payload.txt"
+	content := []byte("Stays on the LAN")
+	os.WriteFile(srcFile, content, 0644)
+	outDir := "output/lan_test"
+	os.RemoveAll(outDir)
+
+	senderCmd := exec.Command(binaryPath, "send", srcFile, "--headless", "--lan-only", "--no-history")
+	senderCmd.Env = env
+	senderOut, _ := senderCmd.StdoutPipe()
+	if err := senderCmd.Start(); err != nil {
+		t.Fatalf("Failed to start sender: %v", err)
+	}
+	defer senderCmd.Process.Kill()
+
+	var senderLog bytes.Buffer
+	codeCh := make(chan string, 1)
+	senderDone := make(chan struct{})
+	go func() {
+		defer close(senderDone)
+		scanner := bufio.NewScanner(senderOut)
+		for scanner.Scan() {
+			line := scanner.Text()
+			senderLog.WriteString(line + "\n")
+			if strings.HasPrefix(line, "Code: ") {
+				codeCh <- strings.TrimPrefix(line, "Code: ")
+			}
+		}
+	}()
+
+	var code string
+	select {
+	case code = <-codeCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for code generation")
+	}
+
+	receiverCmd := exec.Command(binaryPath, "receive", code, "--dir", outDir, "--headless", "--lan-only", "--no-history")
+	receiverCmd.Env = env
+	receiverLog, err := receiverCmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Receiver failed: %v\n%s", err, receiverLog)
+	}
+
+	senderCmd.Process.Signal(os.Interrupt)
+	senderCmd.Wait()
+	<-senderDone
+
+	got, err := os.ReadFile(filepath.Join(outDir, "lan_payload.txt"))
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("Content mismatch: %q (%v)", got, err)
+	}
+	if n := hits.Load(); n != 0 {
+		t.Errorf("Expected no cloud requests, got %d", n)
+	}
+	for _, log := range []string{senderLog.String(), string(receiverLog)} {
+		if strings.Contains(log, "Signaling") || strings.Contains(log, "via cloud") {
+			t.Errorf("LAN-only run touched the cloud path:\n%s", log)
+		}
+	}
+}
+
+// TestJSONEvents runs a transfer with --json-events on both ends: every line
+// of stdout is a JSON event, and the code comes as one rather than a "Code: " line.
+func TestJSONEvents(t *testing.T) {
+	srcFile := "test_data/json_payload.txt"
+	content := []byte("Events, not strings")
+	os.WriteFile(srcFile, content, 0644)
+	outDir := "output/json_test"
+	os.RemoveAll(outDir)
+
+	type event struct {
+		Event     string `json:"event"`
+		Code      string `json:"code"`
+		Message   string `json:"message"`
+		Integrity bool   `json:"integrity"`
+	}
+	parse := func(who, line string) event {
+		var e event
+		if err := json.Unmarshal([]byte(line), &e); err != nil || e.Event == "" {
+			t.Errorf("%s printed a line that is not an event: %q", who, line)
+		}
+		return e
+	}
+
+	senderCmd := exec.Command(binaryPath, "send", srcFile, "--json-events", "--lan-only", "--no-history", "--no-clipboard")
+	senderOut, _ := senderCmd.StdoutPipe()
+	if err := senderCmd.Start(); err != nil {
+		t.Fatalf("Failed to start sender: %v", err)
+	}
+	defer senderCmd.Process.Kill()
+
+	var senderEvents []event
+	codeCh := make(chan string, 1)
+	senderDone := make(chan struct{})
+	go func() {
+		defer close(senderDone)
+		scanner := bufio.NewScanner(senderOut)
+		for scanner.Scan() {
+			e := parse("Sender", scanner.Text())
+			senderEvents = append(senderEvents, e)
+			if e.Event == "code" {
+				codeCh <- e.Code
+			}
+		}
+	}()
+
+	var code string
+	select {
+	case code = <-codeCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for the code event")
+	}
+
+	receiverCmd := exec.Command(binaryPath, "receive", code, "--dir", outDir, "--json-events", "--lan-only", "--no-history", "--no-clipboard")
+	receiverCmd.Stderr = os.Stderr
+	receiverLog, err := receiverCmd.Output()
+	if err != nil {
+		t.Fatalf("Receiver failed: %v\n%s", err, receiverLog)
+	}
+
+	senderCmd.Process.Signal(os.Interrupt)
+	senderCmd.Wait()
+	<-senderDone
+
+	got, err := os.ReadFile(filepath.Join(outDir, "json_payload.txt"))
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("Content mismatch: %q (%v)", got, err)
+	}
+
+	seen := map[string]event{}
+	for _, line := range strings.Split(strings.TrimSpace(string(receiverLog)), "\n") {
+		e := parse("Receiver", line)
+		seen[e.Event] = e
+	}
+	if _, ok := seen["done"]; !ok {
+		t.Errorf("Receiver sent no done event:\n%s", receiverLog)
+	}
+	if !seen["summary"].Integrity {
+		t.Errorf("Receiver summary missing or unverified:\n%s", receiverLog)
+	}
+	if len(senderEvents) == 0 || senderEvents[0].Event != "code" {
+		t.Errorf("Sender's first event should be the code: %+v", senderEvents)
+	}
+}
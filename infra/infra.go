@@ -223,6 +223,14 @@ func NewInfraStack(scope constructs.Construct, id string, props *InfraStackProps
 		// Anti-Abuse Limits
 		jsii.String("echo 'max-bps=1000000' >> /etc/coturn/turnserver.conf"), // 1MB/s limit
 		jsii.String("echo 'user-quota=100' >> /etc/coturn/turnserver.conf"),  // Max allocations per user
+		// TLS listener (turns:) needs a cert. The relay is addressed by IP, so clients pin
+		// this self-signed cert by the fingerprint turn-auth returns (-c turnCertSha256=...).
+		// It is published to SSM for the operator to pass on.
+		jsii.String("openssl req -x509 -newkey rsa:2048 -nodes -days 3650 -subj '/CN=jend-turn' -keyout /etc/coturn/turn_key.pem -out /etc/coturn/turn_cert.pem"),
+		jsii.String("aws ssm put-parameter --name /jend/turn-cert-sha256 --type String --overwrite --value $(openssl x509 -in /etc/coturn/turn_cert.pem -noout -fingerprint -sha256 | cut -d= -f2)"),
+		jsii.String("chown turnserver:turnserver /etc/coturn/turn_key.pem /etc/coturn/turn_cert.pem"),
+		jsii.String("echo 'cert=/etc/coturn/turn_cert.pem' >> /etc/coturn/turnserver.conf"),
+		jsii.String("echo 'pkey=/etc/coturn/turn_key.pem' >> /etc/coturn/turnserver.conf"),
 		jsii.String("# Force Update 3"),
 		jsii.String("systemctl enable coturn"),
 		jsii.String("systemctl restart coturn"),
@@ -241,6 +249,11 @@ func NewInfraStack(scope constructs.Construct, id string, props *InfraStackProps
 	// Add SSM permissions and Secrets Manager Access
 	turnInstance.Role().AddManagedPolicy(awsiam.ManagedPolicy_FromAwsManagedPolicyName(jsii.String("AmazonSSMManagedInstanceCore")))
 	turnSecret.GrantRead(turnInstance.Role(), nil)
+	turnInstance.Role().AddToPrincipalPolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Effect:    awsiam.Effect_ALLOW,
+		Actions:   jsii.Strings("ssm:PutParameter"),
+		Resources: jsii.Strings("arn:aws:ssm:*:*:parameter/jend/turn-cert-sha256"),
+	}))
 
 	// 14b. Elastic IP - Stable IP for TURN
 	eip := awsec2.NewCfnEIP(stack, jsii.String("TurnEip"), &awsec2.CfnEIPProps{
@@ -260,6 +273,10 @@ func NewInfraStack(scope constructs.Construct, id string, props *InfraStackProps
 	// Pass the resolved secret value to Lambda via Environment Variable
 
 	turnAuthFunc.AddEnvironment(jsii.String("TURN_SECRET_KEY"), turnSecret.SecretValueFromJson(jsii.String("secret")).UnsafeUnwrap(), nil)
+	// turns: is only offered once the relay's cert fingerprint is known (see the user data)
+	if fp, ok := stack.Node().TryGetContext(jsii.String("turnCertSha256")).(string); ok && fp != "" {
+		turnAuthFunc.AddEnvironment(jsii.String("TURN_CERT_SHA256"), jsii.String(fp), nil)
+	}
 
 	// Expose Auth Lambda via API Gateway (Reuse existing HTTP API)
 	authIntegration := awsapigatewayv2integrations.NewHttpLambdaIntegration(
@@ -24,6 +24,7 @@ type LogEntry struct {
 	FileName  string    `json:"file_name"`
 	FileSize  int64     `json:"file_size"`
 	FileHash  string    `json:"file_hash"`
+	FilePath  string    `json:"file_path,omitempty"` // Absolute path of the hashed file on this machine, for jend verify
 	Code      string    `json:"code"`
 	Status    string    `json:"status"` // "success" or "failed"
 	Error     string    `json:"error,omitempty"`
@@ -293,17 +294,37 @@ var (
 	statusFailStr    = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).Render("FAILED")
 )
 
-func ShowHistory() {
+// ShowHistory prints the history entries that match filter, as a table or as JSON.
+func ShowHistory(filter Filter, asJSON bool) {
 	entries, err := LoadHistory()
 	if err != nil {
 		fmt.Printf("Error loading history: %v\n", err)
 		return
 	}
+	total := len(entries)
+	entries = filter.Apply(entries)
 
-	if len(entries) == 0 {
+	if asJSON {
+		if entries == nil {
+			entries = []LogEntry{} // "[]", not "null", for scripts
+		}
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding history: %v\n", err)
+			return
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	if total == 0 {
 		fmt.Println("No transfer history found.")
 		return
 	}
+	if len(entries) == 0 {
+		fmt.Printf("No transfers match the filters (%d in history).\n", total)
+		return
+	}
 
 	// Define Columns
 	// DATE | ROLE | FILE | SIZE | TIME | STATUS | HASH
@@ -327,7 +348,7 @@ func ShowHistory() {
 		if len(file) > 23 {
 			file = file[:20] + "..."
 		}
-		size := formatBytes(e.FileSize)
+		size := FormatBytes(e.FileSize)
 		duration := fmt.Sprintf("%.1fs", e.Duration)
 		status := statusSuccessStr
 		if e.Status != "success" {
@@ -379,7 +400,10 @@ func ShowDetail(id string) {
 	printKV("Role", strings.ToUpper(entry.Role))
 	printKV("Status", entry.Status)
 	printKV("File", entry.FileName)
-	printKV("Size", formatBytes(entry.FileSize))
+	printKV("Size", FormatBytes(entry.FileSize))
+	if entry.FilePath != "" {
+		printKV("Path", entry.FilePath)
+	}
 	printKV("Code", entry.Code)
 	printKV("Duration", fmt.Sprintf("%.2fs", entry.Duration))
 	fmt.Println("")
@@ -395,7 +419,8 @@ func ShowDetail(id string) {
 	}
 }
 
-func formatBytes(b int64) string {
+// FormatBytes renders a byte count in binary units, e.g. "1.5 MB".
+func FormatBytes(b int64) string {
 	const unit = 1024
 	if b < unit {
 		return fmt.Sprintf("%d B", b)
@@ -0,0 +1,39 @@
+package audit
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// csvHeader lists the export columns. Sizes stay raw bytes and durations raw
+// seconds so spreadsheets can sum and sort them.
+var csvHeader = []string{"Timestamp", "Role", "FileName", "FileSize", "Status", "Duration", "Code", "FileHash", "Error"}
+
+// ExportCSV writes entries as CSV with a header row. An empty history still
+// produces the header, so the file opens cleanly.
+func ExportCSV(w io.Writer, entries []LogEntry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		record := []string{
+			e.Timestamp.Format(time.RFC3339),
+			e.Role,
+			e.FileName,
+			strconv.FormatInt(e.FileSize, 10),
+			e.Status,
+			strconv.FormatFloat(e.Duration, 'f', 2, 64),
+			e.Code,
+			e.FileHash,
+			e.Error,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+)
+
+func TestExportCSV(t *testing.T) {
+	entries := []LogEntry{
+		{
+			Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			Role:      "receiver",
+			FileName:  "report, final.pdf",
+			FileSize:  5 * 1024 * 1024,
+			Status:    "failed",
+			Duration:  1.5,
+			Code:      "happy-delta-seven",
+			FileHash:  "abc123",
+			Error:     "integrity check failed: expected \"abc\", got \"def\"",
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := ExportCSV(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Export is not valid CSV: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected header + 1 row, got %d rows", len(records))
+	}
+	want := []string{"2024-01-02T03:04:05Z", "receiver", "report, final.pdf", "5242880", "failed", "1.50",
+		"happy-delta-seven", "abc123", "integrity check failed: expected \"abc\", got \"def\""}
+	for i, v := range want {
+		if records[1][i] != v {
+			t.Errorf("Column %s: got %q, want %q", records[0][i], records[1][i], v)
+		}
+	}
+}
+
+func TestExportCSV_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := ExportCSV(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil || len(records) != 1 || records[0][0] != "Timestamp" {
+		t.Errorf("Expected a header-only CSV, got %v (err %v)", records, err)
+	}
+}
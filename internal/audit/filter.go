@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter narrows the loaded history for display. Zero fields match everything.
+type Filter struct {
+	Since  time.Time // Entries at or after this time
+	Until  time.Time // Entries before this time
+	Status string    // "success" or "failed"
+}
+
+// Apply returns the entries that match every set field, in their original order.
+func (f Filter) Apply(entries []LogEntry) []LogEntry {
+	var out []LogEntry
+	for _, e := range entries {
+		if !f.Since.IsZero() && e.Timestamp.Before(f.Since) {
+			continue
+		}
+		if !f.Until.IsZero() && !e.Timestamp.Before(f.Until) {
+			continue
+		}
+		if f.Status != "" && !strings.EqualFold(e.Status, f.Status) {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// ParseSince parses a --since bound: a local date ("2024-01-01", start of day)
+// or an age relative to now ("7d", "24h", "30m", "2w").
+func ParseSince(s string, now time.Time) (time.Time, error) {
+	return parseTimeBound(s, now, false)
+}
+
+// ParseUntil parses an --until bound like ParseSince, except that a date covers
+// the whole day: "--until 2024-02-01" includes transfers made on Feb 1.
+func ParseUntil(s string, now time.Time) (time.Time, error) {
+	return parseTimeBound(s, now, true)
+}
+
+func parseTimeBound(s string, now time.Time, endOfDay bool) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+
+	age, err := parseAge(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q (use YYYY-MM-DD or an age like 7d, 24h)", s)
+	}
+	return now.Add(-age), nil
+}
+
+// parseAge extends time.ParseDuration with day ("d") and week ("w") units.
+func parseAge(s string) (time.Duration, error) {
+	if len(s) > 1 {
+		unit := time.Duration(0)
+		switch s[len(s)-1] {
+		case 'd':
+			unit = 24 * time.Hour
+		case 'w':
+			unit = 7 * 24 * time.Hour
+		}
+		if unit != 0 {
+			n, err := strconv.Atoi(s[:len(s)-1])
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
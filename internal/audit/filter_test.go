@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeBounds(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		in    string
+		until bool
+		want  time.Time
+	}{
+		{"2024-01-01", false, time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)},
+		{"2024-02-01", true, time.Date(2024, 2, 2, 0, 0, 0, 0, time.Local)}, // Whole day included
+		{"7d", false, now.AddDate(0, 0, -7)},
+		{"2w", false, now.AddDate(0, 0, -14)},
+		{"24h", true, now.Add(-24 * time.Hour)},
+		{"90m", false, now.Add(-90 * time.Minute)},
+	}
+	for _, tt := range tests {
+		parse := ParseSince
+		if tt.until {
+			parse = ParseUntil
+		}
+		got, err := parse(tt.in, now)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.in, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%q (until=%v): got %v, want %v", tt.in, tt.until, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "yesterday", "2024-13-01", "-3d", "d", "1.5d"} {
+		if _, err := ParseSince(bad, now); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestFilterApply(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 12, 0, 0, 0, time.UTC) }
+	entries := []LogEntry{
+		{ID: "a", Timestamp: day(1), Status: "success"},
+		{ID: "b", Timestamp: day(5), Status: "failed"},
+		{ID: "c", Timestamp: day(10), Status: "success"},
+		{ID: "d", Timestamp: day(15), Status: "failed"},
+	}
+
+	ids := func(es []LogEntry) string {
+		s := ""
+		for _, e := range es {
+			s += e.ID
+		}
+		return s
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   string
+	}{
+		{"zero matches all", Filter{}, "abcd"},
+		{"since", Filter{Since: day(5)}, "bcd"},
+		{"until is exclusive", Filter{Until: day(10)}, "ab"},
+		{"range", Filter{Since: day(2), Until: day(12)}, "bc"},
+		{"status", Filter{Status: "failed"}, "bd"},
+		{"status is case-insensitive", Filter{Status: "SUCCESS"}, "ac"},
+		{"combined", Filter{Since: day(2), Status: "success"}, "c"},
+		{"no match", Filter{Since: day(20)}, ""},
+	}
+	for _, tt := range tests {
+		if got := ids(tt.filter.Apply(entries)); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
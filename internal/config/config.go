@@ -11,6 +11,30 @@ type Config struct {
 	RelayURL  string `json:"relay_url,omitempty"`
 	RelayUser string `json:"relay_user,omitempty"`
 	RelayPass string `json:"relay_pass,omitempty"`
+
+	// STUN servers replacing the default Google one (see `jend config set-stun`).
+	StunServers []string `json:"stun_servers,omitempty"`
+
+	// Argon2id cost picked by `jend config calibrate-pake` (Memory in KiB).
+	// Zero means "use the built-in defaults".
+	ArgonTime   uint32 `json:"argon_time,omitempty"`
+	ArgonMemory uint32 `json:"argon_memory,omitempty"`
+
+	// Signaling network of a self-hosted JEND stack (see `jend config set-signaling`).
+	// Empty means the public JEND infrastructure.
+	IoTEndpoint    string `json:"iot_endpoint,omitempty"`
+	AWSRegion      string `json:"aws_region,omitempty"`
+	IdentityPoolID string `json:"identity_pool_id,omitempty"`
+
+	// HTTP APIs of a self-hosted stack: the discovery registry and TURN credentials.
+	RegistryURL string `json:"registry_url,omitempty"`
+	TurnAuthURL string `json:"turn_auth_url,omitempty"`
+
+	// Plain MQTT broker used for signaling instead of AWS IoT, e.g. tcp://host:1883.
+	MQTTBroker string `json:"mqtt_broker,omitempty"`
+
+	// Defaults for send and receive flags (see `jend config set`).
+	Defaults Defaults `json:"defaults,omitzero"`
 }
 
 func GetConfigPath() (string, error) {
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// Defaults replace built-in flag defaults for send and receive. A flag given
+// on the command line still wins: command line > config file > built-in.
+// Zero values are unset.
+type Defaults struct {
+	Dir           string `json:"dir,omitempty"`            // receive --dir
+	NoClipboard   bool   `json:"no_clipboard,omitempty"`   // send and receive --no-clipboard
+	NoHistory     bool   `json:"no_history,omitempty"`     // send and receive --no-history
+	CompressLevel *int   `json:"compress_level,omitempty"` // send --compress-level; 0 is a level
+	SendRate      string `json:"send_rate,omitempty"`      // send --rate
+	ReceiveRate   string `json:"receive_rate,omitempty"`   // receive --rate
+}
+
+// DefaultKey is a setting of `jend config get/set`.
+type DefaultKey struct {
+	Name     string
+	Flag     string   // The flag it sets a default for
+	Commands []string // The commands that have that flag
+	Help     string
+}
+
+// DefaultKeys lists every key Get and Set accept.
+var DefaultKeys = []DefaultKey{
+	{"dir", "dir", []string{"receive"}, "Directory received files are saved in"},
+	{"no-clipboard", "no-clipboard", []string{"send", "receive"}, "Never copy codes or received text to the clipboard (true/false)"},
+	{"no-history", "no-history", []string{"send", "receive"}, "Never write transfers to the history log (true/false)"},
+	{"compress-level", "compress-level", []string{"send"}, "gzip/zip level for directories, 0 to 9"},
+	{"send-rate", "rate", []string{"send"}, "Upload bandwidth cap, e.g. 5M"},
+	{"receive-rate", "rate", []string{"receive"}, "Download bandwidth cap, e.g. 5M"},
+}
+
+func lookupKey(name string) (DefaultKey, error) {
+	for _, k := range DefaultKeys {
+		if k.Name == name {
+			return k, nil
+		}
+	}
+	names := make([]string, len(DefaultKeys))
+	for i, k := range DefaultKeys {
+		names[i] = k.Name
+	}
+	return DefaultKey{}, fmt.Errorf("unknown setting %q (one of: %s)", name, strings.Join(names, ", "))
+}
+
+// Get returns key's saved value, "" if it is unset.
+func (d *Defaults) Get(key string) (string, error) {
+	if _, err := lookupKey(key); err != nil {
+		return "", err
+	}
+	switch key {
+	case "dir":
+		return d.Dir, nil
+	case "no-clipboard":
+		return formatBool(d.NoClipboard), nil
+	case "no-history":
+		return formatBool(d.NoHistory), nil
+	case "compress-level":
+		if d.CompressLevel == nil {
+			return "", nil
+		}
+		return strconv.Itoa(*d.CompressLevel), nil
+	case "send-rate":
+		return d.SendRate, nil
+	default: // receive-rate
+		return d.ReceiveRate, nil
+	}
+}
+
+// Set checks and saves value for key; "" unsets it. Sizes are checked where
+// they are used, like the flags they stand in for.
+func (d *Defaults) Set(key, value string) error {
+	if _, err := lookupKey(key); err != nil {
+		return err
+	}
+	switch key {
+	case "dir":
+		d.Dir = value
+	case "no-clipboard", "no-history":
+		b := false
+		if value != "" {
+			var err error
+			if b, err = strconv.ParseBool(value); err != nil {
+				return fmt.Errorf("%s takes true or false, not %q", key, value)
+			}
+		}
+		if key == "no-clipboard" {
+			d.NoClipboard = b
+		} else {
+			d.NoHistory = b
+		}
+	case "compress-level":
+		if value == "" {
+			d.CompressLevel = nil
+			return nil
+		}
+		level, err := strconv.Atoi(value)
+		if err != nil || level < 0 || level > 9 {
+			return fmt.Errorf("compress-level takes 0 to 9, not %q", value)
+		}
+		d.CompressLevel = &level
+	case "send-rate":
+		d.SendRate = value
+	default: // receive-rate
+		d.ReceiveRate = value
+	}
+	return nil
+}
+
+// Apply sets the defaults for command ("send" or "receive") on its parsed
+// flags, skipping every flag given on the command line. Flags it sets don't
+// count as Changed, so checks for flags the user passed still hold.
+func (d *Defaults) Apply(command string, flags *pflag.FlagSet) error {
+	for _, k := range DefaultKeys {
+		if !slices.Contains(k.Commands, command) {
+			continue
+		}
+		value, _ := d.Get(k.Name)
+		f := flags.Lookup(k.Flag)
+		if value == "" || f == nil || f.Changed {
+			continue
+		}
+		if err := f.Value.Set(value); err != nil {
+			return fmt.Errorf("config %s: %v", k.Name, err)
+		}
+	}
+	return nil
+}
+
+// formatBool leaves false blank: it is the built-in default, so unset.
+func formatBool(b bool) string {
+	if b {
+		return "true"
+	}
+	return ""
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestDefaultsGetSet(t *testing.T) {
+	var d Defaults
+	for key, value := range map[string]string{"dir": "/srv/in", "no-clipboard": "true", "compress-level": "0", "receive-rate": "5M"} {
+		if err := d.Set(key, value); err != nil {
+			t.Fatalf("Set(%s, %s): %v", key, value, err)
+		}
+		if got, _ := d.Get(key); got != value {
+			t.Errorf("Get(%s) = %q; want %q", key, got, value)
+		}
+	}
+	for key, value := range map[string]string{"no-history": "maybe", "compress-level": "10", "colour": "blue"} {
+		if err := d.Set(key, value); err == nil {
+			t.Errorf("Set(%s, %s) accepted", key, value)
+		}
+	}
+	// "" unsets, back to the built-in default
+	d.Set("compress-level", "")
+	if d.CompressLevel != nil {
+		t.Error("compress-level still set")
+	}
+}
+
+// TestDefaultsPrecedence: command line > config file > built-in default.
+func TestDefaultsPrecedence(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cfg, _ := Load()
+	cfg.Defaults.Set("dir", "/srv/in")
+	cfg.Defaults.Set("receive-rate", "5M")
+	cfg.Defaults.Set("send-rate", "9M")
+	if err := Save(cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags := pflag.NewFlagSet("receive", pflag.ContinueOnError)
+	dir := flags.String("dir", ".", "")
+	rate := flags.String("rate", "0", "")
+	noClipboard := flags.Bool("no-clipboard", false, "")
+	if err := flags.Parse([]string{"--rate", "1M"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Defaults.Apply("receive", flags); err != nil {
+		t.Fatal(err)
+	}
+
+	if *dir != "/srv/in" {
+		t.Errorf("dir = %q; the config should beat the built-in default", *dir)
+	}
+	if *rate != "1M" {
+		t.Errorf("rate = %q; the command line should beat the config (and send-rate is send's)", *rate)
+	}
+	if *noClipboard {
+		t.Error("no-clipboard set without a config value")
+	}
+	if flags.Changed("dir") {
+		t.Error("A config default counts as given on the command line")
+	}
+}
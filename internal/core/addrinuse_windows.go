@@ -0,0 +1,12 @@
+package core
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// addrInUse reports whether a listen failed because the port is taken.
+func addrInUse(err error) bool {
+	return errors.Is(err, windows.WSAEADDRINUSE)
+}
@@ -0,0 +1,168 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archiveEntry is one directory, regular file or symlink going into an archive.
+type archiveEntry struct {
+	path string      // On disk
+	name string      // In the archive: slash-separated, starting with the root's base name
+	info os.FileInfo // Of the link itself, or of its target when following
+	link string      // Target of a symlink archived as a link; empty otherwise
+}
+
+// walkArchive calls fn for root and everything under it, directories before
+// their contents. root itself is always followed. Other symlinks are passed
+// as links, or with followSymlinks dereferenced (directories included, loops
+// are an error); a dangling one stays a link either way. Sockets, devices and
+// pipes are skipped, as is whatever exclude matches: an excluded directory
+// is not read at all.
+func walkArchive(root string, followSymlinks bool, exclude *excludeRules, fn func(archiveEntry) error) error {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return err
+	}
+	w := archiveWalk{follow: followSymlinks, exclude: exclude, active: make(map[string]bool), fn: fn}
+	return w.entry(abs, filepath.Base(abs), info)
+}
+
+// archiveWalk is the state of one walkArchive.
+type archiveWalk struct {
+	follow  bool
+	exclude *excludeRules
+	active  map[string]bool // Real paths of the directories being walked, to catch loops
+	fn      func(archiveEntry) error
+}
+
+func (w *archiveWalk) entry(path, name string, info os.FileInfo) error {
+	e := archiveEntry{path: path, name: name, info: info}
+	if _, rel, ok := strings.Cut(name, "/"); ok && w.exclude.match(rel, info.IsDir()) {
+		return nil
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		if w.follow {
+			if target, err := os.Stat(path); err == nil {
+				return w.entry(path, name, target)
+			}
+		}
+		link, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		e.link = link
+		return w.fn(e)
+	}
+	if !info.IsDir() {
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return w.fn(e)
+	}
+
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	if w.active[real] {
+		return fmt.Errorf("symlink loop at %s", path)
+	}
+	w.active[real] = true
+	defer delete(w.active, real)
+
+	if err := w.fn(e); err != nil {
+		return err
+	}
+	_, rel, _ := strings.Cut(name, "/")
+	n, err := w.exclude.enterDir(path, rel)
+	if err != nil {
+		return err
+	}
+	defer w.exclude.leaveDir(n)
+	children, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, c := range children {
+		childInfo, err := c.Info()
+		if err != nil {
+			return err
+		}
+		if err := w.entry(filepath.Join(path, c.Name()), name+"/"+c.Name(), childInfo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reproducibleModTime is every mtime in a reproducible archive: 1980-01-01,
+// the earliest a zip header can hold.
+var reproducibleModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// reproducibleMode is what a reproducible archive keeps of a mode: the type,
+// and 0755 or 0644 depending on whether it is a directory or executable.
+func reproducibleMode(mode os.FileMode) os.FileMode {
+	perm := os.FileMode(0644)
+	if mode.IsDir() || mode&0111 != 0 {
+		perm = 0755
+	}
+	if mode&os.ModeSymlink != 0 {
+		perm = 0777
+	}
+	return mode.Type() | perm
+}
+
+// archiveMark is where a regular file's data starts in a compressed archive.
+// Offsets are counted below the compressor, so they trail by what it still
+// buffers; good enough to say which file is going out.
+type archiveMark struct {
+	offset int64
+	name   string
+}
+
+// countingWriter counts the archive bytes written so far.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// fileIndexer is a source made of several files. fileAt names the one holding
+// stream offset pos, with its 1-based index and the file count, for progress.
+type fileIndexer interface {
+	fileAt(pos int64) (name string, index, count int)
+}
+
+// archiveFile is a temp archive being sent, with the marks recorded while it
+// was built.
+type archiveFile struct {
+	*os.File
+	marks []archiveMark
+}
+
+func (a *archiveFile) fileAt(pos int64) (string, int, int) {
+	if len(a.marks) == 0 {
+		return "", 0, 0
+	}
+	i := sort.Search(len(a.marks), func(i int) bool { return a.marks[i].offset > pos })
+	if i == 0 {
+		i = 1 // Still in the archive's leading directory headers
+	}
+	return a.marks[i-1].name, i, len(a.marks)
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// connectAttempt is one step of the receiver's fallback chain.
+type connectAttempt struct {
+	method string
+	detail string
+	err    error
+	count  int // Consecutive identical outcomes (dial retries) are folded together
+}
+
+// attemptLog records every connection method the receiver tried, in order, so a
+// transfer can end with "mdns: not found, cloud: found, QUIC: connected" instead
+// of just the last status line.
+type attemptLog struct {
+	mu       sync.Mutex
+	attempts []connectAttempt
+}
+
+// record adds an outcome. A nil err means the method succeeded; detail says what
+// it found or how it connected.
+func (l *attemptLog) record(method string, detail string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if n := len(l.attempts); n > 0 {
+		last := &l.attempts[n-1]
+		if last.method == method && last.detail == detail && sameError(last.err, err) {
+			last.count++
+			return
+		}
+	}
+	l.attempts = append(l.attempts, connectAttempt{method: method, detail: detail, err: err, count: 1})
+}
+
+func sameError(a, b error) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Error() == b.Error()
+}
+
+// String renders the chain, one numbered line per attempt.
+func (l *attemptLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.attempts) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("Connection attempts:\n")
+	for i, a := range l.attempts {
+		outcome := "ok"
+		if a.err != nil {
+			outcome = "failed"
+		}
+		if a.count > 1 {
+			outcome += fmt.Sprintf(" x%d", a.count)
+		}
+
+		fmt.Fprintf(&b, "  %d. %s: %s", i+1, a.method, outcome)
+		if a.detail != "" {
+			fmt.Fprintf(&b, ", %s", a.detail)
+		}
+		if a.err != nil {
+			fmt.Fprintf(&b, " (%v)", a.err)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
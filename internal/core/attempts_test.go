@@ -0,0 +1,29 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAttemptLog(t *testing.T) {
+	var log attemptLog
+	if log.String() != "" {
+		t.Fatalf("empty log should render nothing, got %q", log.String())
+	}
+
+	timeout := errors.New("timeout")
+	log.record("mdns", "", errors.New("sender not found"))
+	log.record("cloud", "found 203.0.113.7:9000", nil)
+	log.record("QUIC 203.0.113.7:9000", "", timeout)
+	log.record("QUIC 203.0.113.7:9000", "", errors.New("timeout"))
+	log.record("QUIC 203.0.113.7:9000", "", nil)
+
+	want := "Connection attempts:\n" +
+		"  1. mdns: failed (sender not found)\n" +
+		"  2. cloud: ok, found 203.0.113.7:9000\n" +
+		"  3. QUIC 203.0.113.7:9000: failed x2 (timeout)\n" +
+		"  4. QUIC 203.0.113.7:9000: ok\n"
+	if got := log.String(); got != want {
+		t.Errorf("unexpected summary:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/darkprince558/jend/pkg/protocol"
+	"github.com/quic-go/quic-go"
+)
+
+// receiverCancelReason is the TypeCancel reason a receiver sends when it is
+// stopped mid-transfer (Ctrl-C).
+const receiverCancelReason = "stopped by the user"
+
+// errReceiverCancelled marks a transfer the receiver called off after
+// accepting it: Ctrl-C, or it couldn't write what it was sent.
+var errReceiverCancelled = errors.New("receiver cancelled the transfer")
+
+// cancelOnDone sends TypeCancel on stream once ctx is cancelled, so the sender
+// stops pushing data instead of filling a dead connection. The sender then
+// closes the stream, which ends the receive loop; if it doesn't within
+// cancelGracePeriod (an older sender), conn is dropped instead.
+// Arm it only once the Ack is sent: nothing else may write to stream.
+func cancelOnDone(ctx context.Context, conn *quic.Conn, stream io.Writer) (stop func() bool) {
+	return context.AfterFunc(ctx, func() {
+		sendCancel(stream, receiverCancelReason)
+		if conn != nil {
+			time.AfterFunc(cancelGracePeriod, func() { conn.CloseWithError(0, "cancelled") })
+		}
+	})
+}
+
+// watchReceiverCancel reads the stream while the sender writes data to it.
+// Receivers send nothing after their Ack but TypeCancel; when one arrives the
+// returned context is cancelled with errReceiverCancelled and the reason.
+// The watcher ends with the stream, or when stop is called.
+func watchReceiverCancel(stream io.Reader) (stopped context.Context, stop func()) {
+	stopped, cancel := context.WithCancelCause(context.Background())
+	go func() {
+		for {
+			pType, length, err := readHeader(stream)
+			if err != nil || stopped.Err() != nil {
+				return
+			}
+			if pType != protocol.TypeCancel {
+				io.CopyN(io.Discard, stream, int64(length))
+				continue
+			}
+			reason := "no reason given"
+			if length > 0 && length <= maxCancelReason {
+				buf := make([]byte, length)
+				if _, err := io.ReadFull(stream, buf); err == nil {
+					reason = string(buf)
+				}
+			}
+			cancel(fmt.Errorf("%w: %s", errReceiverCancelled, reason))
+			return
+		}
+	}()
+	return stopped, func() { cancel(nil) }
+}
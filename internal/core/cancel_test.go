@@ -0,0 +1,43 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darkprince558/jend/pkg/protocol"
+)
+
+func TestReceiverCancel(t *testing.T) {
+	sender, receiver := net.Pipe()
+	defer sender.Close()
+	defer receiver.Close()
+
+	stopped, stop := watchReceiverCancel(sender)
+	defer stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancelOnDone(ctx, nil, receiver)()
+
+	// Anything else the receiver sends is skipped
+	go protocol.EncodeHeader(receiver, protocol.TypeKeepAlive, 0)
+	select {
+	case <-stopped.Done():
+		t.Fatal("Stopped before the receiver cancelled")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case <-stopped.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Sender never saw the receiver's cancel")
+	}
+	err := context.Cause(stopped)
+	if !errors.Is(err, errReceiverCancelled) || !strings.Contains(err.Error(), receiverCancelReason) {
+		t.Errorf("Cause = %v, want errReceiverCancelled with the reason", err)
+	}
+}
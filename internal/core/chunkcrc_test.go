@@ -0,0 +1,25 @@
+package core
+
+import "testing"
+
+func TestChunkCRC(t *testing.T) {
+	payload := []byte("some chunk of file data")
+	frame := appendChunkCRC(append([]byte(nil), payload...))
+	if len(frame) != len(payload)+chunkCRCSize {
+		t.Fatalf("Expected %d byte frame, got %d", len(payload)+chunkCRCSize, len(frame))
+	}
+
+	data, err := verifyChunkCRC(frame)
+	if err != nil || string(data) != string(payload) {
+		t.Fatalf("verifyChunkCRC = %q, %v", data, err)
+	}
+
+	frame[3] ^= 0x01 // Flip one bit in the data
+	if _, err := verifyChunkCRC(frame); err == nil {
+		t.Error("Expected mismatch after bit flip")
+	}
+
+	if _, err := verifyChunkCRC([]byte{1, 2}); err == nil {
+		t.Error("Expected error for a frame shorter than the checksum")
+	}
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Bounds for --chunk-size. Below 4KB the per-frame header and AEAD overhead
+// dominate; above 4MB a single lost packet stalls too much of the QUIC stream
+// window. Both stay well under MaxFrameSize.
+const (
+	MinChunkSize = 4 * 1024
+	MaxChunkSize = 4 * 1024 * 1024
+)
+
+// ParseChunkSize parses a size such as "65536", "256k" or "1M" (binary units)
+// and checks it against MinChunkSize and MaxChunkSize.
+func ParseChunkSize(s string) (int, error) {
+	size, err := ParseByteSize(s)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid chunk size %q (use e.g. 64k, 256k, 1M)", s)
+	}
+	if size < MinChunkSize || size > MaxChunkSize {
+		return 0, fmt.Errorf("chunk size %s out of range (4k to 4M)", s)
+	}
+	return int(size), nil
+}
+
+// ParseByteSize parses a non-negative size with an optional binary unit suffix:
+// "512", "64k", "100M", "2G" (a trailing "B" is allowed, case doesn't matter).
+func ParseByteSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(str, "B")
+
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(str, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(str, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(str, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		str = str[:len(str)-1]
+	}
+
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("invalid size %q (use e.g. 64k, 100M, 2G)", s)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,48 @@
+package core
+
+import "testing"
+
+func TestParseChunkSize(t *testing.T) {
+	valid := map[string]int{
+		"65536": 65536,
+		"64k":   64 * 1024,
+		"256K":  256 * 1024,
+		"1M":    1024 * 1024,
+		"4MB":   MaxChunkSize,
+		"4k":    MinChunkSize,
+	}
+	for in, want := range valid {
+		got, err := ParseChunkSize(in)
+		if err != nil || got != want {
+			t.Errorf("ParseChunkSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"", "abc", "-64k", "1k", "8M", "1G", "0"} {
+		if _, err := ParseChunkSize(in); err == nil {
+			t.Errorf("ParseChunkSize(%q) should fail", in)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	valid := map[string]int64{
+		"0":    0,
+		"512":  512,
+		"100M": 100 << 20,
+		"2g":   2 << 30,
+		"1KB":  1024,
+	}
+	for in, want := range valid {
+		got, err := ParseByteSize(in)
+		if err != nil || got != want {
+			t.Errorf("ParseByteSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"", "M", "-1", "1T", "99999999999G"} {
+		if _, err := ParseByteSize(in); err == nil {
+			t.Errorf("ParseByteSize(%q) should fail", in)
+		}
+	}
+}
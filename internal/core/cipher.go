@@ -0,0 +1,103 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/sys/cpu"
+)
+
+// Cipher is the AEAD a SecureStream encrypts with. Both ends state the one
+// they prefer during the PAKE (see negotiateCipher); the values are the bytes
+// sent there.
+type Cipher uint8
+
+const (
+	CipherAuto     Cipher = 0 // A preference only: AES-GCM with hardware AES, else ChaCha20
+	CipherAESGCM   Cipher = 1
+	CipherChaCha20 Cipher = 2 // ChaCha20-Poly1305
+)
+
+func (c Cipher) String() string {
+	switch c {
+	case CipherAuto:
+		return "auto"
+	case CipherAESGCM:
+		return "aes-gcm"
+	case CipherChaCha20:
+		return "chacha20-poly1305"
+	}
+	return fmt.Sprintf("cipher(%d)", uint8(c))
+}
+
+// ParseCipher reads a --cipher value: auto, aes-gcm or chacha20.
+func ParseCipher(s string) (Cipher, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "auto":
+		return CipherAuto, nil
+	case "aes", "aes-gcm":
+		return CipherAESGCM, nil
+	case "chacha20", "chacha20-poly1305":
+		return CipherChaCha20, nil
+	}
+	return CipherAuto, fmt.Errorf("unknown cipher %q (use auto, aes-gcm or chacha20)", s)
+}
+
+// hasAESHardware reports whether AES-GCM runs in hardware here, as crypto/tls
+// decides it. Without it AES is several times slower than ChaCha20.
+var hasAESHardware = cpu.X86.HasAES && cpu.X86.HasPCLMULQDQ ||
+	cpu.ARM64.HasAES && cpu.ARM64.HasPMULL ||
+	cpu.S390X.HasAES && cpu.S390X.HasAESGCM
+
+// validate checks c is a cipher preference ParseCipher could return.
+func (c Cipher) validate() error {
+	if c != CipherAuto && c != CipherAESGCM && c != CipherChaCha20 {
+		return fmt.Errorf("unknown cipher %d", c)
+	}
+	return nil
+}
+
+// preferredCipher resolves the preference c (--cipher) for this machine.
+func preferredCipher(c Cipher) Cipher {
+	if c != CipherAuto {
+		return c
+	}
+	if hasAESHardware {
+		return CipherAESGCM
+	}
+	return CipherChaCha20
+}
+
+// negotiateCipher picks the stream cipher from both ends' preferences: AES-GCM
+// only if both want it, since one end without hardware AES would be the
+// bottleneck. ChaCha20 is fast everywhere.
+func negotiateCipher(sender, receiver Cipher) (Cipher, error) {
+	for _, c := range []Cipher{sender, receiver} {
+		if c != CipherAESGCM && c != CipherChaCha20 {
+			return 0, fmt.Errorf("peer asked for unknown cipher %d", c)
+		}
+	}
+	if sender == CipherAESGCM && receiver == CipherAESGCM {
+		return CipherAESGCM, nil
+	}
+	return CipherChaCha20, nil
+}
+
+// newAEAD keys c with a 32-byte traffic key. Both take a 12-byte nonce and
+// add a 16-byte tag, so SecureStream frames look the same either way.
+func newAEAD(c Cipher, key []byte) (cipher.AEAD, error) {
+	switch c {
+	case CipherAESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case CipherChaCha20:
+		return chacha20poly1305.New(key)
+	}
+	return nil, fmt.Errorf("unknown cipher %d", c)
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestNegotiateCipher(t *testing.T) {
+	cases := []struct {
+		sender, receiver, want Cipher
+	}{
+		{CipherAESGCM, CipherAESGCM, CipherAESGCM},
+		{CipherAESGCM, CipherChaCha20, CipherChaCha20},
+		{CipherChaCha20, CipherAESGCM, CipherChaCha20},
+		{CipherChaCha20, CipherChaCha20, CipherChaCha20},
+	}
+	for _, c := range cases {
+		if got, err := negotiateCipher(c.sender, c.receiver); err != nil || got != c.want {
+			t.Errorf("negotiateCipher(%s, %s) = %s, %v; want %s", c.sender, c.receiver, got, err, c.want)
+		}
+	}
+	// auto is resolved before it's sent; on the wire it's as unknown as 9
+	for _, bad := range []Cipher{CipherAuto, 9} {
+		if _, err := negotiateCipher(CipherAESGCM, bad); err == nil {
+			t.Errorf("Accepted cipher %d from the peer", bad)
+		}
+	}
+}
+
+func TestParseCipher(t *testing.T) {
+	for in, want := range map[string]Cipher{"": CipherAuto, "auto": CipherAuto, "AES-GCM": CipherAESGCM, "chacha20": CipherChaCha20, "chacha20-poly1305": CipherChaCha20} {
+		if got, err := ParseCipher(in); err != nil || got != want {
+			t.Errorf("ParseCipher(%q) = %s, %v; want %s", in, got, err, want)
+		}
+	}
+	if _, err := ParseCipher("des"); err == nil {
+		t.Error("Expected an unknown cipher to be refused")
+	}
+}
+
+func TestPerformPAKE_ChaCha20Preference(t *testing.T) {
+	// runPAKEPair checks that both ends settled on the preferred cipher
+	sKey, rKey := runPAKEPair(t, "chacha-preference-code", PAKEOptions{Cipher: CipherChaCha20})
+	frames := sealFrames(t, sKey, 0, CipherChaCha20, "over chacha")
+	reader, _ := NewSecureStream(bytes.NewBuffer(frames[0]), rKey, 1, CipherChaCha20)
+	buf := make([]byte, 32)
+	if n, err := reader.Read(buf); err != nil || string(buf[:n]) != "over chacha" {
+		t.Fatalf("Read %q, %v", buf[:n], err)
+	}
+}
+
+// cipherTamperer rewrites the cipher the sender asks for in its nonce
+// message, like an on-path attacker steering both ends to a weaker choice.
+type cipherTamperer struct {
+	io.Writer
+	done bool
+}
+
+func (c *cipherTamperer) Write(b []byte) (int, error) {
+	if !c.done && len(b) == 32+1 { // Nonce and cipher preference
+		c.done = true
+		b = append([]byte(nil), b...)
+		b[32] = byte(CipherAESGCM)
+	}
+	return c.Writer.Write(b)
+}
+
+func TestPerformPAKE_CipherTamperDetected(t *testing.T) {
+	opts := PAKEOptions{Cipher: CipherChaCha20}
+	r, w := io.Pipe()
+	r2, w2 := io.Pipe()
+	senderRW := &readWriter{Reader: r2, Writer: &cipherTamperer{Writer: w}}
+	receiverRW := &readWriter{Reader: r, Writer: w2}
+
+	senderErr := make(chan error, 1)
+	go func() {
+		_, _, err := PerformPAKE(senderRW, "tamper-cipher-code", 0, opts)
+		w.Close()
+		r2.Close()
+		senderErr <- err
+	}()
+
+	_, _, recvErr := PerformPAKE(receiverRW, "tamper-cipher-code", 1, opts)
+	if err := <-senderErr; err == nil {
+		t.Error("Sender accepted a receiver that saw a tampered cipher preference")
+	}
+	if recvErr == nil {
+		t.Error("Receiver completed the handshake with a tampered cipher preference")
+	}
+}
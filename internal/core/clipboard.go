@@ -0,0 +1,26 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/atotto/clipboard"
+)
+
+// clipboardReadAll is swapped out in tests.
+var clipboardReadAll = clipboard.ReadAll
+
+// ReadClipboard returns the clipboard's text for send --clipboard. No
+// clipboard at all (a headless server, or Linux without xclip, xsel or
+// wl-clipboard) and an empty one are errors, rather than an empty snippet.
+func ReadClipboard() (string, error) {
+	text, err := clipboardReadAll()
+	if err != nil {
+		return "", fmt.Errorf("can't read the clipboard (%v); on a headless machine use --text, or pipe into jend send -", err)
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", errors.New("the clipboard is empty, or holds no text")
+	}
+	return text, nil
+}
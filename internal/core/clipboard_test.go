@@ -0,0 +1,26 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReadClipboard(t *testing.T) {
+	defer func(orig func() (string, error)) { clipboardReadAll = orig }(clipboardReadAll)
+
+	clipboardReadAll = func() (string, error) { return "https://example.com\n", nil }
+	if got, err := ReadClipboard(); err != nil || got != "https://example.com\n" {
+		t.Errorf("ReadClipboard = %q, %v", got, err)
+	}
+
+	clipboardReadAll = func() (string, error) { return " \n\t", nil }
+	if _, err := ReadClipboard(); err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Errorf("Empty clipboard: %v", err)
+	}
+
+	clipboardReadAll = func() (string, error) { return "", errors.New("no clipboard utilities available") }
+	if _, err := ReadClipboard(); err == nil || !strings.Contains(err.Error(), "--text") {
+		t.Errorf("No clipboard: %v, want a hint at --text", err)
+	}
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+	"unicode"
+
+	petname "github.com/dustinkirkland/golang-petname"
+)
+
+// Code length bounds for --words. Each word is one petname list: the last a
+// name, the one before an adjective, any others adverbs.
+const (
+	DefaultCodeWords = 3
+	MinCodeWords     = 2
+	MaxCodeWords     = 8
+)
+
+// codeNumbers is the range of the leading number, read aloud as one word.
+const codeNumbers = 100
+
+// Sizes of the golang-petname word lists.
+const (
+	petnameAdverbs    = 261
+	petnameAdjectives = 449
+	petnameNames      = 452
+)
+
+// minCustomCode is the shortest code --code accepts.
+const minCustomCode = 8
+
+// maxWrongCodes is how many receivers may fail the PAKE before the sender
+// retires its code. It bounds online guessing only: offline guesses against
+// the published discovery ID are slowed by its Argon2 (see
+// discovery.ComputeHash), not by this. The count is shared by every address,
+// so anyone who can reach the sender can also retire its code on purpose.
+const maxWrongCodes = 3
+
+// maxWrongCodeDelay caps the pause after a wrong code.
+const maxWrongCodeDelay = 30 * time.Second
+
+// wrongCodeDelay is how long the sender stops accepting after the nth wrong
+// code: 1s, 2s, 4s, ... Connections are served one at a time, so this bounds
+// how fast anyone can guess even below maxWrongCodes.
+func wrongCodeDelay(n int) time.Duration {
+	if n < 1 {
+		return 0
+	}
+	if n > 6 {
+		return maxWrongCodeDelay
+	}
+	return min(time.Second<<(n-1), maxWrongCodeDelay)
+}
+
+// wrongCodeReason is the QUIC close reason the sender gives such a receiver,
+// so it stops retrying instead of using up the other tries.
+const wrongCodeReason = "wrong code"
+
+// GenerateCode makes a code like "7-brave-llama": a number and words petname
+// words, easy to read aloud.
+func GenerateCode(words int) string {
+	n, err := rand.Int(rand.Reader, big.NewInt(codeNumbers))
+	if err != nil {
+		n = big.NewInt(0)
+	}
+	return fmt.Sprintf("%d-%s", n.Int64(), petname.Generate(words, "-"))
+}
+
+// CodeEntropy is how many bits of randomness GenerateCode(words) carries.
+func CodeEntropy(words int) float64 {
+	bits := math.Log2(codeNumbers) + math.Log2(petnameNames)
+	if words >= 2 {
+		bits += math.Log2(petnameAdjectives)
+	}
+	if words > 2 {
+		bits += float64(words-2) * math.Log2(petnameAdverbs)
+	}
+	return bits
+}
+
+// ValidateCode checks a code chosen with --code: long enough not to be
+// trivial, and free of characters that break links, topics and shells.
+func ValidateCode(code string) error {
+	if len(code) < minCustomCode {
+		return fmt.Errorf("code must be at least %d characters", minCustomCode)
+	}
+	if strings.HasPrefix(strings.ToLower(code), "jend:") {
+		return fmt.Errorf("give the code itself, not a jend:// link")
+	}
+	for _, r := range code {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || strings.ContainsRune("/?#+", r) {
+			return fmt.Errorf("code may not contain spaces or any of / ? # +")
+		}
+	}
+	return nil
+}
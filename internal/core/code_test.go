@@ -0,0 +1,55 @@
+package core
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGenerateCode(t *testing.T) {
+	for words := MinCodeWords; words <= MaxCodeWords; words++ {
+		code := GenerateCode(words)
+		re := regexp.MustCompile(`^\d{1,2}(-[a-z]+){` + strconv.Itoa(words) + `}$`)
+		if !re.MatchString(code) {
+			t.Errorf("GenerateCode(%d) = %q", words, code)
+		}
+		if err := ValidateCode(code); err != nil {
+			t.Errorf("Generated code %q fails ValidateCode: %v", code, err)
+		}
+	}
+
+	// The default is over 32 bits; each extra word adds an adverb's worth
+	if bits := CodeEntropy(DefaultCodeWords); bits < 32 {
+		t.Errorf("Default entropy %.1f bits, want >= 32", bits)
+	}
+	if d := CodeEntropy(4) - CodeEntropy(3); math.Abs(d-math.Log2(petnameAdverbs)) > 1e-9 {
+		t.Errorf("Extra word adds %.2f bits", d)
+	}
+}
+
+func TestValidateCode(t *testing.T) {
+	for _, code := range []string{"short", "has space-in-it", "jend://some-code", "a/b-c-d-e", "topic+wildcard", "tab\tinside-code"} {
+		if err := ValidateCode(code); err == nil {
+			t.Errorf("ValidateCode(%q) accepted", code)
+		}
+	}
+	for _, code := range []string{"correct-horse-battery", "42-our-secret"} {
+		if err := ValidateCode(code); err != nil {
+			t.Errorf("ValidateCode(%q): %v", code, err)
+		}
+	}
+}
+
+func TestWrongCodeDelay(t *testing.T) {
+	want := []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, maxWrongCodeDelay, maxWrongCodeDelay}
+	for n, w := range want {
+		if got := wrongCodeDelay(n); got != w {
+			t.Errorf("wrongCodeDelay(%d) = %s, want %s", n, got, w)
+		}
+	}
+	if got := wrongCodeDelay(100); got != maxWrongCodeDelay {
+		t.Errorf("wrongCodeDelay(100) = %s", got)
+	}
+}
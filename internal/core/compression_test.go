@@ -3,11 +3,15 @@ package core
 import (
 	"archive/tar"
 	"archive/zip"
+	"bytes"
 	"compress/gzip"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCompressPath(t *testing.T) {
@@ -106,3 +110,480 @@ func TestCompressPath(t *testing.T) {
 		t.Errorf("Zip missing files. Found1: %v, Found2: %v", foundFile1, foundFile2)
 	}
 }
+
+func TestCompressPathLevels(t *testing.T) {
+	testDir := t.TempDir()
+	// Compressible but not trivially so: level 1 and 9 should differ
+	var data []byte
+	for i := 0; i < 20000; i++ {
+		data = append(data, fmt.Sprintf("line %d: the quick brown fox %d\n", i, i%97)...)
+	}
+	if err := os.WriteFile(filepath.Join(testDir, "log.txt"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sizeAt := func(format string, level int) int64 {
+		t.Helper()
+		path, err := CompressPathWithOptions(testDir, format, CompressOptions{Level: level})
+		if err != nil {
+			t.Fatalf("CompressPathWithOptions(%s, %d) failed: %v", format, level, err)
+		}
+		defer os.Remove(path)
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+
+	for _, format := range []string{"tar.gz", "zip"} {
+		store, fast, best := sizeAt(format, 0), sizeAt(format, 1), sizeAt(format, 9)
+		if !(best < fast && fast < store) {
+			t.Errorf("%s: expected level 9 < level 1 < level 0, got %d, %d, %d", format, best, fast, store)
+		}
+		if store < int64(len(data)) {
+			t.Errorf("%s: level 0 should store, got %d bytes for %d input", format, store, len(data))
+		}
+	}
+
+	if _, err := CompressPathWithOptions(testDir, "zip", CompressOptions{Level: 10}); err == nil {
+		t.Error("Expected error for level 10")
+	}
+}
+
+// symlinkTree makes dir/tree with a file, a link to it, a dangling link and a
+// link that escapes the tree.
+func symlinkTree(t *testing.T, dir string) string {
+	t.Helper()
+	tree := filepath.Join(dir, "tree")
+	os.MkdirAll(tree, 0755)
+	os.WriteFile(filepath.Join(tree, "real.txt"), []byte("real"), 0644)
+	for link, target := range map[string]string{
+		"link.txt":     "real.txt",
+		"dangling.txt": "missing.txt",
+		"escape.txt":   "../../outside.txt",
+	} {
+		if err := os.Symlink(target, filepath.Join(tree, link)); err != nil {
+			t.Skipf("Symlinks unavailable: %v", err)
+		}
+	}
+	return tree
+}
+
+func TestCompressSymlinks(t *testing.T) {
+	for _, format := range []string{"tar.gz", "zip"} {
+		t.Run(format, func(t *testing.T) {
+			tree := symlinkTree(t, t.TempDir())
+			archive, err := CompressPathWithOptions(tree, format, DefaultCompressOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(archive)
+
+			out := t.TempDir()
+			extract := extractTarGz
+			if format == "zip" {
+				extract = extractZip
+			}
+			skipped, err := extract(archive, out)
+			if err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+			if skipped != 1 {
+				t.Errorf("Expected escape.txt to be the one skipped entry, got %d", skipped)
+			}
+
+			if link, err := os.Readlink(filepath.Join(out, "tree", "link.txt")); err != nil || link != "real.txt" {
+				t.Errorf("Expected link.txt -> real.txt, got %q (%v)", link, err)
+			}
+			if got, _ := os.ReadFile(filepath.Join(out, "tree", "link.txt")); string(got) != "real" {
+				t.Errorf("Expected link.txt to read through to real.txt, got %q", got)
+			}
+			if link, err := os.Readlink(filepath.Join(out, "tree", "dangling.txt")); err != nil || link != "missing.txt" {
+				t.Errorf("Expected the dangling link to be kept, got %q (%v)", link, err)
+			}
+			if _, err := os.Lstat(filepath.Join(out, "tree", "escape.txt")); err == nil {
+				t.Error("Expected the link pointing outside the output dir to be rejected")
+			}
+		})
+	}
+}
+
+func TestCompressFollowSymlinks(t *testing.T) {
+	tree := symlinkTree(t, t.TempDir())
+	os.Remove(filepath.Join(tree, "escape.txt"))
+	os.MkdirAll(filepath.Join(tree, "sub"), 0755)
+	os.WriteFile(filepath.Join(tree, "sub", "inner.txt"), []byte("inner"), 0644)
+	os.Symlink("sub", filepath.Join(tree, "sublink"))
+
+	archive, err := CompressPathWithOptions(tree, "tar.gz", CompressOptions{Level: DefaultCompressOptions.Level, FollowSymlinks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(archive)
+	out := t.TempDir()
+	if _, err := extractTarGz(archive, out); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Lstat(filepath.Join(out, "tree", "link.txt"))
+	if err != nil || !info.Mode().IsRegular() {
+		t.Errorf("Expected link.txt to be archived as a regular file, got %v (%v)", info, err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(out, "tree", "sublink", "inner.txt")); string(got) != "inner" {
+		t.Errorf("Expected the linked directory to be archived, got %q", got)
+	}
+	// Nothing to follow: still a link
+	if _, err := os.Readlink(filepath.Join(out, "tree", "dangling.txt")); err != nil {
+		t.Errorf("Expected the dangling link to stay a link: %v", err)
+	}
+
+	// A link back up the tree would never end
+	os.Symlink("..", filepath.Join(tree, "sub", "loop"))
+	if _, err := CompressPathWithOptions(tree, "zip", CompressOptions{Level: DefaultCompressOptions.Level, FollowSymlinks: true}); err == nil {
+		t.Error("Expected a symlink loop to be an error")
+	}
+}
+
+func TestCompressEmptyDirs(t *testing.T) {
+	for _, format := range []string{"tar.gz", "zip"} {
+		t.Run(format, func(t *testing.T) {
+			tree := filepath.Join(t.TempDir(), "tree")
+			os.MkdirAll(filepath.Join(tree, "empty"), 0755)
+			os.MkdirAll(filepath.Join(tree, "nested", "deeper", "empty"), 0755)
+			os.WriteFile(filepath.Join(tree, "file.txt"), []byte("x"), 0644)
+
+			archive, err := CompressPath(tree, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(archive)
+
+			out := t.TempDir()
+			extract := extractTarGz
+			if format == "zip" {
+				extract = extractZip
+			}
+			if _, err := extract(archive, out); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+			for _, dir := range []string{"tree/empty", "tree/nested/deeper/empty"} {
+				info, err := os.Stat(filepath.Join(out, dir))
+				if err != nil || !info.IsDir() {
+					t.Errorf("Expected empty directory %s after extraction: %v", dir, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCompressExclude(t *testing.T) {
+	for _, format := range []string{"tar.gz", "zip"} {
+		t.Run(format, func(t *testing.T) {
+			tree := filepath.Join(t.TempDir(), "tree")
+			for _, dir := range []string{"node_modules/pkg", "src/node_modules", "build/cache", "logs"} {
+				os.MkdirAll(filepath.Join(tree, dir), 0755)
+			}
+			for _, file := range []string{
+				"main.go", "debug.log", "src/app.go", "src/trace.log", "src/node_modules/x.js",
+				"node_modules/pkg/index.js", "build/out.o", "build/keep.txt", "build/cache/blob", "logs/today",
+			} {
+				os.WriteFile(filepath.Join(tree, file), []byte(file), 0644)
+			}
+			// A file named like a directory-only pattern stays
+			os.WriteFile(filepath.Join(tree, "src", "logs"), []byte("file"), 0644)
+			os.WriteFile(filepath.Join(tree, ignoreFileName), []byte("# build output\n\nbuild/*.o\n/build/cache/\n"), 0644)
+
+			opts := CompressOptions{Level: DefaultCompressOptions.Level, Exclude: []string{"node_modules", "*.log", "logs/"}}
+			archive, err := CompressPathWithOptions(tree, format, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(archive)
+
+			out := t.TempDir()
+			extract := extractTarGz
+			if format == "zip" {
+				extract = extractZip
+			}
+			if _, err := extract(archive, out); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+			for _, kept := range []string{"main.go", "src/app.go", "src/logs", "build/keep.txt", ignoreFileName} {
+				if _, err := os.Stat(filepath.Join(out, "tree", kept)); err != nil {
+					t.Errorf("Expected %s in the archive: %v", kept, err)
+				}
+			}
+			for _, gone := range []string{"node_modules", "src/node_modules", "debug.log", "src/trace.log", "build/out.o", "build/cache", "logs"} {
+				if _, err := os.Lstat(filepath.Join(out, "tree", gone)); err == nil {
+					t.Errorf("Expected %s to be excluded", gone)
+				}
+			}
+		})
+	}
+}
+
+func TestCompressExcludePrunes(t *testing.T) {
+	tree := filepath.Join(t.TempDir(), "tree")
+	os.MkdirAll(filepath.Join(tree, "vendor", "deep"), 0755)
+	os.WriteFile(filepath.Join(tree, "file.txt"), []byte("x"), 0644)
+	// Walking into vendor with symlinks followed would hit the loop
+	os.Symlink("..", filepath.Join(tree, "vendor", "deep", "loop"))
+
+	opts := CompressOptions{Level: DefaultCompressOptions.Level, FollowSymlinks: true}
+	if _, err := CompressPathWithOptions(tree, "tar.gz", opts); err == nil {
+		t.Fatal("Expected the loop to be an error without --exclude")
+	}
+	opts.Exclude = []string{"vendor/"}
+	archive, err := CompressPathWithOptions(tree, "tar.gz", opts)
+	if err != nil {
+		t.Fatalf("Expected the excluded directory not to be walked: %v", err)
+	}
+	os.Remove(archive)
+}
+
+func TestCompressGitignore(t *testing.T) {
+	tree := filepath.Join(t.TempDir(), "tree")
+	for _, dir := range []string{"build", "src/gen", "docs/out", ".git", "src/lib"} {
+		os.MkdirAll(filepath.Join(tree, dir), 0755)
+	}
+	files := map[string]string{
+		".gitignore":       "*.log\n!keep.log\n/build/\n.env\ndocs/**/*.html\n",
+		".env":             "SECRET=1",
+		"main.go":          "package main",
+		"debug.log":        "x",
+		"keep.log":         "kept by a negation",
+		"build/out":        "x",
+		"src/.gitignore":   "gen/\n!debug.log\n/local.txt\n",
+		"src/app.go":       "package src",
+		"src/debug.log":    "re-included below src",
+		"src/local.txt":    "x",
+		"src/gen/code.go":  "x",
+		"docs/index.md":    "docs",
+		"docs/out/a.html":  "x",
+		"docs/local.txt":   "anchored to src only",
+		"src/build/nested": "not the root build",
+		".git/config":      "[remote] url = https://token@example.com",
+		"src/lib/.git":     "gitdir: ../../.git/modules/lib", // A submodule
+	}
+	os.MkdirAll(filepath.Join(tree, "src", "build"), 0755)
+	for name, data := range files {
+		os.WriteFile(filepath.Join(tree, name), []byte(data), 0644)
+	}
+
+	extracted := func(opts CompressOptions) string {
+		t.Helper()
+		archive, err := CompressPathWithOptions(tree, "tar.gz", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(archive)
+		out := t.TempDir()
+		if _, err := extractTarGz(archive, out); err != nil {
+			t.Fatal(err)
+		}
+		return filepath.Join(out, "tree")
+	}
+
+	// Off by default
+	out := extracted(CompressOptions{Level: DefaultCompressOptions.Level})
+	if _, err := os.Stat(filepath.Join(out, ".env")); err != nil {
+		t.Errorf("Expected .gitignore to be ignored without RespectGitignore: %v", err)
+	}
+
+	out = extracted(CompressOptions{Level: DefaultCompressOptions.Level, RespectGitignore: true, Exclude: []string{"*.md"}})
+	for _, kept := range []string{".gitignore", "main.go", "keep.log", "src/.gitignore", "src/app.go", "src/debug.log", "docs/local.txt", "src/build/nested"} {
+		if _, err := os.Stat(filepath.Join(out, kept)); err != nil {
+			t.Errorf("Expected %s in the archive: %v", kept, err)
+		}
+	}
+	for _, gone := range []string{".env", "debug.log", "build", "src/local.txt", "src/gen", "docs/out/a.html", "docs/index.md", ".git", "src/lib/.git"} {
+		if _, err := os.Lstat(filepath.Join(out, gone)); err == nil {
+			t.Errorf("Expected %s to be ignored", gone)
+		}
+	}
+}
+
+func TestMatchSegments(t *testing.T) {
+	for _, c := range []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"a/*.go", "a/b.go", true},
+		{"a/*.go", "a/b/c.go", false},
+		{"**/c.go", "c.go", true},
+		{"**/c.go", "a/b/c.go", true},
+		{"a/**/c.go", "a/c.go", true},
+		{"a/**/c.go", "a/x/y/c.go", true},
+		{"a/**", "a/x/y", true},
+		{"a/**", "a", false},
+		{"a/**/c.go", "b/c.go", false},
+	} {
+		if got := matchSegments(strings.Split(c.pattern, "/"), strings.Split(c.name, "/")); got != c.want {
+			t.Errorf("matchSegments(%q, %q) = %v, want %v", c.pattern, c.name, got, c.want)
+		}
+	}
+}
+
+func TestCompressExcludeInvalid(t *testing.T) {
+	for _, p := range []string{"[", "/", "  "} {
+		if err := ValidateExcludes([]string{p}); err == nil {
+			t.Errorf("Accepted pattern %q", p)
+		}
+	}
+	tree := t.TempDir()
+	os.WriteFile(filepath.Join(tree, ignoreFileName), []byte("ok\n[bad\n"), 0644)
+	if _, err := CompressPath(tree, "tar.gz"); err == nil {
+		t.Error("Expected a bad .jendignore line to be an error")
+	}
+}
+
+func TestCompressReproducible(t *testing.T) {
+	for _, format := range []string{"tar.gz", "zip"} {
+		t.Run(format, func(t *testing.T) {
+			tree := filepath.Join(t.TempDir(), "tree")
+			os.MkdirAll(filepath.Join(tree, "sub", "empty"), 0755)
+			os.WriteFile(filepath.Join(tree, "a.txt"), []byte("a"), 0600)
+			os.WriteFile(filepath.Join(tree, "run.sh"), []byte("#!/bin/sh"), 0700)
+			os.WriteFile(filepath.Join(tree, "sub", "b.txt"), []byte("b"), 0644)
+			os.Symlink("a.txt", filepath.Join(tree, "link"))
+
+			opts := CompressOptions{Level: DefaultCompressOptions.Level, Reproducible: true}
+			compress := func() []byte {
+				t.Helper()
+				archive, err := CompressPathWithOptions(tree, format, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer os.Remove(archive)
+				data, err := os.ReadFile(archive)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return data
+			}
+
+			first := compress()
+			// Same content, different mtimes and permissions
+			later := time.Now().Add(time.Hour)
+			for _, name := range []string{"a.txt", "sub/b.txt", "sub"} {
+				os.Chtimes(filepath.Join(tree, name), later, later)
+			}
+			os.Chmod(filepath.Join(tree, "a.txt"), 0644)
+			if second := compress(); !bytes.Equal(first, second) {
+				t.Error("Expected the same archive bytes for the same files")
+			}
+
+			for name, h := range archiveHeaders(t, format, writeTemp(t, first)) {
+				want := os.FileMode(0644)
+				switch name {
+				case "tree", "tree/sub", "tree/sub/empty", "tree/run.sh":
+					want = 0755
+				case "tree/link":
+					want = 0777
+				}
+				if h.mode.Perm() != want || !h.modTime.Equal(reproducibleModTime) {
+					t.Errorf("%s: mode %v, mtime %v; want %v, %v", name, h.mode.Perm(), h.modTime, want, reproducibleModTime)
+				}
+			}
+
+			// Without the option the mtimes show through
+			opts.Reproducible = false
+			before := compress()
+			os.Chtimes(filepath.Join(tree, "a.txt"), later.Add(time.Hour), later.Add(time.Hour))
+			if after := compress(); bytes.Equal(before, after) {
+				t.Error("Expected a changed mtime to change a normal archive")
+			}
+		})
+	}
+}
+
+type archiveHeader struct {
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// archiveHeaders reads each entry's mode and mtime from an archive.
+func archiveHeaders(t *testing.T, format, path string) map[string]archiveHeader {
+	t.Helper()
+	headers := make(map[string]archiveHeader)
+	if format == "zip" {
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			headers[strings.TrimSuffix(f.Name, "/")] = archiveHeader{f.Mode(), f.Modified}
+		}
+		return headers
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return headers
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers[h.Name] = archiveHeader{h.FileInfo().Mode(), h.ModTime}
+	}
+}
+
+// writeTemp writes data to a file in a temp dir and returns its path.
+func writeTemp(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "archive")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCompressFileMarks(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dir")
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "sub/c.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, 256<<10), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, format := range []string{"tar.gz", "zip"} {
+		path, marks, err := compressPath(dir, format, CompressOptions{Level: 0})
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		defer os.Remove(path)
+
+		want := []string{"dir/a.txt", "dir/b.txt", "dir/sub/c.txt"}
+		if len(marks) != len(want) {
+			t.Fatalf("%s: %d marks, want %d", format, len(marks), len(want))
+		}
+		for i, m := range marks {
+			if m.name != want[i] || (i > 0 && m.offset <= marks[i-1].offset) {
+				t.Errorf("%s: mark %d = %+v", format, i, m)
+			}
+		}
+
+		a := &archiveFile{marks: marks}
+		if name, i, n := a.fileAt(0); name != "dir/a.txt" || i != 1 || n != 3 {
+			t.Errorf("%s: fileAt(0) = %q %d/%d", format, name, i, n)
+		}
+		if name, i, _ := a.fileAt(marks[2].offset + 1); name != "dir/sub/c.txt" || i != 3 {
+			t.Errorf("%s: fileAt(last) = %q %d", format, name, i)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/darkprince558/jend/internal/audit"
+	"github.com/darkprince558/jend/internal/ui"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/quic-go/quic-go"
+)
+
+// errDeclined ends both sides when the receiver answers no to the offer.
+var errDeclined = errors.New("receiver declined the transfer")
+
+// offerSummary is what the receiver is asked to accept.
+func offerSummary(meta FileMeta, name string) string {
+	switch meta.Type {
+	case "multi":
+		return fmt.Sprintf("Accept %d files (%s)?", len(meta.Files), audit.FormatBytes(meta.Size))
+	case "stream":
+		return fmt.Sprintf("Accept live stream %s (size unknown)?", name)
+	case "text":
+		return fmt.Sprintf("Accept text snippet (%s)?", audit.FormatBytes(meta.Size))
+	}
+	s := fmt.Sprintf("Accept %s (%s)?", name, audit.FormatBytes(meta.Size))
+	if meta.Hash != "" {
+		s += "\nSHA-256 (as claimed by the sender): " + meta.Hash
+	}
+	return s
+}
+
+// confirmOffer asks the user about the offer before anything is written or
+// acknowledged. On no, it tells the sender and returns errDeclined once the
+// sender has hung up (or the grace period is over).
+func confirmOffer(conn *quic.Conn, stream io.Writer, meta FileMeta, name string, sendMsg func(tea.Msg)) error {
+	reply := make(chan bool, 1)
+	sendMsg(ui.ConfirmMsg{Prompt: offerSummary(meta, name), Reply: reply})
+
+	var done <-chan struct{}
+	if conn != nil {
+		done = conn.Context().Done()
+	}
+	select {
+	case ok := <-reply:
+		if ok {
+			return nil
+		}
+	case <-done:
+		return fmt.Errorf("sender hung up while waiting for confirmation")
+	}
+
+	sendMsg(ui.StatusMsg("Declined. Telling the sender..."))
+	refuseOffer(conn, stream, errDeclined.Error())
+	return errDeclined
+}
+
+// refuseOffer tells the sender why its offer is turned down and waits for it
+// to hang up (or the grace period to end), so hanging up ourselves doesn't
+// drop the reason on the way.
+func refuseOffer(conn *quic.Conn, stream io.Writer, reason string) {
+	if err := sendCancel(stream, reason); err != nil {
+		return
+	}
+	if c, ok := stream.(io.Closer); ok {
+		c.Close()
+	}
+	if conn != nil {
+		select {
+		case <-conn.Context().Done():
+		case <-time.After(cancelGracePeriod):
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/darkprince558/jend/internal/audit"
+	"github.com/darkprince558/jend/internal/ui"
+	"github.com/darkprince558/jend/pkg/protocol"
+)
+
+// Delta sync (receive --delta) sends only what changed in a file the receiver
+// already has an older version of, rsync style.
+//
+// Negotiation: the sender advertises "delta": true for a plain file. A
+// receiver with --delta, an older version at the path it would save to and no
+// partial download to resume answers with TypeDeltaSig instead of TypeAck: its
+// block size, then a weak rolling sum and a strong hash of each whole block of
+// the older version. The sender slides a window over the new file looking for
+// those blocks and sends TypeDeltaCopy for each run it finds and TypeData (no
+// chunk CRC) for the bytes in between. The receiver rebuilds the file in
+// .partial and checks the whole-file hash as usual; a dropped transfer resumes
+// from that .partial like any other.
+
+const (
+	deltaMinBlock   = 2 * 1024
+	deltaMaxBlock   = 1024 * 1024
+	deltaStrongSize = 16
+	deltaSigEntry   = 4 + deltaStrongSize
+	// maxDeltaSig bounds the signature packet: with 1 MiB blocks, older
+	// versions up to about 1.6 TiB
+	maxDeltaSig = 32 * 1024 * 1024
+)
+
+// deltaBlockSize picks about the square root of the larger version, like rsync.
+func deltaBlockSize(size, basisSize int64) int {
+	block := int(math.Sqrt(float64(max(size, basisSize))))
+	return min(max(block, deltaMinBlock), deltaMaxBlock)
+}
+
+// openDeltaBasis opens the older version a delta can build on: the file name
+// in opts.OutputDir, when opts.Delta is on, the offer allows it and there is
+// no partial download to resume instead (unless opts.Fresh discards it). It
+// returns nil when the transfer should go the usual way.
+func openDeltaBasis(meta FileMeta, name string, opts *ReceiveOptions) (*os.File, int) {
+	if !opts.Delta || !meta.Delta || meta.Type != "file" {
+		return nil, 0
+	}
+	if _, err := os.Stat(filepath.Join(opts.OutputDir, name+".partial")); err == nil && !opts.Fresh {
+		return nil, 0
+	}
+	f, err := os.Open(filepath.Join(opts.OutputDir, name))
+	if err != nil {
+		return nil, 0
+	}
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		f.Close()
+		return nil, 0
+	}
+	block := deltaBlockSize(meta.Size, info.Size())
+	if info.Size() < int64(block) || 4+info.Size()/int64(block)*deltaSigEntry > maxDeltaSig {
+		f.Close()
+		return nil, 0
+	}
+	return f, block
+}
+
+// deltaSignature computes the TypeDeltaSig payload for basis.
+func deltaSignature(basis *os.File, block int) ([]byte, error) {
+	info, err := basis.Stat()
+	if err != nil {
+		return nil, err
+	}
+	count := info.Size() / int64(block)
+	payload := make([]byte, 4, 4+count*deltaSigEntry)
+	binary.LittleEndian.PutUint32(payload, uint32(block))
+
+	r := bufio.NewReaderSize(io.NewSectionReader(basis, 0, count*int64(block)), block)
+	buf := make([]byte, block)
+	for range count {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		strong := sha256.Sum256(buf)
+		payload = binary.LittleEndian.AppendUint32(payload, newRollingSum(buf).sum())
+		payload = append(payload, strong[:deltaStrongSize]...)
+	}
+	return payload, nil
+}
+
+// readDeltaCopy reads a TypeDeltaCopy payload.
+func readDeltaCopy(r io.Reader, length uint32) (offset, n int64, err error) {
+	if length != 16 {
+		return 0, 0, fmt.Errorf("invalid delta copy length %d", length)
+	}
+	var payload [16]byte
+	if _, err := io.ReadFull(r, payload[:]); err != nil {
+		return 0, 0, err
+	}
+	return int64(binary.LittleEndian.Uint64(payload[:8])), int64(binary.LittleEndian.Uint64(payload[8:])), nil
+}
+
+// deltaIndex is the receiver's older version, as the sender looks it up.
+type deltaIndex struct {
+	block  int
+	blocks map[uint32][]deltaBlock // By weak sum
+}
+
+type deltaBlock struct {
+	index  int64
+	strong [deltaStrongSize]byte
+}
+
+// readDeltaSignature reads a TypeDeltaSig payload.
+func readDeltaSignature(r io.Reader, length uint32) (*deltaIndex, error) {
+	if length < 4 || length > maxDeltaSig || (length-4)%deltaSigEntry != 0 {
+		return nil, fmt.Errorf("invalid delta signature length %d", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	sig := &deltaIndex{
+		block:  int(binary.LittleEndian.Uint32(payload)),
+		blocks: make(map[uint32][]deltaBlock),
+	}
+	if sig.block < deltaMinBlock || sig.block > deltaMaxBlock {
+		return nil, fmt.Errorf("invalid delta block size %d", sig.block)
+	}
+	for i, entry := 0, payload[4:]; len(entry) > 0; i, entry = i+1, entry[deltaSigEntry:] {
+		b := deltaBlock{index: int64(i)}
+		copy(b.strong[:], entry[4:deltaSigEntry])
+		weak := binary.LittleEndian.Uint32(entry)
+		sig.blocks[weak] = append(sig.blocks[weak], b)
+	}
+	return sig, nil
+}
+
+// find returns the index of an older block equal to window, whose rolling sum is weak.
+func (s *deltaIndex) find(weak uint32, window []byte) (int64, bool) {
+	candidates := s.blocks[weak]
+	if len(candidates) == 0 {
+		return 0, false
+	}
+	strong := sha256.Sum256(window)
+	for _, b := range candidates {
+		if bytes.Equal(b.strong[:], strong[:deltaStrongSize]) {
+			return b.index, true
+		}
+	}
+	return 0, false
+}
+
+// writeDelta sends r as instructions to rebuild it from the receiver's older
+// version: TypeDeltaCopy for blocks found in sig, TypeData of at most
+// chunkSize bytes for the rest. step is called after each packet with how much
+// of r the receiver can now rebuild, and stops the transfer by returning an
+// error. It returns how many bytes went out as data.
+func writeDelta(w io.Writer, r io.Reader, sig *deltaIndex, chunkSize int, step func(done int64) error) (int64, error) {
+	bs := sig.block
+	buf := make([]byte, 0, 2*max(bs, chunkSize)+bs)
+	var (
+		pos     int64 // Position of buf[0] in r
+		start   int   // Start of the window in buf
+		lit     int   // Start of what is not sent yet
+		eof     bool
+		weak    rollingSum
+		fresh   = true // The window jumped: sum it from scratch
+		copyOff int64  // Pending copy, merged with the next one when they're adjacent
+		copyLen int64
+		literal int64
+	)
+
+	flushCopy := func() error {
+		if copyLen == 0 {
+			return nil
+		}
+		if err := protocol.EncodeHeader(w, protocol.TypeDeltaCopy, 16); err != nil {
+			return err
+		}
+		var payload [16]byte
+		binary.LittleEndian.PutUint64(payload[:8], uint64(copyOff))
+		binary.LittleEndian.PutUint64(payload[8:], uint64(copyLen))
+		if _, err := w.Write(payload[:]); err != nil {
+			return err
+		}
+		copyLen = 0
+		return step(pos + int64(lit))
+	}
+	sendLiteral := func(end int) error {
+		if err := flushCopy(); err != nil {
+			return err
+		}
+		for lit < end {
+			n := min(end-lit, chunkSize)
+			if err := protocol.EncodeHeader(w, protocol.TypeData, uint32(n)); err != nil {
+				return err
+			}
+			if _, err := w.Write(buf[lit : lit+n]); err != nil {
+				return err
+			}
+			lit += n
+			literal += int64(n)
+			if err := step(pos + int64(lit)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for {
+		if len(buf)-start < bs && !eof {
+			// Drop what's sent and read on
+			copy(buf, buf[lit:])
+			buf = buf[:len(buf)-lit]
+			start -= lit
+			pos += int64(lit)
+			lit = 0
+			n, err := io.ReadFull(r, buf[len(buf):cap(buf)])
+			buf = buf[:len(buf)+n]
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				eof = true
+			} else if err != nil {
+				return literal, err
+			}
+			continue
+		}
+		if len(buf)-start < bs {
+			// The tail, shorter than a block
+			if err := sendLiteral(len(buf)); err != nil {
+				return literal, err
+			}
+			return literal, flushCopy()
+		}
+
+		window := buf[start : start+bs]
+		if fresh {
+			weak = newRollingSum(window)
+			fresh = false
+		}
+		if index, ok := sig.find(weak.sum(), window); ok {
+			if err := sendLiteral(start); err != nil {
+				return literal, err
+			}
+			offset := index * int64(bs)
+			if copyLen > 0 && copyOff+copyLen == offset {
+				copyLen += int64(bs)
+			} else {
+				if err := flushCopy(); err != nil {
+					return literal, err
+				}
+				copyOff, copyLen = offset, int64(bs)
+			}
+			start += bs
+			lit = start
+			fresh = true
+			continue
+		}
+
+		// No match here: slide a byte, if the next one is read yet
+		if start+bs < len(buf) {
+			weak.roll(buf[start], buf[start+bs])
+		} else {
+			fresh = true
+		}
+		start++
+		if start-lit >= chunkSize {
+			if err := sendLiteral(start); err != nil {
+				return literal, err
+			}
+		}
+	}
+}
+
+// rollingSum is rsync's weak checksum: it slides along a byte at a time.
+type rollingSum struct {
+	a, b, n uint32
+}
+
+func newRollingSum(p []byte) rollingSum {
+	s := rollingSum{n: uint32(len(p))}
+	for i, c := range p {
+		s.a += uint32(c)
+		s.b += uint32(len(p)-i) * uint32(c)
+	}
+	return s
+}
+
+// roll moves the window one byte on: out leaves at the front, in joins at the end.
+func (s *rollingSum) roll(out, in byte) {
+	s.a += uint32(in) - uint32(out)
+	s.b += s.a - s.n*uint32(out)
+}
+
+func (s rollingSum) sum() uint32 {
+	return s.a&0xffff | s.b<<16
+}
+
+// sendDelta is handleConnection's data loop for a receiver that sent sig: it
+// sends the slice of file from currentOffset as a delta (see writeDelta).
+func sendDelta(ctx context.Context, stream io.ReadWriter, file io.Reader, sig *deltaIndex, currentOffset, fileSize int64, startModTime time.Time, chunkSize int, sendMsg func(tea.Msg)) (span, error) {
+	readerAt, ok := file.(io.ReaderAt)
+	if !ok {
+		err := fmt.Errorf("delta needs a seekable file")
+		sendError(stream, errCodeSource, err)
+		return span{}, err
+	}
+	if chunkSize <= 0 {
+		chunkSize = ChunkSize
+	}
+	sliceSize := fileSize - currentOffset
+
+	// The receiver may call it off mid-way (Ctrl-C, disk full); stop as soon as it says so
+	stopped, stopWatch := watchReceiverCancel(stream)
+	defer stopWatch()
+
+	checkChanges := !startModTime.IsZero()
+	lastProgress, lastCheck := time.Now(), time.Now()
+	throughput := newThroughputEstimator(0, lastProgress)
+	literal, err := writeDelta(stream, io.NewSectionReader(readerAt, currentOffset, sliceSize), sig, chunkSize, func(done int64) error {
+		select {
+		case <-stopped.Done():
+			return context.Cause(stopped)
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				sendCancel(stream, "transfer took longer than the sender's --max-duration")
+			} else {
+				protocol.EncodeHeader(stream, protocol.TypeCancel, 0)
+			}
+			return ctx.Err()
+		default:
+		}
+		if checkChanges && time.Since(lastCheck) >= fileChangeCheckInterval {
+			lastCheck = time.Now()
+			if fileChanged(file, fileSize, startModTime) {
+				sendCancel(stream, errFileChanged.Error())
+				return errFileChanged
+			}
+		}
+		if time.Since(lastProgress) >= progressInterval && done < sliceSize {
+			lastProgress = time.Now()
+			sendProgress(sendMsg, file, currentOffset+done, done, sliceSize, throughput)
+		}
+		return nil
+	})
+	if err != nil {
+		return span{}, err
+	}
+	// A write may have landed after the last periodic check
+	if checkChanges && fileChanged(file, fileSize, startModTime) {
+		sendCancel(stream, errFileChanged.Error())
+		return span{}, errFileChanged
+	}
+	sendMsg(ui.StatusMsg(fmt.Sprintf("Delta: sent %s of %s, the receiver had the rest.", audit.FormatBytes(literal), audit.FormatBytes(sliceSize))))
+	return span{0, sliceSize}, nil
+}
@@ -0,0 +1,190 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/darkprince558/jend/pkg/protocol"
+)
+
+func TestRollingSum(t *testing.T) {
+	data := make([]byte, 5000)
+	rand.New(rand.NewSource(1)).Read(data)
+	const window = 1000
+	s := newRollingSum(data[:window])
+	for i := 1; i+window <= len(data); i++ {
+		s.roll(data[i-1], data[i+window-1])
+		if want := newRollingSum(data[i : i+window]).sum(); s.sum() != want {
+			t.Fatalf("Rolled sum at %d = %x, want %x", i, s.sum(), want)
+		}
+	}
+}
+
+// changedVersion is old with an insertion, an overwrite and an append.
+func changedVersion(old []byte) []byte {
+	var b bytes.Buffer
+	b.Write(old[:50000])
+	b.WriteString("inserted, shifting everything after it")
+	b.Write(old[50000:120000])
+	b.WriteString(strings.Repeat("overwritten", 100))
+	b.Write(old[121100:])
+	b.WriteString("appended")
+	return b.Bytes()
+}
+
+// applyDelta rebuilds a file from old and writeDelta's packets.
+func applyDelta(t *testing.T, old []byte, r io.Reader) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	for {
+		pType, length, err := protocol.DecodeHeader(r)
+		if err == io.EOF {
+			return out.Bytes()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch pType {
+		case protocol.TypeDeltaCopy:
+			off, n, err := readDeltaCopy(r, length)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out.Write(old[off : off+n])
+		case protocol.TypeData:
+			io.CopyN(&out, r, int64(length))
+		default:
+			t.Fatalf("Unexpected packet type %d", pType)
+		}
+	}
+}
+
+func TestWriteDelta(t *testing.T) {
+	old := make([]byte, 300000)
+	rand.New(rand.NewSource(2)).Read(old)
+	basis := filepath.Join(t.TempDir(), "old")
+	os.WriteFile(basis, old, 0644)
+	f, err := os.Open(basis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, tc := range []struct {
+		name       string
+		data       []byte
+		maxLiteral int64
+	}{
+		{"unchanged", old, deltaMinBlock}, // The tail, short of a block, is never signed
+		{"changed", changedVersion(old), 3 * 2 * deltaMinBlock},
+		{"unrelated", bytes.Repeat([]byte("z"), 10000), 10000},
+		{"empty", nil, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sig, err := deltaSignature(f, deltaBlockSize(int64(len(tc.data)), int64(len(old))))
+			if err != nil {
+				t.Fatal(err)
+			}
+			index, err := readDeltaSignature(bytes.NewReader(sig), uint32(len(sig)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var packets bytes.Buffer
+			var lastDone int64
+			literal, err := writeDelta(&packets, bytes.NewReader(tc.data), index, 4096, func(done int64) error {
+				if done < lastDone {
+					t.Errorf("Progress went back from %d to %d", lastDone, done)
+				}
+				lastDone = done
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if literal > tc.maxLiteral {
+				t.Errorf("Sent %d bytes as data, want at most %d", literal, tc.maxLiteral)
+			}
+			if got := applyDelta(t, old, &packets); !bytes.Equal(got, tc.data) {
+				t.Errorf("Rebuilt %d bytes that don't match the %d sent", len(got), len(tc.data))
+			}
+		})
+	}
+}
+
+func TestReadDeltaSignatureInvalid(t *testing.T) {
+	for _, payload := range [][]byte{
+		{1, 2},                // No block size
+		{0, 1, 0, 0},          // Block of 256 bytes, under deltaMinBlock
+		{0, 8, 0, 0, 1, 2, 3}, // Not a whole entry
+	} {
+		if _, err := readDeltaSignature(bytes.NewReader(payload), uint32(len(payload))); err == nil {
+			t.Errorf("Accepted %v", payload)
+		}
+	}
+}
+
+// deltaSession sends data to a receiver whose outDir may hold an older version
+// of it, as out.bin, and returns what was saved and the sender's status lines.
+func deltaSession(t *testing.T, outDir string, data []byte, delta bool) (saved []byte, status []string) {
+	t.Helper()
+	src := filepath.Join(t.TempDir(), "new")
+	os.WriteFile(src, data, 0644)
+	file, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	info, _ := file.Stat()
+
+	sendOpts := &SendOptions{Code: "code", ChunkSize: ChunkSize}
+	recvOpts := &ReceiveOptions{Code: "code", OutputDir: outDir, Force: true, NoPreserve: true, NoClipboard: true, Concurrency: 1, Delta: delta}
+	sendErr, recvErr, status := pipeSession(t, file, "out.bin", info.Size(), info.ModTime(), sendOpts, recvOpts)
+	if sendErr != nil || recvErr != nil {
+		t.Fatalf("Sender %v, receiver %v", sendErr, recvErr)
+	}
+	saved, _ = os.ReadFile(filepath.Join(outDir, "out.bin"))
+	return saved, status
+}
+
+func TestDeltaSession(t *testing.T) {
+	t.Setenv("HOME", t.TempDir()) // The sender signs with its identity key
+
+	old := make([]byte, 300000)
+	rand.New(rand.NewSource(3)).Read(old)
+	data := changedVersion(old)
+	deltaSent := func(status []string) bool {
+		for _, s := range status {
+			if strings.HasPrefix(s, "Delta: sent") {
+				return true
+			}
+		}
+		return false
+	}
+
+	// No older version: the whole file, as usual
+	outDir := t.TempDir()
+	got, status := deltaSession(t, outDir, old, true)
+	if !bytes.Equal(got, old) || deltaSent(status) {
+		t.Fatalf("First send: saved %d bytes, delta %v", len(got), deltaSent(status))
+	}
+
+	got, status = deltaSession(t, outDir, data, true)
+	if !bytes.Equal(got, data) {
+		t.Errorf("Delta rebuilt %d bytes that don't match the %d sent", len(got), len(data))
+	}
+	if !deltaSent(status) {
+		t.Errorf("Expected a delta, sender said %q", status)
+	}
+
+	// Without --delta the receiver asks for everything
+	os.WriteFile(filepath.Join(outDir, "out.bin"), old, 0644)
+	if got, status = deltaSession(t, outDir, data, false); !bytes.Equal(got, data) || deltaSent(status) {
+		t.Errorf("Without --delta: saved %d bytes, delta %v", len(got), deltaSent(status))
+	}
+}
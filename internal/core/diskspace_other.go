@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package core
+
+import "errors"
+
+// freeSpace isn't implemented here; callers skip the check.
+func freeSpace(dir string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
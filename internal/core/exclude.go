@@ -0,0 +1,215 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFileName, at the root of a directory being sent, lists more --exclude
+// patterns: one per line, blank lines and lines starting with # skipped.
+const ignoreFileName = ".jendignore"
+
+// gitignoreFileName is read in every directory walked with RespectGitignore.
+const gitignoreFileName = ".gitignore"
+
+// excludePattern is one --exclude, .jendignore or .gitignore line: a glob in
+// path.Match syntax, where a "**" segment also matches any number of
+// directories.
+type excludePattern struct {
+	glob     string
+	base     string // Directory of the .gitignore it came from, relative to the root; "" for the root
+	dirOnly  bool   // Written with a trailing "/": directories only
+	anchored bool   // Has a "/" inside: matches the whole path below base, not a name at any depth
+	negate   bool   // Written with a leading "!": re-includes what an earlier pattern excluded
+}
+
+// excludeRules decides what under a sent directory stays out of the archive.
+// As in .gitignore, the last pattern matching a path decides, and patterns
+// from deeper .gitignore files come later; .git comes after them, and
+// --exclude and .jendignore last of all. A nil *excludeRules excludes nothing.
+type excludeRules struct {
+	patterns  []excludePattern // --exclude and .jendignore
+	gitignore bool             // Also follow .gitignore files
+	git       []excludePattern // From the .gitignore files of the directories being walked, outermost first
+}
+
+func parseExclude(p string) (excludePattern, error) {
+	var e excludePattern
+	p = strings.TrimSpace(p)
+	if rest, ok := strings.CutPrefix(p, "!"); ok {
+		e.negate = true
+		p = rest
+	}
+	if strings.HasSuffix(p, "/") {
+		e.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+	p = strings.TrimPrefix(p, "./")
+	e.anchored = strings.Contains(p, "/")
+	e.glob = strings.TrimPrefix(p, "/")
+	if e.glob == "" {
+		return e, fmt.Errorf("empty exclude pattern")
+	}
+	for _, seg := range strings.Split(e.glob, "/") {
+		if _, err := path.Match(seg, ""); err != nil {
+			return e, fmt.Errorf("invalid exclude pattern %q: %v", p, err)
+		}
+	}
+	return e, nil
+}
+
+// ValidateExcludes checks --exclude patterns before anything is archived.
+func ValidateExcludes(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := parseExclude(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadExcludeRules combines patterns with root's .jendignore, if it has one.
+// With gitignore, the walk also reads each directory's .gitignore (see enterDir).
+func loadExcludeRules(root string, patterns []string, gitignore bool) (*excludeRules, error) {
+	r := excludeRules{gitignore: gitignore}
+	if info, err := os.Stat(root); err == nil && info.IsDir() {
+		// A single file sent on its own has no .jendignore
+		ignored, err := readIgnoreFile(filepath.Join(root, ignoreFileName), "")
+		if err != nil {
+			return nil, err
+		}
+		r.patterns = ignored
+	}
+	for _, p := range patterns {
+		e, err := parseExclude(p)
+		if err != nil {
+			return nil, err
+		}
+		r.patterns = append(r.patterns, e)
+	}
+
+	if len(r.patterns) == 0 && !gitignore {
+		return nil, nil
+	}
+	return &r, nil
+}
+
+// readIgnoreFile parses a .jendignore or .gitignore; a missing one is empty.
+func readIgnoreFile(name, base string) ([]excludePattern, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []excludePattern
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		e, err := parseExclude(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", name, line, err)
+		}
+		e.base = base
+		patterns = append(patterns, e)
+	}
+	return patterns, scanner.Err()
+}
+
+// enterDir adds the .gitignore of dir (rel below the root) for the walk of
+// its contents. Leaving dir, the walk calls leaveDir(n).
+func (r *excludeRules) enterDir(dir, rel string) (n int, err error) {
+	if r == nil || !r.gitignore {
+		return 0, nil
+	}
+	n = len(r.git)
+	patterns, err := readIgnoreFile(filepath.Join(dir, gitignoreFileName), rel)
+	if err != nil {
+		return n, err
+	}
+	r.git = append(r.git, patterns...)
+	return n, nil
+}
+
+func (r *excludeRules) leaveDir(n int) {
+	if r != nil && r.gitignore {
+		r.git = r.git[:n]
+	}
+}
+
+// match reports whether rel, a slash-separated path below the root, is
+// excluded. An excluded directory is skipped with everything under it.
+func (r *excludeRules) match(rel string, dir bool) bool {
+	if r == nil || rel == "" {
+		return false
+	}
+	excluded := false
+	for _, p := range r.git {
+		if p.matches(rel, dir) {
+			excluded = !p.negate
+		}
+	}
+	// Git never lists its own repository (a directory, or a file in a
+	// submodule), which holds the whole history and .git/config
+	if r.gitignore && path.Base(rel) == ".git" {
+		excluded = true
+	}
+	for _, p := range r.patterns {
+		if p.matches(rel, dir) {
+			excluded = !p.negate
+		}
+	}
+	return excluded
+}
+
+func (p excludePattern) matches(rel string, dir bool) bool {
+	if p.dirOnly && !dir {
+		return false
+	}
+	if p.base != "" {
+		var ok bool
+		if rel, ok = strings.CutPrefix(rel, p.base+"/"); !ok {
+			return false
+		}
+	}
+	if !p.anchored {
+		rel = path.Base(rel)
+	}
+	return matchSegments(strings.Split(p.glob, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments matches a path against a pattern one directory at a time. A
+// "**" segment matches any number of them; a trailing one at least one.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return len(name) > 0
+			}
+			for i := len(name); i >= 0; i-- {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,214 @@
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// extractTarget resolves an archive entry against outputDir. It reports false
+// for entries that would land outside it (Zip Slip). Both sides are absolute
+// and cleaned, so outputDir "." or "dir/" compare the same as any other.
+func extractTarget(outputDir, name string) (string, bool) {
+	root, err := filepath.Abs(outputDir)
+	if err != nil {
+		return "", false
+	}
+	target := filepath.Join(root, name)
+	if !within(root, target) {
+		return "", false
+	}
+	return target, true
+}
+
+// within reports whether path is root or under it; both absolute and clean.
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
+
+// maxLinkTarget bounds a zip symlink's content, which is its target.
+const maxLinkTarget = 4096
+
+// errUnsafeSymlink marks a symlink entry that is skipped, like a Zip Slip entry.
+var errUnsafeSymlink = errors.New("unsafe symlink")
+
+// extractSymlink recreates a symlink at target, but only if what it points to
+// stays inside outputDir. The link must be relative and clean, so any ".."
+// comes first; those are resolved against the real (symlink-free) directory,
+// and the rest only descends, through links that passed this same check.
+func extractSymlink(outputDir, target, link string) error {
+	link = filepath.FromSlash(link)
+	if link == "" || filepath.IsAbs(link) || filepath.VolumeName(link) != "" || filepath.Clean(link) != link {
+		return fmt.Errorf("%w: %s -> %s is not a clean relative path", errUnsafeSymlink, filepath.Base(target), link)
+	}
+	root, err := filepath.Abs(outputDir)
+	if err != nil {
+		return err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+	if !within(root, dir) || !within(root, filepath.Join(dir, link)) {
+		return fmt.Errorf("%w: %s -> %s points outside %s", errUnsafeSymlink, filepath.Base(target), link, outputDir)
+	}
+
+	// Replace an old link of the same name, like files are replaced
+	if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		os.Remove(target)
+	}
+	return os.Symlink(link, target)
+}
+
+// extractTarGz unpacks directories (empty ones included), regular files and
+// symlinks from a .tar.gz into outputDir. It returns how many entries it
+// skipped: ones that would escape outputDir, and types it doesn't create
+// (hard links, devices, pipes).
+func extractTarGz(path, outputDir string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		return 0, err
+	}
+	defer gzr.Close()
+
+	skipped := 0
+	tr := tar.NewReader(gzr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return skipped, nil
+		}
+		if err != nil {
+			return skipped, err
+		}
+
+		// Zip Slip Protection
+		target, ok := extractTarget(outputDir, header.Name)
+		if !ok {
+			skipped++
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return skipped, err
+			}
+		case tar.TypeSymlink:
+			if err := extractSymlink(outputDir, target, header.Linkname); errors.Is(err, errUnsafeSymlink) {
+				skipped++
+			} else if err != nil {
+				return skipped, err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return skipped, err
+			}
+			out, err := os.Create(target)
+			if err != nil {
+				return skipped, err
+			}
+			if _, err := io.Copy(out, tr); err != nil {
+				out.Close()
+				return skipped, err
+			}
+			out.Close()
+		default:
+			skipped++
+		}
+	}
+}
+
+// extractZip is extractTarGz for a .zip. File permissions come from the
+// archive, without setuid/setgid or group/other write.
+func extractZip(path, outputDir string) (int, error) {
+	// zip.OpenReader requires random access, safe since we have the file on disk
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return 0, err
+	}
+	defer zr.Close()
+
+	skipped := 0
+	for _, f := range zr.File {
+		// Check for Zip Slip
+		fpath, ok := extractTarget(outputDir, f.Name)
+		if !ok {
+			skipped++
+			continue
+		}
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			// Directory entries are what carries an empty directory
+			if err := os.MkdirAll(fpath, 0755); err != nil {
+				return skipped, err
+			}
+			continue
+
+		case mode&os.ModeSymlink != 0:
+			rc, err := f.Open()
+			if err != nil {
+				return skipped, err
+			}
+			link, err := io.ReadAll(io.LimitReader(rc, maxLinkTarget))
+			rc.Close()
+			if err != nil {
+				return skipped, err
+			}
+			if err := extractSymlink(outputDir, fpath, string(link)); errors.Is(err, errUnsafeSymlink) {
+				skipped++
+			} else if err != nil {
+				return skipped, err
+			}
+			continue
+
+		case !mode.IsRegular():
+			skipped++
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			return skipped, err
+		}
+
+		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm()&^0o022)
+		if err != nil {
+			return skipped, err
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			outFile.Close()
+			return skipped, err
+		}
+
+		_, err = io.Copy(outFile, rc)
+		outFile.Close()
+		rc.Close()
+		if err != nil {
+			return skipped, err
+		}
+	}
+	return skipped, nil
+}
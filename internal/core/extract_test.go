@@ -0,0 +1,113 @@
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// archiveEntries is every archive's content: a top-level file, a nested one
+// and an escape attempt.
+var archiveEntries = [][2]string{
+	{"top.txt", "top"},
+	{"sub/nested.txt", "nested"},
+	{"../escape.txt", "evil"},
+}
+
+func writeTarGz(t *testing.T, path string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gzw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gzw)
+	for _, e := range archiveEntries {
+		tw.WriteHeader(&tar.Header{Name: e[0], Mode: 0644, Size: int64(len(e[1])), Typeflag: tar.TypeReg})
+		tw.Write([]byte(e[1]))
+	}
+	tw.Close()
+	gzw.Close()
+}
+
+func writeZip(t *testing.T, path string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, e := range archiveEntries {
+		w, err := zw.Create(e[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e[1]))
+	}
+	zw.Close()
+}
+
+func TestExtractArchives(t *testing.T) {
+	formats := map[string]struct {
+		write   func(*testing.T, string)
+		extract func(string, string) (int, error)
+	}{
+		"tar.gz": {writeTarGz, extractTarGz},
+		"zip":    {writeZip, extractZip},
+	}
+	for format, fns := range formats {
+		for _, dirArg := range []string{".", "out/", "out"} {
+			t.Run(format+" "+dirArg, func(t *testing.T) {
+				base := t.TempDir()
+				// The archive sits one level up from where it unpacks, so an
+				// escape would land next to it
+				os.MkdirAll(filepath.Join(base, "work", "out"), 0755)
+				t.Chdir(filepath.Join(base, "work"))
+				archive := filepath.Join(base, "archive."+format)
+				fns.write(t, archive)
+
+				skipped, err := fns.extract(archive, dirArg)
+				if err != nil {
+					t.Fatalf("Extract failed: %v", err)
+				}
+				if skipped != 1 {
+					t.Errorf("Expected ../escape.txt to be skipped, got %d skipped", skipped)
+				}
+				for _, e := range archiveEntries[:2] {
+					got, err := os.ReadFile(filepath.Join(dirArg, e[0]))
+					if err != nil || string(got) != e[1] {
+						t.Errorf("%s: expected %q, got %q (%v)", e[0], e[1], got, err)
+					}
+				}
+				escaped := filepath.Join(dirArg, "..", "escape.txt")
+				if _, err := os.Stat(escaped); err == nil {
+					t.Errorf("../escape.txt was extracted to %s", escaped)
+				}
+			})
+		}
+	}
+}
+
+func TestExtractTarget(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"../x", "a/../../x", "../" + filepath.Base(dir) + "x/y"} {
+		if _, ok := extractTarget(dir, name); ok {
+			t.Errorf("Expected %q to be rejected", name)
+		}
+	}
+	for _, name := range []string{"x", "a/b", "./", "a/../x", "/etc/passwd"} {
+		target, ok := extractTarget(dir, name)
+		if !ok {
+			t.Errorf("Expected %q to be allowed", name)
+			continue
+		}
+		if rel, _ := filepath.Rel(dir, target); rel == ".." || filepath.IsAbs(rel) {
+			t.Errorf("%q resolved outside %s: %s", name, dir, target)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/darkprince558/jend/pkg/protocol"
+)
+
+// fileChangeCheckInterval is how often the sender re-stats the source mid-transfer.
+const fileChangeCheckInterval = time.Second
+
+// cancelGracePeriod is how long a TypeCancel may take to go out before the
+// sender drops the connection instead.
+const cancelGracePeriod = 5 * time.Second
+
+// maxCancelReason bounds the optional reason carried by TypeCancel.
+const maxCancelReason = 1024
+
+// errFileChanged means the source no longer matches the hash in the handshake,
+// so neither this receiver nor any later one can get a valid copy.
+var errFileChanged = errors.New("sender's file changed during transfer")
+
+// fileChanged reports whether file no longer has the size and modtime the sender
+// captured at startup. Only regular files can be checked; everything else is
+// reported unchanged. A multi-file source checks each of its files.
+func fileChanged(file io.Reader, size int64, modTime time.Time) bool {
+	if m, ok := file.(*multiFile); ok {
+		return m.changed()
+	}
+	if a, ok := file.(*archiveFile); ok {
+		file = a.File
+	}
+	f, ok := file.(*os.File)
+	if !ok || modTime.IsZero() {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Size() != size || !info.ModTime().Equal(modTime)
+}
+
+// sendCancel tells the receiver to stop, with a reason it can show the user.
+// Older receivers expect an empty payload, but they stop reading at TypeCancel anyway.
+func sendCancel(w io.Writer, reason string) error {
+	if len(reason) > maxCancelReason {
+		reason = reason[:maxCancelReason]
+	}
+	if err := protocol.EncodeHeader(w, protocol.TypeCancel, uint32(len(reason))); err != nil {
+		return err
+	}
+	if reason == "" {
+		return nil
+	}
+	_, err := io.WriteString(w, reason)
+	return err
+}
+
+// errSenderCancelled is the receiver's error when the sender cancels the
+// transfer; it stops the receiver from retrying.
+var errSenderCancelled = errors.New("transfer cancelled by sender")
+
+// cancelError reads a TypeCancel payload and turns it into the receiver's error,
+// which wraps errSenderCancelled.
+func cancelError(r io.Reader, length uint32) error {
+	if length == 0 || length > maxCancelReason {
+		return errSenderCancelled
+	}
+	reason := make([]byte, length)
+	if _, err := io.ReadFull(r, reason); err != nil {
+		return errSenderCancelled
+	}
+	return fmt.Errorf("%s (%w)", reason, errSenderCancelled)
+}
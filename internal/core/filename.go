@@ -0,0 +1,79 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxFilenameBytes is the longest name most filesystems take (ext4, APFS, NTFS).
+const maxFilenameBytes = 255
+
+// maxExtBytes: anything longer after the last dot isn't treated as an extension.
+const maxExtBytes = 32
+
+// Device names Windows reserves in every directory, with or without an extension.
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM0": true, "COM1": true, "COM2": true, "COM3": true, "COM4": true,
+	"COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT0": true, "LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true,
+	"LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// sanitizeFilename turns a name the sender chose into one that is safe to
+// create in the output directory on any OS: the last path element only (either
+// separator), no control or Windows-invalid characters, no reserved device
+// names, no leading dash, and at most maxFilenameBytes with the extension kept.
+// Anything left empty becomes "received_file".
+func sanitizeFilename(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.ToValidUTF8(name, "_")
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsControl(r):
+			return -1
+		case strings.ContainsRune(`<>:"|?*`, r):
+			return '_'
+		}
+		return r
+	}, name)
+	// Windows drops trailing dots and spaces, which also disposes of "." and ".."
+	name = strings.TrimLeft(strings.TrimRight(name, ". "), " ")
+	if name == "" {
+		return "received_file"
+	}
+	if name[0] == '-' {
+		name = "_" + name[1:] // Would read as a flag to whatever runs on it next
+	}
+	stem, _, _ := strings.Cut(name, ".")
+	if windowsReserved[strings.ToUpper(strings.TrimRight(stem, " "))] {
+		name = "_" + name
+	}
+	return truncateFilename(name, "")
+}
+
+// truncateFilename fits name plus suffix (inserted before the extension) into
+// maxFilenameBytes, cutting the stem on a rune boundary.
+func truncateFilename(name, suffix string) string {
+	ext := filepath.Ext(name)
+	if len(ext) > maxExtBytes {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(name, ext)
+	limit := maxFilenameBytes - len(suffix) - len(ext)
+	for len(stem) > limit {
+		_, size := utf8.DecodeLastRuneInString(stem)
+		stem = stem[:len(stem)-size]
+	}
+	return stem + suffix + ext
+}
+
+// numberedName is name's n-th alternative for when it's taken: "name (n).ext".
+func numberedName(name string, n int) string {
+	return truncateFilename(name, fmt.Sprintf(" (%d)", n))
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"report.pdf", "report.pdf"},
+		{".bashrc", ".bashrc"},
+		{"", "received_file"},
+		{".", "received_file"},
+		{"..", "received_file"},
+		{"...", "received_file"},
+		{"/", "received_file"},
+		{"../../etc/passwd", "passwd"},
+		{`..\..\Windows\win.ini`, "win.ini"},
+		{`C:\Users\x\evil.exe`, "evil.exe"},
+		{"dir/..", "received_file"},
+		{"a\x00b.txt", "ab.txt"},
+		{"bell\a\r\n.txt", "bell.txt"},
+		{"what?.txt", "what_.txt"},
+		{`a<b>c:d"e|f*.txt`, "a_b_c_d_e_f_.txt"},
+		{"-rf", "_rf"},
+		{"--help.txt", "_-help.txt"},
+		{"CON", "_CON"},
+		{"con.txt", "_con.txt"},
+		{"LPT1.tar.gz", "_LPT1.tar.gz"},
+		{"console.txt", "console.txt"},
+		{"trailing. . ", "trailing"},
+		{"  spaced.txt", "spaced.txt"},
+		{"bad\xffutf8", "bad_utf8"},
+	}
+	for _, c := range cases {
+		if got := sanitizeFilename(c.in); got != c.want {
+			t.Errorf("sanitizeFilename(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestSanitizeFilenameLong(t *testing.T) {
+	got := sanitizeFilename(strings.Repeat("a", 300) + ".tar.gz")
+	if len(got) != maxFilenameBytes || !strings.HasSuffix(got, "a.gz") {
+		t.Errorf("Expected %d bytes ending in the extension, got %d: %q", maxFilenameBytes, len(got), got)
+	}
+
+	// Multi-byte runes are never cut in half
+	got = sanitizeFilename(strings.Repeat("é", 200) + ".txt")
+	if len(got) > maxFilenameBytes || !utf8.ValidString(got) || !strings.HasSuffix(got, ".txt") {
+		t.Errorf("Expected a valid name within %d bytes, got %d: %q", maxFilenameBytes, len(got), got)
+	}
+
+	// An "extension" that is most of the name isn't kept whole
+	got = sanitizeFilename("x." + strings.Repeat("b", 300))
+	if len(got) != maxFilenameBytes {
+		t.Errorf("Expected %d bytes, got %d", maxFilenameBytes, len(got))
+	}
+
+	got = numberedName(strings.Repeat("c", 260)+".txt", 12)
+	if len(got) != maxFilenameBytes || !strings.HasSuffix(got, " (12).txt") {
+		t.Errorf("Expected the number to survive truncation, got %q", got)
+	}
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// followPollInterval is the fallback re-check when no fsnotify event arrives
+// (network filesystems, editors that write via rename, missed events).
+const followPollInterval = 500 * time.Millisecond
+
+// followReader reads a file that is still being written, like `tail -f`.
+// At EOF it blocks until the file grows. When ctx is done it returns io.EOF,
+// so stopping the sender ends the stream cleanly instead of cancelling it.
+type followReader struct {
+	ctx     context.Context
+	file    *os.File
+	offset  int64
+	watcher *fsnotify.Watcher
+}
+
+func newFollowReader(ctx context.Context, file *os.File, offset int64) (*followReader, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(file.Name()); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	return &followReader{ctx: ctx, file: file, offset: offset, watcher: watcher}, nil
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.file.ReadAt(p, r.offset)
+		if n > 0 {
+			r.offset += int64(n)
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		// Caught up. Anything still being written is picked up after the stop signal.
+		if r.ctx.Err() != nil {
+			return 0, io.EOF
+		}
+
+		if info, err := r.file.Stat(); err == nil && info.Size() < r.offset {
+			return 0, fmt.Errorf("followed file was truncated")
+		}
+
+		select {
+		case <-r.ctx.Done():
+			// Loop once more to drain bytes appended since the last read
+		case _, ok := <-r.watcher.Events:
+			if !ok {
+				return 0, io.EOF
+			}
+		case err, ok := <-r.watcher.Errors:
+			if ok && err != nil {
+				return 0, err
+			}
+		case <-time.After(followPollInterval):
+		}
+	}
+}
+
+func (r *followReader) Close() error {
+	return r.watcher.Close()
+}
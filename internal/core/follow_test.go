@@ -0,0 +1,60 @@
+package core
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFollowReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("line1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fr, err := newFollowReader(ctx, f, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fr.Close()
+
+	// Append while the reader is blocked at EOF, then stop following
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		w, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return
+		}
+		w.Write([]byte("line2\n"))
+		w.Close()
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(fr)
+		done <- data
+	}()
+
+	select {
+	case data := <-done:
+		if string(data) != "line1\nline2\n" {
+			t.Errorf("Expected both lines, got %q", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("followReader did not finish after cancel")
+	}
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// maxHashCacheEntries bounds the cache; the least recently hashed entries go first.
+const maxHashCacheEntries = 256
+
+// hashCacheEntry is the SHA-256 of a file slice, valid while size and modtime match.
+type hashCacheEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Offset  int64     `json:"offset"` // --since-offset the hash starts at
+	Hash    string    `json:"hash"`
+	Used    time.Time `json:"used"`
+}
+
+var hashCachePathOverride string
+
+// hashCachePath is ~/.jend/.jend-hash: one table keyed by absolute path, so
+// shared folders (often read-only) never get sidecar files written into them.
+func hashCachePath() (string, error) {
+	if hashCachePathOverride != "" {
+		return hashCachePathOverride, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(home, ".jend")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, ".jend-hash"), nil
+}
+
+func hashCacheKey(path string, offset int64) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return fmt.Sprintf("%s@%d", path, offset)
+}
+
+func loadHashCache() map[string]hashCacheEntry {
+	cache := make(map[string]hashCacheEntry)
+	path, err := hashCachePath()
+	if err != nil {
+		return cache
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	// A corrupt cache is just a cold cache
+	json.Unmarshal(data, &cache)
+	return cache
+}
+
+func saveHashCache(cache map[string]hashCacheEntry) error {
+	if len(cache) > maxHashCacheEntries {
+		keys := make([]string, 0, len(cache))
+		for k := range cache {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return cache[keys[i]].Used.Before(cache[keys[j]].Used) })
+		for _, k := range keys[:len(keys)-maxHashCacheEntries] {
+			delete(cache, k)
+		}
+	}
+
+	path, err := hashCachePath()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	// Write-then-rename, each writer through its own temp file, so two senders
+	// never leave a half-written cache (the last to finish wins)
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Gone already once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// cachedFileHash returns the cached hash of path from offset, if the file still
+// has the size and modtime it had when it was hashed.
+func cachedFileHash(path string, info os.FileInfo, offset int64) (string, bool) {
+	entry, ok := loadHashCache()[hashCacheKey(path, offset)]
+	if !ok || entry.Size != info.Size() || !entry.ModTime.Equal(info.ModTime()) {
+		return "", false
+	}
+	return entry.Hash, true
+}
+
+// storeFileHash records a hash for cachedFileHash. Failures only cost a rehash
+// next time, so they are ignored.
+func storeFileHash(path string, info os.FileInfo, offset int64, hash string) {
+	cache := loadHashCache()
+	cache[hashCacheKey(path, offset)] = hashCacheEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Offset:  offset,
+		Hash:    hash,
+		Used:    time.Now(),
+	}
+	saveHashCache(cache)
+}
+
+// hashFrom returns the hex SHA-256 of r from offset to EOF.
+func hashFrom(r io.ReadSeeker, offset int64) (string, error) {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, r); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+// HashFile returns the hex SHA-256 of a whole file, as sent in the handshake.
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return hashFrom(f, 0)
+}
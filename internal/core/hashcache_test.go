@@ -0,0 +1,120 @@
+package core
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileHashCache(t *testing.T) {
+	dir := t.TempDir()
+	hashCachePathOverride = filepath.Join(dir, ".jend-hash")
+	defer func() { hashCachePathOverride = "" }()
+
+	path := filepath.Join(dir, "data.bin")
+	if err := os.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, _ := f.Stat()
+
+	if _, ok := cachedFileHash(path, info, 0); ok {
+		t.Fatal("Expected a cold cache")
+	}
+
+	hash, err := hashFrom(f, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storeFileHash(path, info, 4, hash)
+
+	if got, ok := cachedFileHash(path, info, 4); !ok || got != hash {
+		t.Errorf("Expected cached hash %s, got %q (hit %v)", hash, got, ok)
+	}
+	if _, ok := cachedFileHash(path, info, 0); ok {
+		t.Error("A different --since-offset must not share the cached hash")
+	}
+
+	// Touching the file invalidates the entry
+	later := info.ModTime().Add(time.Second)
+	os.Chtimes(path, later, later)
+	info, _ = os.Stat(path)
+	if _, ok := cachedFileHash(path, info, 4); ok {
+		t.Error("Expected a miss after the file's modtime changed")
+	}
+}
+
+func TestFileHashCache_Prunes(t *testing.T) {
+	dir := t.TempDir()
+	hashCachePathOverride = filepath.Join(dir, ".jend-hash")
+	defer func() { hashCachePathOverride = "" }()
+
+	path := filepath.Join(dir, "data.bin")
+	os.WriteFile(path, []byte("x"), 0644)
+	info, _ := os.Stat(path)
+
+	for i := int64(0); i < maxHashCacheEntries+10; i++ {
+		storeFileHash(path, info, i, "h")
+	}
+	if n := len(loadHashCache()); n != maxHashCacheEntries {
+		t.Errorf("Expected cache capped at %d entries, got %d", maxHashCacheEntries, n)
+	}
+	// The newest entry survives pruning
+	if _, ok := cachedFileHash(path, info, maxHashCacheEntries+9); !ok {
+		t.Error("Expected the most recent entry to be kept")
+	}
+}
+
+// Senders saving at once must each leave a whole cache, and no temp files.
+func TestFileHashCache_ConcurrentSaves(t *testing.T) {
+	dir := t.TempDir()
+	hashCachePathOverride = filepath.Join(dir, ".jend-hash")
+	defer func() { hashCachePathOverride = "" }()
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache := make(map[string]hashCacheEntry)
+			for j := range 50 {
+				cache[fmt.Sprintf("%d-%d", i, j)] = hashCacheEntry{Hash: "h"}
+			}
+			if err := saveHashCache(cache); err != nil {
+				t.Errorf("saveHashCache: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := len(loadHashCache()); n != 50 {
+		t.Errorf("Expected one writer's 50 entries, got %d", n)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only the cache file to be left, got %v", entries)
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	os.WriteFile(path, []byte("jend"), 0644)
+
+	got, err := HashFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%x", sha256.Sum256([]byte("jend"))); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if _, err := HashFile(path + ".missing"); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/darkprince558/jend/internal/identity"
+	"github.com/darkprince558/jend/pkg/protocol"
+)
+
+// identityNonceSize is the sender's challenge in TypeIdentityReq.
+const identityNonceSize = 32
+
+// identityContext separates identity signatures from any other use of the key.
+const identityContext = "jend-identity-v1"
+
+// errNotAllowed rejects a receiver whose key isn't on the sender's --allow list.
+var errNotAllowed = errors.New("receiver not allowed")
+
+// parseAllowList reads the sender's --allow list (see SendOptions.Allow) into
+// a set of normalized fingerprints.
+func parseAllowList(fingerprints []string) (map[string]bool, error) {
+	allowed := make(map[string]bool, len(fingerprints))
+	for _, fp := range fingerprints {
+		norm, err := identity.ParseFingerprint(fp)
+		if err != nil {
+			return nil, err
+		}
+		allowed[norm] = true
+	}
+	return allowed, nil
+}
+
+// senderIdentityContext separates the sender's handshake signature from a
+// receiver's answer to TypeIdentityReq.
+const senderIdentityContext = "jend-sender-identity-v1"
+
+// parseExpectedSender normalizes the receiver's --expect-sender (see
+// ReceiveOptions.ExpectSender); empty stays empty.
+func parseExpectedSender(fingerprint string) (string, error) {
+	if fingerprint == "" {
+		return "", nil
+	}
+	return identity.ParseFingerprint(fingerprint)
+}
+
+// senderIdentityMessage is what the sender signs in its handshake: this PAKE
+// session's traffic key, so the signature is only good on this connection,
+// from whoever proved the code.
+func senderIdentityMessage(sessionKey []byte) []byte {
+	keyHash := sha256.Sum256(sessionKey)
+	return append([]byte(senderIdentityContext), keyHash[:]...)
+}
+
+// signOffer adds the sender's public key and its signature to the handshake.
+// Without a usable key the handshake goes unsigned, as from older senders.
+func signOffer(meta map[string]interface{}, sessionKey []byte) {
+	key, err := identity.Load()
+	if err != nil {
+		return
+	}
+	meta["sender_key"] = []byte(key.Public().(ed25519.PublicKey))
+	meta["sender_sig"] = ed25519.Sign(key, senderIdentityMessage(sessionKey))
+}
+
+// verifySender checks the handshake's signature and returns the sender's
+// fingerprint, or "" if it signed nothing. A bad signature, or a sender other
+// than expected (a normalized fingerprint, "" for any), is refused.
+func verifySender(meta FileMeta, sessionKey []byte, expected string) (string, error) {
+	fp := ""
+	if len(meta.SenderKey) > 0 || len(meta.SenderSig) > 0 {
+		if len(meta.SenderKey) != ed25519.PublicKeySize || !ed25519.Verify(meta.SenderKey, senderIdentityMessage(sessionKey), meta.SenderSig) {
+			return "", fmt.Errorf("%w: the sender's identity signature is invalid", errRefused)
+		}
+		fp = identity.Fingerprint(meta.SenderKey)
+	}
+	if expected != "" && fp != expected {
+		if fp == "" {
+			return "", fmt.Errorf("%w: the sender proved no identity (it may run an older jend), but --expect-sender requires %s", errRefused, expected)
+		}
+		return fp, fmt.Errorf("%w: sender %s is not %s (--expect-sender)", errRefused, fp, expected)
+	}
+	return fp, nil
+}
+
+// identityMessage is what the receiver signs: the sender's nonce, bound to
+// this PAKE session's traffic key so the answer can't be replayed elsewhere.
+func identityMessage(nonce, sessionKey []byte) []byte {
+	keyHash := sha256.Sum256(sessionKey)
+	msg := append([]byte(identityContext), nonce...)
+	return append(msg, keyHash[:]...)
+}
+
+// requireIdentity is the sender's side: challenge the receiver over the secure
+// stream and check its key against allowed (see parseAllowList). A rejected
+// receiver gets a TypeCancel saying why, which stops it from retrying.
+func requireIdentity(stream io.ReadWriter, sessionKey []byte, allowed map[string]bool) (string, error) {
+	nonce := make([]byte, identityNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	if err := protocol.EncodeHeader(stream, protocol.TypeIdentityReq, identityNonceSize); err != nil {
+		return "", err
+	}
+	if _, err := stream.Write(nonce); err != nil {
+		return "", err
+	}
+
+	pType, length, err := readHeader(stream)
+	if err != nil {
+		return "", err
+	}
+	if pType != protocol.TypeIdentity || length != ed25519.PublicKeySize+ed25519.SignatureSize {
+		// Older receivers don't know the request
+		sendCancel(stream, "this sender only accepts known receivers; update jend and share your fingerprint")
+		return "", fmt.Errorf("%w: no identity offered", errNotAllowed)
+	}
+	answer := make([]byte, length)
+	if _, err := io.ReadFull(stream, answer); err != nil {
+		return "", err
+	}
+	pub := ed25519.PublicKey(answer[:ed25519.PublicKeySize])
+	if !ed25519.Verify(pub, identityMessage(nonce, sessionKey), answer[ed25519.PublicKeySize:]) {
+		sendCancel(stream, "identity signature invalid")
+		return "", fmt.Errorf("%w: bad identity signature", errNotAllowed)
+	}
+	fp := identity.Fingerprint(pub)
+	if !allowed[fp] {
+		sendCancel(stream, fmt.Sprintf("fingerprint %s is not on the sender's --allow list", fp))
+		return fp, fmt.Errorf("%w: %s", errNotAllowed, fp)
+	}
+	return fp, nil
+}
+
+// readOffer is the receiver's side of the start of a session: it answers
+// identity requests and returns the header of the sender's handshake. A
+// TypeCancel (e.g. not on the allow-list) or TypeError (e.g. hashing failed)
+// instead comes back as its error.
+func readOffer(stream io.ReadWriter, sessionKey []byte) (uint32, error) {
+	for {
+		pType, length, err := readHeader(stream)
+		if err != nil {
+			return 0, fmt.Errorf("invalid handshake")
+		}
+		switch pType {
+		case protocol.TypeHandshake:
+			return length, nil
+		case protocol.TypeCancel:
+			return 0, cancelError(stream, length)
+		case protocol.TypeError:
+			return 0, readSenderError(stream, length)
+		case protocol.TypeIdentityReq:
+			if length != identityNonceSize {
+				return 0, fmt.Errorf("invalid identity request")
+			}
+			nonce := make([]byte, length)
+			if _, err := io.ReadFull(stream, nonce); err != nil {
+				return 0, err
+			}
+			key, err := identity.Load()
+			if err != nil {
+				return 0, fmt.Errorf("sender asked for our identity: %w", err)
+			}
+			sig := ed25519.Sign(key, identityMessage(nonce, sessionKey))
+			if err := protocol.EncodeHeader(stream, protocol.TypeIdentity, uint32(ed25519.PublicKeySize+len(sig))); err != nil {
+				return 0, err
+			}
+			answer := append([]byte(key.Public().(ed25519.PublicKey)), sig...)
+			if _, err := stream.Write(answer); err != nil {
+				return 0, err
+			}
+		default:
+			return 0, fmt.Errorf("invalid handshake")
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/darkprince558/jend/internal/identity"
+	"github.com/darkprince558/jend/pkg/protocol"
+)
+
+// identityExchange runs the sender's check with the allow list against
+// readOffer over a pipe and returns both sides' errors.
+func identityExchange(t *testing.T, allow ...string) (senderErr, receiverErr error) {
+	t.Helper()
+	sender, receiver := net.Pipe()
+	defer sender.Close()
+	defer receiver.Close()
+	key := []byte("session key from PAKE")
+
+	allowed, err := parseAllowList(allow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := readOffer(receiver, key)
+		done <- err
+	}()
+	if _, senderErr = requireIdentity(sender, key, allowed); senderErr == nil {
+		protocol.EncodeHeader(sender, protocol.TypeHandshake, 0)
+	}
+	return senderErr, <-done
+}
+
+func TestIdentityAllowList(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	key, err := identity.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := identity.Fingerprint(key.Public().(ed25519.PublicKey))
+
+	// Allowed, with or without the SHA256: prefix
+	if s, r := identityExchange(t, strings.TrimPrefix(fp, "SHA256:")); s != nil || r != nil {
+		t.Fatalf("Allowed receiver rejected: sender %v, receiver %v", s, r)
+	}
+
+	// Someone else's fingerprint only
+	other, _, _ := ed25519.GenerateKey(nil)
+	s, r := identityExchange(t, identity.Fingerprint(other))
+	if !errors.Is(s, errNotAllowed) {
+		t.Errorf("Sender error = %v, want errNotAllowed", s)
+	}
+	if r == nil || !strings.Contains(r.Error(), fp) || !errors.Is(r, errSenderCancelled) {
+		t.Errorf("Receiver error = %v, want a cancel naming %s", r, fp)
+	}
+
+	if err := (&SendOptions{Allow: []string{"SHA256:nope"}}).validate(); err == nil {
+		t.Error("Accepted a malformed fingerprint")
+	}
+}
+
+func TestSenderIdentity(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	key, err := identity.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := identity.Fingerprint(key.Public().(ed25519.PublicKey))
+
+	sessionKey := []byte("session key from PAKE")
+	meta := map[string]interface{}{"name": "data.bin"}
+	signOffer(meta, sessionKey)
+	data, _ := json.Marshal(meta)
+	var offer FileMeta
+	if err := json.Unmarshal(data, &offer); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := verifySender(offer, sessionKey, ""); err != nil || got != fp {
+		t.Fatalf("verifySender = %q, %v; want %s", got, err, fp)
+	}
+	// The signature covers the session, so it can't be replayed on another
+	if _, err := verifySender(offer, []byte("another session"), ""); !errors.Is(err, errRefused) {
+		t.Errorf("Replayed signature: %v, want errRefused", err)
+	}
+
+	expected, err := parseExpectedSender(strings.TrimPrefix(fp, "SHA256:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifySender(offer, sessionKey, expected); err != nil {
+		t.Errorf("Expected sender refused: %v", err)
+	}
+	// An older sender signs nothing
+	if _, err := verifySender(FileMeta{Name: "data.bin"}, sessionKey, expected); !errors.Is(err, errRefused) {
+		t.Errorf("Unsigned offer with --expect-sender: %v, want errRefused", err)
+	}
+
+	other, _, _ := ed25519.GenerateKey(nil)
+	if _, err := verifySender(offer, sessionKey, identity.Fingerprint(other)); err == nil || !strings.Contains(err.Error(), fp) {
+		t.Errorf("Other sender: %v, want a refusal naming %s", err, fp)
+	}
+
+	if got, err := verifySender(FileMeta{Name: "data.bin"}, sessionKey, ""); err != nil || got != "" {
+		t.Errorf("Unsigned offer: %q, %v", got, err)
+	}
+	if err := (&ReceiveOptions{ExpectSender: "SHA256:nope"}).validate(); err == nil {
+		t.Error("Accepted a malformed --expect-sender")
+	}
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/darkprince558/jend/internal/ui"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// JSONPrinter is the --json-events Notifier: one JSON object per line, each
+// with an "event" naming it, for scripts that would otherwise scrape Printer's
+// lines:
+//
+//	{"event":"code","code":"7-happy-delta-seven"}   (sender, see Code)
+//	{"event":"link","link":"jend://..."}
+//	{"event":"status","message":"..."}
+//	{"event":"progress","sent":1024,"total":4096,"speed":512,"eta":6}
+//	{"event":"done"}
+//	{"event":"summary","bytes":4096,"elapsed":2.5,"speed":1638.4,"protocol":"QUIC direct","integrity":true}
+//	{"event":"text","message":"..."}
+//	{"event":"attempts","message":"..."}
+//	{"event":"error","message":"..."}
+//
+// Sizes are bytes, speeds bytes per second and times seconds. total is -1
+// while the size is unknown (stdin, --follow). Progress comes at most every
+// Interval, like Printer's; "done" always follows the last byte.
+type JSONPrinter struct {
+	W        io.Writer
+	Interval time.Duration
+
+	mu       sync.Mutex // One whole line at a time
+	progress throttle
+}
+
+type jsonEvent struct {
+	Event   string `json:"event"`
+	Code    string `json:"code,omitempty"`
+	Link    string `json:"link,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type jsonProgress struct {
+	Event string  `json:"event"`
+	Sent  int64   `json:"sent"`
+	Total int64   `json:"total"`
+	Speed float64 `json:"speed"`
+	ETA   float64 `json:"eta,omitempty"`
+	File  string  `json:"file,omitempty"` // For a directory or several files
+}
+
+type jsonSummary struct {
+	Event     string  `json:"event"`
+	Bytes     int64   `json:"bytes"`
+	Elapsed   float64 `json:"elapsed"`
+	Speed     float64 `json:"speed"`
+	Protocol  string  `json:"protocol"`
+	Integrity bool    `json:"integrity"`
+}
+
+// Code reports the code a receiver needs. The sender's caller knows it before
+// anything else happens, so it comes first.
+func (pr *JSONPrinter) Code(code string) {
+	pr.emit(jsonEvent{Event: "code", Code: code})
+}
+
+func (pr *JSONPrinter) Send(msg tea.Msg) {
+	switch m := msg.(type) {
+	case ui.ErrorMsg:
+		pr.emit(jsonEvent{Event: "error", Message: m.Error()})
+	case ui.StatusMsg:
+		pr.emit(jsonEvent{Event: "status", Message: string(m)})
+	case ui.LinkMsg:
+		pr.emit(jsonEvent{Event: "link", Link: string(m)})
+	case ui.TextMsg:
+		pr.emit(jsonEvent{Event: "text", Message: string(m)})
+	case ui.AttemptsMsg:
+		pr.emit(jsonEvent{Event: "attempts", Message: string(m)})
+	case ui.ProgressMsg:
+		if m.TotalBytes > 0 && m.SentBytes == m.TotalBytes {
+			pr.emit(jsonEvent{Event: "done"})
+		} else if pr.progress.due(pr.Interval) {
+			total := m.TotalBytes
+			if total <= 0 {
+				total = -1
+			}
+			pr.emit(jsonProgress{
+				Event: "progress",
+				Sent:  m.SentBytes,
+				Total: total,
+				Speed: m.Speed,
+				ETA:   m.ETA.Seconds(),
+				File:  m.File,
+			})
+		}
+	case ui.SummaryMsg:
+		var speed float64
+		if secs := m.Elapsed.Seconds(); secs > 0 {
+			speed = float64(m.Bytes) / secs
+		}
+		pr.emit(jsonSummary{
+			Event:     "summary",
+			Bytes:     m.Bytes,
+			Elapsed:   m.Elapsed.Seconds(),
+			Speed:     speed,
+			Protocol:  m.Protocol,
+			Integrity: m.Integrity,
+		})
+	}
+}
+
+// emit writes e, one of the json* event types, as a line.
+func (pr *JSONPrinter) emit(e any) {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.W.Write(append(line, '\n'))
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darkprince558/jend/internal/ui"
+)
+
+func TestJSONPrinter(t *testing.T) {
+	var buf bytes.Buffer
+	pr := &JSONPrinter{W: &buf, Interval: time.Hour}
+	pr.Code("7-happy-delta-seven")
+	pr.Send(ui.StatusMsg("Waiting"))
+	pr.Send(ui.ProgressMsg{SentBytes: 1024, TotalBytes: 4096, Speed: 512, ETA: 6 * time.Second})
+	pr.Send(ui.ProgressMsg{SentBytes: 2048, TotalBytes: 4096}) // Within the interval
+	pr.Send(ui.ProgressMsg{SentBytes: 4096, TotalBytes: 4096})
+	pr.Send(ui.SummaryMsg{Bytes: 4096, Elapsed: 2 * time.Second, Protocol: "QUIC direct", Integrity: true})
+	pr.Send(ui.ErrorMsg(errors.New("boom")))
+
+	want := []string{
+		`{"event":"code","code":"7-happy-delta-seven"}`,
+		`{"event":"status","message":"Waiting"}`,
+		`{"event":"progress","sent":1024,"total":4096,"speed":512,"eta":6}`,
+		`{"event":"done"}`,
+		`{"event":"summary","bytes":4096,"elapsed":2,"speed":2048,"protocol":"QUIC direct","integrity":true}`,
+		`{"event":"error","message":"boom"}`,
+	}
+	if got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected\n%s\ngot\n%s", strings.Join(want, "\n"), buf.String())
+	}
+
+	// Unknown size, and text that must survive as JSON
+	buf.Reset()
+	pr = &JSONPrinter{W: &buf, Interval: time.Hour}
+	pr.Send(ui.ProgressMsg{SentBytes: 10, TotalBytes: -1})
+	pr.Send(ui.TextMsg("line one\n\"quoted\""))
+	var events []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e map[string]any
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("Not JSON: %q: %v", line, err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 2 || events[0]["total"] != float64(-1) || events[1]["message"] != "line one\n\"quoted\"" {
+		t.Errorf("Got %v", events)
+	}
+}
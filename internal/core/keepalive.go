@@ -0,0 +1,57 @@
+package core
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/darkprince558/jend/pkg/protocol"
+)
+
+// keepAliveInterval keeps well under the QUIC idle timeout, so a receiver waiting
+// on a long checksum always sees traffic on the stream.
+var keepAliveInterval = 2 * time.Second
+
+// startKeepAlive sends an empty TypeKeepAlive packet on w every keepAliveInterval
+// until stop is called. stop waits for the writer to exit, so the caller owns w
+// again as soon as it returns.
+func startKeepAlive(w io.Writer) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(keepAliveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := protocol.EncodeHeader(w, protocol.TypeKeepAlive, 0); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// readHeader is protocol.DecodeHeader for the receive paths: keepalives (and any
+// payload they carry) are consumed silently and the next real header is returned.
+func readHeader(r io.Reader) (uint8, uint32, error) {
+	for {
+		pType, length, err := protocol.DecodeHeader(r)
+		if err != nil || pType != protocol.TypeKeepAlive {
+			return pType, length, err
+		}
+		if length > 0 {
+			if _, err := io.CopyN(io.Discard, r, int64(length)); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darkprince558/jend/pkg/protocol"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// slowSeeker reads a few bytes at a time with a delay, like hashing a huge file.
+type slowSeeker struct {
+	r *strings.Reader
+}
+
+func (s *slowSeeker) Read(p []byte) (int, error) {
+	time.Sleep(20 * time.Millisecond)
+	if len(p) > 4 {
+		p = p[:4]
+	}
+	return s.r.Read(p)
+}
+
+func (s *slowSeeker) Seek(offset int64, whence int) (int64, error) {
+	return s.r.Seek(offset, whence)
+}
+
+func TestReadHeader_SkipsKeepAlives(t *testing.T) {
+	var buf bytes.Buffer
+	protocol.EncodeHeader(&buf, protocol.TypeKeepAlive, 0)
+	protocol.EncodeHeader(&buf, protocol.TypeKeepAlive, 3) // Payload is ignored too
+	buf.WriteString("xyz")
+	protocol.EncodeHeader(&buf, protocol.TypeHandshake, 2)
+	buf.WriteString("{}")
+
+	pType, length, err := readHeader(&buf)
+	if err != nil || pType != protocol.TypeHandshake || length != 2 {
+		t.Fatalf("Expected handshake header, got type %d len %d err %v", pType, length, err)
+	}
+	if buf.String() != "{}" {
+		t.Errorf("Expected handshake payload to be left unread, got %q", buf.String())
+	}
+}
+
+func TestHandleConnection_KeepAliveWhileHashing(t *testing.T) {
+	defer func(old time.Duration) { keepAliveInterval = old }(keepAliveInterval)
+	keepAliveInterval = 10 * time.Millisecond
+
+	content := "slow to hash"
+	file := &slowSeeker{r: strings.NewReader(content)}
+
+	r, w := io.Pipe()
+	r2, w2 := io.Pipe()
+	senderRW := &readWriter{Reader: r2, Writer: w}
+	receiverRW := &readWriter{Reader: r, Writer: w2}
+
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := handleConnection(context.Background(), senderRW, file, "data.bin",
+			0, int64(len(content)), "", time.Now(), time.Time{}, 0, func(tea.Msg) {}, true, &SendOptions{Code: "code", ChunkSize: ChunkSize})
+		w.Close()
+		errChan <- err
+	}()
+
+	keepAlives := 0
+	for {
+		pType, length, err := protocol.DecodeHeader(receiverRW)
+		if err != nil {
+			t.Fatalf("Stream ended before handshake: %v", err)
+		}
+		if pType == protocol.TypeKeepAlive {
+			keepAlives++
+			continue
+		}
+		if pType != protocol.TypeHandshake {
+			t.Fatalf("Expected handshake after keepalives, got type %d", pType)
+		}
+		io.CopyN(io.Discard, receiverRW, int64(length))
+		break
+	}
+	if keepAlives == 0 {
+		t.Error("Expected keepalives while the sender was hashing")
+	}
+
+	// Refuse the transfer so the sender returns
+	protocol.EncodeHeader(receiverRW, protocol.TypeCancel, 0)
+	w2.Close()
+	<-errChan
+}
@@ -0,0 +1,146 @@
+package core
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darkprince558/jend/pkg/protocol"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const fourGB = int64(4) << 30
+
+// sparseFile creates a file of the given size that takes no real disk space,
+// with marker written at offset.
+func sparseFile(t *testing.T, size int64, offset int64, marker string) *os.File {
+	t.Helper()
+	f, err := os.Create(filepath.Join(t.TempDir(), "large.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	if err := f.Truncate(size); err != nil {
+		t.Skipf("filesystem can't hold a %d byte sparse file: %v", size, err)
+	}
+	if _, err := f.WriteAt([]byte(marker), offset); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// rangeRequest runs handleConnection on file and asks for start+length of the slice.
+func rangeRequest(t *testing.T, file *os.File, base, fileSize, start, length int64) ([]byte, error) {
+	t.Helper()
+	r, w := io.Pipe()
+	r2, w2 := io.Pipe()
+	senderRW := &readWriter{Reader: r2, Writer: w}
+	receiverRW := &readWriter{Reader: r, Writer: w2}
+
+	errChan := make(chan error, 1)
+	go func() {
+		// RunSender passes its precomputed hash; don't read 4GB of zeros here
+		_, err := handleConnection(context.Background(), senderRW, file, "large.bin",
+			base, fileSize, "precomputed", time.Now(), time.Time{}, 0, func(tea.Msg) {}, true, &SendOptions{Code: "code", ChunkSize: ChunkSize})
+		w.Close()
+		errChan <- err
+	}()
+
+	pType, l, err := protocol.DecodeHeader(receiverRW)
+	if err != nil || pType != protocol.TypeHandshake {
+		t.Fatalf("Expected handshake, got type %d err %v", pType, err)
+	}
+	metaBytes := make([]byte, l)
+	io.ReadFull(receiverRW, metaBytes)
+	var meta FileMeta
+	json.Unmarshal(metaBytes, &meta)
+	if meta.Size != fileSize-base {
+		t.Errorf("Expected handshake size %d, got %d", fileSize-base, meta.Size)
+	}
+
+	protocol.EncodeHeader(receiverRW, protocol.TypeRangeReq, 16)
+	binary.Write(receiverRW, binary.LittleEndian, start)
+	binary.Write(receiverRW, binary.LittleEndian, length)
+
+	var got []byte
+	for {
+		pType, l, err := protocol.DecodeHeader(receiverRW)
+		if err != nil {
+			break
+		}
+		buf := make([]byte, l)
+		io.ReadFull(receiverRW, buf)
+		if pType == protocol.TypeData {
+			got = append(got, buf...)
+		}
+	}
+	return got, <-errChan
+}
+
+func TestHandleConnection_RangePast4GB(t *testing.T) {
+	// The slice starts just below 4GB so only 9MB gets hashed, but the requested
+	// range lands past the 4GB mark in the underlying file.
+	base := fourGB - 1<<20
+	fileSize := fourGB + 8<<20
+	markerAt := fourGB + 12345
+	f := sparseFile(t, fileSize, markerAt, "past-4gb")
+
+	got, err := rangeRequest(t, f, base, fileSize, markerAt-base, 8)
+	if err != nil {
+		t.Fatalf("handleConnection failed: %v", err)
+	}
+	if string(got) != "past-4gb" {
+		t.Errorf("Expected marker, got %q", got)
+	}
+}
+
+func TestHandleConnection_RejectsBadRange(t *testing.T) {
+	f := sparseFile(t, 1024, 0, "x")
+
+	for _, tc := range []struct{ start, length int64 }{
+		{-1, 10},
+		{0, -1},
+		{1000, 100}, // runs past the end
+		{1, 1<<63 - 1},
+	} {
+		_, err := rangeRequest(t, f, 0, 1024, tc.start, tc.length)
+		if err == nil || !strings.Contains(err.Error(), "invalid range request") {
+			t.Errorf("range %d+%d: expected invalid range error, got %v", tc.start, tc.length, err)
+		}
+	}
+}
+
+func TestLoadOrInitState_LargeFile(t *testing.T) {
+	metaPath := filepath.Join(t.TempDir(), "large.meta")
+	totalSize := 6*fourGB + 3 // Not divisible by the chunk count
+
+	state, err := loadOrInitState(metaPath, totalSize, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := loadOrInitState(metaPath, totalSize, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var next int64
+	for i, c := range reloaded.Chunks {
+		if c != state.Chunks[i] {
+			t.Errorf("Chunk %d changed across reload: %+v vs %+v", i, c, state.Chunks[i])
+		}
+		if c.Start != next {
+			t.Errorf("Chunk %d starts at %d, expected %d", i, c.Start, next)
+		}
+		next = c.Start + c.Length
+	}
+	if next != totalSize {
+		t.Errorf("Chunks cover %d bytes, expected %d", next, totalSize)
+	}
+}
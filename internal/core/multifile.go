@@ -0,0 +1,235 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// maxManifestFiles bounds a multi-file session, so a hostile handshake can't make
+// the receiver open an unbounded number of .partial files.
+const maxManifestFiles = 10000
+
+// ManifestEntry describes one file of a multi-file session ("type": "multi").
+type ManifestEntry struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	Hash    string `json:"hash"`
+	Mode    uint32 `json:"mode,omitempty"`    // Permission bits, see preserveAttrs
+	ModTime int64  `json:"mtime,omitempty"`   // Unix nanoseconds
+	CopyOf  string `json:"copy_of,omitempty"` // Earlier entry with the same content; no data of its own in the stream
+}
+
+// multiFile presents several files as one seekable stream, back to back, so
+// offsets, resume and keepalives work exactly as for a single file. The data
+// loop in handleConnection caps reads at file boundaries and marks each one with
+// TypeFileStart.
+type multiFile struct {
+	files    []*os.File
+	infos    []os.FileInfo
+	starts   []int64 // Offset of each file in the stream; starts[len(files)] is the total size
+	manifest []ManifestEntry
+	pos      int64 // For Read/Seek
+}
+
+// openMultiFile opens regular files for one session. Names in the manifest are
+// sanitized base names, made unique with a " (N)" suffix.
+func openMultiFile(paths []string) (*multiFile, error) {
+	if len(paths) > maxManifestFiles {
+		return nil, fmt.Errorf("too many files (%d, at most %d per session)", len(paths), maxManifestFiles)
+	}
+	m := &multiFile{starts: []int64{0}}
+	used := make(map[string]bool)
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		if !info.Mode().IsRegular() {
+			m.Close()
+			return nil, fmt.Errorf("%s is not a regular file (send directories on their own, they are archived)", p)
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		m.files = append(m.files, f)
+		m.infos = append(m.infos, info)
+		m.starts = append(m.starts, m.starts[len(m.starts)-1]+info.Size())
+
+		// The receiver only accepts names that are already sanitized
+		base := sanitizeFilename(info.Name())
+		name := base
+		for n := 1; used[name]; n++ {
+			name = numberedName(base, n)
+		}
+		used[name] = true
+		m.manifest = append(m.manifest, ManifestEntry{Name: name, Size: info.Size(), Mode: uint32(info.Mode().Perm()), ModTime: info.ModTime().UnixNano()})
+	}
+	return m, nil
+}
+
+// hashFiles fills in the manifest hashes, from the hash cache where possible,
+// and marks files with the same content as an earlier one as its copies, so
+// their data goes out once. It returns the session hash: the SHA-256 of the
+// manifest, which covers every file through its own hash.
+func (m *multiFile) hashFiles() (string, error) {
+	for i, f := range m.files {
+		if h, ok := cachedFileHash(f.Name(), m.infos[i], 0); ok {
+			m.manifest[i].Hash = h
+			continue
+		}
+		h, err := hashFrom(f, 0)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", f.Name(), err)
+		}
+		storeFileHash(f.Name(), m.infos[i], 0, h)
+		m.manifest[i].Hash = h
+	}
+	m.dedupe()
+	return manifestHash(m.manifest), nil
+}
+
+// dedupe points every file whose content was already seen at its first
+// occurrence and lays the stream out again without the copies.
+func (m *multiFile) dedupe() {
+	first := make(map[string]string) // Hash -> name of the first file with it
+	m.starts = m.starts[:1]
+	for i := range m.manifest {
+		e := &m.manifest[i]
+		size := e.Size
+		if size > 0 {
+			if name, ok := first[e.Hash]; ok {
+				e.CopyOf = name
+				size = 0
+			} else {
+				first[e.Hash] = e.Name
+			}
+		}
+		m.starts = append(m.starts, m.starts[i]+size)
+	}
+}
+
+// duplicates counts the copies in the manifest and the bytes they save.
+func (m *multiFile) duplicates() (int, int64) {
+	var n int
+	var saved int64
+	for _, e := range m.manifest {
+		if e.CopyOf != "" {
+			n++
+			saved += e.Size
+		}
+	}
+	return n, saved
+}
+
+func manifestHash(manifest []ManifestEntry) string {
+	data, _ := json.Marshal(manifest)
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+func (m *multiFile) size() int64 { return m.starts[len(m.starts)-1] }
+
+// locate returns the file holding stream offset pos and how many of its bytes
+// are left from there. Empty files hold no bytes and are never returned.
+func (m *multiFile) locate(pos int64) (int, int64) {
+	i := sort.Search(len(m.files), func(i int) bool { return m.starts[i+1] > pos })
+	if i == len(m.files) {
+		return i, 0
+	}
+	return i, m.starts[i+1] - pos
+}
+
+func (m *multiFile) fileAt(pos int64) (string, int, int) {
+	i, _ := m.locate(pos)
+	if i == len(m.files) {
+		i-- // At the end: the last file went out
+	}
+	return m.manifest[i].Name, i + 1, len(m.files)
+}
+
+func (m *multiFile) ReadAt(p []byte, off int64) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		i, left := m.locate(off)
+		if i == len(m.files) {
+			return total, io.EOF
+		}
+		chunk := p
+		if int64(len(chunk)) > left {
+			chunk = chunk[:left]
+		}
+		n, err := m.files[i].ReadAt(chunk, off-m.starts[i])
+		total += n
+		off += int64(n)
+		p = p[n:]
+		if err != nil && err != io.EOF {
+			return total, err
+		}
+		if n < len(chunk) {
+			// The file is shorter than when we opened it
+			return total, io.ErrUnexpectedEOF
+		}
+	}
+	return total, nil
+}
+
+func (m *multiFile) Read(p []byte) (int, error) {
+	n, err := m.ReadAt(p, m.pos)
+	m.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (m *multiFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += m.pos
+	case io.SeekEnd:
+		offset += m.size()
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative position")
+	}
+	m.pos = offset
+	return offset, nil
+}
+
+// changed is fileChanged for every file in the session.
+func (m *multiFile) changed() bool {
+	for i, f := range m.files {
+		if fileChanged(f, m.infos[i].Size(), m.infos[i].ModTime()) {
+			return true
+		}
+	}
+	return false
+}
+
+// modTime is the newest modtime in the session, so the change check is armed.
+func (m *multiFile) modTime() time.Time {
+	var newest time.Time
+	for _, info := range m.infos {
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	return newest
+}
+
+func (m *multiFile) Close() error {
+	for _, f := range m.files {
+		f.Close()
+	}
+	return nil
+}
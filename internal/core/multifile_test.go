@@ -0,0 +1,226 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darkprince558/jend/pkg/protocol"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// writeFiles creates name -> content files under dir and returns their paths in order.
+func writeFiles(t *testing.T, dir string, files [][2]string) []string {
+	t.Helper()
+	var paths []string
+	for _, f := range files {
+		path := filepath.Join(dir, f[0])
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(f[1]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// transferMulti runs handleConnection on a multi-file source against receiveMulti
+// with opts and returns the receiver's error.
+func transferMulti(t *testing.T, paths []string, opts *ReceiveOptions, chunkSize int) error {
+	t.Helper()
+	mf, err := openMultiFile(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mf.Close()
+	hash, err := mf.hashFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, w := io.Pipe()
+	r2, w2 := io.Pipe()
+	senderRW := &readWriter{Reader: r2, Writer: w}
+	receiverRW := &readWriter{Reader: r, Writer: w2}
+
+	go func() {
+		handleConnection(context.Background(), senderRW, mf, "files",
+			0, mf.size(), hash, time.Now(), mf.modTime(), 0, func(tea.Msg) {}, true, &SendOptions{Code: "code", ChunkSize: chunkSize})
+		w.Close()
+	}()
+
+	pType, l, err := protocol.DecodeHeader(receiverRW)
+	if err != nil || pType != protocol.TypeHandshake {
+		t.Fatalf("Expected handshake, got type %d err %v", pType, err)
+	}
+	metaBytes := make([]byte, l)
+	io.ReadFull(receiverRW, metaBytes)
+	var meta FileMeta
+	if err := json.Unmarshal(metaBytes, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Type != "multi" || len(meta.Files) != len(paths) {
+		t.Fatalf("Expected a multi handshake with %d files, got %+v", len(paths), meta)
+	}
+
+	var saved receivedFile
+	_, _, _, err = receiveMulti(context.Background(), nil, receiverRW, meta, opts, func(tea.Msg) {}, "QUIC direct", &saved)
+	r2.Close()
+	return err
+}
+
+func TestMultiFileTransfer(t *testing.T) {
+	hashCachePathOverride = filepath.Join(t.TempDir(), "hash")
+	defer func() { hashCachePathOverride = "" }()
+
+	src := t.TempDir()
+	paths := writeFiles(t, src, [][2]string{
+		{"a.txt", strings.Repeat("a", 100)},
+		{"empty.txt", ""},
+		{"b.txt", strings.Repeat("b", 37)},
+		{"other/a.txt", "second a"},
+	})
+	mtime := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	os.Chtimes(paths[0], mtime, mtime)
+	os.Chmod(paths[2], 0755)
+	out := t.TempDir()
+	// A chunk size that never lines up with a file boundary
+	if err := transferMulti(t, paths, &ReceiveOptions{OutputDir: out}, 16); err != nil {
+		t.Fatalf("Transfer failed: %v", err)
+	}
+
+	want := map[string]string{
+		"a.txt":     strings.Repeat("a", 100),
+		"empty.txt": "",
+		"b.txt":     strings.Repeat("b", 37),
+		"a (1).txt": "second a",
+	}
+	for name, content := range want {
+		got, err := os.ReadFile(filepath.Join(out, name))
+		if err != nil {
+			t.Errorf("Missing %s: %v", name, err)
+			continue
+		}
+		if string(got) != content {
+			t.Errorf("%s: expected %q, got %q", name, content, got)
+		}
+	}
+	if partials, _ := filepath.Glob(filepath.Join(out, "*.partial")); len(partials) != 0 {
+		t.Errorf("Expected no partials left, got %v", partials)
+	}
+	if info, err := os.Stat(filepath.Join(out, "a.txt")); err == nil && !info.ModTime().Equal(mtime) {
+		t.Errorf("Expected a.txt to keep its modtime %v, got %v", mtime, info.ModTime())
+	}
+	if info, err := os.Stat(filepath.Join(out, "b.txt")); err == nil && info.Mode().Perm() != 0755 {
+		t.Errorf("Expected b.txt to keep mode 0755, got %v", info.Mode())
+	}
+}
+
+// TestMultiFileResume picks up after a complete first file and half of the second.
+func TestMultiFileResume(t *testing.T) {
+	hashCachePathOverride = filepath.Join(t.TempDir(), "hash")
+	defer func() { hashCachePathOverride = "" }()
+
+	src := t.TempDir()
+	paths := writeFiles(t, src, [][2]string{
+		{"one.bin", strings.Repeat("1", 50)},
+		{"two.bin", strings.Repeat("2", 50)},
+		{"three.bin", strings.Repeat("3", 50)},
+	})
+	out := t.TempDir()
+	os.WriteFile(filepath.Join(out, "one.bin.partial"), []byte(strings.Repeat("1", 50)), 0644)
+	os.WriteFile(filepath.Join(out, "two.bin.partial"), []byte(strings.Repeat("2", 20)), 0644)
+
+	mf, _ := openMultiFile(paths)
+	hash, _ := mf.hashFiles()
+	mf.Close()
+	meta := FileMeta{Size: 150, Hash: hash, Type: "multi", Files: mf.manifest}
+	if got := multiResumeOffset(meta, out); got != 70 {
+		t.Errorf("Expected resume offset 70, got %d", got)
+	}
+
+	if err := transferMulti(t, paths, &ReceiveOptions{OutputDir: out}, ChunkSize); err != nil {
+		t.Fatalf("Resumed transfer failed: %v", err)
+	}
+	for i, name := range []string{"one.bin", "two.bin", "three.bin"} {
+		got, _ := os.ReadFile(filepath.Join(out, name))
+		if string(got) != strings.Repeat(string(rune('1'+i)), 50) {
+			t.Errorf("%s: got %q", name, got)
+		}
+	}
+}
+
+// TestMultiFileDuplicates sends identical files once and copies (or links) them on arrival.
+func TestMultiFileDuplicates(t *testing.T) {
+	hashCachePathOverride = filepath.Join(t.TempDir(), "hash")
+	defer func() { hashCachePathOverride = "" }()
+
+	src := t.TempDir()
+	dup := strings.Repeat("d", 64)
+	paths := writeFiles(t, src, [][2]string{
+		{"one.bin", dup},
+		{"other.bin", "other"},
+		{"two.bin", dup},
+		{"sub/one.bin", dup},
+	})
+
+	mf, _ := openMultiFile(paths)
+	mf.hashFiles()
+	mf.Close()
+	if got := mf.size(); got != int64(len(dup)+len("other")) {
+		t.Errorf("Expected duplicates to take no room in the stream, got %d bytes", got)
+	}
+	if n, saved := mf.duplicates(); n != 2 || saved != 128 {
+		t.Errorf("Expected 2 duplicates saving 128 bytes, got %d and %d", n, saved)
+	}
+	if mf.manifest[2].CopyOf != "one.bin" || mf.manifest[3].CopyOf != "one.bin" {
+		t.Errorf("Expected copies of one.bin, got %+v", mf.manifest)
+	}
+
+	for _, link := range []bool{false, true} {
+		out := t.TempDir()
+		if err := transferMulti(t, paths, &ReceiveOptions{OutputDir: out, Hardlink: link}, 16); err != nil {
+			t.Fatalf("Transfer (hardlink %v) failed: %v", link, err)
+		}
+		first, _ := os.Stat(filepath.Join(out, "one.bin"))
+		for _, name := range []string{"one.bin", "two.bin", "one (1).bin"} {
+			got, _ := os.ReadFile(filepath.Join(out, name))
+			if string(got) != dup {
+				t.Errorf("%s (hardlink %v): got %q", name, link, got)
+			}
+			info, err := os.Stat(filepath.Join(out, name))
+			if err == nil && first != nil && os.SameFile(first, info) != (link || name == "one.bin") {
+				t.Errorf("%s (hardlink %v): expected linked = %v", name, link, link)
+			}
+		}
+	}
+}
+
+func TestValidateManifestRejectsPaths(t *testing.T) {
+	for _, name := range []string{"../evil", "dir/file", `dir\file`, "..", ""} {
+		files := []ManifestEntry{{Name: name, Size: 1}}
+		meta := FileMeta{Size: 1, Hash: manifestHash(files), Type: "multi", Files: files}
+		if err := validateManifest(meta); err == nil {
+			t.Errorf("Expected %q to be rejected", name)
+		}
+	}
+	files := []ManifestEntry{{Name: "a", Size: 1}, {Name: "a", Size: 1}}
+	if err := validateManifest(FileMeta{Size: 2, Hash: manifestHash(files), Files: files}); err == nil {
+		t.Error("Expected duplicate names to be rejected")
+	}
+	for _, files := range [][]ManifestEntry{
+		{{Name: "a", Size: 1, CopyOf: "b"}, {Name: "b", Size: 1}}, // Not earlier
+		{{Name: "a", Size: 1, Hash: "x"}, {Name: "b", Size: 1, Hash: "y", CopyOf: "a"}},
+		{{Name: "a", Size: 1}, {Name: "b", Size: 1, CopyOf: "a"}, {Name: "c", Size: 1, CopyOf: "b"}},
+	} {
+		if err := validateManifest(FileMeta{Size: 1, Hash: manifestHash(files), Files: files}); err == nil {
+			t.Errorf("Expected bad copy in %+v to be rejected", files)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/darkprince558/jend/internal/audit"
+	"github.com/darkprince558/jend/internal/ui"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Notifier receives what a transfer has to report: ui.StatusMsg, ui.ProgressMsg,
+// ui.ErrorMsg, ui.AttemptsMsg, ui.TextMsg, ui.LinkMsg and ui.SummaryMsg. *tea.Program is one; pkg/jend
+// turns them into Events, and a JSONPrinter into lines of JSON (--json-events).
+// A nil Notifier means headless: a Printer on stdout (stderr for receive
+// --stdout) with DefaultProgressInterval.
+type Notifier interface {
+	Send(msg tea.Msg)
+}
+
+// DefaultProgressInterval spaces headless "Progress:" lines (--progress-interval).
+const DefaultProgressInterval = 2 * time.Second
+
+// Printer is the headless Notifier: one line per status or error, a
+// "Progress:" line every Interval while data moves, "Done!" when the transfer
+// completes and a "Summary:" line once the file is saved. AttemptsMsg is left
+// to the caller, which prints the fallback chain once on the way out.
+type Printer struct {
+	W  io.Writer
+	QR bool // Print the sender's link as a QR code as well
+
+	// Interval is the least time between "Progress:" lines, however often
+	// progress arrives, so a piped log grows by a line per Interval at most.
+	// 0 prints none.
+	Interval time.Duration
+
+	progress throttle
+}
+
+func (pr *Printer) Send(msg tea.Msg) {
+	switch m := msg.(type) {
+	case ui.ErrorMsg:
+		fmt.Fprintln(pr.W, "Error:", m)
+	case ui.StatusMsg:
+		fmt.Fprintln(pr.W, "Status:", m)
+	case ui.LinkMsg:
+		fmt.Fprintln(pr.W, "Link:", m)
+		if pr.QR {
+			if qr, err := ui.ViewQR(string(m)); err == nil {
+				fmt.Fprintln(pr.W, qr)
+			}
+		}
+	case ui.TextMsg:
+		fmt.Fprintf(pr.W, "\nReceived Text:\n%s\n", m)
+	case ui.ProgressMsg:
+		if m.TotalBytes > 0 && m.SentBytes == m.TotalBytes {
+			fmt.Fprintln(pr.W, "Done!")
+		} else if pr.progress.due(pr.Interval) {
+			fmt.Fprintln(pr.W, "Progress:", progressLine(m))
+		}
+	case ui.SummaryMsg:
+		fmt.Fprintln(pr.W, "Summary:", m)
+	}
+}
+
+// throttle spaces out progress reports. Parallel streams report concurrently.
+type throttle struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// due reports whether interval has passed since the last report, and if so
+// starts the next one. An interval of 0 is never due.
+func (t *throttle) due(interval time.Duration) bool {
+	if interval <= 0 {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if now.Sub(t.last) < interval {
+		return false
+	}
+	t.last = now
+	return true
+}
+
+// progressLine is e.g. "45% (450.0 MB/1.0 GB) 12.3 MB/s, 1m20s left"; without
+// a total (stdin, --follow) just the bytes and speed.
+func progressLine(m ui.ProgressMsg) string {
+	speed := audit.FormatBytes(int64(m.Speed)) + "/s"
+	if m.TotalBytes <= 0 {
+		return fmt.Sprintf("%s %s", audit.FormatBytes(m.SentBytes), speed)
+	}
+	line := fmt.Sprintf("%d%% (%s/%s) %s", m.SentBytes*100/m.TotalBytes,
+		audit.FormatBytes(m.SentBytes), audit.FormatBytes(m.TotalBytes), speed)
+	if m.ETA > 0 {
+		line += fmt.Sprintf(", %s left", m.ETA.Round(time.Second))
+	}
+	return line
+}
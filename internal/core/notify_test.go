@@ -0,0 +1,83 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darkprince558/jend/internal/ui"
+)
+
+func TestPrinter(t *testing.T) {
+	var buf bytes.Buffer
+	pr := &Printer{W: &buf}
+	pr.Send(ui.StatusMsg("Waiting"))
+	pr.Send(ui.ProgressMsg{SentBytes: 1, TotalBytes: 2})
+	pr.Send(ui.ProgressMsg{SentBytes: 2, TotalBytes: 2})
+	pr.Send(ui.ErrorMsg(errors.New("boom")))
+	pr.Send(ui.AttemptsMsg("left to the caller"))
+	pr.Send(ui.SummaryMsg{Bytes: 2 << 20, Elapsed: time.Second, Protocol: "QUIC direct", Integrity: true})
+
+	want := "Status: Waiting\nDone!\nError: boom\nSummary: 2097152 bytes in 1s (2.00 MB/s) via QUIC direct, integrity passed\n"
+	if buf.String() != want {
+		t.Errorf("Expected %q, got %q", want, buf.String())
+	}
+}
+
+// TestRunReceiverReturnsError runs the receiver's failure path in-process: it
+// must return the error and print only to the Printer it was given.
+func TestRunReceiverReturnsError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var buf bytes.Buffer
+	err := RunReceiver(ctx, &Printer{W: &buf}, ReceiveOptions{
+		Code:              "no-such-code",
+		OutputDir:         t.TempDir(),
+		NoClipboard:       true,
+		NoHistory:         true,
+		Concurrency:       1,
+		ParallelThreshold: DefaultParallelThreshold,
+		MaxAttempts:       1,
+		LANOnly:           true,
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if !strings.Contains(buf.String(), "Status: LAN-only mode") {
+		t.Errorf("Expected status lines on the Printer, got %q", buf.String())
+	}
+}
+
+func TestPrinterProgress(t *testing.T) {
+	var buf bytes.Buffer
+	pr := &Printer{W: &buf, Interval: time.Hour}
+	pr.Send(ui.ProgressMsg{SentBytes: 450 << 20, TotalBytes: 1 << 30, Speed: 12.5 * (1 << 20), ETA: 46 * time.Second})
+	// However fast progress comes, one line per interval
+	for i := range 100 {
+		pr.Send(ui.ProgressMsg{SentBytes: 451<<20 + int64(i), TotalBytes: 1 << 30})
+	}
+	want := "Progress: 43% (450.0 MB/1.0 GB) 12.5 MB/s, 46s left\n"
+	if buf.String() != want {
+		t.Errorf("Expected %q, got %q", want, buf.String())
+	}
+
+	// Unknown size (stdin, --follow)
+	buf.Reset()
+	(&Printer{W: &buf, Interval: time.Hour}).Send(ui.ProgressMsg{SentBytes: 2048, Speed: 1024})
+	if want := "Progress: 2.0 KB 1.0 KB/s\n"; buf.String() != want {
+		t.Errorf("Expected %q, got %q", want, buf.String())
+	}
+
+	// No interval, no progress lines; completion still prints
+	buf.Reset()
+	quiet := &Printer{W: &buf}
+	quiet.Send(ui.ProgressMsg{SentBytes: 1, TotalBytes: 2})
+	quiet.Send(ui.ProgressMsg{SentBytes: 2, TotalBytes: 2})
+	if buf.String() != "Done!\n" {
+		t.Errorf("Expected only Done!, got %q", buf.String())
+	}
+}
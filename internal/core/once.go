@@ -0,0 +1,54 @@
+package core
+
+import (
+	"sort"
+	"sync"
+)
+
+// span is a byte range [start, end) of the offered slice.
+type span struct {
+	start, end int64
+}
+
+// coverage collects the spans a sender has served, across streams and
+// reconnects, so --once can tell a finished transfer from a dropped one that
+// the receiver is about to resume. Safe for concurrent use by parallel streams.
+type coverage struct {
+	mu    sync.Mutex
+	spans []span // Sorted and merged
+	any   bool   // A stream ran to completion, for empty payloads
+}
+
+func (c *coverage) add(s span) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.any = true
+	if s.end <= s.start {
+		return
+	}
+	spans := append(c.spans, s)
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	merged := spans[:1]
+	for _, next := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if next.start <= last.end {
+			last.end = max(last.end, next.end)
+			continue
+		}
+		merged = append(merged, next)
+	}
+	c.spans = merged
+}
+
+// complete reports whether every byte of [0, size) has been sent.
+func (c *coverage) complete(size int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.any {
+		return false
+	}
+	if size <= 0 {
+		return true
+	}
+	return len(c.spans) == 1 && c.spans[0].start <= 0 && c.spans[0].end >= size
+}
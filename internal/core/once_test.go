@@ -0,0 +1,40 @@
+package core
+
+import "testing"
+
+func TestCoverage(t *testing.T) {
+	var c coverage
+	if c.complete(0) {
+		t.Error("Nothing served yet, but complete")
+	}
+
+	// A dropped sequential send, then the resume from where it stopped
+	c.add(span{0, 400})
+	if c.complete(1000) {
+		t.Error("Complete after 400 of 1000 bytes")
+	}
+	c.add(span{400, 1000})
+	if !c.complete(1000) {
+		t.Error("Not complete after a resume covered the rest")
+	}
+
+	// Parallel ranges out of order, overlapping, with a gap until the last one
+	var p coverage
+	for _, s := range []span{{750, 1000}, {0, 250}, {200, 500}} {
+		p.add(s)
+	}
+	if p.complete(1000) {
+		t.Error("Complete with 500-750 missing")
+	}
+	p.add(span{500, 750})
+	if !p.complete(1000) {
+		t.Errorf("Not complete: %+v", p.spans)
+	}
+
+	// An empty payload is complete once any stream finished
+	var e coverage
+	e.add(span{0, 0})
+	if !e.complete(0) {
+		t.Error("Empty payload not complete")
+	}
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/darkprince558/jend/internal/discovery"
+	"github.com/darkprince558/jend/internal/transport"
+)
+
+// SendOptions configures RunSender. Zero values are "off" or "no limit"; the
+// CLI and pkg/jend fill in their defaults before calling.
+type SendOptions struct {
+	Paths  []string // Several are sent in one session, under a manifest (see multifile.go)
+	Text   string
+	IsText bool
+	Code   string
+
+	Timeout     time.Duration // How long to wait for a receiver
+	MaxDuration time.Duration // Bounds each transfer once its receiver has connected (0 = no limit)
+	ForceTar    bool
+	ForceZip    bool
+	Compress    CompressOptions
+	Follow      bool  // Stream a growing file until cancelled
+	SinceOffset int64 // With Follow, start this far into the file
+	ChunkSize   int
+	NoHistory   bool
+	Rate        int64 // Caps the bytes per second across all receivers and streams (0 = unlimited)
+
+	// DryRun stops after the payload is prepared and hashed: it reports what
+	// would be sent, never listens, and leaves no audit entry.
+	DryRun bool
+
+	// Port is the direct listener's UDP port (0 = any free one) and Bind its IP
+	// ("" = every interface); discovery advertises whichever address was bound.
+	Port  int
+	Bind  string
+	NoTCP bool // No TCP listener for receivers whose network blocks UDP
+
+	// Once exits after the first complete transfer instead of serving the code
+	// to more receivers; a transfer that drops and resumes still counts as one.
+	// A followed file never completes, so it can't be combined with Follow.
+	Once bool
+
+	ICE     *transport.ICEConfig
+	LANOnly bool
+
+	// Argon is the Argon2id cost of the code check, advertised to receivers
+	// (zero = DefaultArgonParams), and Cipher the stream cipher asked for.
+	Argon  ArgonParams
+	Cipher Cipher
+
+	// Allow restricts who may receive to these key fingerprints (see
+	// identity.Fingerprint); empty lets anyone who knows the code in.
+	Allow []string
+
+	// Session, if not nil, is saved once the payload is hashed and kept up to
+	// date until RunSender returns, when it is removed (see SenderSession).
+	Session *SenderSession
+}
+
+// ReceiveOptions configures RunReceiver. Zero values are "off" or "no limit";
+// the CLI and pkg/jend fill in their defaults before calling.
+type ReceiveOptions struct {
+	Code string
+	Hint string // The sender's "host:port" from a jend:// link, dialed before discovery ("" = none)
+
+	OutputDir   string
+	OutputName  string // Replaces the sender's file name
+	Force       bool   // Overwrite instead of adding " (N)"
+	NoPreserve  bool   // Skip restoring the sender's permission bits and modtime
+	Unzip       bool
+	NoClipboard bool
+	Stdout      bool // Write the payload to stdout; status goes to stderr
+	NoHistory   bool
+	Fresh       bool // Discard partial downloads instead of resuming
+	Delta       bool // Ask for only the changes when an older version of the file is already there
+	Hardlink    bool // Save files the sender marked as copies of another (see ManifestEntry.CopyOf) as hard links to it
+
+	Concurrency       int
+	ParallelThreshold int64
+	MaxAttempts       int
+	Rate              int64 // Caps the bytes per second read across all streams (0 = unlimited)
+
+	// MaxSize refuses offers larger than this many bytes (0 = no limit); offers
+	// that won't fit on disk are refused too.
+	MaxSize int64
+	// TextLimit refuses text snippets larger than this (0 = no limit). Text is
+	// held in memory until it is shown or saved; see DefaultTextLimit.
+	TextLimit int64
+
+	// Confirm asks the user (via ui.ConfirmMsg) before accepting the offer;
+	// saying no cancels the sender and RunReceiver returns nil.
+	Confirm bool
+
+	ICE     *transport.ICEConfig
+	LANOnly bool
+	IPPref  discovery.IPPreference
+
+	Cipher Cipher // The stream cipher asked for; the sender has a say too
+
+	// ExpectSender refuses a sender whose handshake isn't signed by the key
+	// with this fingerprint, and discovery skips senders publishing another
+	// key. Empty accepts any sender that knows the code.
+	ExpectSender string
+}
+
+// validate checks the settings RunSender can't tell are wrong until a receiver
+// connects.
+func (o *SendOptions) validate() error {
+	if o.Once && o.Follow {
+		return fmt.Errorf("--once cannot be combined with --follow, which never completes")
+	}
+	if o.Argon != (ArgonParams{}) {
+		if err := o.Argon.Validate(); err != nil {
+			return err
+		}
+	}
+	if _, err := parseAllowList(o.Allow); err != nil {
+		return fmt.Errorf("--allow: %w", err)
+	}
+	return o.Cipher.validate()
+}
+
+// pake returns the sender's handshake settings.
+func (o *SendOptions) pake() PAKEOptions {
+	return PAKEOptions{Argon: o.Argon, Cipher: o.Cipher}
+}
+
+// validate checks the settings RunReceiver can't tell are wrong until it has
+// found a sender.
+func (o *ReceiveOptions) validate() error {
+	if _, err := parseExpectedSender(o.ExpectSender); err != nil {
+		return fmt.Errorf("--expect-sender: %w", err)
+	}
+	return o.Cipher.validate()
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/darkprince558/jend/internal/ui"
+
+	"github.com/atotto/clipboard"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// availablePath returns outputDir/name, or the first "name (N).ext" that
+// doesn't exist yet.
+func availablePath(outputDir, name string) string {
+	finalPath := filepath.Join(outputDir, name)
+	for counter := 1; ; counter++ {
+		if _, err := os.Stat(finalPath); os.IsNotExist(err) {
+			return finalPath
+		}
+		finalPath = filepath.Join(outputDir, numberedName(name, counter))
+	}
+}
+
+// savePath is where a finished download goes: outputDir/name, replacing any
+// existing file with --force, otherwise the next free " (N)" name.
+func savePath(outputDir, name string, force bool) string {
+	if force {
+		return filepath.Join(outputDir, name)
+	}
+	return availablePath(outputDir, name)
+}
+
+// deliverText hands over a received snippet: saved to a file with --output,
+// otherwise shown and copied to the clipboard. It returns
+// handleReceiveSession's results.
+func deliverText(content, outputDir, outputName string, force, noClipboard bool, sendMsg func(tea.Msg), saved *receivedFile, size int64, hash string) (bool, int64, string, error) {
+	if outputName != "" {
+		return saveText(content, outputDir, outputName, force, sendMsg, saved, size, hash)
+	}
+	sendMsg(ui.TextMsg(content))
+	switch {
+	case noClipboard:
+		sendMsg(ui.StatusMsg("Clipboard copy skipped (--no-clipboard)"))
+	case clipboard.WriteAll(content) == nil:
+		sendMsg(ui.StatusMsg("Text copied to clipboard!"))
+	default:
+		sendMsg(ui.StatusMsg("Failed to copy to clipboard"))
+	}
+	return true, size, hash, nil
+}
+
+// saveText writes a received snippet to a file (receive --output) instead of
+// showing it. It returns handleReceiveSession's results.
+func saveText(content, outputDir, name string, force bool, sendMsg func(tea.Msg), saved *receivedFile, size int64, hash string) (bool, int64, string, error) {
+	path := savePath(outputDir, name, force)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return false, size, "", fmt.Errorf("failed to save text: %v", err)
+	}
+	saved.Name = filepath.Base(path)
+	saved.Path, _ = filepath.Abs(path)
+	sendMsg(ui.StatusMsg("Text saved to: " + saved.Name))
+	return true, size, hash, nil
+}
+
+// preserveAttrs restores the sender's permission bits and modtime on a saved
+// file. Only the permission bits are applied, without group/other write:
+// setuid, setgid and world-writable files are never recreated as such.
+// Zero values were not advertised and are left alone.
+func preserveAttrs(path string, mode uint32, mtime int64) error {
+	if mode != 0 {
+		if err := os.Chmod(path, os.FileMode(mode).Perm()&^0o022); err != nil {
+			return err
+		}
+	}
+	if mtime != 0 {
+		// A zero access time leaves it unchanged
+		if err := os.Chtimes(path, time.Time{}, time.Unix(0, mtime)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreAttrs is preserveAttrs for the receive paths: skipped with
+// --no-preserve, and a failure is only a warning since the data is saved.
+func restoreAttrs(path string, mode uint32, mtime int64, noPreserve bool, sendMsg func(tea.Msg)) {
+	if noPreserve {
+		return
+	}
+	if err := preserveAttrs(path, mode, mtime); err != nil {
+		sendMsg(ui.StatusMsg(fmt.Sprintf("Warning: could not restore permissions or modtime: %v", err)))
+	}
+}
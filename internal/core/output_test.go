@@ -0,0 +1,79 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestSavePath(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("old"), 0644)
+
+	if got := savePath(dir, "a.txt", false); got != filepath.Join(dir, "a (1).txt") {
+		t.Errorf("Expected a (1).txt without --force, got %s", got)
+	}
+	if got := savePath(dir, "a.txt", true); got != filepath.Join(dir, "a.txt") {
+		t.Errorf("Expected a.txt with --force, got %s", got)
+	}
+	if got := savePath(dir, "b.txt", false); got != filepath.Join(dir, "b.txt") {
+		t.Errorf("Expected a free name to be kept, got %s", got)
+	}
+}
+
+func TestSaveText(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "note.txt"), []byte("old"), 0644)
+
+	var saved receivedFile
+	done, _, _, err := saveText("hello", dir, "note.txt", false, func(tea.Msg) {}, &saved, 5, "")
+	if !done || err != nil {
+		t.Fatalf("saveText failed: %v", err)
+	}
+	if saved.Name != "note (1).txt" {
+		t.Errorf("Expected note (1).txt, got %s", saved.Name)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "note (1).txt")); string(got) != "hello" {
+		t.Errorf("Expected the snippet in note (1).txt, got %q", got)
+	}
+
+	if _, _, _, err := saveText("again", dir, "note.txt", true, func(tea.Msg) {}, &saved, 5, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "note.txt")); string(got) != "again" {
+		t.Errorf("Expected --force to overwrite note.txt, got %q", got)
+	}
+}
+
+func TestPreserveAttrs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no permission bits to restore")
+	}
+	path := filepath.Join(t.TempDir(), "run.sh")
+	os.WriteFile(path, []byte("#!/bin/sh\n"), 0600)
+	mtime := time.Date(2020, 5, 17, 12, 0, 0, 0, time.UTC)
+
+	// setuid and world-writable from the sender come out as a plain 0755
+	if err := preserveAttrs(path, uint32(os.ModeSetuid|0o777), mtime.UnixNano()); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(path)
+	if info.Mode() != 0o755 {
+		t.Errorf("Expected mode 0755, got %v", info.Mode())
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("Expected modtime %v, got %v", mtime, info.ModTime())
+	}
+
+	// Nothing advertised: nothing changes
+	if err := preserveAttrs(path, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.Stat(path); after.Mode() != info.Mode() || !after.ModTime().Equal(info.ModTime()) {
+		t.Errorf("Expected zero values to leave the file alone")
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"slices"
 
 	"github.com/darkprince558/jend/pkg/protocol"
 	"golang.org/x/crypto/argon2"
@@ -18,149 +21,293 @@ const (
 	ArgonMemory  = 64 * 1024 // 64 MB
 	ArgonThreads = 4
 	ArgonKeyLen  = 32
+
+	// Bounds for advertised params. The receiver refuses anything outside them so a
+	// sender can't make it burn unbounded memory, or downgrade below a sane floor.
+	MinArgonTime   = 1
+	MaxArgonTime   = 16
+	MinArgonMemory = 8 * 1024    // 8 MB
+	MaxArgonMemory = 1024 * 1024 // 1 GB
 )
 
+// ArgonParams are the Argon2id cost settings the sender uses for a transfer.
+// Memory is in KiB, as in argon2.IDKey.
+type ArgonParams struct {
+	Time   uint32
+	Memory uint32
+}
+
+// DefaultArgonParams matches the historical hardcoded settings.
+var DefaultArgonParams = ArgonParams{Time: ArgonTime, Memory: ArgonMemory}
+
+// Validate checks that params are within the accepted bounds.
+func (p ArgonParams) Validate() error {
+	if p.Time < MinArgonTime || p.Time > MaxArgonTime {
+		return fmt.Errorf("argon2 time %d out of range [%d, %d]", p.Time, MinArgonTime, MaxArgonTime)
+	}
+	if p.Memory < MinArgonMemory || p.Memory > MaxArgonMemory {
+		return fmt.Errorf("argon2 memory %d KiB out of range [%d, %d]", p.Memory, MinArgonMemory, MaxArgonMemory)
+	}
+	return nil
+}
+
+// PAKEOptions are one end's settings for PerformPAKE.
+type PAKEOptions struct {
+	// Argon is what a sender uses and advertises; zero means DefaultArgonParams.
+	// Receivers always follow whatever the sender advertises.
+	Argon ArgonParams
+	// Cipher is the stream cipher this end asks for (see negotiateCipher).
+	Cipher Cipher
+}
+
+// errWrongCode is the sender's verdict on a receiver that proved a different code.
+var errWrongCode = errors.New("authentication failed: wrong password")
+
 // PerformPAKE executes a custom Mutual Authentication protocol using Argon2id + HMAC-SHA256
 // and a challenge-response mechanism.
 // It establishes that both parties share the same correct code/password without revealing it.
-// Returns the session key K upon success.
+// Returns the traffic key and cipher for SecureStream upon success (see
+// deriveTrafficKey and negotiateCipher).
 // role: 0 for Sender (Verifier), 1 for Receiver (Prover).
-func PerformPAKE(stream io.ReadWriter, password string, role int) ([]byte, error) {
+//
+// After a full PAKE both sides keep a short-lived resume ticket (see pake_resume.go).
+// On an immediate reconnect the receiver offers the ticket ID in its hello; if the
+// sender still holds it, K is derived from the ticket secret and the fresh salt
+// instead of running Argon2 again. The challenge-response below is unchanged, so a
+// resumed session still proves both sides hold the secret.
+func PerformPAKE(stream io.ReadWriter, password string, role int, opts PAKEOptions) ([]byte, Cipher, error) {
 
 	// Step 0: Sync Stream (Receiver speaks first to trigger AcceptStream on Server)
-	if role == 1 { // Receiver
-		if err := protocol.EncodeHeader(stream, protocol.TypePAKE, 0); err != nil {
-			return nil, err
+	var offered []byte       // Ticket ID the receiver presented (empty = none)
+	var ticket *resumeTicket // Ticket both sides agreed to resume from
+	if role == 1 {           // Receiver
+		ticket = resumeTickets.forCode(password)
+		if ticket != nil {
+			offered = ticket.id
+		}
+		if err := protocol.EncodeHeader(stream, protocol.TypePAKE, uint32(len(offered))); err != nil {
+			return nil, 0, err
+		}
+		if len(offered) > 0 {
+			if _, err := stream.Write(offered); err != nil {
+				return nil, 0, err
+			}
 		}
 	} else { // Sender
 		// Sender waits for Hello
-		pType, _, err := protocol.DecodeHeader(stream)
+		pType, length, err := protocol.DecodeHeader(stream)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		if pType != protocol.TypePAKE {
-			return nil, fmt.Errorf("expected PAKE hello")
+			return nil, 0, fmt.Errorf("expected PAKE hello")
+		}
+		if length > resumeTicketIDLen {
+			return nil, 0, fmt.Errorf("invalid PAKE hello")
+		}
+		offered = make([]byte, length)
+		if _, err := io.ReadFull(stream, offered); err != nil {
+			return nil, 0, err
+		}
+		if len(offered) > 0 {
+			ticket = resumeTickets.lookup(offered, password)
 		}
 	}
 
 	// 1. Salt Exchange (Sender generates Salt)
+	// When a ticket was offered, the salt is prefixed with one byte: 1 = resumed, 0 = full PAKE.
+	// Non-default Argon2 params are appended as [time uint32][memory uint32]; a plain
+	// 16-byte salt means the defaults, so default senders still talk to older receivers.
 	var salt []byte
+	params := DefaultArgonParams
 	if role == 0 { // Sender
 		salt = make([]byte, 16)
 		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
-			return nil, err
+			return nil, 0, err
+		}
+		if opts.Argon != (ArgonParams{}) {
+			params = opts.Argon
+		}
+		msg := salt
+		if params != DefaultArgonParams {
+			msg = binary.LittleEndian.AppendUint32(msg, params.Time)
+			msg = binary.LittleEndian.AppendUint32(msg, params.Memory)
+		}
+		if len(offered) > 0 {
+			flag := byte(0)
+			if ticket != nil {
+				flag = 1
+			}
+			msg = append([]byte{flag}, msg...)
 		}
 		// Send Salt
-		if err := protocol.EncodeHeader(stream, protocol.TypePAKE, uint32(len(salt))); err != nil {
-			return nil, err
+		if err := protocol.EncodeHeader(stream, protocol.TypePAKE, uint32(len(msg))); err != nil {
+			return nil, 0, err
 		}
-		if _, err := stream.Write(salt); err != nil {
-			return nil, err
+		if _, err := stream.Write(msg); err != nil {
+			return nil, 0, err
 		}
 	} else { // Receiver
 		// Read Salt
 		pType, length, err := protocol.DecodeHeader(stream)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		if pType != protocol.TypePAKE {
-			return nil, fmt.Errorf("expected salt")
+			return nil, 0, fmt.Errorf("expected salt")
 		}
 		salt = make([]byte, length)
 		if _, err := io.ReadFull(stream, salt); err != nil {
-			return nil, err
+			return nil, 0, err
+		}
+		if len(offered) > 0 {
+			if len(salt) < 1 {
+				return nil, 0, fmt.Errorf("expected salt")
+			}
+			if salt[0] != 1 {
+				// Sender doesn't know our ticket (restarted or expired)
+				resumeTickets.forget(password)
+				ticket = nil
+			}
+			salt = salt[1:]
+		}
+		if len(salt) == 16+8 {
+			params = ArgonParams{
+				Time:   binary.LittleEndian.Uint32(salt[16:20]),
+				Memory: binary.LittleEndian.Uint32(salt[20:24]),
+			}
+			if err := params.Validate(); err != nil {
+				return nil, 0, fmt.Errorf("sender requested unsupported parameters: %v", err)
+			}
+			// Fail with a clear error rather than getting OOM-killed mid-handshake
+			if avail, ok := availableMemory(); ok && uint64(params.Memory)*1024 > avail/2 {
+				return nil, 0, fmt.Errorf("sender requested %d MB of Argon2 memory, only %d MB available here (sender can lower it with --kdf-memory)", params.Memory/1024, avail/1024/1024)
+			}
+			salt = salt[:16]
 		}
 	}
 
 	// 2. Derive Session Key K = Argon2id(Password, Salt, ...)
 	// Upgraded from SHA256 to Argon2id for brute-force resistance.
-	K := argon2.IDKey([]byte(password), salt, ArgonTime, ArgonMemory, ArgonThreads, ArgonKeyLen)
+	// A resumed session skips Argon2: the ticket secret already came out of one.
+	var K []byte
+	if ticket != nil {
+		K = computeHMAC(ticket.secret, append([]byte("jend-resume-key"), salt...))
+	} else {
+		K = argon2.IDKey([]byte(password), salt, params.Time, params.Memory, ArgonThreads, ArgonKeyLen)
+	}
 
 	// 3. Mutual Challenge-Response
-	// Sender generates Random Nonce N
+	// Sender generates Random Nonce N, followed by the cipher it prefers
 	var nonce []byte
+	// The ciphers preferred by the sender and the receiver (see negotiateCipher)
+	var ciphers [2]byte
 	if role == 0 { // Sender
 		nonce = make([]byte, 32)
 		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
+		ciphers[0] = byte(preferredCipher(opts.Cipher))
 		// Send Nonce
-		if err := protocol.EncodeHeader(stream, protocol.TypePAKE, uint32(len(nonce))); err != nil {
-			return nil, err
+		if err := protocol.EncodeHeader(stream, protocol.TypePAKE, uint32(len(nonce)+1)); err != nil {
+			return nil, 0, err
 		}
-		if _, err := stream.Write(nonce); err != nil {
-			return nil, err
+		if _, err := stream.Write(append(nonce, ciphers[0])); err != nil {
+			return nil, 0, err
 		}
 	} else { // Receiver
 		// Read Nonce
 		pType, length, err := protocol.DecodeHeader(stream)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
-		if pType != protocol.TypePAKE {
-			return nil, fmt.Errorf("expected nonce")
+		if pType != protocol.TypePAKE || length != 32+1 {
+			return nil, 0, fmt.Errorf("expected nonce")
 		}
 		nonce = make([]byte, length)
 		if _, err := io.ReadFull(stream, nonce); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
+		nonce, ciphers[0] = nonce[:32], nonce[32]
+		ciphers[1] = byte(preferredCipher(opts.Cipher))
 	}
 
-	// 4. Receiver Authenticates First (sends HMAC(K, "client" + Nonce))
-	clientTag := computeHMAC(K, append([]byte("client"), nonce...))
-
+	// 4. Receiver Authenticates First (sends HMAC(K, "client" + Nonce + ciphers)),
+	// followed by the cipher it prefers. Both tags cover both preferences, so
+	// nobody in between can talk the two ends down to another cipher.
 	if role == 1 { // Receiver sends proof
-		if err := protocol.EncodeHeader(stream, protocol.TypePAKE, uint32(len(clientTag))); err != nil {
-			return nil, err
+		clientTag := computeHMAC(K, slices.Concat([]byte("client"), nonce, ciphers[:]))
+		proof := append(clientTag, ciphers[1])
+		if err := protocol.EncodeHeader(stream, protocol.TypePAKE, uint32(len(proof))); err != nil {
+			return nil, 0, err
 		}
-		if _, err := stream.Write(clientTag); err != nil {
-			return nil, err
+		if _, err := stream.Write(proof); err != nil {
+			return nil, 0, err
 		}
 	} else { // Sender verifies proof
 		pType, length, err := protocol.DecodeHeader(stream)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
-		if pType != protocol.TypePAKE {
-			return nil, fmt.Errorf("expected client proof")
+		if pType != protocol.TypePAKE || length != sha256.Size+1 {
+			return nil, 0, fmt.Errorf("expected client proof")
 		}
 		gotTag := make([]byte, length)
 		if _, err := io.ReadFull(stream, gotTag); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
+		gotTag, ciphers[1] = gotTag[:sha256.Size], gotTag[sha256.Size]
+		clientTag := computeHMAC(K, slices.Concat([]byte("client"), nonce, ciphers[:]))
 		if subtle.ConstantTimeCompare(gotTag, clientTag) != 1 {
-			return nil, fmt.Errorf("authentication failed: wrong password")
+			return nil, 0, errWrongCode
 		}
 	}
+	suite, err := negotiateCipher(Cipher(ciphers[0]), Cipher(ciphers[1]))
+	if err != nil {
+		return nil, 0, err
+	}
 
-	// 5. Sender Authenticates (sends HMAC(K, "server" + Nonce))
-	serverTag := computeHMAC(K, append([]byte("server"), nonce...))
+	// 5. Sender Authenticates (sends HMAC(K, "server" + Nonce + ciphers))
+	serverTag := computeHMAC(K, slices.Concat([]byte("server"), nonce, ciphers[:]))
 
 	if role == 0 { // Sender sends proof
 		if err := protocol.EncodeHeader(stream, protocol.TypePAKE, uint32(len(serverTag))); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		if _, err := stream.Write(serverTag); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 	} else { // Receiver verifies proof
 		pType, length, err := protocol.DecodeHeader(stream)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		if pType != protocol.TypePAKE {
-			return nil, fmt.Errorf("expected server proof")
+			return nil, 0, fmt.Errorf("expected server proof")
 		}
 		gotTag := make([]byte, length)
 		if _, err := io.ReadFull(stream, gotTag); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		if subtle.ConstantTimeCompare(gotTag, serverTag) != 1 {
-			return nil, fmt.Errorf("server authentication failed")
+			return nil, 0, fmt.Errorf("server authentication failed")
 		}
 	}
 
-	return K, nil
+	// Only a full PAKE mints a ticket, so a ticket's lifetime can't be extended by resuming.
+	if ticket == nil {
+		resumeTickets.issue(K, password, role)
+	}
+
+	return deriveTrafficKey(K, nonce, suite), suite, nil
+}
+
+// deriveTrafficKey keeps the SecureStream key separate from K, which also keys the
+// challenge-response tags. Mixing in the fresh challenge nonce gives every stream
+// its own key, so SecureStream's frame counters can start at zero on each. The
+// cipher goes in too: one key is never used with both.
+func deriveTrafficKey(K, nonce []byte, c Cipher) []byte {
+	return computeHMAC(K, slices.Concat([]byte("jend-traffic-key"), nonce, []byte{byte(c)}))
 }
 
 func computeHMAC(key, data []byte) []byte {
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// CalibrateArgon measures this host's Argon2id speed and picks params whose
+// key derivation takes roughly target, in the spirit of cryptsetup's benchmark.
+// Memory is preferred over iterations: start at the default 64 MB, shrink it if
+// a single pass is already too slow, and grow it once iterations hit the cap.
+func CalibrateArgon(target time.Duration) ArgonParams {
+	memory := uint32(ArgonMemory)
+
+	// One pass at the current memory size
+	perPass := measureArgon(1, memory)
+
+	// Too slow even for one pass: trade memory away until it fits
+	for perPass > target && memory > MinArgonMemory {
+		memory /= 2
+		if memory < MinArgonMemory {
+			memory = MinArgonMemory
+		}
+		perPass = measureArgon(1, memory)
+	}
+	if perPass >= target {
+		return ArgonParams{Time: MinArgonTime, Memory: memory}
+	}
+
+	iterations := uint32(target / perPass)
+	if iterations > MaxArgonTime {
+		// Fast host: spend the extra budget on memory instead (cost scales ~linearly)
+		scaled := uint64(memory) * uint64(iterations) / MaxArgonTime
+		if scaled > MaxArgonMemory {
+			scaled = MaxArgonMemory
+		}
+		memory = uint32(scaled)
+		iterations = MaxArgonTime
+	}
+	if iterations < MinArgonTime {
+		iterations = MinArgonTime
+	}
+
+	return ArgonParams{Time: iterations, Memory: memory}
+}
+
+// measureArgon times a single key derivation with throwaway inputs.
+func measureArgon(t, memory uint32) time.Duration {
+	start := time.Now()
+	argon2.IDKey([]byte("jend-calibration"), make([]byte, 16), t, memory, ArgonThreads, ArgonKeyLen)
+	return time.Since(start)
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// AutoArgonParams returns DefaultArgonParams, with memory scaled down on hosts or
+// containers that can't comfortably spare 64 MB: Argon2 may use at most a quarter
+// of what is available, and never less than MinArgonMemory.
+func AutoArgonParams() ArgonParams {
+	params := DefaultArgonParams
+	avail, ok := availableMemory()
+	if !ok {
+		return params
+	}
+	budget := avail / 4 / 1024 // KiB
+	for uint64(params.Memory) > budget && params.Memory > MinArgonMemory {
+		params.Memory /= 2
+		// Keep the cost roughly level: memory-hard less, time-hard more
+		if params.Time < MaxArgonTime {
+			params.Time++
+		}
+	}
+	if params.Memory < MinArgonMemory {
+		params.Memory = MinArgonMemory
+	}
+	return params
+}
+
+// availableMemory reports how many bytes this process can still allocate: the lower
+// of MemAvailable and the cgroup v2 headroom. ok is false when neither is readable
+// (non-Linux hosts), in which case callers keep their defaults.
+func availableMemory() (uint64, bool) {
+	avail, ok := memAvailable("/proc/meminfo")
+	if limit, okLimit := cgroupHeadroom("/sys/fs/cgroup"); okLimit && (!ok || limit < avail) {
+		avail, ok = limit, true
+	}
+	return avail, ok
+}
+
+func memAvailable(path string) (uint64, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, false
+			}
+			return kb * 1024, true
+		}
+	}
+	return 0, false
+}
+
+func cgroupHeadroom(dir string) (uint64, bool) {
+	limit, ok := readCgroupValue(dir + "/memory.max")
+	if !ok {
+		return 0, false
+	}
+	used, _ := readCgroupValue(dir + "/memory.current")
+	if used >= limit {
+		return 0, true
+	}
+	return limit - used, true
+}
+
+// readCgroupValue parses a cgroup v2 memory file; "max" means unlimited (not ok).
+func readCgroupValue(path string) (uint64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
@@ -0,0 +1,48 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemAvailable(t *testing.T) {
+	dir := t.TempDir()
+	meminfo := filepath.Join(dir, "meminfo")
+	os.WriteFile(meminfo, []byte("MemTotal:        2048000 kB\nMemFree:          100000 kB\nMemAvailable:     512000 kB\n"), 0644)
+
+	got, ok := memAvailable(meminfo)
+	if !ok || got != 512000*1024 {
+		t.Errorf("memAvailable = %d, %v", got, ok)
+	}
+	if _, ok := memAvailable(filepath.Join(dir, "missing")); ok {
+		t.Error("Missing meminfo should not be ok")
+	}
+}
+
+func TestCgroupHeadroom(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "memory.max"), []byte("134217728\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "memory.current"), []byte("100663296\n"), 0644)
+
+	got, ok := cgroupHeadroom(dir)
+	if !ok || got != 32<<20 {
+		t.Errorf("cgroupHeadroom = %d, %v; want 32 MB", got, ok)
+	}
+
+	// Unlimited cgroup
+	os.WriteFile(filepath.Join(dir, "memory.max"), []byte("max\n"), 0644)
+	if _, ok := cgroupHeadroom(dir); ok {
+		t.Error("memory.max of \"max\" should not be treated as a limit")
+	}
+}
+
+func TestAutoArgonParams(t *testing.T) {
+	params := AutoArgonParams()
+	if err := params.Validate(); err != nil {
+		t.Fatalf("AutoArgonParams out of bounds: %v", err)
+	}
+	if avail, ok := availableMemory(); ok && uint64(params.Memory)*1024 > avail/4 && params.Memory > MinArgonMemory {
+		t.Errorf("Argon2 memory %d KiB exceeds a quarter of the %d bytes available", params.Memory, avail)
+	}
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// ResumeTicketTTL bounds how long a successful PAKE can be reused without Argon2.
+// Kept short on purpose: it only needs to cover reconnects after a drop and the
+// extra streams of a parallel download, not a new transfer.
+const ResumeTicketTTL = 2 * time.Minute
+
+const resumeTicketIDLen = 16
+
+// resumeTicket is derived from the session key K of a full (Argon2) PAKE.
+// Both sides compute the same ID and secret independently; neither is sent in a
+// form that reveals K, and the secret never crosses the wire.
+type resumeTicket struct {
+	id      []byte
+	secret  []byte
+	code    string
+	expires time.Time
+}
+
+// ticketStore is an in-memory, per-process cache. Tickets never touch disk, so a
+// restarted sender simply falls back to a full PAKE.
+type ticketStore struct {
+	mu      sync.Mutex
+	byID    map[string]*resumeTicket // Sender side: presented ID -> ticket
+	byCode  map[string]*resumeTicket // Receiver side: code -> ticket to present
+	nowFunc func() time.Time
+}
+
+var resumeTickets = &ticketStore{
+	byID:    make(map[string]*resumeTicket),
+	byCode:  make(map[string]*resumeTicket),
+	nowFunc: time.Now,
+}
+
+// newResumeTicket derives the ticket for a session key.
+// The ID is bound to K, and K is bound to the code and the sender's salt.
+func newResumeTicket(K []byte, code string, now time.Time) *resumeTicket {
+	return &resumeTicket{
+		id:      computeHMAC(K, []byte("jend-resume-id"))[:resumeTicketIDLen],
+		secret:  computeHMAC(K, []byte("jend-resume-secret")),
+		code:    code,
+		expires: now.Add(ResumeTicketTTL),
+	}
+}
+
+// issue stores a ticket for the given role after a full PAKE.
+func (s *ticketStore) issue(K []byte, code string, role int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := newResumeTicket(K, code, s.nowFunc())
+	if role == 0 {
+		s.byID[hex.EncodeToString(t.id)] = t
+	} else {
+		s.byCode[code] = t
+	}
+	s.pruneLocked()
+}
+
+// forCode returns the receiver's ticket for a code, if one is still valid.
+func (s *ticketStore) forCode(code string) *resumeTicket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.byCode[code]
+	if !ok || s.nowFunc().After(t.expires) {
+		delete(s.byCode, code)
+		return nil
+	}
+	return t
+}
+
+// lookup returns the sender's ticket for a presented ID. The ticket must still be
+// valid and must have been issued for the same code this sender is serving.
+func (s *ticketStore) lookup(id []byte, code string) *resumeTicket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := hex.EncodeToString(id)
+	t, ok := s.byID[key]
+	if !ok {
+		return nil
+	}
+	if s.nowFunc().After(t.expires) {
+		delete(s.byID, key)
+		return nil
+	}
+	if t.code != code {
+		return nil
+	}
+	return t
+}
+
+// forget drops a receiver ticket the sender refused, so we don't keep offering it.
+func (s *ticketStore) forget(code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.byCode, code)
+}
+
+func (s *ticketStore) pruneLocked() {
+	now := s.nowFunc()
+	for k, t := range s.byID {
+		if now.After(t.expires) {
+			delete(s.byID, k)
+		}
+	}
+	for k, t := range s.byCode {
+		if now.After(t.expires) {
+			delete(s.byCode, k)
+		}
+	}
+}
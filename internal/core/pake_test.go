@@ -1,6 +1,9 @@
 package core
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"io"
 	"testing"
 	"time"
@@ -23,16 +26,18 @@ func TestPerformPAKE_Argon2(t *testing.T) {
 	start := time.Now()
 
 	errChan := make(chan error)
+	var senderKey []byte
 
 	go func() {
-		_, err := PerformPAKE(senderRW, password, 0)
+		k, _, err := PerformPAKE(senderRW, password, 0, PAKEOptions{})
 		if err != nil {
 			errChan <- err
 		}
+		senderKey = k
 		close(errChan)
 	}()
 
-	_, err := PerformPAKE(receiverRW, password, 1)
+	receiverKey, _, err := PerformPAKE(receiverRW, password, 1, PAKEOptions{})
 	if err != nil {
 		t.Errorf("Handshake failed: %v", err)
 	}
@@ -48,6 +53,11 @@ func TestPerformPAKE_Argon2(t *testing.T) {
 	elapsed := time.Since(start)
 	t.Logf("PAKE Handshake took: %v", elapsed)
 
+	// Both sides must end up with the same AES-256 key
+	if len(receiverKey) != 32 || !bytes.Equal(senderKey, receiverKey) {
+		t.Errorf("Derived keys differ or have the wrong size (%d bytes)", len(receiverKey))
+	}
+
 	// Verify it took at least some time (proving Argon2 is active)
 	// Argon2 with these params should take > 100ms usually.
 	if elapsed < 100*time.Millisecond {
@@ -59,3 +69,214 @@ type readWriter struct {
 	io.Reader
 	io.Writer
 }
+
+// runPAKEPair runs a handshake with both ends configured by opts and returns
+// the sender's and the receiver's keys.
+func runPAKEPair(t *testing.T, password string, opts PAKEOptions) ([]byte, []byte) {
+	t.Helper()
+	r, w := io.Pipe()
+	r2, w2 := io.Pipe()
+	senderRW := &readWriter{Reader: r2, Writer: w}
+	receiverRW := &readWriter{Reader: r, Writer: w2}
+
+	type result struct {
+		key   []byte
+		suite Cipher
+		err   error
+	}
+	senderRes := make(chan result, 1)
+	go func() {
+		k, suite, err := PerformPAKE(senderRW, password, 0, opts)
+		senderRes <- result{k, suite, err}
+	}()
+
+	recvKey, recvSuite, err := PerformPAKE(receiverRW, password, 1, opts)
+	if err != nil {
+		t.Fatalf("Receiver handshake failed: %v", err)
+	}
+	res := <-senderRes
+	if res.err != nil {
+		t.Fatalf("Sender handshake failed: %v", res.err)
+	}
+	if res.suite != recvSuite || recvSuite != preferredCipher(opts.Cipher) {
+		t.Fatalf("Ciphers differ: sender %s, receiver %s, both prefer %s", res.suite, recvSuite, preferredCipher(opts.Cipher))
+	}
+	return res.key, recvKey
+}
+
+func TestPerformPAKE_WrongPassword(t *testing.T) {
+	r, w := io.Pipe()
+	r2, w2 := io.Pipe()
+	senderRW := &readWriter{Reader: r2, Writer: w}
+	receiverRW := &readWriter{Reader: r, Writer: w2}
+
+	type result struct {
+		key []byte
+		err error
+	}
+	senderRes := make(chan result, 1)
+	go func() {
+		k, _, err := PerformPAKE(senderRW, "right-code-here", 0, PAKEOptions{})
+		// Hang up like a closed stream would, so the receiver stops waiting for a proof
+		w.Close()
+		r2.Close()
+		senderRes <- result{k, err}
+	}()
+
+	recvKey, _, recvErr := PerformPAKE(receiverRW, "wrong-code-here", 1, PAKEOptions{})
+	res := <-senderRes
+
+	if res.err == nil || res.key != nil {
+		t.Errorf("Sender accepted a wrong password (key %x)", res.key)
+	}
+	if !errors.Is(res.err, errWrongCode) {
+		t.Errorf("Expected errWrongCode so the sender counts it, got %v", res.err)
+	}
+	if recvErr == nil || recvKey != nil {
+		t.Errorf("Receiver got a key without a valid sender proof (key %x)", recvKey)
+	}
+}
+
+func TestPerformPAKE_Resumption(t *testing.T) {
+	password := "resume-test-code"
+
+	sKey1, rKey1 := runPAKEPair(t, password, PAKEOptions{})
+	if string(sKey1) != string(rKey1) {
+		t.Fatal("Full PAKE keys differ")
+	}
+
+	ticket := resumeTickets.forCode(password)
+	if ticket == nil {
+		t.Fatal("Full PAKE left no ticket")
+	}
+
+	// Immediate reconnect should resume without Argon2
+	sKey2, rKey2 := runPAKEPair(t, password, PAKEOptions{})
+
+	if string(sKey2) != string(rKey2) {
+		t.Fatal("Resumed PAKE keys differ")
+	}
+	if string(sKey2) == string(sKey1) {
+		t.Error("Resumed session must use a fresh key")
+	}
+	// Only a full PAKE mints a ticket, so the same one still standing means
+	// Argon2 was skipped
+	if resumeTickets.forCode(password) != ticket {
+		t.Error("Reconnect ran a full PAKE instead of resuming")
+	}
+}
+
+func TestPerformPAKE_ResumptionExpires(t *testing.T) {
+	password := "expiry-test-code"
+	runPAKEPair(t, password, PAKEOptions{})
+
+	// Jump past the ticket lifetime
+	resumeTickets.mu.Lock()
+	resumeTickets.nowFunc = func() time.Time { return time.Now().Add(ResumeTicketTTL + time.Second) }
+	resumeTickets.mu.Unlock()
+	defer func() {
+		resumeTickets.mu.Lock()
+		resumeTickets.nowFunc = time.Now
+		resumeTickets.mu.Unlock()
+	}()
+
+	if resumeTickets.forCode(password) != nil {
+		t.Error("Expired ticket should not be offered")
+	}
+}
+
+func TestPerformPAKE_ResumptionUnknownTicket(t *testing.T) {
+	password := "unknown-ticket-code"
+	runPAKEPair(t, password, PAKEOptions{})
+
+	// Simulate a restarted sender: it no longer knows the receiver's ticket
+	resumeTickets.mu.Lock()
+	resumeTickets.byID = make(map[string]*resumeTicket)
+	resumeTickets.mu.Unlock()
+
+	sKey, rKey := runPAKEPair(t, password, PAKEOptions{})
+	if string(sKey) != string(rKey) {
+		t.Fatal("Fallback to full PAKE produced different keys")
+	}
+}
+
+func TestPerformPAKE_AdvertisedParams(t *testing.T) {
+	custom := PAKEOptions{Argon: ArgonParams{Time: 1, Memory: MinArgonMemory}}
+
+	// Receivers ignore opts.Argon; they must follow the sender
+	sKey, rKey := runPAKEPair(t, "advertised-params-code", custom)
+	if string(sKey) != string(rKey) {
+		t.Fatal("Receiver did not adopt the sender's Argon2 params")
+	}
+}
+
+// paramTamperer rewrites the Argon2 time in the sender's salt message, like an
+// on-path attacker trying to make the receiver derive with cheaper settings.
+type paramTamperer struct {
+	io.Writer
+	done bool
+}
+
+func (p *paramTamperer) Write(b []byte) (int, error) {
+	if !p.done && len(b) == 16+8 { // Salt payload with advertised params
+		p.done = true
+		b = append([]byte(nil), b...)
+		binary.LittleEndian.PutUint32(b[16:20], MinArgonTime)
+	}
+	return p.Writer.Write(b)
+}
+
+func TestPerformPAKE_ParamsTamperDetected(t *testing.T) {
+	opts := PAKEOptions{Argon: ArgonParams{Time: 2, Memory: MinArgonMemory}}
+	r, w := io.Pipe()
+	r2, w2 := io.Pipe()
+	senderRW := &readWriter{Reader: r2, Writer: &paramTamperer{Writer: w}}
+	receiverRW := &readWriter{Reader: r, Writer: w2}
+
+	senderErr := make(chan error, 1)
+	go func() {
+		_, _, err := PerformPAKE(senderRW, "tamper-params-code", 0, opts)
+		w.Close()
+		r2.Close()
+		senderErr <- err
+	}()
+
+	// K depends on the params, so the downgraded receiver can't produce a valid proof
+	_, _, recvErr := PerformPAKE(receiverRW, "tamper-params-code", 1, opts)
+	if err := <-senderErr; err == nil {
+		t.Error("Sender accepted a receiver that derived with tampered params")
+	}
+	if recvErr == nil {
+		t.Error("Receiver completed the handshake with tampered params")
+	}
+}
+
+func TestArgonParamsValidate(t *testing.T) {
+	bad := []ArgonParams{
+		{Time: 0, Memory: ArgonMemory},
+		{Time: MaxArgonTime + 1, Memory: ArgonMemory},
+		{Time: ArgonTime, Memory: MinArgonMemory - 1},
+		{Time: ArgonTime, Memory: MaxArgonMemory + 1},
+	}
+	for _, p := range bad {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", p)
+		}
+		if err := (&SendOptions{Argon: p}).validate(); err == nil {
+			t.Errorf("Expected RunSender to refuse %+v", p)
+		}
+	}
+	if err := (&SendOptions{}).validate(); err != nil {
+		t.Errorf("Expected zero params to mean the defaults, got %v", err)
+	}
+}
+
+func TestCalibrateArgon(t *testing.T) {
+	p := CalibrateArgon(time.Millisecond)
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Calibration produced invalid params: %v", err)
+	}
+	if p.Time != MinArgonTime {
+		t.Errorf("Expected minimum iterations for a tiny target, got %d", p.Time)
+	}
+}
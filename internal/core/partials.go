@@ -0,0 +1,110 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Suffixes of the temp files a receiver leaves behind when a transfer stops early.
+const (
+	partialSuffix      = ".partial"
+	parallelPartSuffix = ".parallel.part"
+	parallelMetaSuffix = ".parallel.meta"
+)
+
+// PartialDownload is an unfinished receive found on disk.
+type PartialDownload struct {
+	Name    string   // Target file name, without the temp suffix
+	Files   []string // Every artifact belonging to it
+	Size    int64    // Bytes on disk across Files
+	ModTime time.Time
+	// Percent complete, from .parallel.meta. -1 when unknown (sequential .partial).
+	Percent float64
+}
+
+// FindPartials lists the JEND temp artifacts in dir (not recursive), oldest first.
+// A .parallel.part and its .parallel.meta are reported as one download.
+func FindPartials(dir string) ([]PartialDownload, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*PartialDownload)
+	get := func(name string) *PartialDownload {
+		p, ok := byName[name]
+		if !ok {
+			p = &PartialDownload{Name: name, Percent: -1}
+			byName[name] = p
+		}
+		return p
+	}
+
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		fileName := e.Name()
+		var name string
+		switch {
+		case strings.HasSuffix(fileName, parallelPartSuffix):
+			name = strings.TrimSuffix(fileName, parallelPartSuffix)
+		case strings.HasSuffix(fileName, parallelMetaSuffix):
+			name = strings.TrimSuffix(fileName, parallelMetaSuffix)
+		case strings.HasSuffix(fileName, partialSuffix):
+			name = strings.TrimSuffix(fileName, partialSuffix)
+		default:
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		p := get(name)
+		path := filepath.Join(dir, fileName)
+		p.Files = append(p.Files, path)
+		p.Size += info.Size()
+		if info.ModTime().After(p.ModTime) {
+			p.ModTime = info.ModTime()
+		}
+		if strings.HasSuffix(fileName, parallelMetaSuffix) {
+			p.Percent = parallelPercent(path)
+		}
+	}
+
+	out := make([]PartialDownload, 0, len(byName))
+	for _, p := range byName {
+		sort.Strings(p.Files)
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ModTime.Before(out[j].ModTime) })
+	return out, nil
+}
+
+// parallelPercent reads a .parallel.meta and reports how much of it is done.
+func parallelPercent(metaPath string) float64 {
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return -1
+	}
+	var state DownloadState
+	if err := json.Unmarshal(data, &state); err != nil || state.TotalSize <= 0 {
+		return -1
+	}
+	return float64(state.completed()) * 100 / float64(state.TotalSize)
+}
+
+// RemovePartial deletes every artifact of p.
+func RemovePartial(p PartialDownload) error {
+	for _, f := range p.Files {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
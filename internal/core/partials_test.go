@@ -0,0 +1,53 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFindPartials(t *testing.T) {
+	dir := t.TempDir()
+
+	// Sequential leftover
+	os.WriteFile(filepath.Join(dir, "notes.txt.partial"), []byte("half"), 0644)
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(filepath.Join(dir, "notes.txt.partial"), old, old)
+
+	// Parallel leftover: 1 of 4 chunks done
+	os.WriteFile(filepath.Join(dir, "disk.iso.parallel.part"), make([]byte, 250), 0644)
+	if _, err := loadOrInitState(filepath.Join(dir, "disk.iso.parallel.meta"), 1000, 4); err != nil {
+		t.Fatal(err)
+	}
+	markChunkDone(filepath.Join(dir, "disk.iso.parallel.meta"), 0)
+
+	// Not ours
+	os.WriteFile(filepath.Join(dir, "finished.txt"), []byte("done"), 0644)
+
+	partials, err := FindPartials(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(partials) != 2 {
+		t.Fatalf("Expected 2 partial downloads, got %d: %+v", len(partials), partials)
+	}
+
+	// Oldest first
+	if partials[0].Name != "notes.txt" || partials[0].Percent != -1 || partials[0].Size != 4 {
+		t.Errorf("Unexpected sequential partial: %+v", partials[0])
+	}
+	if partials[1].Name != "disk.iso" || len(partials[1].Files) != 2 || partials[1].Percent != 25 {
+		t.Errorf("Unexpected parallel partial: %+v", partials[1])
+	}
+
+	for _, p := range partials {
+		if err := RemovePartial(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != "finished.txt" {
+		t.Errorf("Only finished.txt should remain, got %v", entries)
+	}
+}
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/darkprince558/jend/internal/discovery"
+	"github.com/darkprince558/jend/internal/transport"
+)
+
+// An unreachable first candidate (e.g. advertised but unroutable IPv6) must not
+// stop the receiver from reaching the sender at the next one.
+func TestProbeDialTriesEachAddress(t *testing.T) {
+	tr := transport.NewQUICTransport()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := tr.ListenPacket(pc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go listener.Accept(context.Background())
+
+	// A bound socket nobody reads from: dials to it can only time out
+	dead, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dead.Close()
+
+	conn, addr, err := probeDial(tr, []string{dead.LocalAddr().String(), pc.LocalAddr().String()})
+	if err != nil {
+		t.Fatalf("probeDial failed: %v", err)
+	}
+	defer conn.CloseWithError(0, "")
+	if addr != pc.LocalAddr().String() {
+		t.Errorf("Expected the reachable address %s, got %s", pc.LocalAddr(), addr)
+	}
+}
+
+// squatBackend is a discovery backend that hands out a squatter's address
+// ahead of the real sender's, like two LAN hosts answering for one code. The
+// zero value finds and advertises nothing.
+type squatBackend struct {
+	squatter  string
+	sender    chan string
+	advertise sync.Once
+}
+
+func (b *squatBackend) Name() string { return "squat-test" }
+
+func (b *squatBackend) Advertise(code, addr string) (func(), error) {
+	if b.sender != nil {
+		b.advertise.Do(func() { b.sender <- addr })
+	}
+	return func() {}, nil
+}
+
+func (b *squatBackend) Find(code string, timeout time.Duration) ([]string, error) {
+	if b.sender == nil {
+		return nil, nil
+	}
+	select {
+	case addr := <-b.sender:
+		return []string{b.squatter, "127.0.0.1:" + addr[strings.LastIndex(addr, ":")+1:]}, nil
+	case <-time.After(timeout):
+		return nil, nil
+	}
+}
+
+// A first candidate that doesn't know the code must be hung up on, and the
+// next one tried, rather than retried or taken as the sender rejecting it.
+func TestReceiverSkipsSenderFailingPAKE(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	tr := transport.NewQUICTransport()
+	squatter, err := tr.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer squatter.Close()
+	go func() {
+		for {
+			conn, err := squatter.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				stream, err := conn.AcceptStream(context.Background())
+				if err != nil {
+					return
+				}
+				PerformPAKE(stream, "other-code", 0, PAKEOptions{Argon: ArgonParams{Time: 1, Memory: MinArgonMemory}})
+				conn.CloseWithError(0, "")
+			}()
+		}
+	}()
+
+	backend := &squatBackend{squatter: squatter.Addr().String(), sender: make(chan string, 1)}
+	discovery.RegisterBackend(backend)
+	t.Cleanup(func() { discovery.RegisterBackend(&squatBackend{}) }) // Backends can't be unregistered
+	t.Setenv(discovery.EnvDiscovery, backend.Name())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sent := make(chan error, 1)
+	go func() {
+		sent <- RunSender(ctx, &Printer{W: io.Discard}, SendOptions{
+			Text:      "hello",
+			IsText:    true,
+			Code:      "real-code",
+			Timeout:   30 * time.Second,
+			ChunkSize: ChunkSize,
+			NoHistory: true,
+			LANOnly:   true,
+			NoTCP:     true,
+			Once:      true,
+			Argon:     ArgonParams{Time: 1, Memory: MinArgonMemory},
+		})
+	}()
+
+	var buf bytes.Buffer
+	err = RunReceiver(ctx, &Printer{W: &buf}, ReceiveOptions{
+		Code:              "real-code",
+		OutputDir:         t.TempDir(),
+		NoClipboard:       true,
+		NoHistory:         true,
+		Concurrency:       1,
+		ParallelThreshold: DefaultParallelThreshold,
+		MaxAttempts:       1,
+		LANOnly:           true,
+	})
+	if err != nil {
+		t.Fatalf("RunReceiver: %v\n%s", err, buf.String())
+	}
+	out := buf.String()
+	if !strings.Contains(out, "Sender at "+squatter.Addr().String()+" failed authentication") {
+		t.Errorf("Expected the squatter to be skipped, got:\n%s", out)
+	}
+	if !strings.Contains(out, "Received Text:\nhello") {
+		t.Errorf("Expected the real sender's text, got:\n%s", out)
+	}
+	if err := <-sent; err != nil {
+		t.Errorf("RunSender: %v", err)
+	}
+}
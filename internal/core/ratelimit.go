@@ -0,0 +1,114 @@
+package core
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket shared by every stream of a transfer (--rate),
+// so parallel streams split the budget instead of each getting all of it.
+// Up to one second's worth of bytes may go out in a burst.
+type rateLimiter struct {
+	ctx  context.Context
+	rate float64 // Bytes per second
+
+	mu     sync.Mutex
+	tokens float64 // Negative while a large write is being paid off
+	last   time.Time
+
+	now   func() time.Time
+	sleep func(context.Context, time.Duration) error
+}
+
+// newRateLimiter returns nil (no limit) for bytesPerSec <= 0. Waits end early
+// when ctx is done.
+func newRateLimiter(ctx context.Context, bytesPerSec int64) *rateLimiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		ctx:    ctx,
+		rate:   float64(bytesPerSec),
+		tokens: float64(bytesPerSec),
+		last:   time.Now(),
+		now:    time.Now,
+		sleep:  sleepCtx,
+	}
+}
+
+// wait takes n bytes from the bucket, sleeping until they are paid for.
+// n may exceed the burst: the bucket goes into debt and the caller waits it off.
+func (l *rateLimiter) wait(n int) error {
+	l.mu.Lock()
+	now := l.now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	return l.sleep(l.ctx, delay)
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// limitedStream throttles a raw QUIC stream. It sits below the PAKE and the
+// secure stream, so the limit covers what actually goes on the wire: frame
+// headers, AEAD overhead and CRCs included.
+type limitedStream struct {
+	io.ReadWriter
+	l *rateLimiter
+}
+
+// limitStream wraps s in l; a nil l returns s unchanged.
+func limitStream(s io.ReadWriter, l *rateLimiter) io.ReadWriter {
+	if l == nil {
+		return s
+	}
+	return &limitedStream{ReadWriter: s, l: l}
+}
+
+func (s *limitedStream) Write(p []byte) (int, error) {
+	if err := s.l.wait(len(p)); err != nil {
+		return 0, err
+	}
+	return s.ReadWriter.Write(p)
+}
+
+// Read pays after the fact: how many bytes a read returns isn't known up front.
+func (s *limitedStream) Read(p []byte) (int, error) {
+	n, err := s.ReadWriter.Read(p)
+	if n > 0 {
+		if werr := s.l.wait(n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+func (s *limitedStream) Close() error {
+	if c, ok := s.ReadWriter.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeLimiter returns a limiter on a fake clock that records its sleeps
+// instead of taking them.
+func fakeLimiter(rate int64) (*rateLimiter, *[]time.Duration) {
+	l := newRateLimiter(context.Background(), rate)
+	now := time.Unix(0, 0)
+	l.last = now
+	l.now = func() time.Time { return now }
+	var slept []time.Duration
+	l.sleep = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		now = now.Add(d)
+		return nil
+	}
+	return l, &slept
+}
+
+func TestRateLimiterBucket(t *testing.T) {
+	l, slept := fakeLimiter(1000)
+
+	// The first second's worth goes out as a burst
+	l.wait(1000)
+	if len(*slept) != 0 {
+		t.Fatalf("Expected the burst to pass without waiting, slept %v", *slept)
+	}
+	l.wait(500)
+	if len(*slept) != 1 || (*slept)[0] != 500*time.Millisecond {
+		t.Fatalf("Expected a 500ms wait, got %v", *slept)
+	}
+	// A write bigger than the bucket is paid off in one longer wait
+	l.wait(3000)
+	if len(*slept) != 2 || (*slept)[1] != 3*time.Second {
+		t.Fatalf("Expected a 3s wait, got %v", *slept)
+	}
+}
+
+func TestLimitStreamCountsEveryByte(t *testing.T) {
+	l, slept := fakeLimiter(100)
+	var buf bytes.Buffer
+	s := limitStream(&buf, l)
+
+	s.Write(make([]byte, 100)) // Burst
+	s.Write(make([]byte, 50))
+	if len(*slept) != 1 || (*slept)[0] != 500*time.Millisecond {
+		t.Fatalf("Expected writes to be throttled, slept %v", *slept)
+	}
+	s.Read(make([]byte, 150))
+	if len(*slept) != 2 || (*slept)[1] != 1500*time.Millisecond {
+		t.Errorf("Expected reads to share the bucket, slept %v", *slept)
+	}
+
+	if limitStream(&buf, nil) != &buf {
+		t.Error("Expected no wrapper without a limit")
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := newRateLimiter(ctx, 10)
+	l.wait(10)
+	cancel()
+	if err := l.wait(1000); err != context.Canceled {
+		t.Errorf("Expected a cancelled wait to return context.Canceled, got %v", err)
+	}
+}
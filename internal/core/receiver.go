@@ -1,22 +1,21 @@
 package core
 
 import (
-	"archive/tar"
-	"archive/zip"
 	"bytes"
-	"compress/gzip"
 	"context"
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/atotto/clipboard"
 	"github.com/darkprince558/jend/internal/transport"
 	"github.com/darkprince558/jend/internal/ui"
 	"github.com/darkprince558/jend/pkg/protocol"
@@ -28,53 +27,85 @@ import (
 	"github.com/darkprince558/jend/internal/signaling"
 )
 
+// DefaultParallelThreshold is the file size above which the receiver splits the
+// download across --concurrency streams.
+const DefaultParallelThreshold = 100 * 1024 * 1024
+
+// A discovered address gets a short reachability probe before we commit to it.
+// A cloud registry entry is the sender's public IP: behind NAT it never answers,
+// and ICE should get its turn instead of the whole retry loop.
+const (
+	discoveryDialAttempts = 3
+	discoveryDialTimeout  = 3 * time.Second
+)
+
+// maxRetryDelay caps the linear backoff between failed dials.
+const maxRetryDelay = 30 * time.Second
+
 // RunReceiver handles the main receiving logic
-func RunReceiver(p *tea.Program, code string, outputDir string, autoUnzip bool, noClipboard bool, noHistory bool, concurrency int, turnCfg *transport.CustomTurnConfig) {
+// Cancelling ctx stops discovery, signaling and retries.
+// It returns the error that ended the session, nil once the file is saved.
+func RunReceiver(ctx context.Context, p Notifier, opts ReceiveOptions) (finalErr error) {
+	if p == nil {
+		// With --stdout the payload owns stdout; everything else goes to stderr
+		var logOut io.Writer = os.Stdout
+		if opts.Stdout {
+			logOut = os.Stderr
+		}
+		p = &Printer{W: logOut, Interval: DefaultProgressInterval}
+	}
+
 	sendMsg := func(msg tea.Msg) {
-		if p != nil {
-			p.Send(msg)
-		} else {
-			switch m := msg.(type) {
-			case ui.ErrorMsg:
-				fmt.Println("Error:", m)
-				// os.Exit(1) handled in defer
-			case ui.StatusMsg:
-				fmt.Println("Status:", m)
-			case ui.ProgressMsg:
-				if m.TotalBytes > 0 && m.SentBytes == m.TotalBytes {
-					fmt.Println("Done!")
-				}
+		if text, ok := msg.(ui.TextMsg); ok {
+			if _, tui := p.(*tea.Program); tui {
+				// The TUI has quit once the transfer is done; print below it
+				fmt.Printf("\nReceived Text:\n%s\n", text)
+				return
 			}
 		}
+		p.Send(msg)
+	}
+
+	if err := opts.validate(); err != nil {
+		sendMsg(ui.ErrorMsg(err))
+		return err
 	}
+	opts.ExpectSender, _ = parseExpectedSender(opts.ExpectSender) // Checked above
 
 	time.Sleep(time.Second * 1) // Fake discovery time
 
 	startTime := time.Now()
-	var finalErr error
 	var fileHash string
 	var fileSize int64
-	var exitCode int
+	var saved receivedFile // Filled in by the handshake; empty if we never got that far
+	var attempts attemptLog
+	limiter := newRateLimiter(ctx, opts.Rate)
+	if limiter != nil {
+		sendMsg(ui.StatusMsg(fmt.Sprintf("Bandwidth limited to %s/s", audit.FormatBytes(opts.Rate))))
+	}
 
 	// Audit Log Defer
 	defer func() {
+		// Headless has no final screen; print the fallback chain on the way out
+		if pr, ok := p.(*Printer); ok {
+			fmt.Fprint(pr.W, attempts.String())
+		}
+
 		status := "failed"
 		errMsg := ""
 		if finalErr == nil {
 			status = "success"
 		} else {
 			errMsg = finalErr.Error()
-			if p == nil {
-				exitCode = 1
-			}
 		}
 
-		if !noHistory {
+		if !opts.NoHistory {
 			audit.WriteEntry(audit.LogEntry{
 				Timestamp: startTime,
 				Role:      "receiver",
-				Code:      code,
-				FileName:  filepath.Base(outputDir), // Rough approximation or update later
+				Code:      opts.Code,
+				FileName:  saved.Name,
+				FilePath:  saved.Path,
 				FileSize:  fileSize,
 				FileHash:  fileHash,
 				Status:    status,
@@ -82,10 +113,6 @@ func RunReceiver(p *tea.Program, code string, outputDir string, autoUnzip bool,
 				Duration:  time.Since(startTime).Seconds(),
 			})
 		}
-
-		if p == nil && exitCode != 0 {
-			os.Exit(exitCode)
-		}
 	}()
 
 	sendMsg(ui.StatusMsg("Searching for sender on local network..."))
@@ -97,155 +124,396 @@ func RunReceiver(p *tea.Program, code string, outputDir string, autoUnzip bool,
 	// We determine HOW to connect (Direct IP or ICE P2P) and store it in this function.
 	var dialFunc func(context.Context) (*quic.Conn, error)
 	var connectionDesc string
-
-	// Try Discovery
-	// address := "localhost:" + Port // Removed unused var
-	foundIP, err := discovery.FindSender(code, 2*time.Second) // Reduced local timeout
-	if err == nil {
-		sendMsg(ui.StatusMsg(fmt.Sprintf("Found sender at %s!", foundIP)))
-		dialectAddr := foundIP
-		connectionDesc = foundIP
-		dialFunc = func(ctx context.Context) (*quic.Conn, error) {
-			return tr.Dial(dialectAddr)
-		}
-	} else {
-		sendMsg(ui.StatusMsg("Local discovery timed out, checking Cloud Registry..."))
-		cloudIP, errCloud := discovery.LookupCloud(code)
-		if errCloud == nil {
-			sendMsg(ui.StatusMsg(fmt.Sprintf("Found sender via Cloud at %s!", cloudIP)))
-			dialectAddr := cloudIP
-			connectionDesc = cloudIP
-			dialFunc = func(ctx context.Context) (*quic.Conn, error) {
-				return tr.Dial(dialectAddr)
+	via := "QUIC direct"      // For the summary
+	var probedConn *quic.Conn // Connection from the discovery probe, used for the first session
+	var directAddr string     // Discovered sender address dialFunc connects to
+	var discoveredVia string  // Backend that found directAddr
+	var candidates []string   // Other discovered addresses, tried if directAddr fails the PAKE
+	var unreachable []string  // Discovered addresses QUIC couldn't reach: UDP may be blocked
+	var tcpAddr string        // The sender's TCP listener, once QUIC has given way to it
+	var probedTCP net.Conn    // Connection from the TCP fallback, used for the next session
+
+	fallbackPort := strconv.Itoa(DefaultPort) // The sender's --port, once discovery has seen it
+
+	// Try Discovery: each configured backend in order, first hit wins
+	backends := discovery.Backends()
+	if opts.LANOnly {
+		backends = discovery.LANBackends()
+		sendMsg(ui.StatusMsg("LAN-only mode: cloud registry and P2P signaling disabled"))
+	}
+	backends = discovery.WithIdentity(backends, discovery.Identity{Expect: opts.ExpectSender})
+	if opts.Hint != "" {
+		// The address from a jend:// link goes first; if it's stale the probe fails
+		backends = append([]discovery.Discoverer{discovery.Hint(opts.Hint)}, backends...)
+	}
+	for _, d := range backends {
+		found, err := d.Find(opts.Code, 2*time.Second) // Reduced local timeout
+		if err != nil {
+			attempts.record(d.Name(), "", err)
+			if errors.Is(err, discovery.ErrNoMulticast) {
+				sendMsg(ui.StatusMsg(fmt.Sprintf("Skipping %s: no multicast on this network", d.Name())))
+				continue
 			}
-		} else {
-			sendMsg(ui.StatusMsg("Cloud lookup failed. Initiating P2P Signaling (ICE)..."))
+			sendMsg(ui.StatusMsg(fmt.Sprintf("Discovery via %s failed: %v", d.Name(), err)))
+			continue
+		}
+		found = discovery.OrderAddrs(found, opts.IPPref)
+		if _, port, err := net.SplitHostPort(found[0]); err == nil {
+			fallbackPort = port
+		}
+		attempts.record(d.Name(), "found "+strings.Join(found, ", "), nil)
+		sendMsg(ui.StatusMsg(fmt.Sprintf("Found sender via %s at %s!", d.Name(), strings.Join(found, ", "))))
 
-			// Start P2P Negotiation (Blocking for setup)
-			sigClient, errSig := signaling.NewIoTClient(context.Background(), "receiver-"+code)
-			if errSig == nil {
-				// Note: We keep sigClient connected if P2P manager needs it, or strictly for setup.
-				// The p2p manager currently uses it for signaling exchange then ICE takes over.
-				// We can disconnect after ICE is established, but let's defer carefully.
-				// defer sigClient.Disconnect() // Defer runs at function exit.
+		conn, foundAddr, err := probeDial(tr, found)
+		attempts.record("QUIC "+strings.Join(found, ", "), "probe", err)
+		if err != nil {
+			sendMsg(ui.StatusMsg(fmt.Sprintf("Direct dial to %s failed (sender may be behind NAT): %v", strings.Join(found, ", "), err)))
+			unreachable = append(unreachable, found...)
+			continue
+		}
+		probedConn = conn
 
-				p2p := transport.NewP2PManager(sigClient, code, turnCfg)
-				pc, errIce := p2p.EstablishConnection(context.Background(), true) // true = Offerer (Receiver)
+		directAddr, discoveredVia = foundAddr, d.Name()
+		candidates = remainingAddrs(found, foundAddr)
+		connectionDesc = fmt.Sprintf("%s (found via %s)", directAddr, discoveredVia)
+		dialFunc = func(ctx context.Context) (*quic.Conn, error) {
+			return tr.Dial(directAddr)
+		}
+		break
+	}
 
-				// We can disconnect signaling now that ICE is set
-				sigClient.Disconnect()
+	// Found, but QUIC didn't get through: the network may block UDP, so try
+	// the TCP listener the sender keeps on the same port before ICE
+	if dialFunc == nil && len(unreachable) > 0 {
+		c, addr, err := dialTCP(ctx, unreachable)
+		attempts.record("TCP "+strings.Join(unreachable, ", "), "fallback", err)
+		if err == nil {
+			sendMsg(ui.StatusMsg(fmt.Sprintf("UDP looks blocked; reached the sender over TCP at %s", addr)))
+			probedTCP, tcpAddr = c, addr
+			connectionDesc = addr + " (TCP fallback)"
+			via = "TCP fallback"
+		}
+	}
 
-				if errIce == nil {
-					sendMsg(ui.StatusMsg("P2P (ICE) Connected! Switching transport..."))
-					connectionDesc = "via P2P ICE"
-					dialFunc = func(ctx context.Context) (*quic.Conn, error) {
-						return tr.DialPacket(pc, nil)
-					}
-				} else {
-					sendMsg(ui.StatusMsg(fmt.Sprintf("P2P ICE Failed: %v", errIce)))
+	if dialFunc == nil && tcpAddr == "" && !opts.LANOnly {
+		sendMsg(ui.StatusMsg("Discovery failed. Initiating P2P Signaling (ICE)..."))
+
+		// Start P2P Negotiation (Blocking for setup)
+		sigClient, errSig := signaling.Connect(ctx, signaling.ClientID("receiver"))
+		if errSig == nil {
+			p2p := transport.NewP2PManager(sigClient, opts.Code, opts.ICE)
+			p2p.OnStatus = func(s string) { sendMsg(ui.StatusMsg(s)) }
+			pc, errIce := p2p.EstablishConnection(ctx, true) // true = Offerer (Receiver)
+
+			if errIce == nil {
+				// Signaling stays up until we return: ICE restarts renegotiate over it
+				defer sigClient.Disconnect()
+				attempts.record("ICE", p2p.SelectedPath(), nil)
+				sendMsg(ui.StatusMsg("P2P (ICE) Connected! Switching transport..."))
+				connectionDesc = "via P2P ICE"
+				via = iceProtocol(p2p.PathType())
+				dialFunc = func(ctx context.Context) (*quic.Conn, error) {
+					return tr.DialPacket(pc, nil)
 				}
 			} else {
-				sendMsg(ui.StatusMsg(fmt.Sprintf("Signaling Auth Failed: %v", errSig)))
+				sigClient.Disconnect()
+				attempts.record("ICE", p2p.CandidateSummary(), errIce)
+				sendMsg(ui.StatusMsg(fmt.Sprintf("P2P ICE Failed: %v", errIce)))
 			}
+		} else {
+			attempts.record("signaling", "", errSig)
+			sendMsg(ui.StatusMsg(fmt.Sprintf("Signaling Auth Failed: %v", errSig)))
 		}
 	}
 
 	// Fallback to Localhost if everything failed (Legacy/Testing)
-	if dialFunc == nil {
+	if dialFunc == nil && tcpAddr == "" {
 		sendMsg(ui.StatusMsg("Fallback exhausted. Defaulting to localhost dial..."))
 		connectionDesc = "localhost"
+		via = "QUIC direct (localhost)"
 		dialFunc = func(ctx context.Context) (*quic.Conn, error) {
-			return tr.Dial("localhost:" + Port)
+			return tr.Dial(net.JoinHostPort("localhost", fallbackPort))
 		}
 	}
 
 	// Main Receiver Loop
 	// We will attempt to authenticate and resume until complete or fatal error
 
+	// maxAttempts bounds consecutive failed dials; 0 retries forever
 	retryCount := 0
-	maxRetries := 10 // Global retries for connection establishment
+	var connectedAt time.Time // First successful dial: the summary's elapsed time
 
 	for {
+		if ctx.Err() != nil {
+			finalErr = ctx.Err()
+			return
+		}
 
 		sendMsg(ui.StatusMsg("Dialing " + connectionDesc + "..."))
 
 		// Use the strategy
-		conn, err := dialFunc(context.Background())
-
+		var conn *quic.Conn
+		var tcpConn net.Conn // Set instead of conn on the TCP fallback
+		var err error
+		switch {
+		case probedConn != nil:
+			conn, probedConn = probedConn, nil
+		case probedTCP != nil:
+			tcpConn, probedTCP = probedTCP, nil
+		case tcpAddr != "":
+			tcpConn, _, err = dialTCP(ctx, []string{tcpAddr})
+			attempts.record("TCP "+tcpAddr, "", err)
+		default:
+			conn, err = dialFunc(ctx)
+			attempts.record("QUIC "+connectionDesc, "", err)
+		}
 		if err != nil {
 			retryCount++
-			if retryCount > maxRetries {
+			if retryCount == tcpFallbackAfter && tcpAddr == "" && directAddr != "" {
+				// The sender answered QUIC before, so UDP may have been cut since
+				// (e.g. the network changed): its TCP listener may still get through
+				c, _, terr := dialTCP(ctx, []string{directAddr})
+				attempts.record("TCP "+directAddr, "fallback", terr)
+				if terr == nil {
+					sendMsg(ui.StatusMsg(fmt.Sprintf("QUIC keeps failing; switching to TCP at %s", directAddr)))
+					probedTCP, tcpAddr = c, directAddr
+					connectionDesc = directAddr + " (TCP fallback)"
+					via = "TCP fallback"
+					continue
+				}
+			}
+			if opts.MaxAttempts > 0 && retryCount >= opts.MaxAttempts {
 				finalErr = err
-				sendMsg(ui.ErrorMsg(fmt.Errorf("max retries exceeded: %v", err)))
+				sendMsg(ui.AttemptsMsg(attempts.String()))
+				sendMsg(ui.ErrorMsg(fmt.Errorf("giving up after %d attempts: %v", retryCount, err)))
 				return
 			}
-			sendMsg(ui.StatusMsg(fmt.Sprintf("Connection failed. Retrying in %d seconds...", retryCount)))
-			time.Sleep(time.Duration(retryCount) * time.Second)
+			delay := time.Duration(retryCount) * time.Second
+			if delay > maxRetryDelay {
+				delay = maxRetryDelay // --max-attempts 0 can retry for hours
+			}
+			sendMsg(ui.StatusMsg(fmt.Sprintf("Connection failed. Retrying in %d seconds...", int(delay.Seconds()))))
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
 			continue
 		}
 
 		// Reset retry count on successful dial
 		retryCount = 0
-		sendMsg(ui.StatusMsg("Connected! Opening stream..."))
+		if connectedAt.IsZero() {
+			connectedAt = time.Now()
+		}
+		sendMsg(ui.AttemptsMsg(attempts.String()))
 
-		stream, err := conn.OpenStreamSync(context.Background())
-		if err != nil {
-			sendMsg(ui.ErrorMsg(fmt.Errorf("failed to open stream: %v", err)))
-			conn.CloseWithError(0, "stream open failed")
-			time.Sleep(time.Second)
-			continue
+		// hangUp ends the connection; TCP can't carry the reason
+		hangUp := func(reason string) {
+			if conn != nil {
+				conn.CloseWithError(0, reason)
+			} else {
+				tcpConn.Close()
+			}
+		}
+
+		var stream io.ReadWriteCloser
+		stopTCPClose := func() bool { return false }
+		if tcpConn != nil {
+			// The connection is the one stream. Cancelling drops it after the
+			// grace period, as cancelOnDone does for a QUIC connection.
+			sendMsg(ui.StatusMsg("Connected over TCP!"))
+			stream = tcpConn
+			stopTCPClose = context.AfterFunc(ctx, func() {
+				time.AfterFunc(cancelGracePeriod, func() { tcpConn.Close() })
+			})
+		} else {
+			sendMsg(ui.StatusMsg("Connected! Opening stream..."))
+			qs, err := conn.OpenStreamSync(ctx)
+			if err != nil {
+				sendMsg(ui.ErrorMsg(fmt.Errorf("failed to open stream: %v", err)))
+				conn.CloseWithError(0, "stream open failed")
+				time.Sleep(time.Second)
+				continue
+			}
+			stream = qs
 		}
 
 		// Handle Session
-		done, size, hash, err := handleReceiveSession(conn, stream, code, outputDir, autoUnzip, noClipboard, sendMsg, concurrency)
+		done, size, hash, err := handleReceiveSession(ctx, conn, limitStream(stream, limiter), &opts, sendMsg, limiter, via, &saved)
+		stopTCPClose()
 		fileSize = size
 		fileHash = hash
 
+		// --fresh only applies until the handshake got through; retries must resume what we just wrote
+		if size != 0 {
+			opts.Fresh = false
+		}
+
 		if done {
-			// Success!
+			// Success! Hang up so the sender doesn't wait out the idle timeout
+			hangUp("done")
+			sendMsg(ui.SummaryMsg{Bytes: size, Elapsed: time.Since(connectedAt), Protocol: via, Integrity: hash != ""})
+			return
+		}
+
+		if errors.Is(err, errDeclined) {
+			sendMsg(ui.StatusMsg("Transfer declined."))
+			hangUp("declined")
+			return
+		}
+
+		if errors.Is(err, errRefused) {
+			finalErr = err
+			sendMsg(ui.ErrorMsg(err))
+			hangUp("refused")
 			return
 		}
 
 		if err != nil {
-			// Check for cancellation
-			if strings.Contains(err.Error(), "transfer cancelled by sender") {
+			// Whoever answered there doesn't know the code: a hash collision or a
+			// squatter. Move on to the next discovered sender rather than retry it.
+			if errors.Is(err, errAuthFailed) && len(candidates) > 0 && conn != nil {
+				hangUp("authentication failed")
+				sendMsg(ui.StatusMsg(fmt.Sprintf("Sender at %s failed authentication, trying the next one...", directAddr)))
+				next, addr, perr := probeDial(tr, candidates)
+				attempts.record("QUIC "+strings.Join(candidates, ", "), "probe", perr)
+				if perr == nil {
+					probedConn, directAddr = next, addr
+					candidates = remainingAddrs(candidates, addr)
+					connectionDesc = fmt.Sprintf("%s (found via %s)", directAddr, discoveredVia)
+					continue
+				}
+				candidates = nil
+			}
+			if codeRejected(err) || (tcpConn != nil && errors.Is(err, errAuthFailed)) {
+				// Retrying would only count against the sender's wrong-code limit.
+				// Over TCP the sender just hangs up on a wrong code, so any PAKE
+				// failure counts.
+				finalErr = fmt.Errorf("the sender rejected the code; check it and try again")
+				sendMsg(ui.AttemptsMsg(attempts.String()))
+				sendMsg(ui.ErrorMsg(finalErr))
+				return
+			}
+			if ctx.Err() != nil {
+				// Stopped mid-transfer; the sender was told, and the partial stays for a resume
+				hangUp("cancelled")
+				sendMsg(ui.StatusMsg("Cancelled. Receive again with the same code to resume."))
+				finalErr = ctx.Err()
+				return
+			}
+			// Check for cancellation, or a sender that can't go on (e.g. its disk failed)
+			var senderErr *senderError
+			if errors.Is(err, errSenderCancelled) || errors.As(err, &senderErr) {
+				hangUp("cancelled") // The sender waits for this before it exits
 				finalErr = err
 				sendMsg(ui.ErrorMsg(err))
 				return
 			}
+			// Bytes already written to stdout can't be taken back or resumed
+			if opts.Stdout && size != 0 {
+				finalErr = err
+				sendMsg(ui.ErrorMsg(fmt.Errorf("transfer to stdout interrupted: %v", err)))
+				return
+			}
 			sendMsg(ui.StatusMsg(fmt.Sprintf("Transfer interrupted (%v). Retrying...", err)))
 			stream.Close()
 			// Close connection if not already closed
-			conn.CloseWithError(0, "interrupted")
+			hangUp("interrupted")
 			time.Sleep(time.Second)
 			continue
 		}
 	}
 }
 
+// iceProtocol names an ICE path (transport.P2PManager.PathType) for progress
+// and the summary.
+func iceProtocol(pathType string) string {
+	switch pathType {
+	case "relay":
+		return "QUIC over TURN relay"
+	case "srflx":
+		return "QUIC over STUN (NAT traversal)"
+	case "host":
+		return "QUIC over ICE (LAN)"
+	}
+	return "QUIC over ICE"
+}
+
+// errAuthFailed marks a session that failed the PAKE.
+var errAuthFailed = errors.New("authentication failed")
+
+// codeRejected reports whether the sender hung up because our PAKE proof was
+// wrong, as opposed to the connection failing mid-handshake.
+func codeRejected(err error) bool {
+	var appErr *quic.ApplicationError
+	return errors.As(err, &appErr) && appErr.Remote && appErr.ErrorMessage == wrongCodeReason
+}
+
+// remainingAddrs returns the candidates after the one that answered.
+func remainingAddrs(addrs []string, answered string) []string {
+	for i, a := range addrs {
+		if a == answered {
+			return append([]string(nil), addrs[i+1:]...)
+		}
+	}
+	return nil
+}
+
+// probeDial tries a sender's discovered addresses in order, a few rounds with a
+// short deadline and exponential backoff, separate from the main retry loop.
+// It returns the connection and the address that answered.
+func probeDial(tr *transport.QUICTransport, addrs []string) (*quic.Conn, string, error) {
+	lastErr := fmt.Errorf("no address to dial")
+	backoff := 500 * time.Millisecond
+	for i := 0; i < discoveryDialAttempts; i++ {
+		if i > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		for _, addr := range addrs {
+			ctx, cancel := context.WithTimeout(context.Background(), discoveryDialTimeout)
+			conn, err := tr.DialContext(ctx, addr)
+			cancel()
+			if err == nil {
+				return conn, addr, nil
+			}
+			lastErr = fmt.Errorf("%s: %w", addr, err)
+		}
+	}
+	return nil, "", lastErr
+}
+
+// receivedFile is what the audit log records about a session's output.
+type receivedFile struct {
+	Name string // Name it was saved under (the sender's name for text and --stdout)
+	Path string // Absolute path on disk, set once a hashed file is saved
+}
+
 // handleReceiveSession encapsulates the logic for a single resume attempt
+// via is how the connection travels (e.g. "QUIC over TURN relay"), shown with progress.
+// saved receives the name and location of the output, for the audit log.
 func handleReceiveSession(
+	ctx context.Context, // Cancelling it mid-transfer tells the sender to stop
 	conn *quic.Conn,
 	stream io.ReadWriter,
-	code string,
-	outputDir string,
-	autoUnzip bool,
-	noClipboard bool,
+	opts *ReceiveOptions, // opts.Confirm is cleared once the user has said yes
 	sendMsg func(tea.Msg),
-	concurrency int,
+	limiter *rateLimiter,
+	via string,
+	saved *receivedFile,
 ) (bool, int64, string, error) {
 	var fileSize int64
 	var fileHash string
 
 	// 1. PAKE Authentication
 	sendMsg(ui.StatusMsg("Authenticating..."))
-	key, err := PerformPAKE(stream, code, 1)
+	key, suite, err := PerformPAKE(stream, opts.Code, 1, PAKEOptions{Cipher: opts.Cipher})
 	if err != nil {
-		return false, 0, "", fmt.Errorf("authentication failed: %v", err)
+		return false, 0, "", fmt.Errorf("%w: %w", errAuthFailed, err)
 	}
 
 	// Upgrade to Secure Stream
-	secureStream, err := NewSecureStream(stream, key)
+	secureStream, err := NewSecureStream(stream, key, 1, suite)
 	if err != nil {
 		return false, 0, "", fmt.Errorf("failed to create secure stream: %v", err)
 	}
@@ -254,10 +522,10 @@ func handleReceiveSession(
 	// 2. Handshake
 	sendMsg(ui.StatusMsg("Authenticated! Waiting for handshake..."))
 
-	// Read Handshake
-	pType, length, err := protocol.DecodeHeader(stream)
-	if err != nil || pType != protocol.TypeHandshake {
-		return false, 0, "", fmt.Errorf("invalid handshake")
+	// Read Handshake, proving who we are first if the sender has an allow-list
+	length, err := readOffer(stream, key)
+	if err != nil {
+		return false, 0, "", err
 	}
 
 	metaBytes := make([]byte, length)
@@ -271,69 +539,148 @@ func handleReceiveSession(
 	}
 	fileSize = meta.Size
 
-	// Handle Text Mode
+	senderFP, err := verifySender(meta, key, opts.ExpectSender)
+	if err != nil {
+		refuseOffer(conn, stream, err.Error())
+		return false, 0, "", err
+	}
+	if senderFP != "" {
+		sendMsg(ui.StatusMsg("Sender identity verified: " + senderFP))
+	}
+
 	if meta.Type == "text" {
-		// Just check size warnings
 		sendMsg(ui.StatusMsg("Receiving text snippet..."))
+	}
 
-		// Read all data
-		// Limit size for safety (e.g. 1MB for text)
-		limit := int64(1 * 1024 * 1024)
-		if meta.Size > limit {
-			return false, meta.Size, "", fmt.Errorf("text content too large (>1MB)")
-		}
+	// Live stream (sender --follow): size is unknown until the sender stops
+	isStream := meta.Type == "stream"
+	if isStream {
+		sendMsg(ui.StatusMsg("Receiving live stream. It ends when the sender stops sending."))
 	}
 
 	// Prepare Output
-	safeName := filepath.Base(meta.Name)
-	if safeName == "." || safeName == "/" {
-		safeName = "received_file"
+	safeName := sanitizeFilename(meta.Name)
+	if opts.OutputName != "" {
+		safeName = opts.OutputName // --output: the user's choice, already a plain name
+	}
+	saved.Name = safeName
+
+	if err := checkOffer(meta, safeName, opts); err != nil {
+		refuseOffer(conn, stream, err.Error())
+		return false, 0, "", err
+	}
+
+	if opts.Confirm {
+		if err := confirmOffer(conn, stream, meta, safeName, sendMsg); err != nil {
+			return false, 0, "", err
+		}
+		opts.Confirm = false // Don't ask again when a retry resumes
 	}
 
 	// Ensure output directory exists
-	if outputDir != "." {
-		if err := os.MkdirAll(outputDir, 0755); err != nil {
+	if opts.OutputDir != "." {
+		if err := os.MkdirAll(opts.OutputDir, 0755); err != nil {
 			return false, fileSize, "", fmt.Errorf("failed to create output dir: %w", err)
 		}
 	}
 
+	if meta.Type == "multi" {
+		if opts.Stdout || opts.OutputName != "" {
+			return false, fileSize, "", fmt.Errorf("--stdout and --output take a single file, the sender is sending %d", len(meta.Files))
+		}
+		return receiveMulti(ctx, conn, stream, meta, opts, sendMsg, via, saved)
+	}
+
+	// An older version to rebuild from, if only the changes are wanted (--delta)
+	var basis *os.File
+	var deltaBlock int
+	if !opts.Stdout {
+		basis, deltaBlock = openDeltaBasis(meta, safeName, opts)
+	}
+	if basis != nil {
+		defer basis.Close()
+	}
+
 	// Decide on Parallel vs Sequential
-	// Threshold: 100MB
-	useParallel := meta.Size > 100*1024*1024 && meta.Type != "text"
+	// A single stream gains nothing from the range machinery, and the TCP
+	// fallback (no conn) has only the one; a delta is one stream
+	useParallel := basis == nil && meta.Size > opts.ParallelThreshold && opts.Concurrency > 1 && meta.Type != "text" && conn != nil
+	if useParallel && opts.Stdout {
+		// Parallel ranges land out of order; stdout can only take bytes in sequence
+		sendMsg(ui.StatusMsg("Writing to stdout: parallel download and resume disabled."))
+		useParallel = false
+	}
 
 	if useParallel {
-		sendMsg(ui.StatusMsg(fmt.Sprintf("Large file detected (%d MB). Using %d parallel streams...", meta.Size/1024/1024, concurrency)))
-		return downloadParallel(conn, stream, meta, outputDir, safeName, sendMsg, code, concurrency) // Call specialized function
+		sendMsg(ui.StatusMsg(fmt.Sprintf("Large file detected (%d MB). Using %d parallel streams...", meta.Size/1024/1024, opts.Concurrency)))
+		return downloadParallel(ctx, conn, stream, meta, safeName, opts, sendMsg, limiter, via, saved) // Call specialized function
 	}
 
 	// Fallback to Sequential (Original Logic)
 	// Send Ack
-	partialPath := filepath.Join(outputDir, safeName+".partial")
+	partialPath := filepath.Join(opts.OutputDir, safeName+".partial")
 	var offset int64 = 0
 
-	if meta.Type != "text" {
+	if opts.Stdout {
+		// Nothing on disk to resume from
+	} else if meta.Type != "text" && opts.Fresh {
+		if err := os.Remove(partialPath); err == nil {
+			sendMsg(ui.StatusMsg("Discarded previous partial download (--fresh)."))
+		}
+	} else if meta.Type != "text" && !meta.NoResume {
 		if info, err := os.Stat(partialPath); err == nil {
-			if info.Size() < meta.Size && info.Size() > 0 {
+			if (isStream || info.Size() < meta.Size) && info.Size() > 0 {
 				offset = info.Size()
 				sendMsg(ui.StatusMsg(fmt.Sprintf("Partial download found. Resuming from %d bytes...", offset)))
 			}
 		}
 	}
 
-	if err := protocol.EncodeHeader(stream, protocol.TypeAck, 8); err != nil {
-		return false, fileSize, "", err
-	}
-	if err := binary.Write(stream, binary.LittleEndian, offset); err != nil {
-		return false, fileSize, "", err
+	withCRC := meta.ChunkCRC && basis == nil
+	if basis != nil {
+		sendMsg(ui.StatusMsg("Older version of " + safeName + " found. Asking for the changes only (--delta)..."))
+		// Reading it all can take a while; keep the sender from idling out
+		stopKeepAlive := startKeepAlive(stream)
+		sig, err := deltaSignature(basis, deltaBlock)
+		stopKeepAlive()
+		if err != nil {
+			return false, fileSize, "", fmt.Errorf("failed to read the older version: %w", err)
+		}
+		if err := protocol.EncodeHeader(stream, protocol.TypeDeltaSig, uint32(len(sig))); err != nil {
+			return false, fileSize, "", err
+		}
+		if _, err := stream.Write(sig); err != nil {
+			return false, fileSize, "", err
+		}
+	} else {
+		ackLen := uint32(8)
+		if withCRC {
+			ackLen = 9
+		}
+		if err := protocol.EncodeHeader(stream, protocol.TypeAck, ackLen); err != nil {
+			return false, fileSize, "", err
+		}
+		if err := binary.Write(stream, binary.LittleEndian, offset); err != nil {
+			return false, fileSize, "", err
+		}
+		if withCRC {
+			if err := binary.Write(stream, binary.LittleEndian, uint8(ackFlagChunkCRC)); err != nil {
+				return false, fileSize, "", err
+			}
+		}
 	}
 
+	defer cancelOnDone(ctx, conn, stream)()
+
 	sendMsg(ui.StatusMsg("Receiving " + safeName))
 
 	// Continuation of Sequential Logic variables
 	var outFile io.WriteCloser
 	var textBuf *bytes.Buffer
 
-	if meta.Type == "text" {
+	if opts.Stdout {
+		outFile = &nopCloser{os.Stdout}
+	} else if meta.Type == "text" {
 		textBuf = new(bytes.Buffer)
 		// wrapper to satisfy WriteCloser
 		outFile = &nopCloser{textBuf}
@@ -356,7 +703,7 @@ func handleReceiveSession(
 	// Receive Loop
 	buf := make([]byte, ChunkSize)
 	var totalRecv int64 = offset
-	startTime := time.Now()
+	throughput := newThroughputEstimator(offset, time.Now()) // Resumed bytes didn't travel this session
 
 	hasher := sha256.New()
 
@@ -376,8 +723,11 @@ func handleReceiveSession(
 	mw := io.MultiWriter(outFile, hasher)
 
 	for {
-		pType, length, err := protocol.DecodeHeader(stream)
+		pType, length, err := readHeader(stream)
 		if err != nil {
+			if ctx.Err() != nil {
+				return false, fileSize, "", ctx.Err()
+			}
 			if err == io.EOF {
 				break
 			}
@@ -389,10 +739,36 @@ func handleReceiveSession(
 		}
 
 		if pType == protocol.TypeCancel {
-			return false, fileSize, "", fmt.Errorf("transfer cancelled by sender")
+			return false, fileSize, "", cancelError(stream, length)
+		}
+		if pType == protocol.TypeError {
+			return false, fileSize, "", readSenderError(stream, length)
+		}
+
+		if pType == protocol.TypeDeltaCopy && basis != nil {
+			off, n, err := readDeltaCopy(stream, length)
+			if err != nil {
+				return false, fileSize, "", err
+			}
+			if off < 0 || n <= 0 || n > meta.Size-totalRecv {
+				return false, fileSize, "", fmt.Errorf("invalid delta copy %d+%d at offset %d", off, n, totalRecv)
+			}
+			copied, err := io.Copy(mw, io.NewSectionReader(basis, off, n))
+			if err == nil && copied != n {
+				err = fmt.Errorf("older version has no bytes %d-%d", off, off+n)
+			}
+			if err != nil {
+				sendCancel(stream, "can't rebuild the file: "+err.Error())
+				return false, fileSize, "", err
+			}
+			totalRecv += n
+			continue
 		}
 
 		if pType == protocol.TypeData {
+			if length > MaxFrameSize {
+				return false, fileSize, "", fmt.Errorf("oversized data packet: %d bytes", length)
+			}
 			// Reallocate if buf too small
 			if uint32(len(buf)) < length {
 				buf = make([]byte, length)
@@ -400,26 +776,39 @@ func handleReceiveSession(
 			if _, err := io.ReadFull(stream, buf[:length]); err != nil {
 				return false, fileSize, "", err
 			}
-			mw.Write(buf[:length])
-			totalRecv += int64(length)
+			data := buf[:length]
+			if withCRC {
+				// Drop the bad chunk: the retry resumes from the last good byte in .partial
+				if data, err = verifyChunkCRC(data); err != nil {
+					return false, fileSize, "", fmt.Errorf("%w at offset %d", err, totalRecv)
+				}
+			}
+			if isStream && opts.MaxSize > 0 && totalRecv+int64(len(data)) > opts.MaxSize {
+				sendCancel(stream, "stream is over the receiver's --max-size")
+				return false, fileSize, "", fmt.Errorf("%w: stream is over the --max-size of %s", errRefused, audit.FormatBytes(opts.MaxSize))
+			}
+			if !isStream && totalRecv+int64(len(data)) > meta.Size {
+				return false, fileSize, "", fmt.Errorf("sender sent more than the %d bytes it offered", meta.Size)
+			}
+			if _, err := mw.Write(data); err != nil {
+				sendCancel(stream, "can't write the file: "+err.Error())
+				return false, fileSize, "", err
+			}
+			totalRecv += int64(len(data))
 
 			// Calculate Telemetry
-			elapsed := time.Since(startTime).Seconds()
-			var speed float64
-			var eta time.Duration
-			if elapsed > 0 {
-				speed = float64(totalRecv) / elapsed
-				if speed > 0 {
-					eta = time.Duration(float64(meta.Size-totalRecv)/speed) * time.Second
-				}
+			size := meta.Size
+			if isStream {
+				size = -1
 			}
+			speed, eta := throughput.update(totalRecv, size, time.Now())
 
 			sendMsg(ui.ProgressMsg{
 				SentBytes:  totalRecv,
 				TotalBytes: meta.Size,
 				Speed:      speed,
 				ETA:        eta,
-				Protocol:   "QUIC (Direct)",
+				Protocol:   via,
 			})
 		}
 	}
@@ -429,6 +818,11 @@ func handleReceiveSession(
 	if c, ok := stream.(io.Closer); ok {
 		c.Close()
 	}
+	if isStream {
+		// Now we know how big it was
+		meta.Size = totalRecv
+		fileSize = totalRecv
+	}
 	sendMsg(ui.ProgressMsg{
 		SentBytes:  meta.Size,
 		TotalBytes: meta.Size,
@@ -441,165 +835,70 @@ func handleReceiveSession(
 	outFile.Close()
 
 	// Verify Checksum
-	finalPath := filepath.Join(outputDir, safeName)
-	if meta.Hash != "" {
-		recvHash := fmt.Sprintf("%x", hasher.Sum(nil))
-		if recvHash == meta.Hash {
-			sendMsg(ui.StatusMsg("Integrity Check: PASSED"))
-
-			if meta.Type == "text" {
-				content := textBuf.String()
-				fmt.Printf("\nReceived Text:\n%s\n", content)
-				if !noClipboard {
-					if err := clipboard.WriteAll(content); err == nil {
-						sendMsg(ui.StatusMsg("Text copied to clipboard!"))
-					} else {
-						sendMsg(ui.StatusMsg("Failed to copy to clipboard"))
-					}
-				} else {
-					sendMsg(ui.StatusMsg("Clipboard copy skipped (--no-clipboard)"))
-				}
-				return true, fileSize, meta.Hash, nil
-			}
-
-			// Safe Move Logic
-			counter := 0
-			// Find a non-colliding name
-			for {
-				if _, err := os.Stat(finalPath); os.IsNotExist(err) {
-					break
-				}
-				counter++
-				ext := filepath.Ext(safeName)
-				nameBox := strings.TrimSuffix(safeName, ext)
-				finalPath = filepath.Join(outputDir, fmt.Sprintf("%s (%d)%s", nameBox, counter, ext))
-			}
-
-			if err := os.Rename(partialPath, finalPath); err != nil {
-				return false, fileSize, "", fmt.Errorf("failed to save final file: %v", err)
+	if opts.Stdout {
+		// Data is already out; all we can do is report whether it was intact
+		if meta.Hash != "" {
+			recvHash := fmt.Sprintf("%x", hasher.Sum(nil))
+			if recvHash != meta.Hash {
+				return false, fileSize, "", fmt.Errorf("Integrity Check: FAILED (Expected %s, Got %s). Output on stdout is corrupt.", meta.Hash, recvHash)
 			}
-			fileHash = meta.Hash // Set hash for audit log only on success
-			sendMsg(ui.StatusMsg("Saved to: " + filepath.Base(finalPath)))
+			sendMsg(ui.StatusMsg("Integrity Check: PASSED"))
+		}
+		return true, fileSize, meta.Hash, nil
+	}
 
-		} else {
+	if meta.Hash != "" {
+		recvHash := fmt.Sprintf("%x", hasher.Sum(nil))
+		if recvHash != meta.Hash {
 			return false, fileSize, "", fmt.Errorf("Integrity Check: FAILED (Expected %s, Got %s).", meta.Hash, recvHash)
 		}
-	} else {
-		if meta.Type == "text" {
-			content := textBuf.String()
-			fmt.Printf("\nReceived Text:\n%s\n", content)
-			if !noClipboard {
-				clipboard.WriteAll(content)
-			}
-			return true, fileSize, "", nil
-		}
+		sendMsg(ui.StatusMsg("Integrity Check: PASSED"))
+	}
 
-		// No hash provided, move file without verification
-		os.Rename(partialPath, finalPath)
+	if meta.Type == "text" {
+		return deliverText(textBuf.String(), opts.OutputDir, opts.OutputName, opts.Force, opts.NoClipboard, sendMsg, saved, fileSize, meta.Hash)
+	}
+
+	// Safe Move Logic: find a non-colliding name, unless --force
+	finalPath := savePath(opts.OutputDir, safeName, opts.Force)
+	if err := os.Rename(partialPath, finalPath); err != nil {
+		return false, fileSize, "", fmt.Errorf("failed to save final file: %v", err)
+	}
+	saved.Name = filepath.Base(finalPath) // May have gained a " (N)" suffix
+	saved.Path, _ = filepath.Abs(finalPath)
+	restoreAttrs(finalPath, meta.Mode, meta.ModTime, opts.NoPreserve, sendMsg)
+	switch {
+	case meta.Hash != "":
+		fileHash = meta.Hash // Set hash for audit log only on success
+		sendMsg(ui.StatusMsg("Saved to: " + filepath.Base(finalPath)))
+	case isStream:
+		sendMsg(ui.StatusMsg(fmt.Sprintf("Stream ended (%d bytes). Saved to: %s", totalRecv, filepath.Base(finalPath))))
+	default:
 		sendMsg(ui.StatusMsg("Integrity Check: SKIPPED (No hash provided)"))
 	}
 
 	time.Sleep(time.Second)
 
 	// Auto-Unzip Logic
-	if autoUnzip {
-		ext := filepath.Ext(safeName)
+	if opts.Unzip {
+		var skipped int
+		var err error
 		if strings.HasSuffix(safeName, ".tar.gz") {
 			sendMsg(ui.StatusMsg("Unzipping .tar.gz archive..."))
-			// Re-open the file
-			f, err := os.Open(finalPath)
-			if err != nil {
-				return true, fileSize, fileHash, err // Return true because transfer succeeded, unzip failed
-			}
-			defer f.Close()
-
-			gzr, err := gzip.NewReader(f)
-			if err != nil {
-				return true, fileSize, fileHash, err
-			}
-			defer gzr.Close()
-
-			tr := tar.NewReader(gzr)
-
-			for {
-				header, err := tr.Next()
-				if err == io.EOF {
-					break
-				}
-				if err != nil {
-					return true, fileSize, fileHash, err
-				}
-
-				// Zip Slip Protection
-				target := filepath.Join(outputDir, header.Name)
-				if !strings.HasPrefix(target, filepath.Clean(outputDir)+string(os.PathSeparator)) {
-					// log.Println("zip slip attempt detected")
-					continue
-				}
-
-				if header.Typeflag == tar.TypeDir {
-					if err := os.MkdirAll(target, 0755); err != nil {
-						return true, fileSize, fileHash, err
-					}
-				} else if header.Typeflag == tar.TypeReg {
-					f, err := os.Create(target)
-					if err != nil {
-						return true, fileSize, fileHash, err
-					}
-					if _, err := io.Copy(f, tr); err != nil {
-						f.Close()
-						return true, fileSize, fileHash, err
-					}
-					f.Close()
-				}
-			}
-			sendMsg(ui.StatusMsg("Extracted successfully!"))
-
-		} else if ext == ".zip" {
+			skipped, err = extractTarGz(finalPath, opts.OutputDir)
+		} else if filepath.Ext(safeName) == ".zip" {
 			sendMsg(ui.StatusMsg("Unzipping .zip archive..."))
-
-			// zip.OpenReader requires random access, safe since we have the file on disk
-			zr, err := zip.OpenReader(finalPath)
-			if err != nil {
-				return true, fileSize, fileHash, err
-			}
-			defer zr.Close()
-
-			for _, f := range zr.File {
-				fpath := filepath.Join(outputDir, f.Name)
-
-				// Check for Zip Slip
-				if !strings.HasPrefix(fpath, filepath.Clean(outputDir)+string(os.PathSeparator)) {
-					continue
-				}
-
-				if f.FileInfo().IsDir() {
-					os.MkdirAll(fpath, os.ModePerm)
-					continue
-				}
-
-				if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
-					return true, fileSize, fileHash, err
-				}
-
-				outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-				if err != nil {
-					return true, fileSize, fileHash, err
-				}
-
-				rc, err := f.Open()
-				if err != nil {
-					outFile.Close()
-					return true, fileSize, fileHash, err
-				}
-
-				_, err = io.Copy(outFile, rc)
-				outFile.Close()
-				rc.Close()
-				if err != nil {
-					return true, fileSize, fileHash, err
-				}
-			}
+			skipped, err = extractZip(finalPath, opts.OutputDir)
+		} else {
+			return true, fileSize, fileHash, nil
+		}
+		if err != nil {
+			return true, fileSize, fileHash, err // Return true because transfer succeeded, unzip failed
+		}
+		if skipped > 0 {
+			sendMsg(ui.StatusMsg(fmt.Sprintf("Extracted, skipping %d unsafe or unsupported entries.", skipped)))
+		} else {
+			sendMsg(ui.StatusMsg("Extracted successfully!"))
 		}
 	}
 	return true, fileSize, fileHash, nil
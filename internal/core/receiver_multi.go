@@ -0,0 +1,363 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/darkprince558/jend/internal/ui"
+	"github.com/darkprince558/jend/pkg/protocol"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/quic-go/quic-go"
+)
+
+// copiedBytes is the size of the files materialized from others: they take
+// disk space but none of the stream.
+func copiedBytes(meta FileMeta) int64 {
+	var n int64
+	for _, e := range meta.Files {
+		if e.CopyOf != "" {
+			n += e.Size
+		}
+	}
+	return n
+}
+
+// validateManifest rejects a manifest that could write outside outputDir,
+// doesn't add up to the size in the handshake, or has a copy of nothing.
+func validateManifest(meta FileMeta) error {
+	if len(meta.Files) == 0 || len(meta.Files) > maxManifestFiles {
+		return fmt.Errorf("invalid manifest: %d files", len(meta.Files))
+	}
+	if manifestHash(meta.Files) != meta.Hash {
+		return fmt.Errorf("invalid manifest: checksum mismatch")
+	}
+	seen := make(map[string]bool)
+	sent := make(map[string]ManifestEntry) // Entries whose data is in the stream
+	var total int64
+	for _, e := range meta.Files {
+		if sanitizeFilename(e.Name) != e.Name {
+			return fmt.Errorf("invalid manifest: bad file name %q", e.Name)
+		}
+		if seen[e.Name] {
+			return fmt.Errorf("invalid manifest: %q listed twice", e.Name)
+		}
+		seen[e.Name] = true
+		if e.Size < 0 {
+			return fmt.Errorf("invalid manifest: negative size for %q", e.Name)
+		}
+		if e.CopyOf != "" {
+			// Only of an earlier file that is itself sent, so copies resolve in one pass
+			src, ok := sent[e.CopyOf]
+			if !ok || src.Size != e.Size || src.Hash != e.Hash {
+				return fmt.Errorf("invalid manifest: %q is not a copy of an earlier file", e.Name)
+			}
+			continue
+		}
+		sent[e.Name] = e
+		total += e.Size
+	}
+	if total != meta.Size {
+		return fmt.Errorf("invalid manifest: files add up to %d bytes, handshake says %d", total, meta.Size)
+	}
+	return nil
+}
+
+// multiResumeOffset walks the manifest in order and returns how much of the
+// stream is already on disk: whole verified files, plus the partial of the
+// first unfinished one.
+func multiResumeOffset(meta FileMeta, outputDir string) int64 {
+	var offset int64
+	for _, e := range meta.Files {
+		if e.Size == 0 || e.CopyOf != "" {
+			continue
+		}
+		partialPath := filepath.Join(outputDir, e.Name+partialSuffix)
+		info, err := os.Stat(partialPath)
+		if err != nil || info.Size() > e.Size {
+			return offset
+		}
+		if info.Size() < e.Size {
+			return offset + info.Size()
+		}
+		if h, err := HashFile(partialPath); err != nil || h != e.Hash {
+			os.Remove(partialPath)
+			return offset
+		}
+		offset += e.Size
+	}
+	return offset
+}
+
+// receiveMulti is the sequential receive of a multi-file session: every
+// manifest entry goes to its own .partial, is checked against its own hash as
+// soon as it's complete, and all of them are renamed into place at the end.
+// Copies carry no data; they are made from their saved original last.
+// Parallel download is never used; the files are usually small, and resume
+// already works per file.
+func receiveMulti(ctx context.Context, conn *quic.Conn, stream io.ReadWriter, meta FileMeta, opts *ReceiveOptions, sendMsg func(tea.Msg), via string, saved *receivedFile) (bool, int64, string, error) {
+	if err := validateManifest(meta); err != nil {
+		return false, meta.Size, "", err
+	}
+	files := meta.Files
+	saved.Name = fmt.Sprintf("%d files", len(files))
+
+	starts := make([]int64, len(files)+1)
+	for i, e := range files {
+		starts[i+1] = starts[i]
+		if e.CopyOf == "" {
+			starts[i+1] += e.Size
+		}
+	}
+
+	var offset int64
+	if opts.Fresh {
+		removed := false
+		for _, e := range files {
+			if err := os.Remove(filepath.Join(opts.OutputDir, e.Name+partialSuffix)); err == nil {
+				removed = true
+			}
+		}
+		if removed {
+			sendMsg(ui.StatusMsg("Discarded previous partial download (--fresh)."))
+		}
+	} else {
+		offset = multiResumeOffset(meta, opts.OutputDir)
+		if offset > 0 {
+			sendMsg(ui.StatusMsg(fmt.Sprintf("Partial download found. Resuming from %d bytes...", offset)))
+		}
+	}
+
+	ackLen := uint32(8)
+	if meta.ChunkCRC {
+		ackLen = 9
+	}
+	if err := protocol.EncodeHeader(stream, protocol.TypeAck, ackLen); err != nil {
+		return false, meta.Size, "", err
+	}
+	if err := binary.Write(stream, binary.LittleEndian, offset); err != nil {
+		return false, meta.Size, "", err
+	}
+	if meta.ChunkCRC {
+		if err := binary.Write(stream, binary.LittleEndian, uint8(ackFlagChunkCRC)); err != nil {
+			return false, meta.Size, "", err
+		}
+	}
+
+	defer cancelOnDone(ctx, conn, stream)()
+
+	sendMsg(ui.StatusMsg(fmt.Sprintf("Receiving %d files", len(files))))
+
+	// The manifest entry being written, and the last one started (for progress)
+	cur, last := -1, 0
+	var out *os.File
+	var hasher hash.Hash
+	defer func() {
+		if out != nil {
+			out.Close()
+		}
+	}()
+
+	// open starts (or resumes) entry idx at stream offset pos
+	open := func(idx int, pos int64) error {
+		partialPath := filepath.Join(opts.OutputDir, files[idx].Name+partialSuffix)
+		have := pos - starts[idx]
+		f, err := os.OpenFile(partialPath, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		hasher = sha256.New()
+		if have > 0 {
+			// The resume offset came from this partial; hash what's already there
+			if _, err := io.CopyN(hasher, f, have); err != nil {
+				f.Close()
+				return fmt.Errorf("partial %s shrank: %v", files[idx].Name, err)
+			}
+		}
+		if err := f.Truncate(have); err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := f.Seek(have, io.SeekStart); err != nil {
+			f.Close()
+			return err
+		}
+		out, cur, last = f, idx, idx
+		return nil
+	}
+
+	buf := make([]byte, ChunkSize)
+	totalRecv := offset
+	throughput := newThroughputEstimator(offset, time.Now())
+
+	for {
+		pType, length, err := readHeader(stream)
+		if err != nil {
+			if ctx.Err() != nil {
+				return false, meta.Size, "", ctx.Err()
+			}
+			if err == io.EOF {
+				break
+			}
+			return false, meta.Size, "", err
+		}
+
+		switch pType {
+		case protocol.TypeCancel:
+			return false, meta.Size, "", cancelError(stream, length)
+		case protocol.TypeError:
+			return false, meta.Size, "", readSenderError(stream, length)
+
+		case protocol.TypeFileStart:
+			var idx uint32
+			if length != 4 {
+				return false, meta.Size, "", fmt.Errorf("invalid file start packet length %d", length)
+			}
+			if err := binary.Read(stream, binary.LittleEndian, &idx); err != nil {
+				return false, meta.Size, "", err
+			}
+			if int(idx) >= len(files) || totalRecv < starts[idx] || totalRecv >= starts[idx+1] {
+				return false, meta.Size, "", fmt.Errorf("file start %d out of sequence at offset %d", idx, totalRecv)
+			}
+			if cur != -1 {
+				return false, meta.Size, "", fmt.Errorf("file start %d before %s was complete", idx, files[cur].Name)
+			}
+			if err := open(int(idx), totalRecv); err != nil {
+				return false, meta.Size, "", err
+			}
+
+		case protocol.TypeData:
+			if length > MaxFrameSize {
+				return false, meta.Size, "", fmt.Errorf("oversized data packet: %d bytes", length)
+			}
+			if uint32(len(buf)) < length {
+				buf = make([]byte, length)
+			}
+			if _, err := io.ReadFull(stream, buf[:length]); err != nil {
+				return false, meta.Size, "", err
+			}
+			data := buf[:length]
+			if meta.ChunkCRC {
+				if data, err = verifyChunkCRC(data); err != nil {
+					return false, meta.Size, "", fmt.Errorf("%w at offset %d", err, totalRecv)
+				}
+			}
+			if cur == -1 || totalRecv+int64(len(data)) > starts[cur+1] {
+				return false, meta.Size, "", fmt.Errorf("data at offset %d outside the current file", totalRecv)
+			}
+			if _, err := out.Write(data); err != nil {
+				sendCancel(stream, "can't write the file: "+err.Error())
+				return false, meta.Size, "", err
+			}
+			hasher.Write(data)
+			totalRecv += int64(len(data))
+
+			if totalRecv == starts[cur+1] {
+				// File complete: check it now, so a retry resumes from the last good file
+				out.Close()
+				out = nil
+				entry := files[cur]
+				cur = -1
+				if recvHash := fmt.Sprintf("%x", hasher.Sum(nil)); recvHash != entry.Hash {
+					os.Remove(filepath.Join(opts.OutputDir, entry.Name+partialSuffix))
+					return false, meta.Size, "", fmt.Errorf("Integrity Check: FAILED for %s (Expected %s, Got %s).", entry.Name, entry.Hash, recvHash)
+				}
+			}
+
+			speed, eta := throughput.update(totalRecv, meta.Size, time.Now())
+			sendMsg(ui.ProgressMsg{
+				SentBytes:  totalRecv,
+				TotalBytes: meta.Size,
+				Speed:      speed,
+				ETA:        eta,
+				Protocol:   via,
+				File:       files[last].Name,
+				FileIndex:  last + 1,
+				FileCount:  len(files),
+			})
+
+		default:
+			return false, meta.Size, "", fmt.Errorf("unexpected packet type: %d", pType)
+		}
+	}
+
+	if c, ok := stream.(io.Closer); ok {
+		c.Close()
+	}
+	if totalRecv != meta.Size {
+		return false, meta.Size, "", fmt.Errorf("stream ended at %d of %d bytes", totalRecv, meta.Size)
+	}
+	sendMsg(ui.ProgressMsg{
+		SentBytes:  meta.Size,
+		TotalBytes: meta.Size,
+		Protocol:   "Done",
+	})
+	sendMsg(ui.StatusMsg("Integrity Check: PASSED"))
+
+	saves := make(map[string]string) // Manifest name -> where it was saved
+	for _, e := range files {
+		partialPath := filepath.Join(opts.OutputDir, e.Name+partialSuffix)
+		linked := false
+		if e.CopyOf != "" {
+			var err error
+			if linked, err = materializeCopy(saves[e.CopyOf], partialPath, opts.Hardlink); err != nil {
+				return false, meta.Size, "", fmt.Errorf("failed to save %s as a copy of %s: %v", e.Name, e.CopyOf, err)
+			}
+		} else if e.Size == 0 {
+			// Empty files carry no data, so nothing created them yet
+			f, err := os.Create(partialPath)
+			if err != nil {
+				return false, meta.Size, "", err
+			}
+			f.Close()
+		}
+		finalPath := savePath(opts.OutputDir, e.Name, opts.Force)
+		if err := os.Rename(partialPath, finalPath); err != nil {
+			return false, meta.Size, "", fmt.Errorf("failed to save %s: %v", e.Name, err)
+		}
+		saves[e.Name] = finalPath
+		if linked {
+			// A hard link shares the original's permissions and modtime
+			sendMsg(ui.StatusMsg("Saved to: " + filepath.Base(finalPath) + " (hard link to " + filepath.Base(saves[e.CopyOf]) + ")"))
+			continue
+		}
+		restoreAttrs(finalPath, e.Mode, e.ModTime, opts.NoPreserve, sendMsg)
+		sendMsg(ui.StatusMsg("Saved to: " + filepath.Base(finalPath)))
+	}
+	saved.Path, _ = filepath.Abs(opts.OutputDir)
+	return true, meta.Size, meta.Hash, nil
+}
+
+// materializeCopy creates partialPath with the content of the already saved
+// src: a hard link with hardlink (--hardlink) where the filesystem allows one,
+// a copy otherwise. It reports whether it linked.
+func materializeCopy(src, partialPath string, hardlink bool) (bool, error) {
+	os.Remove(partialPath) // A leftover would fail the link and isn't resumed
+	if hardlink {
+		if err := os.Link(src, partialPath); err == nil {
+			return true, nil
+		}
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+	out, err := os.Create(partialPath)
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(partialPath)
+		return false, err
+	}
+	return false, out.Close()
+}
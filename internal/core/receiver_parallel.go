@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/darkprince558/jend/internal/ui"
 	"github.com/darkprince558/jend/pkg/protocol"
+	"github.com/gofrs/flock"
 	"github.com/quic-go/quic-go"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -24,23 +26,45 @@ type FileMeta struct {
 	Code string `json:"code"`
 	Hash string `json:"hash"`
 	Type string `json:"type"`
+	// ChunkCRC: the sender can append a CRC32 to each TypeData payload (see chunkcrc.go)
+	ChunkCRC bool `json:"chunk_crc,omitempty"`
+	// NoResume: the source can't seek (stdin), so a partial file is useless
+	NoResume bool `json:"no_resume,omitempty"`
+	// Delta: the sender can send only what changed from an older version (see delta.go)
+	Delta bool `json:"delta,omitempty"`
+	// Files: the manifest of a multi-file session (Type "multi"), in stream order
+	Files []ManifestEntry `json:"files,omitempty"`
+	// Mode and ModTime (Unix nanoseconds) of a plain file, restored unless --no-preserve
+	Mode    uint32 `json:"mode,omitempty"`
+	ModTime int64  `json:"mtime,omitempty"`
+	// SenderKey and SenderSig prove who the sender is (see signOffer)
+	SenderKey []byte `json:"sender_key,omitempty"`
+	SenderSig []byte `json:"sender_sig,omitempty"`
 }
 
 func downloadParallel(
+	ctx context.Context,
 	conn *quic.Conn,
 	controlStream io.ReadWriter,
 	meta FileMeta,
-	outputDir string,
 	safeName string,
+	opts *ReceiveOptions,
 	sendMsg func(tea.Msg),
-	password string,
-	concurrency int,
+	limiter *rateLimiter, // Shared with the control stream, see --rate
+	via string,
+	saved *receivedFile,
 ) (bool, int64, string, error) {
 
 	// 1. Setup Output File and Meta File
-	finalPath := filepath.Join(outputDir, safeName)
-	parallelPath := filepath.Join(outputDir, safeName+".parallel.part")
-	metaPath := filepath.Join(outputDir, safeName+".parallel.meta")
+	concurrency := opts.Concurrency // A resumed download keeps its saved one
+	parallelPath := filepath.Join(opts.OutputDir, safeName+".parallel.part")
+	metaPath := filepath.Join(opts.OutputDir, safeName+".parallel.meta")
+
+	if opts.Fresh {
+		if removeParallelArtifacts(parallelPath, metaPath) {
+			sendMsg(ui.StatusMsg("Discarded previous partial download (--fresh)."))
+		}
+	}
 
 	// Load or Initialize State
 	state, err := loadOrInitState(metaPath, meta.Size, concurrency)
@@ -66,17 +90,11 @@ func downloadParallel(
 	}
 	defer f.Close()
 
-	if err := f.Truncate(meta.Size); err != nil {
-		return false, meta.Size, "", fmt.Errorf("failed to pre-allocate file: %w", err)
-	}
+	// No upfront Truncate: WriteAt extends the file sparsely as chunks land, so an
+	// aborted handshake doesn't leave a full-size file of zeros behind.
 
 	// Calculate completed bytes
-	var completedBytes int64 = 0
-	for _, c := range state.Chunks {
-		if c.Done {
-			completedBytes += c.Length
-		}
-	}
+	completedBytes := state.completed()
 
 	if completedBytes > 0 {
 		sendMsg(ui.StatusMsg(fmt.Sprintf("Resuming parallel download... (%d%% done)", (completedBytes*100)/meta.Size)))
@@ -92,13 +110,15 @@ func downloadParallel(
 	// Launch workers for INCOMPLETE chunks
 	activeWorkers := 0
 	for i, chunk := range state.Chunks {
-		if chunk.Done {
+		offset, length := chunk.remaining()
+		if length == 0 {
 			continue // Skip completed chunks
 		}
 		activeWorkers++
 		wg.Add(1)
 
-		go func(id int, start, length int64) {
+		// id's range starts at base; what's left of it is [start, start+length)
+		go func(id int, base, start, length int64) {
 			defer wg.Done()
 
 			// Each worker needs a stream.
@@ -116,24 +136,25 @@ func downloadParallel(
 				return
 			}
 			defer ns.Close()
-			s = ns
+			s = limitStream(ns, limiter)
 			// Authenticate sub-stream
-			key, err := PerformPAKE(s, password, 1) // Role 1 = Receiver
+			key, suite, err := PerformPAKE(s, opts.Code, 1, PAKEOptions{Cipher: opts.Cipher}) // Role 1 = Receiver
 			if err != nil {
 				errChan <- fmt.Errorf("worker %d pake failed: %w", id, err)
 				return
 			}
 
 			// Upgrade
-			secureStream, err := NewSecureStream(s, key)
+			secureStream, err := NewSecureStream(s, key, 1, suite)
 			if err != nil {
 				errChan <- fmt.Errorf("worker %d failed to upgrade stream: %w", id, err)
 				return
 			}
 			s = secureStream
 
-			// Consume Handshake from sender (it sends it after PAKE)
-			_, l, err := protocol.DecodeHeader(s)
+			// Consume Handshake from sender (it sends it after PAKE, and after
+			// checking our identity if it has an allow-list)
+			l, err := readOffer(s, key)
 			if err != nil {
 				errChan <- err
 				return
@@ -141,7 +162,11 @@ func downloadParallel(
 			io.CopyN(io.Discard, s, int64(l))
 
 			// Send Range Request
-			if err := protocol.EncodeHeader(s, protocol.TypeRangeReq, 16); err != nil {
+			reqLen := uint32(16)
+			if meta.ChunkCRC {
+				reqLen = 17
+			}
+			if err := protocol.EncodeHeader(s, protocol.TypeRangeReq, reqLen); err != nil {
 				errChan <- err
 				return
 			}
@@ -153,12 +178,27 @@ func downloadParallel(
 				errChan <- err
 				return
 			}
+			if meta.ChunkCRC {
+				if err := binary.Write(s, binary.LittleEndian, uint8(ackFlagChunkCRC)); err != nil {
+					errChan <- err
+					return
+				}
+			}
+
+			defer cancelOnDone(ctx, conn, s)()
 
 			// Receive Data Loop
 			buf := make([]byte, 64*1024)
 			var receivedLocal int64 = 0
+			lastSave := time.Now()
+			defer func() {
+				// However the worker ends, a resume picks up where it got to
+				if receivedLocal > 0 && receivedLocal < length {
+					markChunkReceived(metaPath, id, start+receivedLocal-base)
+				}
+			}()
 			for {
-				pType, l, err := protocol.DecodeHeader(s)
+				pType, l, err := readHeader(s)
 				if err != nil {
 					if err == io.EOF {
 						break
@@ -167,6 +207,10 @@ func downloadParallel(
 					return
 				}
 				if pType == protocol.TypeData {
+					if l > MaxFrameSize {
+						errChan <- fmt.Errorf("worker %d: oversized data packet: %d bytes", id, l)
+						return
+					}
 					if int(l) > len(buf) {
 						buf = make([]byte, l)
 					}
@@ -174,22 +218,42 @@ func downloadParallel(
 						errChan <- err
 						return
 					}
-					if _, err := f.WriteAt(buf[:l], start+receivedLocal); err != nil {
+					data := buf[:l]
+					if meta.ChunkCRC {
+						// Never write a bad chunk; the range stays not-done and is fetched again
+						if data, err = verifyChunkCRC(data); err != nil {
+							errChan <- fmt.Errorf("worker %d: %w at offset %d", id, err, start+receivedLocal)
+							return
+						}
+					}
+					if _, err := f.WriteAt(data, start+receivedLocal); err != nil {
+						sendCancel(s, "can't write the file: "+err.Error())
 						errChan <- err
 						return
 					}
-					receivedLocal += int64(l)
-					progressChan <- int64(l)
+					receivedLocal += int64(len(data))
+					progressChan <- int64(len(data))
+					if time.Since(lastSave) >= chunkProgressInterval && receivedLocal < length {
+						markChunkReceived(metaPath, id, start+receivedLocal-base)
+						lastSave = time.Now()
+					}
+				} else if pType == protocol.TypeCancel {
+					errChan <- cancelError(s, l)
+					return
+				} else if pType == protocol.TypeError {
+					errChan <- readSenderError(s, l)
+					return
 				} else {
 					break
 				}
 			}
 
 			if receivedLocal == length {
-				// Mark chunk done
-				markChunkDone(metaPath, id)
+				if err := markChunkDone(metaPath, id); err != nil {
+					errChan <- fmt.Errorf("worker %d couldn't save its progress: %w", id, err)
+				}
 			}
-		}(i, chunk.Start, chunk.Length)
+		}(i, chunk.Start, offset, length)
 	}
 
 	if activeWorkers == 0 {
@@ -198,29 +262,33 @@ func downloadParallel(
 
 	// Progress Monitor
 	monitorDone := make(chan struct{})
+	var total int64 = completedBytes
 	go func() {
-		var total int64 = completedBytes
-		for n := range progressChan {
-			total += n
-			elapsed := time.Since(startTime).Seconds()
-			speed := 0.0
-			eta := time.Duration(0)
-			if elapsed > 0 {
-				bytesSinceStart := total - completedBytes
-				speed = float64(bytesSinceStart) / elapsed
-				if speed > 0 {
-					eta = time.Duration(float64(meta.Size-total)/speed) * time.Second
+		// Chunks done in an earlier run are in total from the start, never in the speed
+		throughput := newThroughputEstimator(completedBytes, startTime)
+		// Also report on a tick, so the resumed total shows while the streams
+		// open and a stall drags the speed down instead of freezing it
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		defer close(monitorDone)
+		for {
+			select {
+			case n, ok := <-progressChan:
+				if !ok {
+					return
 				}
+				total += n
+			case <-ticker.C:
 			}
+			speed, eta := throughput.update(total, meta.Size, time.Now())
 			sendMsg(ui.ProgressMsg{
 				SentBytes:  total,
 				TotalBytes: meta.Size,
 				Speed:      speed,
 				ETA:        eta,
-				Protocol:   fmt.Sprintf("QUIC (%dx Parallel)", concurrency),
+				Protocol:   fmt.Sprintf("%s, %dx parallel", via, concurrency),
 			})
 		}
-		close(monitorDone)
 	}()
 
 	wg.Wait()
@@ -228,16 +296,79 @@ func downloadParallel(
 	close(errChan)
 	<-monitorDone
 
+	if ctx.Err() != nil {
+		// Stopped by the user: the done chunks stay for a resume
+		return false, meta.Size, "", ctx.Err()
+	}
+
 	if len(errChan) > 0 {
-		return false, meta.Size, "", <-errChan
+		err := <-errChan
+		// Keep partial state for resume only if it holds real progress.
+		// A cancelled transfer won't be resumed, and an empty one is just clutter.
+		if errors.Is(err, errSenderCancelled) || total == 0 {
+			f.Close()
+			removeParallelArtifacts(parallelPath, metaPath)
+		}
+		return false, meta.Size, "", err
+	}
+
+	// Workers that hit EOF early exit without error; make sure nothing is missing
+	if data, err := os.ReadFile(metaPath); err == nil {
+		var done DownloadState
+		if json.Unmarshal(data, &done) == nil {
+			for _, c := range done.Chunks {
+				if !c.Done {
+					return false, meta.Size, "", fmt.Errorf("parallel download incomplete")
+				}
+			}
+		}
+	}
+
+	if err := f.Truncate(meta.Size); err != nil {
+		return false, meta.Size, "", fmt.Errorf("failed to finalize file: %w", err)
+	}
+	f.Close()
+
+	verified, err := verifyParallelDownload(parallelPath, metaPath, meta.Hash, sendMsg)
+	if err != nil {
+		return false, meta.Size, "", err
 	}
 
 	// Cleanup
-	os.Rename(parallelPath, finalPath)
+	finalPath := savePath(opts.OutputDir, safeName, opts.Force)
+	if err := os.Rename(parallelPath, finalPath); err != nil {
+		return false, meta.Size, "", fmt.Errorf("failed to save final file: %v", err)
+	}
 	os.Remove(metaPath)
+	saved.Name = filepath.Base(finalPath)
+	saved.Path, _ = filepath.Abs(finalPath)
+	restoreAttrs(finalPath, meta.Mode, meta.ModTime, opts.NoPreserve, sendMsg)
 
 	sendMsg(ui.StatusMsg("Parallel Download Complete!"))
-	return true, meta.Size, meta.Hash, nil
+	return true, meta.Size, verified, nil
+}
+
+// verifyParallelDownload checks the assembled file against the sender's hash.
+// Ranges land out of order, so nothing can be hashed as it streams in; this
+// reads the whole file once it's complete. On a mismatch there's no telling
+// which range is bad, so the download is discarded and a retry starts over.
+// It returns the verified hash, or "" when the sender gave none.
+func verifyParallelDownload(parallelPath, metaPath, want string, sendMsg func(tea.Msg)) (string, error) {
+	if want == "" {
+		sendMsg(ui.StatusMsg("Integrity Check: SKIPPED (No hash provided)"))
+		return "", nil
+	}
+	sendMsg(ui.StatusMsg("Verifying checksum..."))
+	got, err := HashFile(parallelPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to verify download: %w", err)
+	}
+	if got != want {
+		removeParallelArtifacts(parallelPath, metaPath)
+		return "", fmt.Errorf("Integrity Check: FAILED (Expected %s, Got %s). The download was discarded.", want, got)
+	}
+	sendMsg(ui.StatusMsg("Integrity Check: PASSED"))
+	return got, nil
 }
 
 // State Management
@@ -251,6 +382,31 @@ type Chunk struct {
 	Start  int64 `json:"start"`
 	Length int64 `json:"length"`
 	Done   bool  `json:"done"`
+	// Received is how much of the range, from Start, is already written; a
+	// resume asks only for the rest. Saved every chunkProgressInterval, so a
+	// crash costs at most that much of the range.
+	Received int64 `json:"received,omitempty"`
+}
+
+// chunkProgressInterval is how often a worker saves its Received.
+const chunkProgressInterval = time.Second
+
+// remaining is the part of the range still to fetch.
+func (c Chunk) remaining() (offset, length int64) {
+	if c.Done {
+		return c.Start + c.Length, 0
+	}
+	return c.Start + c.Received, c.Length - c.Received
+}
+
+// completed is how much of the file is already on disk.
+func (s *DownloadState) completed() int64 {
+	var n int64
+	for _, c := range s.Chunks {
+		_, left := c.remaining()
+		n += c.Length - left
+	}
+	return n
 }
 
 func loadOrInitState(metaPath string, totalSize int64, chunks int) (*DownloadState, error) {
@@ -286,33 +442,87 @@ func loadOrInitState(metaPath string, totalSize int64, chunks int) (*DownloadSta
 		}
 	}
 
-	saveState(metaPath, state)
+	if err := saveState(metaPath, state); err != nil {
+		return nil, err
+	}
 	return state, nil
 }
 
-func saveState(path string, state *DownloadState) {
-	data, _ := json.Marshal(state)
-	os.WriteFile(path, data, 0644)
+func saveState(path string, state *DownloadState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
 }
 
-func markChunkDone(path string, id int) {
-	// Simple RMW (Race condition possible if multiple workers finish exactly same time?
-	// Realistically file system lock or mutex needed, but for MVP this is okay-ish as they are distinct chunks)
-	// Better: Use a file lock.
-	// We'll trust optimistic update for this PoC or just re-read.
-	// Since we are inside a process, we should use a memory mutex?
-	// But we need persistence.
-	// Let's do a quick read-modify-write.
+// stateMu serializes chunk state updates from this process's workers.
+var stateMu sync.Mutex
+
+// markChunkDone records a finished chunk in the state file.
+func markChunkDone(path string, id int) error {
+	return updateChunk(path, id, func(c *Chunk) {
+		c.Done = true
+		c.Received = c.Length
+	})
+}
+
+// markChunkReceived records that received bytes of chunk id, from its Start,
+// are written. It never moves backwards or past the end of the range.
+func markChunkReceived(path string, id int, received int64) error {
+	return updateChunk(path, id, func(c *Chunk) {
+		if received > c.Received && received <= c.Length {
+			c.Received = received
+		}
+	})
+}
+
+// updateChunk applies change to chunk id in the state file. Workers update
+// concurrently, and each update is a read-modify-write of the whole file, so
+// it runs under stateMu and an exclusive flock (against another receiver
+// resuming the same download); otherwise one worker's update can drop
+// another's, and a finished chunk is fetched again on resume.
+func updateChunk(path string, id int, change func(*Chunk)) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	// Lock the state file itself; it must already exist
+	lock := flock.New(path, flock.SetFlag(os.O_RDWR))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	locked, err := lock.TryLockContext(ctx, 10*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return fmt.Errorf("timed out waiting for a lock on %s", filepath.Base(path))
+	}
+	defer lock.Close()
 
-	// In a real app we'd use a proper DB or flock.
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return
+		return err
 	}
 	var state DownloadState
-	json.Unmarshal(data, &state)
-	if id < len(state.Chunks) {
-		state.Chunks[id].Done = true
-		saveState(path, &state)
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("corrupt %s: %w", filepath.Base(path), err)
+	}
+	if id < 0 || id >= len(state.Chunks) {
+		return fmt.Errorf("chunk %d not in %s", id, filepath.Base(path))
+	}
+	change(&state.Chunks[id])
+	return saveState(path, &state)
+}
+
+// removeParallelArtifacts deletes the partial file and its chunk state.
+// Reports whether anything was actually removed.
+func removeParallelArtifacts(parallelPath, metaPath string) bool {
+	removed := false
+	if err := os.Remove(parallelPath); err == nil {
+		removed = true
+	}
+	if err := os.Remove(metaPath); err == nil {
+		removed = true
 	}
+	return removed
 }
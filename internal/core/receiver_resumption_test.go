@@ -1,9 +1,15 @@
 package core
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
 )
 
 func TestStatePersistence(t *testing.T) {
@@ -63,3 +69,159 @@ func TestDownloadStateResumption(t *testing.T) {
 	// Ideally we mock the networking, but for now we test the state engine.
 	// (covered above)
 }
+
+func TestRemoveParallelArtifacts(t *testing.T) {
+	tmpDir := t.TempDir()
+	partPath := filepath.Join(tmpDir, "file.bin.parallel.part")
+	metaPath := filepath.Join(tmpDir, "file.bin.parallel.meta")
+
+	if _, err := loadOrInitState(metaPath, 1000, 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(partPath, []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if !removeParallelArtifacts(partPath, metaPath) {
+		t.Error("Expected artifacts to be reported as removed")
+	}
+	if _, err := os.Stat(partPath); !os.IsNotExist(err) {
+		t.Error("Partial file should be gone")
+	}
+	if _, err := os.Stat(metaPath); !os.IsNotExist(err) {
+		t.Error("Meta file should be gone")
+	}
+
+	// Second call has nothing left to remove
+	if removeParallelArtifacts(partPath, metaPath) {
+		t.Error("Expected nothing to remove on second call")
+	}
+}
+
+func TestVerifyParallelDownload(t *testing.T) {
+	tmpDir := t.TempDir()
+	partPath := filepath.Join(tmpDir, "file.bin.parallel.part")
+	metaPath := filepath.Join(tmpDir, "file.bin.parallel.meta")
+	content := []byte("ranges assembled out of order")
+	want := fmt.Sprintf("%x", sha256.Sum256(content))
+	if err := os.WriteFile(partPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadOrInitState(metaPath, int64(len(content)), 4); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := verifyParallelDownload(partPath, metaPath, want, func(tea.Msg) {}); err != nil || got != want {
+		t.Fatalf("Intact file: got %q, %v", got, err)
+	}
+	if got, err := verifyParallelDownload(partPath, metaPath, "", func(tea.Msg) {}); err != nil || got != "" {
+		t.Errorf("No hash to check: got %q, %v; want no verified hash", got, err)
+	}
+
+	// One range came in wrong: every chunk says done, but the file doesn't match
+	content[3] ^= 0xff
+	os.WriteFile(partPath, content, 0644)
+	_, err := verifyParallelDownload(partPath, metaPath, want, func(tea.Msg) {})
+	if err == nil || !strings.Contains(err.Error(), "Integrity Check: FAILED") {
+		t.Fatalf("Expected an integrity failure, got %v", err)
+	}
+	if _, err := os.Stat(partPath); !os.IsNotExist(err) {
+		t.Error("Corrupt download should be discarded so a retry starts over")
+	}
+	if _, err := os.Stat(metaPath); !os.IsNotExist(err) {
+		t.Error("Meta file should be discarded with it")
+	}
+}
+
+func TestMarkChunkDoneConcurrent(t *testing.T) {
+	metaPath := filepath.Join(t.TempDir(), "file.bin.parallel.meta")
+	const chunks = 64
+	if _, err := loadOrInitState(metaPath, chunks*1000, chunks); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every worker finishing at once: no update may be lost
+	var wg sync.WaitGroup
+	errs := make(chan error, chunks)
+	for id := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- markChunkDone(metaPath, id)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("markChunkDone: %v", err)
+		}
+	}
+
+	state, err := loadOrInitState(metaPath, chunks*1000, chunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range state.Chunks {
+		if !c.Done {
+			t.Errorf("Chunk %d lost its done flag", c.ID)
+		}
+	}
+
+	if err := markChunkDone(metaPath, chunks); err == nil {
+		t.Error("Expected a chunk outside the state to be refused")
+	}
+	os.Remove(metaPath)
+	if err := markChunkDone(metaPath, 0); err == nil {
+		t.Error("Expected an error once the state file is gone, not a new one")
+	}
+	if _, err := os.Stat(metaPath); !os.IsNotExist(err) {
+		t.Error("Locking recreated the discarded state file")
+	}
+}
+
+func TestChunkPartialProgress(t *testing.T) {
+	state := DownloadState{TotalSize: 3000, Chunks: []Chunk{
+		{ID: 0, Start: 0, Length: 1000, Done: true, Received: 1000},
+		{ID: 1, Start: 1000, Length: 1000, Received: 400},
+		{ID: 2, Start: 2000, Length: 1000},
+	}}
+	for i, want := range [][2]int64{{1000, 0}, {1400, 600}, {2000, 1000}} {
+		if off, n := state.Chunks[i].remaining(); off != want[0] || n != want[1] {
+			t.Errorf("Chunk %d remaining = %d+%d; want %d+%d", i, off, n, want[0], want[1])
+		}
+	}
+	if got := state.completed(); got != 1400 {
+		t.Errorf("completed = %d; want 1400", got)
+	}
+
+	metaPath := filepath.Join(t.TempDir(), "file.bin.parallel.meta")
+	if _, err := loadOrInitState(metaPath, 3000, 3); err != nil {
+		t.Fatal(err)
+	}
+	// Saved progress only moves forward, and never past the range
+	for _, n := range []int64{400, 300, 1001} {
+		if err := markChunkReceived(metaPath, 1, n); err != nil {
+			t.Fatalf("markChunkReceived(%d): %v", n, err)
+		}
+	}
+	reloaded, err := loadOrInitState(metaPath, 3000, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := reloaded.Chunks[1]; c.Received != 400 || c.Done {
+		t.Errorf("Chunk 1 saved as received=%d done=%v; want 400, not done", c.Received, c.Done)
+	}
+	if got := parallelPercent(metaPath); got < 13.3 || got > 13.4 {
+		t.Errorf("parallelPercent = %.2f; want 400 of 3000 bytes", got)
+	}
+
+	// Finishing the chunk counts all of it
+	if err := markChunkDone(metaPath, 1); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, _ = loadOrInitState(metaPath, 3000, 3)
+	if off, n := reloaded.Chunks[1].remaining(); n != 0 || off != 2000 {
+		t.Errorf("Done chunk remaining = %d+%d; want nothing", off, n)
+	}
+}
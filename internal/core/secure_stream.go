@@ -1,83 +1,125 @@
 package core
 
 import (
-	"crypto/aes"
 	"crypto/cipher"
-	"crypto/rand"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"sync"
 )
 
 const (
 	NonceSize  = 12
 	TagSize    = 16
-	HeaderSize = 4 + NonceSize // Length (4) + Nonce (12)
+	HeaderSize = 4 // Length; the nonce is a counter both ends keep, never sent
+
+	// MaxFrameSize is the largest ciphertext frame a reader accepts by default,
+	// and the largest data packet inside the stream.
+	MaxFrameSize = 10 * 1024 * 1024
+
+	// WriteFrameSize is how much plaintext Write puts in each frame. A big Write
+	// goes out as many frames, so neither end holds more than this per frame.
+	WriteFrameSize = 64 * 1024
 )
 
-// SecureStream wraps an io.ReadWriter with AES-GCM encryption
+// errNonceExhausted stops a stream before its frame counter would wrap and
+// reuse a nonce.
+var errNonceExhausted = errors.New("secure stream: frame counter exhausted")
+
+// SecureStream wraps an io.ReadWriter with AEAD encryption: AES-GCM or
+// ChaCha20-Poly1305, whichever the PAKE settled on.
+//
+// Each frame's nonce is the writer's role (4 bytes) and its frame count (8
+// bytes, big-endian). Every stream gets a fresh key from its own PAKE, so the
+// count alone is unique per direction, and the role keeps the two directions
+// apart. The reader counts the other side's frames in step: a frame dropped,
+// replayed or reordered fails to decrypt.
 type SecureStream struct {
 	rw   io.ReadWriter
 	aead cipher.AEAD
 
+	wmu        sync.Mutex // A frame and its count go out together
+	writeNonce [NonceSize]byte
+	writeCount uint64
+	readNonce  [NonceSize]byte
+	readCount  uint64
+
+	// maxFrame is the largest ciphertext frame Read accepts; Write keeps its
+	// own frames within it too
+	maxFrame int
+
 	// Read buffer state
 	readBuf    []byte
 	readOffset int
 }
 
 // NewSecureStream creates a new authenticated encryption stream
-// key must be 32 bytes for AES-256
-func NewSecureStream(rw io.ReadWriter, key []byte) (*SecureStream, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
-	}
+// key (32 bytes) and c come from PerformPAKE; role is this end's, as given to
+// it (0 = sender, 1 = receiver)
+func NewSecureStream(rw io.ReadWriter, key []byte, role int, c Cipher) (*SecureStream, error) {
+	return NewSecureStreamLimit(rw, key, role, c, MaxFrameSize)
+}
 
-	gcm, err := cipher.NewGCM(block)
+// NewSecureStreamLimit is NewSecureStream with maxFrame as the largest
+// ciphertext frame Read accepts, instead of MaxFrameSize.
+func NewSecureStreamLimit(rw io.ReadWriter, key []byte, role int, c Cipher, maxFrame int) (*SecureStream, error) {
+	if role != 0 && role != 1 {
+		return nil, fmt.Errorf("invalid role %d", role)
+	}
+	if maxFrame <= TagSize {
+		return nil, fmt.Errorf("max frame size %d leaves no room for data", maxFrame)
+	}
+	aead, err := newAEAD(c, key)
 	if err != nil {
 		return nil, err
 	}
 
-	return &SecureStream{
-		rw:   rw,
-		aead: gcm,
-	}, nil
+	s := &SecureStream{
+		rw:       rw,
+		aead:     aead,
+		maxFrame: maxFrame,
+	}
+	binary.BigEndian.PutUint32(s.writeNonce[:4], uint32(role))
+	binary.BigEndian.PutUint32(s.readNonce[:4], uint32(1-role))
+	return s, nil
 }
 
-// Write encrypts the data and writes a frame: [Length][Nonce][Ciphertext+Tag]
+// Write encrypts the data and writes it as frames of up to WriteFrameSize
+// plaintext each: [Length][Ciphertext+Tag]
 func (s *SecureStream) Write(p []byte) (n int, err error) {
-	if len(p) == 0 {
-		return 0, nil
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	limit := min(WriteFrameSize, s.maxFrame-TagSize)
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > limit {
+			chunk = chunk[:limit]
+		}
+		if err := s.writeFrame(chunk); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		p = p[len(chunk):]
 	}
+	return n, nil
+}
 
-	nonce := make([]byte, NonceSize)
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return 0, err
+func (s *SecureStream) writeFrame(p []byte) error {
+	if s.writeCount == math.MaxUint64 {
+		return errNonceExhausted
 	}
+	binary.BigEndian.PutUint64(s.writeNonce[4:], s.writeCount)
+	s.writeCount++
 
-	// Encrypt
-	// Seal appends to dst, so we can pass nil
-	ciphertext := s.aead.Seal(nil, nonce, p, nil)
-
-	// Prepare Header: Length (uint32) of ciphertext
-	frameLen := uint32(len(ciphertext))
-	header := make([]byte, 4)
-	binary.LittleEndian.PutUint32(header, frameLen)
-
-	// Write Header
-	if _, err := s.rw.Write(header); err != nil {
-		return 0, err
-	}
-	// Write Nonce
-	if _, err := s.rw.Write(nonce); err != nil {
-		return 0, err
-	}
-	// Write Ciphertext
-	if _, err := s.rw.Write(ciphertext); err != nil {
-		return 0, err
-	}
+	// Header and ciphertext in one buffer: Seal appends after the length
+	frame := make([]byte, HeaderSize, HeaderSize+len(p)+TagSize)
+	frame = s.aead.Seal(frame, s.writeNonce[:], p, nil)
+	binary.LittleEndian.PutUint32(frame, uint32(len(frame)-HeaderSize))
 
-	return len(p), nil
+	_, err := s.rw.Write(frame)
+	return err
 }
 
 // Read reads encrypted frames and returns plaintext
@@ -101,29 +143,28 @@ func (s *SecureStream) Read(p []byte) (n int, err error) {
 	}
 	frameLen := binary.LittleEndian.Uint32(header)
 
-	if frameLen > 10*1024*1024 { // Sanity check: 10MB max frame
+	if int64(frameLen) > int64(s.maxFrame) {
 		return 0, fmt.Errorf("oversized frame: %d", frameLen)
 	}
 
-	// 2. Read Nonce
-	nonce := make([]byte, NonceSize)
-	if _, err := io.ReadFull(s.rw, nonce); err != nil {
-		return 0, err
-	}
-
-	// 3. Read Ciphertext
+	// 2. Read Ciphertext
 	ciphertext := make([]byte, frameLen)
 	if _, err := io.ReadFull(s.rw, ciphertext); err != nil {
 		return 0, err
 	}
 
-	// 4. Decrypt
-	plaintext, err := s.aead.Open(nil, nonce, ciphertext, nil)
+	// 3. Decrypt with the next nonce in the sender's sequence
+	if s.readCount == math.MaxUint64 {
+		return 0, errNonceExhausted
+	}
+	binary.BigEndian.PutUint64(s.readNonce[4:], s.readCount)
+	plaintext, err := s.aead.Open(ciphertext[:0], s.readNonce[:], ciphertext, nil)
 	if err != nil {
 		return 0, fmt.Errorf("decryption failed: %v", err)
 	}
+	s.readCount++
 
-	// 5. Copy to p
+	// 4. Copy to p
 	s.readBuf = plaintext
 	s.readOffset = 0
 
@@ -19,14 +19,14 @@ func TestSecureStream(t *testing.T) {
 	var wire bytes.Buffer
 
 	// 3. Create Writer
-	writer, err := NewSecureStream(&wire, key)
+	writer, err := NewSecureStream(&wire, key, 0, CipherAESGCM)
 	if err != nil {
 		t.Fatalf("Failed to create writer: %v", err)
 	}
 
 	// 4. Create Reader
 	// Note: We use the same 'wire' buffer. In reality, this would be two ends of a net.Conn
-	reader, err := NewSecureStream(&wire, key)
+	reader, err := NewSecureStream(&wire, key, 1, CipherAESGCM)
 	if err != nil {
 		t.Fatalf("Failed to create reader: %v", err)
 	}
@@ -77,3 +77,200 @@ func TestSecureStream(t *testing.T) {
 		t.Error("Large message mismatch")
 	}
 }
+
+func TestSecureStream_SplitsOversizedWrite(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	var wire bytes.Buffer
+	writer, _ := NewSecureStream(&wire, key, 0, CipherAESGCM)
+	reader, _ := NewSecureStream(&wire, key, 1, CipherAESGCM)
+
+	// One frame can't hold this; a single big frame would be rejected by the reader
+	msg := make([]byte, MaxFrameSize+1234)
+	rand.Read(msg)
+	if n, err := writer.Write(msg); err != nil || n != len(msg) {
+		t.Fatalf("Write returned %d, %v", n, err)
+	}
+
+	received, err := io.ReadAll(io.LimitReader(reader, int64(len(msg))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(received, msg) {
+		t.Error("Oversized message mismatch")
+	}
+}
+
+func TestSecureStream_TamperedFrame(t *testing.T) {
+	// Keys from a real PAKE, as in a transfer
+	senderKey, receiverKey := runPAKEPair(t, "tamper-test-code", PAKEOptions{})
+
+	var wire bytes.Buffer
+	writer, _ := NewSecureStream(&wire, senderKey, 0, preferredCipher(CipherAuto))
+	if _, err := writer.Write([]byte("file chunk the relay must not alter")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A relay in the path flips one bit of the ciphertext
+	frame := wire.Bytes()
+	frame[HeaderSize+3] ^= 0x01
+
+	reader, _ := NewSecureStream(bytes.NewBuffer(frame), receiverKey, 1, preferredCipher(CipherAuto))
+	if _, err := reader.Read(make([]byte, 64)); err == nil {
+		t.Fatal("Tampered frame decrypted without error")
+	}
+}
+
+func TestSecureStream_LargeWriteInBoundedFrames(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	var wire bytes.Buffer
+	writer, _ := NewSecureStream(&wire, key, 0, CipherAESGCM)
+	// A reader that only takes what writers send now; one 20MB frame would fail it
+	reader, _ := NewSecureStreamLimit(&wire, key, 1, CipherAESGCM, WriteFrameSize+TagSize)
+
+	msg := make([]byte, 20*1024*1024)
+	rand.Read(msg)
+	if n, err := writer.Write(msg); err != nil || n != len(msg) {
+		t.Fatalf("Write returned %d, %v", n, err)
+	}
+	if frames := wire.Len() / (HeaderSize + WriteFrameSize + TagSize); frames != len(msg)/WriteFrameSize {
+		t.Errorf("Expected %d frames of %d bytes, wire holds %d bytes", len(msg)/WriteFrameSize, WriteFrameSize, wire.Len())
+	}
+
+	received, err := io.ReadAll(io.LimitReader(reader, int64(len(msg))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(received, msg) {
+		t.Error("20MB message mismatch")
+	}
+}
+
+func TestSecureStream_RejectsFrameOverLimit(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	var wire bytes.Buffer
+	writer, _ := NewSecureStream(&wire, key, 0, CipherAESGCM)
+	reader, _ := NewSecureStreamLimit(&wire, key, 1, CipherAESGCM, 1024)
+
+	if _, err := writer.Write(make([]byte, 2048)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Read(make([]byte, 4096)); err == nil {
+		t.Fatal("Frame over the reader's limit was accepted")
+	}
+
+	if _, err := NewSecureStreamLimit(&wire, key, 1, CipherAESGCM, TagSize); err == nil {
+		t.Error("Expected a limit with no room for data to be refused")
+	}
+}
+
+// sealFrames writes each message as its own frame and returns the frames.
+func sealFrames(t *testing.T, key []byte, role int, c Cipher, msgs ...string) [][]byte {
+	t.Helper()
+	var wire bytes.Buffer
+	writer, _ := NewSecureStream(&wire, key, role, c)
+	var frames [][]byte
+	for _, m := range msgs {
+		if _, err := writer.Write([]byte(m)); err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, bytes.Clone(wire.Bytes()))
+		wire.Reset()
+	}
+	return frames
+}
+
+func TestSecureStream_CounterNonce(t *testing.T) {
+	for _, c := range []Cipher{CipherAESGCM, CipherChaCha20} {
+		t.Run(c.String(), func(t *testing.T) {
+			key := make([]byte, 32)
+			rand.Read(key)
+			frames := sealFrames(t, key, 0, c, "first", "second", "third")
+
+			// Just the length and ciphertext: the nonce isn't sent
+			if len(frames[0]) != HeaderSize+len("first")+TagSize {
+				t.Errorf("Expected a %d-byte frame, got %d", HeaderSize+len("first")+TagSize, len(frames[0]))
+			}
+
+			read := func(role int, frames ...[]byte) (string, error) {
+				reader, _ := NewSecureStream(bytes.NewBuffer(bytes.Join(frames, nil)), key, role, c)
+				got, err := io.ReadAll(reader)
+				return string(got), err
+			}
+
+			if got, err := read(1, frames...); err != nil || got != "firstsecondthird" {
+				t.Fatalf("In order: got %q, %v", got, err)
+			}
+			if _, err := read(1, frames[1], frames[0]); err == nil {
+				t.Error("Reordered frames decrypted")
+			}
+			if _, err := read(1, frames[0], frames[0]); err == nil {
+				t.Error("Replayed frame decrypted")
+			}
+			if _, err := read(1, frames[0], frames[2]); err == nil {
+				t.Error("Frames decrypted with one dropped")
+			}
+			if _, err := read(0, frames[0]); err == nil {
+				t.Error("Our own frame decrypted as the peer's: the directions share nonces")
+			}
+
+			// Both directions in one conversation, each counting on its own
+			var toReceiver, toSender bytes.Buffer
+			sender, _ := NewSecureStream(&readWriter{Reader: &toSender, Writer: &toReceiver}, key, 0, c)
+			receiver, _ := NewSecureStream(&readWriter{Reader: &toReceiver, Writer: &toSender}, key, 1, c)
+			buf := make([]byte, 16)
+			for i := range 3 {
+				sender.Write([]byte("ping"))
+				receiver.Write([]byte("pong"))
+				if n, err := receiver.Read(buf); err != nil || string(buf[:n]) != "ping" {
+					t.Fatalf("Round %d: receiver read %q, %v", i, buf[:n], err)
+				}
+				if n, err := sender.Read(buf); err != nil || string(buf[:n]) != "pong" {
+					t.Fatalf("Round %d: sender read %q, %v", i, buf[:n], err)
+				}
+			}
+		})
+	}
+}
+
+func TestSecureStream_CipherMismatch(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	frames := sealFrames(t, key, 0, CipherChaCha20, "hello")
+	reader, _ := NewSecureStream(bytes.NewBuffer(frames[0]), key, 1, CipherAESGCM)
+	if _, err := reader.Read(make([]byte, 16)); err == nil {
+		t.Error("ChaCha20 frame decrypted as AES-GCM")
+	}
+}
+
+// benchmarkSecureStream pushes 64KB writes through a stream, encrypting and
+// decrypting, as a transfer's data chunks go.
+func benchmarkSecureStream(b *testing.B, c Cipher) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	var wire bytes.Buffer
+	writer, _ := NewSecureStream(&wire, key, 0, c)
+	reader, _ := NewSecureStream(&wire, key, 1, c)
+	chunk := make([]byte, 64*1024)
+	rand.Read(chunk)
+	out := make([]byte, len(chunk))
+
+	b.SetBytes(int64(len(chunk)))
+	b.ResetTimer()
+	for range b.N {
+		if _, err := writer.Write(chunk); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.ReadFull(reader, out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSecureStream_AESGCM(b *testing.B)   { benchmarkSecureStream(b, CipherAESGCM) }
+func BenchmarkSecureStream_ChaCha20(b *testing.B) { benchmarkSecureStream(b, CipherChaCha20) }
@@ -3,18 +3,23 @@ package core
 import (
 	"archive/tar"
 	"archive/zip"
+	"compress/flate"
 	"compress/gzip"
 	"context"
+	"crypto/ed25519"
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/darkprince558/jend/internal/transport"
@@ -24,40 +29,34 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/darkprince558/jend/internal/audit"
 	"github.com/darkprince558/jend/internal/discovery"
+	"github.com/darkprince558/jend/internal/identity"
 	"github.com/darkprince558/jend/internal/signaling"
 	"github.com/gofrs/flock"
 )
 
 const (
-	Port      = "9000"
-	ChunkSize = 1024 * 64
+	DefaultPort = 9000      // Direct QUIC listener, see --port
+	ChunkSize   = 1024 * 64 // Default data frame size, see --chunk-size
 )
 
 // RunSender handles the main sending logic
-func RunSender(ctx context.Context, p *tea.Program, role ui.Role, filePath, textContent string, isText bool, code string, timeout time.Duration, forceTar, forceZip bool, noHistory bool, turnCfg *transport.CustomTurnConfig) {
+// It returns the error that ended the session; cancelling ctx is not one.
+func RunSender(ctx context.Context, p Notifier, opts SendOptions) (finalErr error) {
 	startTime := time.Now()
-	var finalErr error
 	var fileSize int64
 	var fileHash string
+	var hashedPath string // Set when fileHash covers a whole file on disk
 
-	// Helper for sending messages to UI or stdout
-	sendMsg := func(msg tea.Msg) {
-		if p != nil {
-			p.Send(msg)
-		} else {
-			// Headless fallback
-			switch m := msg.(type) {
-			case ui.ErrorMsg:
-				fmt.Println("Error:", m)
-			case ui.StatusMsg:
-				fmt.Println("Status:", m)
-			case ui.ProgressMsg:
-				if m.SentBytes == m.TotalBytes && m.TotalBytes > 0 {
-					fmt.Println("Done!")
-				}
-			}
-		}
+	var filePath string
+	if len(opts.Paths) > 0 {
+		filePath = opts.Paths[0]
 	}
+	multi := len(opts.Paths) > 1
+
+	if p == nil {
+		p = &Printer{W: os.Stdout, Interval: DefaultProgressInterval}
+	}
+	sendMsg := p.Send
 
 	// Audit Log Defer
 	defer func() {
@@ -69,14 +68,19 @@ func RunSender(ctx context.Context, p *tea.Program, role ui.Role, filePath, text
 			errMsg = finalErr.Error()
 		}
 
-		if !noHistory {
+		name := filepath.Base(filePath)
+		if multi {
+			name = fmt.Sprintf("%d files", len(opts.Paths))
+		}
+		if !opts.NoHistory && !opts.DryRun {
 			audit.WriteEntry(audit.LogEntry{
 				Timestamp: startTime,
 				Role:      "sender",
-				Code:      code,
-				FileName:  filepath.Base(filePath),
+				Code:      opts.Code,
+				FileName:  name,
 				FileSize:  fileSize,
 				FileHash:  fileHash,
+				FilePath:  hashedPath,
 				Status:    status,
 				Error:     errMsg,
 				Duration:  time.Since(startTime).Seconds(),
@@ -89,15 +93,77 @@ func RunSender(ctx context.Context, p *tea.Program, role ui.Role, filePath, text
 	var cleanup func()
 	var err error
 	var startModTime time.Time
+	var fileMode os.FileMode // Advertised for plain files only
 	var info os.FileInfo
+	var hashCacheSource string // Original file path when its hash may be cached
+	var mf *multiFile
+	var archived string // "tar.gz" or "zip" when filePath was compressed
+
+	if finalErr = opts.validate(); finalErr != nil {
+		sendMsg(ui.ErrorMsg(finalErr))
+		return
+	}
+	if multi {
+		if opts.IsText || opts.Follow || opts.ForceTar || opts.ForceZip || opts.SinceOffset != 0 {
+			finalErr = fmt.Errorf("sending several files cannot be combined with --text, --follow, --tar, --zip or --since-offset")
+			sendMsg(ui.ErrorMsg(finalErr))
+			return
+		}
+		for _, path := range opts.Paths {
+			if path == "-" {
+				finalErr = fmt.Errorf("stdin (\"-\") can only be sent on its own")
+				sendMsg(ui.ErrorMsg(finalErr))
+				return
+			}
+		}
+	}
+
+	// "-" reads the payload from stdin: length unknown, read once, no seeking
+	fromStdin := !opts.IsText && filePath == "-"
+	if fromStdin && (opts.Follow || opts.ForceTar || opts.ForceZip || opts.SinceOffset != 0) {
+		finalErr = fmt.Errorf("reading from stdin cannot be combined with --follow, --tar, --zip or --since-offset")
+		sendMsg(ui.ErrorMsg(finalErr))
+		return
+	}
 
-	if isText {
+	if opts.Follow {
+		if opts.IsText || opts.ForceTar || opts.ForceZip {
+			finalErr = fmt.Errorf("--follow only works with a single regular file")
+			sendMsg(ui.ErrorMsg(finalErr))
+			return
+		}
+		if info, err := os.Stat(filePath); err == nil && !info.Mode().IsRegular() {
+			finalErr = fmt.Errorf("--follow only works with a single regular file")
+			sendMsg(ui.ErrorMsg(finalErr))
+			return
+		}
+	}
+
+	if opts.IsText {
 		// handle text mode
-		fileSize = int64(len(textContent))
-		file = strings.NewReader(textContent)
+		fileSize = int64(len(opts.Text))
+		file = strings.NewReader(opts.Text)
 		fileName = "clipboard" // Special name for text mode
 		cleanup = func() {}
 		// No modtime for text
+	} else if fromStdin {
+		fileSize = -1 // Unknown until stdin hits EOF
+		// Hide os.Stdin's ReaderAt/Seeker: they fail on a pipe
+		file = struct{ io.Reader }{os.Stdin}
+		fileName = "stdin"
+		cleanup = func() {}
+	} else if multi {
+		mf, err = openMultiFile(opts.Paths)
+		if err != nil {
+			finalErr = err
+			sendMsg(ui.ErrorMsg(err))
+			return
+		}
+		file = mf
+		fileName = fmt.Sprintf("%d files", len(opts.Paths))
+		fileSize = mf.size()
+		startModTime = mf.modTime()
+		cleanup = func() { mf.Close() }
 	} else {
 		// Check if path is a directory
 		info, err = os.Stat(filePath)
@@ -109,11 +175,13 @@ func RunSender(ctx context.Context, p *tea.Program, role ui.Role, filePath, text
 		fileSize = info.Size()
 
 		var fileObj *os.File
+		var marks []archiveMark // Archives only: where each file starts, for progress
 
 		// Compression Logic
-		if info.IsDir() || forceTar {
+		if info.IsDir() || opts.ForceTar {
 			sendMsg(ui.StatusMsg("Compressing to .tar.gz..."))
-			tempPath, err := CompressPath(filePath, "tar.gz")
+			var tempPath string
+			tempPath, marks, err = compressPath(filePath, "tar.gz", opts.Compress)
 			if err != nil {
 				finalErr = err
 				sendMsg(ui.ErrorMsg(err))
@@ -127,14 +195,17 @@ func RunSender(ctx context.Context, p *tea.Program, role ui.Role, filePath, text
 				return
 			}
 			fileName = filepath.Base(filePath) + ".tar.gz"
+			archived = "tar.gz"
 			cleanup = func() {
 				fileObj.Close()
 				os.Remove(tempPath)
 			}
 			info, _ = fileObj.Stat()
-		} else if forceZip {
+			fileSize = info.Size() // Send the archive, not the directory entry
+		} else if opts.ForceZip {
 			sendMsg(ui.StatusMsg("Compressing to .zip..."))
-			tempPath, err := CompressPath(filePath, "zip")
+			var tempPath string
+			tempPath, marks, err = compressPath(filePath, "zip", opts.Compress)
 			if err != nil {
 				finalErr = err
 				sendMsg(ui.ErrorMsg(err))
@@ -148,13 +219,18 @@ func RunSender(ctx context.Context, p *tea.Program, role ui.Role, filePath, text
 				return
 			}
 			fileName = filepath.Base(filePath) + ".zip"
+			archived = "zip"
 			cleanup = func() {
 				fileObj.Close()
 				os.Remove(tempPath)
 			}
 			info, _ = fileObj.Stat()
+			fileSize = info.Size() // Send the archive, not the directory entry
 		} else {
 			// Normal File
+			if opts.Compress.Level != DefaultCompressOptions.Level {
+				sendMsg(ui.StatusMsg("Warning: --compress-level ignored, a single file is sent as-is."))
+			}
 			fileObj, err = os.Open(filePath)
 			if err != nil {
 				finalErr = err
@@ -176,6 +252,8 @@ func RunSender(ctx context.Context, p *tea.Program, role ui.Role, filePath, text
 			}
 
 			fileName = info.Name()
+			fileMode = info.Mode()
+			hashCacheSource = filePath
 			cleanup = func() {
 				if locked {
 					fileLock.Unlock()
@@ -184,10 +262,82 @@ func RunSender(ctx context.Context, p *tea.Program, role ui.Role, filePath, text
 			}
 		}
 		file = fileObj
+		if marks != nil {
+			file = &archiveFile{File: fileObj, marks: marks}
+		}
 		startModTime = info.ModTime()
 	}
 	defer cleanup()
 
+	if !fromStdin && (opts.SinceOffset < 0 || opts.SinceOffset > fileSize) {
+		finalErr = fmt.Errorf("--since-offset %d is outside the file (size %d)", opts.SinceOffset, fileSize)
+		sendMsg(ui.ErrorMsg(finalErr))
+		return
+	}
+	if opts.SinceOffset > 0 {
+		sendMsg(ui.StatusMsg(fmt.Sprintf("Sending only bytes %d-%d (--since-offset)", opts.SinceOffset, fileSize)))
+	}
+
+	// Hash once up front: every receiver and parallel stream shares the result,
+	// and an unchanged file skips hashing entirely on the next run.
+	if mf != nil {
+		sendMsg(ui.StatusMsg(fmt.Sprintf("Calculating checksums of %d files...", len(opts.Paths))))
+		fileHash, err = mf.hashFiles()
+		if err != nil {
+			finalErr = fmt.Errorf("failed to hash file: %v", err)
+			sendMsg(ui.ErrorMsg(finalErr))
+			return
+		}
+		fileSize = mf.size()
+		if n, saved := mf.duplicates(); n > 0 {
+			sendMsg(ui.StatusMsg(fmt.Sprintf("%d duplicate files are sent once (saves %s).", n, audit.FormatBytes(saved))))
+		}
+	} else if seeker, ok := file.(io.ReadSeeker); ok && !opts.Follow && !fromStdin {
+		if hashCacheSource != "" {
+			if h, ok := cachedFileHash(hashCacheSource, info, opts.SinceOffset); ok {
+				fileHash = h
+				sendMsg(ui.StatusMsg("Using cached checksum."))
+			}
+		}
+		if fileHash == "" {
+			sendMsg(ui.StatusMsg("Calculating checksum..."))
+			fileHash, err = hashFrom(seeker, opts.SinceOffset)
+			if err != nil {
+				finalErr = fmt.Errorf("failed to hash file: %v", err)
+				sendMsg(ui.ErrorMsg(finalErr))
+				return
+			}
+			if hashCacheSource != "" {
+				// Keyed by the pre-hash stat, so a file edited meanwhile never matches
+				storeFileHash(hashCacheSource, info, opts.SinceOffset, fileHash)
+			}
+		}
+		if hashCacheSource != "" && opts.SinceOffset == 0 {
+			hashedPath, _ = filepath.Abs(hashCacheSource)
+		}
+	}
+
+	if opts.DryRun {
+		name := fileName
+		if opts.IsText {
+			name = "text snippet"
+		}
+		reportDryRun(sendMsg, name, fileSize-opts.SinceOffset, fileHash, archived, opts.Compress.Level, mf)
+		return nil
+	}
+
+	// Every range served, across streams and reconnects (and restarts, with a session)
+	var served coverage
+	if opts.Session != nil {
+		if err := opts.Session.start(fileSize-opts.SinceOffset, fileHash, &served); err != nil {
+			finalErr = err
+			sendMsg(ui.ErrorMsg(finalErr))
+			return
+		}
+		defer RemoveSenderSession(opts.Code)
+		sendMsg(ui.StatusMsg("Session saved: if this sender dies, `jend send --resume` with the same code serves it again."))
+	}
+
 	// Start Listener
 	tr := transport.NewQUICTransport()
 
@@ -195,66 +345,121 @@ func RunSender(ctx context.Context, p *tea.Program, role ui.Role, filePath, text
 	multiListener := transport.NewMultiListener()
 	defer multiListener.Close()
 
-	// 1. Direct Listener (Port 9000)
-	directListener, err := tr.Listen(Port)
+	// 1. Direct Listener (--bind and --port, every interface and 9000 by default)
+	listenAddr := net.JoinHostPort(opts.Bind, strconv.Itoa(opts.Port))
+	directListener, err := tr.Listen(listenAddr)
 	if err != nil {
 		finalErr = err
-		sendMsg(ui.ErrorMsg(err))
+		if addrInUse(err) {
+			finalErr = fmt.Errorf("port %d is in use, try --port: %v", opts.Port, err)
+		}
+		sendMsg(ui.ErrorMsg(finalErr))
 		return
 	}
 	multiListener.Add(directListener)
-
-	// Start Advertising
-	stopAdvertising, err := discovery.StartAdvertising(9000, code)
-	if err != nil {
-		sendMsg(ui.StatusMsg(fmt.Sprintf("Warning: Failed to advertise on network: %v", err)))
-	} else {
-		defer stopAdvertising()
-		sendMsg(ui.StatusMsg("Broadcasting on local network..."))
+	if addr, ok := directListener.Addr().(*net.UDPAddr); ok {
+		listenAddr = net.JoinHostPort(opts.Bind, strconv.Itoa(addr.Port)) // The one bound when port is 0
+	}
+	if opts.Bind != "" {
+		sendMsg(ui.StatusMsg("Listening on " + listenAddr))
 	}
 
-	// Start Signaling (MQTT)
-	go func() {
-		sendMsg(ui.StatusMsg("Connecting to Signaling Network..."))
-		sigClient, err := signaling.NewIoTClient(context.Background(), "sender-"+code)
+	// TCP on the same port, for receivers on networks that block UDP
+	var tcpListener net.Listener
+	if !opts.NoTCP {
+		if tcpListener, err = net.Listen("tcp", listenAddr); err != nil {
+			sendMsg(ui.StatusMsg(fmt.Sprintf("Warning: no TCP fallback for networks that block UDP: %v", err)))
+			tcpListener = nil
+		}
+	}
+	sendMsg(ui.LinkMsg(discovery.NewLink(opts.Code, listenAddr).String()))
+
+	// Start Advertising on every configured discovery backend
+	backends := discovery.Backends()
+	if opts.LANOnly {
+		// No registry, no signaling: mDNS and the direct listener only
+		backends = discovery.LANBackends()
+		sendMsg(ui.StatusMsg("LAN-only mode: cloud registry and P2P signaling disabled"))
+	}
+	// Publish our identity key with the address, for receivers using --expect-sender
+	if key, err := identity.Load(); err == nil {
+		pub := key.Public().(ed25519.PublicKey)
+		backends = discovery.WithIdentity(backends, discovery.Identity{PublicKey: pub})
+		sendMsg(ui.StatusMsg("Sender identity: " + identity.Fingerprint(pub)))
+	}
+	for _, d := range backends {
+		stopAdvertising, err := d.Advertise(opts.Code, listenAddr)
 		if err != nil {
-			sendMsg(ui.StatusMsg(fmt.Sprintf("Signaling failed: %v", err)))
-			return
+			sendMsg(ui.StatusMsg(fmt.Sprintf("Warning: Failed to advertise via %s: %v", d.Name(), err)))
+			continue
 		}
-		// sendMsg(ui.StatusMsg("Signaling Connected. Waiting for peer..."))
-		defer sigClient.Disconnect()
+		defer stopAdvertising()
+		sendMsg(ui.StatusMsg(fmt.Sprintf("Advertising via %s...", d.Name())))
+	}
 
-		// Initialize P2P manager
-		p2p := transport.NewP2PManager(sigClient, code, turnCfg)
+	// Start Signaling (MQTT). It stays up for the whole session so a dropped ICE
+	// connection can be renegotiated.
+	sigCtx, stopSignaling := context.WithCancel(ctx)
+	defer stopSignaling()
+	if !opts.LANOnly {
+		go func() {
+			sendMsg(ui.StatusMsg("Connecting to Signaling Network..."))
+			sigClient, err := signaling.Connect(context.Background(), signaling.ClientID("sender"))
+			if err != nil {
+				sendMsg(ui.StatusMsg(fmt.Sprintf("Signaling failed: %v", err)))
+				return
+			}
+			// sendMsg(ui.StatusMsg("Signaling Connected. Waiting for peer..."))
+			defer sigClient.Disconnect()
 
-		// This blocks until ICE connects
-		pc, err := p2p.EstablishConnection(ctx, false) // false = Answerer (Sender)
-		if err != nil {
-			sendMsg(ui.StatusMsg(fmt.Sprintf("P2P Signaling failed: %v", err)))
-			return
-		}
-		sendMsg(ui.StatusMsg("P2P (ICE) Connected! Joining listener pool..."))
+			// Initialize P2P manager
+			p2p := transport.NewP2PManager(sigClient, opts.Code, opts.ICE)
+			p2p.OnStatus = func(s string) { sendMsg(ui.StatusMsg(s)) }
 
-		// 2. Start QUIC Listener on ICE connection
-		iceListener, err := tr.ListenPacket(pc)
-		if err != nil {
-			sendMsg(ui.StatusMsg(fmt.Sprintf("Failed to listen on ICE: %v", err)))
-			return
-		}
+			// This blocks until ICE connects
+			pc, err := p2p.EstablishConnection(sigCtx, false) // false = Answerer (Sender)
+			if err != nil {
+				sendMsg(ui.StatusMsg(fmt.Sprintf("P2P Signaling failed: %v", err)))
+				return
+			}
+			sendMsg(ui.StatusMsg("P2P (ICE) Connected! Joining listener pool..."))
 
-		// Add to MultiListener
-		multiListener.Add(iceListener)
-		sendMsg(ui.StatusMsg("ICE Tunnel Active (Dual-Mode)"))
-	}()
+			// 2. Start QUIC Listener on ICE connection
+			iceListener, err := tr.ListenPacket(pc)
+			if err != nil {
+				sendMsg(ui.StatusMsg(fmt.Sprintf("Failed to listen on ICE: %v", err)))
+				return
+			}
+
+			// Add to MultiListener
+			multiListener.Add(iceListener)
+			sendMsg(ui.StatusMsg("ICE Tunnel Active (Dual-Mode)"))
+			<-sigCtx.Done()
+		}()
+	}
 
 	// Wait for connection Loop
-	sendMsg(ui.StatusMsg(fmt.Sprintf("Waiting for receiver (timeout: %s)...", timeout)))
+	sendMsg(ui.StatusMsg(fmt.Sprintf("Waiting for receiver (timeout: %s)...", opts.Timeout)))
+	if opts.Follow {
+		sendMsg(ui.StatusMsg("Follow mode: new data is streamed as the file grows. Press Ctrl-C to finish."))
+	}
+
+	limiter := newRateLimiter(ctx, opts.Rate)
+	if limiter != nil {
+		sendMsg(ui.StatusMsg(fmt.Sprintf("Bandwidth limited to %s/s", audit.FormatBytes(opts.Rate))))
+	}
 
 	// State for resume
-	var currentOffset int64 = 0
+	// Receiver offsets and ranges are relative to this base (--since-offset)
+	var currentOffset int64 = opts.SinceOffset
+	wrongCodes := 0 // Receivers that failed the PAKE, see maxWrongCodes
+
+	peerCtx, stopPeers := context.WithCancel(ctx)
+	defer stopPeers()
+	peers := acceptPeers(peerCtx, multiListener, tcpListener)
 
 	for {
-		if time.Since(startTime) > timeout {
+		if time.Since(startTime) > opts.Timeout {
 			finalErr = fmt.Errorf("session timed out")
 			sendMsg(ui.ErrorMsg(finalErr))
 			return
@@ -268,34 +473,56 @@ func RunSender(ctx context.Context, p *tea.Program, role ui.Role, filePath, text
 		}
 
 		// Use Passed Context for Accept (handles cancellation)
-		acceptCtx, cancel := context.WithTimeout(ctx, timeout-time.Since(startTime))
-		conn, err := multiListener.Accept(acceptCtx)
+		acceptCtx, cancel := context.WithTimeout(ctx, opts.Timeout-time.Since(startTime))
+		var conn peerConn
+		select {
+		case conn = <-peers:
+		case <-acceptCtx.Done():
+		}
 		cancel()
 
-		if err != nil {
+		if conn == nil {
 			// If context canceled (timeout or manual), we exit
 			if acceptCtx.Err() == context.Canceled {
 				return
 			}
-			if acceptCtx.Err() == context.DeadlineExceeded {
-				finalErr = fmt.Errorf("code has expired or connection lost")
-				sendMsg(ui.ErrorMsg(finalErr))
-				return
-			}
-			finalErr = err
-			sendMsg(ui.ErrorMsg(err))
+			finalErr = fmt.Errorf("code has expired or connection lost")
+			sendMsg(ui.ErrorMsg(finalErr))
 			return
 		}
 
-		sendMsg(ui.StatusMsg(fmt.Sprintf("Receiver connected (%s)! Opening stream...", conn.RemoteAddr())))
+		if _, ok := conn.(*tcpPeer); ok {
+			sendMsg(ui.StatusMsg(fmt.Sprintf("Receiver connected over TCP (%s)! Opening stream...", conn.RemoteAddr())))
+		} else {
+			sendMsg(ui.StatusMsg(fmt.Sprintf("Receiver connected (%s)! Opening stream...", conn.RemoteAddr())))
+		}
+
+		// --max-duration runs from here, separate from the accept timeout and the
+		// QUIC idle timeout: a connection that trickles keepalives never idles out.
+		connCtx, cancelConn := ctx, context.CancelFunc(func() {})
+		if opts.MaxDuration > 0 {
+			connCtx, cancelConn = context.WithTimeout(ctx, opts.MaxDuration)
+		}
+		// handleConnection sends TypeCancel between chunks; a write stuck on flow
+		// control never gets there, so close the connection after a grace period.
+		stopWatchdog := context.AfterFunc(connCtx, func() {
+			if errors.Is(connCtx.Err(), context.DeadlineExceeded) {
+				time.AfterFunc(cancelGracePeriod, func() { conn.CloseWithError(0, "max duration exceeded") })
+			}
+		})
 
 		// Parallel Stream Handling Loop
 		var wg sync.WaitGroup
+		var sourceChanged atomic.Bool
+		var declined atomic.Value // errDeclined, with the receiver's reason if it gave one
+		var wrongCode atomic.Bool
+		var rejected atomic.Value // errNotAllowed, naming the receiver's fingerprint
+		var stoppedByReceiver atomic.Value
 		var streamID int = 0
 
 		for {
 			// Accept Stream (blocks until stream opens or connection dies)
-			stream, err := conn.AcceptStream(context.Background())
+			stream, err := conn.AcceptStream(connCtx)
 			if err != nil {
 				// Connection closed or error
 				break
@@ -314,7 +541,27 @@ func RunSender(ctx context.Context, p *tea.Program, role ui.Role, filePath, text
 					}
 				}()
 
-				_, err := handleConnection(ctx, s, file, isText, fileName, code, currentOffset, fileSize, startTime, startModTime, sendMsg, false)
+				sent, err := handleConnection(connCtx, limitStream(s, limiter), file, fileName, currentOffset, fileSize, fileHash, startTime, startModTime, fileMode, sendMsg, false, &opts)
+				if err == nil {
+					served.add(sent)
+				}
+				if errors.Is(err, errFileChanged) {
+					sourceChanged.Store(true)
+				}
+				if errors.Is(err, errDeclined) {
+					declined.Store(err)
+					conn.CloseWithError(0, "declined")
+				}
+				if errors.Is(err, errWrongCode) {
+					wrongCode.Store(true)
+					conn.CloseWithError(0, wrongCodeReason)
+				}
+				if errors.Is(err, errNotAllowed) {
+					rejected.Store(err)
+				}
+				if errors.Is(err, errReceiverCancelled) {
+					stoppedByReceiver.Store(err) // Once per connection, not per parallel stream
+				}
 				if err != nil && !errors.Is(err, io.EOF) && !strings.Contains(err.Error(), "cancelled") {
 					// sendMsg(ui.ErrorMsg(err))
 				}
@@ -322,147 +569,365 @@ func RunSender(ctx context.Context, p *tea.Program, role ui.Role, filePath, text
 		}
 		// Wait for all active streams to finish
 		wg.Wait()
+		stopWatchdog()
+		timedOut := errors.Is(connCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+		cancelConn()
+		if opts.Session != nil {
+			if err := opts.Session.recordServed(&served); err != nil {
+				sendMsg(ui.StatusMsg(fmt.Sprintf("Warning: couldn't save the session: %v", err)))
+			}
+		}
 
 		// If we are here, connection is done/closed.
+		if timedOut && !opts.Follow {
+			// A followed file just ends there, like Ctrl-C
+			finalErr = fmt.Errorf("transfer exceeded --max-duration %s", opts.MaxDuration)
+			sendMsg(ui.ErrorMsg(finalErr))
+			return
+		}
+		if wrongCode.Load() {
+			wrongCodes++
+			if wrongCodes >= maxWrongCodes {
+				// Stop an online guesser; the real receiver needs a new code anyway
+				finalErr = fmt.Errorf("%d receivers used the wrong code (last from %s), so it was retired; send again for a new one", wrongCodes, conn.RemoteAddr())
+				sendMsg(ui.ErrorMsg(finalErr))
+				return
+			}
+			delay := wrongCodeDelay(wrongCodes)
+			sendMsg(ui.StatusMsg(fmt.Sprintf("Warning: %s used the wrong code (%d of %d tries before it is retired), pausing %s", conn.RemoteAddr(), wrongCodes, maxWrongCodes, delay)))
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
+			continue
+		}
+		if err, ok := rejected.Load().(error); ok {
+			// The code was right, so keep serving: the allowed receiver may still come
+			sendMsg(ui.StatusMsg(fmt.Sprintf("Rejected receiver at %s: %v", conn.RemoteAddr(), err)))
+			continue
+		}
+		if err, ok := stoppedByReceiver.Load().(error); ok {
+			// It can come back for the rest; keep serving
+			sendMsg(ui.StatusMsg(fmt.Sprintf("%v (%s)", err, conn.RemoteAddr())))
+			continue
+		}
+		if err, ok := declined.Load().(error); ok {
+			finalErr = err
+			sendMsg(ui.ErrorMsg(finalErr))
+			return
+		}
+		if sourceChanged.Load() {
+			// The advertised hash is stale; serving anyone else would only fail their check
+			finalErr = errFileChanged
+			sendMsg(ui.ErrorMsg(finalErr))
+			return
+		}
+		if fromStdin {
+			// Stdin is consumed; there is nothing left to offer another receiver
+			return
+		}
 		if ctx.Err() != nil {
+			// Ctrl-C: let the receiver drain the stream (--follow) or read our
+			// TypeCancel, and hang up, before exiting takes the connection down
+			select {
+			case <-conn.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		if opts.Once && served.complete(fileSize-opts.SinceOffset) {
+			sendMsg(ui.StatusMsg("Transfer complete, code retired (--once)."))
 			return
 		}
 		sendMsg(ui.StatusMsg("Session finished or disconnected."))
 	}
 }
 
+// reportDryRun says what RunSender would offer: name, size, hash and whether
+// it was archived. size < 0 and an empty hash mean stdin or --follow, which are
+// only known once sent.
+func reportDryRun(sendMsg func(tea.Msg), name string, size int64, hash, archived string, level int, mf *multiFile) {
+	sendMsg(ui.StatusMsg("Dry run, nothing will be sent: " + name))
+	if mf != nil {
+		for _, e := range mf.manifest {
+			if e.CopyOf != "" {
+				sendMsg(ui.StatusMsg(fmt.Sprintf("  %s (%s, same as %s)", e.Name, audit.FormatBytes(e.Size), e.CopyOf)))
+				continue
+			}
+			sendMsg(ui.StatusMsg(fmt.Sprintf("  %s (%s)", e.Name, audit.FormatBytes(e.Size))))
+		}
+	}
+	if size < 0 {
+		sendMsg(ui.StatusMsg("Size: unknown until the stream ends"))
+	} else {
+		sendMsg(ui.StatusMsg(fmt.Sprintf("Size: %s (%d bytes)", audit.FormatBytes(size), size)))
+	}
+	if hash == "" {
+		hash = "not known until the stream ends"
+	}
+	sendMsg(ui.StatusMsg("SHA-256: " + hash))
+	switch {
+	case archived == "":
+		sendMsg(ui.StatusMsg("Compressed: no"))
+	case level == flate.NoCompression:
+		sendMsg(ui.StatusMsg("Compressed: no, stored as " + archived))
+	default:
+		sendMsg(ui.StatusMsg("Compressed: yes, as " + archived))
+	}
+}
+
+// progressInterval throttles the sender's ProgressMsg; the data loop runs per chunk.
+const progressInterval = 200 * time.Millisecond
+
+// sendProgress reports a sequential send at stream position pos, sent of total
+// bytes (total < 0 when unknown), naming the file in flight when file has several.
+func sendProgress(sendMsg func(tea.Msg), file io.Reader, pos, sent, total int64, throughput *throughputEstimator) {
+	msg := ui.ProgressMsg{SentBytes: sent, TotalBytes: total, Protocol: "QUIC"}
+	msg.Speed, msg.ETA = throughput.update(sent, total, time.Now())
+	if fi, ok := file.(fileIndexer); ok {
+		msg.File, msg.FileIndex, msg.FileCount = fi.fileAt(pos)
+	}
+	sendMsg(msg)
+}
+
 // handleConnection encapsulates the logic for a single connection attempt
-// Returns (done bool, err error).
+// currentOffset is a base offset into file (--since-offset): the receiver sees only
+// the bytes after it, and its resume offsets and ranges are relative to that base.
+// A negative fileSize marks a one-shot source of unknown length (stdin).
+// fileHash is the checksum RunSender precomputed; empty means hash here.
+// mode, with startModTime, is advertised for the receiver to restore; 0 (archives,
+// text, stdin) advertises nothing.
+// On success it returns the part of the slice it sent, [offset, end).
 func handleConnection(
 	ctx context.Context,
 	stream io.ReadWriter,
 	file io.Reader,
-	isText bool,
 	fileName string,
-	code string,
 	currentOffset int64,
 	fileSize int64,
+	fileHash string,
 	startTime time.Time,
 	startModTime time.Time,
+	mode os.FileMode,
 	sendMsg func(tea.Msg),
 	skipAuth bool,
-) (bool, error) {
+	opts *SendOptions,
+) (span, error) {
 
 	// PAKE Authentication
+	var sessionKey []byte // Traffic key from the PAKE, which the handshake signature covers
 	if !skipAuth {
 		sendMsg(ui.StatusMsg("Authenticating..."))
-		key, err := PerformPAKE(stream, code, 0)
+		key, suite, err := PerformPAKE(stream, opts.Code, 0, opts.pake())
 		if err != nil {
-			return false, fmt.Errorf("authentication failed: %v", err)
+			if errors.Is(err, errWrongCode) {
+				return span{}, err
+			}
+			return span{}, fmt.Errorf("authentication failed: %v", err)
 		}
 
 		// Upgrade to Secure Stream
-		secureStream, err := NewSecureStream(stream, key)
+		secureStream, err := NewSecureStream(stream, key, 0, suite)
 		if err != nil {
-			return false, fmt.Errorf("failed to create secure stream: %v", err)
+			return span{}, fmt.Errorf("failed to create secure stream: %v", err)
 		}
 		// Replace the stream with the secure version
 		stream = secureStream
+		sessionKey = key
 
-		sendMsg(ui.StatusMsg("Authenticated! Connection Encrypted."))
-	}
+		sendMsg(ui.StatusMsg(fmt.Sprintf("Authenticated! Connection Encrypted (%s).", suite)))
 
-	// Calculate Code Hash
-	sendMsg(ui.StatusMsg("Calculating checksum..."))
-	hasher := sha256.New()
-
-	// Reset reader if it's an os.File or bytes.Reader-like
-	if seeker, ok := file.(io.Seeker); ok {
-		if _, err := seeker.Seek(0, 0); err != nil {
-			return false, err
+		if len(opts.Allow) > 0 {
+			allowed, err := parseAllowList(opts.Allow)
+			if err != nil {
+				return span{}, err
+			}
+			fp, err := requireIdentity(stream, key, allowed)
+			if err != nil {
+				return span{}, err
+			}
+			sendMsg(ui.StatusMsg("Receiver allowed: " + fp))
 		}
 	}
 
-	if _, err := io.Copy(hasher, file); err != nil {
-		return false, err
+	// Calculate Code Hash, unless RunSender already did
+	// A followed file or stdin has no final content to hash up front; the receiver skips the check.
+	unbounded := opts.Follow || fileSize < 0
+	if !unbounded && fileHash == "" {
+		sendMsg(ui.StatusMsg("Calculating checksum..."))
+		hasher := sha256.New()
+
+		// Reset reader if it's an os.File or bytes.Reader-like
+		if seeker, ok := file.(io.Seeker); ok {
+			if _, err := seeker.Seek(currentOffset, 0); err != nil {
+				sendError(stream, errCodeSource, err)
+				return span{}, err
+			}
+		}
+
+		// Hashing a huge file can take a while; keep the receiver from idling out
+		stopKeepAlive := startKeepAlive(stream)
+		_, err := io.Copy(hasher, file)
+		stopKeepAlive()
+		if err != nil {
+			sendError(stream, errCodeRead, err)
+			return span{}, err
+		}
+		fileHash = fmt.Sprintf("%x", hasher.Sum(nil))
 	}
-	fileHash := fmt.Sprintf("%x", hasher.Sum(nil))
 
 	// Handshake
+	sliceSize := fileSize - currentOffset
 	meta := map[string]interface{}{
 		"name": fileName,
-		"size": fileSize,
-		"code": code,
+		"size": sliceSize,
+		"code": opts.Code,
 		"hash": fileHash,
+		// Offered only; the receiver opts in through its Ack/RangeReq flags
+		"chunk_crc": true,
 	}
-	if isText {
+	mf, _ := file.(*multiFile)
+	if opts.IsText {
 		meta["type"] = "text"
+	} else if mf != nil {
+		meta["type"] = "multi"
+		meta["files"] = mf.manifest
+	} else if unbounded {
+		meta["type"] = "stream"
+		meta["size"] = -1 // Unknown: the file is still growing, or stdin is
+		if !opts.Follow {
+			meta["no_resume"] = true // Stdin can't be rewound to a resume offset
+		}
 	} else {
 		meta["type"] = "file"
+		meta["delta"] = true // Offered only; the receiver opts in with TypeDeltaSig
+		if mode != 0 {
+			meta["mode"] = uint32(mode.Perm())
+			meta["mtime"] = startModTime.UnixNano()
+		}
+	}
+	if sessionKey != nil {
+		signOffer(meta, sessionKey)
 	}
 
 	metaBytes, _ := json.Marshal(meta)
 
 	if err := protocol.EncodeHeader(stream, protocol.TypeHandshake, uint32(len(metaBytes))); err != nil {
-		return false, err
+		return span{}, err
 	}
 	stream.Write(metaBytes)
 
 	// Wait for Ack OR Range Request
 	sendMsg(ui.StatusMsg("Handshake sent. Waiting for response..."))
-	pType, length, err := protocol.DecodeHeader(stream)
+	// A receiver reading its older version for --delta sends keepalives meanwhile
+	pType, length, err := readHeader(stream)
 	if err != nil {
-		return false, fmt.Errorf("handshake failed: %v", err)
+		return span{}, fmt.Errorf("handshake failed: %v", err)
 	}
 
 	var offset int64 = 0
 	var byteLimit int64 = -1 // -1 means until EOF
+	var flags uint8
+	var delta *deltaIndex
 
 	if pType == protocol.TypeAck {
 		// Standard sequential download (or resume)
-		if length == 8 {
+		if length == 8 || length == 9 {
 			if err := binary.Read(stream, binary.LittleEndian, &offset); err != nil {
-				return false, err
+				return span{}, err
 			}
 			if offset > 0 {
 				sendMsg(ui.StatusMsg(fmt.Sprintf("Resuming transfer from %d bytes...", offset)))
 			}
 		}
+		if length == 9 {
+			if err := binary.Read(stream, binary.LittleEndian, &flags); err != nil {
+				return span{}, err
+			}
+		}
+	} else if pType == protocol.TypeCancel {
+		// The receiver looked at the offer and said no, or refused it (--max-size, disk space)
+		if length == 0 || length > maxCancelReason {
+			return span{}, errDeclined
+		}
+		reason := make([]byte, length)
+		if _, err := io.ReadFull(stream, reason); err != nil || string(reason) == errDeclined.Error() {
+			return span{}, errDeclined
+		}
+		return span{}, fmt.Errorf("%w: %s", errDeclined, reason)
+	} else if pType == protocol.TypeDeltaSig && meta["delta"] == true {
+		if delta, err = readDeltaSignature(stream, length); err != nil {
+			return span{}, err
+		}
+		sendMsg(ui.StatusMsg("Receiver has an older version. Sending only the changes..."))
+	} else if pType == protocol.TypeRangeReq && unbounded {
+		return span{}, fmt.Errorf("range requests are not supported for live streams")
+	} else if pType == protocol.TypeRangeReq && mf != nil {
+		return span{}, fmt.Errorf("range requests are not supported for multi-file sessions")
 	} else if pType == protocol.TypeRangeReq {
 		// Parallel Stream Request
-		// Payload: [StartOffset int64][Length int64]
-		if length != 16 {
-			return false, fmt.Errorf("invalid range request length")
+		// Payload: [StartOffset int64][Length int64], optionally [flags uint8]
+		if length != 16 && length != 17 {
+			return span{}, fmt.Errorf("invalid range request length")
 		}
 		var startOff int64
 		var lenReq int64
 		if err := binary.Read(stream, binary.LittleEndian, &startOff); err != nil {
-			return false, err
+			return span{}, err
 		}
 		if err := binary.Read(stream, binary.LittleEndian, &lenReq); err != nil {
-			return false, err
+			return span{}, err
+		}
+		if length == 17 {
+			if err := binary.Read(stream, binary.LittleEndian, &flags); err != nil {
+				return span{}, err
+			}
+		}
+		// All int64: ranges past 4GB are normal for large files, but must stay inside the slice
+		if startOff < 0 || lenReq <= 0 || startOff > sliceSize || lenReq > sliceSize-startOff {
+			return span{}, fmt.Errorf("invalid range request %d+%d for %d bytes", startOff, lenReq, sliceSize)
 		}
 		offset = startOff
 		byteLimit = lenReq
 		sendMsg(ui.StatusMsg(fmt.Sprintf("Parallel worker sending bytes %d-%d", offset, offset+byteLimit)))
 	} else {
-		return false, fmt.Errorf("unexpected packet type: %d", pType)
+		return span{}, fmt.Errorf("unexpected packet type: %d", pType)
+	}
+
+	if delta != nil {
+		return sendDelta(ctx, stream, file, delta, currentOffset, fileSize, startModTime, opts.ChunkSize, sendMsg)
 	}
 
 	// Parallel/Concurrent Read implementation using ReaderAt
 	var dataReader io.Reader
-	if readerAt, ok := file.(io.ReaderAt); ok {
+	if f, ok := file.(*os.File); ok && opts.Follow {
+		fr, err := newFollowReader(ctx, f, currentOffset+offset)
+		if err != nil {
+			sendError(stream, errCodeSource, err)
+			return span{}, fmt.Errorf("failed to watch file: %v", err)
+		}
+		defer fr.Close()
+		dataReader = fr
+	} else if readerAt, ok := file.(io.ReaderAt); ok {
 		// Use SectionReader for thread-safe concurrent access
-		limit := fileSize - offset
+		limit := sliceSize - offset
 		if byteLimit > 0 {
 			limit = byteLimit
 		}
-		dataReader = io.NewSectionReader(readerAt, offset, limit)
+		dataReader = io.NewSectionReader(readerAt, currentOffset+offset, limit)
 	} else {
 		// Fallback for non-ReaderAt (e.g. stdin/text)
-		if offset > 0 {
+		if currentOffset+offset > 0 {
 			// Try to seek if possible
 			if seeker, ok := file.(io.Seeker); ok {
-				if _, err := seeker.Seek(offset, 0); err != nil {
-					return false, err
+				if _, err := seeker.Seek(currentOffset+offset, 0); err != nil {
+					sendError(stream, errCodeSource, err)
+					return span{}, err
 				}
 			} else {
-				return false, fmt.Errorf("cannot seek in non-seekable source")
+				err := fmt.Errorf("cannot seek in non-seekable source")
+				sendError(stream, errCodeSource, err)
+				return span{}, err
 			}
 		}
 		dataReader = file
@@ -470,8 +935,23 @@ func handleConnection(
 
 	// Send Data
 	// sendMsg(ui.StatusMsg("Sending data..."))
-	buf := make([]byte, ChunkSize)
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = ChunkSize
+	}
+	withCRC := flags&ackFlagChunkCRC != 0
+	// The flock is best-effort, so watch for writers: a changed file no longer matches the hash
+	checkChanges := !opts.Follow && !startModTime.IsZero()
+	lastCheck := time.Now()
+	buf := make([]byte, chunkSize, chunkSize+chunkCRCSize)
 	var totalSent int64 = 0
+	currentFile := -1 // Manifest entry the receiver is writing, in a multi-file session
+	lastProgress := time.Now()
+	throughput := newThroughputEstimator(offset, lastProgress) // The resume offset didn't travel this session
+	progressTotal := sliceSize
+	if unbounded {
+		progressTotal = -1
+	}
 
 	// If byteLimit is set, we only send that much
 	var bytesRemaining int64 = -1
@@ -484,16 +964,41 @@ func handleConnection(
 	// actually SectionReader handles EOF at limit automatically.
 	// So we can just read from dataReader until EOF.
 
+	// The receiver may call it off mid-way (Ctrl-C, disk full); stop as soon as it says so
+	stopped, stopWatch := watchReceiverCancel(stream)
+	defer stopWatch()
+
 	for {
-		// Check Cancellation
 		select {
-		case <-ctx.Done():
-			// sendMsg(ui.StatusMsg("Stopping transfer (User Cancelled)..."))
-			protocol.EncodeHeader(stream, protocol.TypeCancel, 0)
-			return false, ctx.Err()
+		case <-stopped.Done():
+			return span{}, context.Cause(stopped)
 		default:
 		}
 
+		// Check Cancellation
+		// In follow mode, stopping is the normal way to finish: the followReader
+		// drains what's left and reports EOF instead.
+		if !opts.Follow {
+			select {
+			case <-ctx.Done():
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					sendCancel(stream, "transfer took longer than the sender's --max-duration")
+				} else {
+					protocol.EncodeHeader(stream, protocol.TypeCancel, 0)
+				}
+				return span{}, ctx.Err()
+			default:
+			}
+		}
+
+		if checkChanges && time.Since(lastCheck) >= fileChangeCheckInterval {
+			lastCheck = time.Now()
+			if fileChanged(file, fileSize, startModTime) {
+				sendCancel(stream, errFileChanged.Error())
+				return span{}, errFileChanged
+			}
+		}
+
 		// TEST HOOK: Slow down transfer for cancellation testing
 		if delay := os.Getenv("JEND_TEST_DELAY"); delay != "" {
 			d, _ := time.ParseDuration(delay)
@@ -501,25 +1006,51 @@ func handleConnection(
 		}
 
 		// Calculate read size
-		readSize := ChunkSize
+		readSize := chunkSize
 		// We don't strictly need manual limiting if SectionReader is used, but good for chunking.
 		if bytesRemaining > 0 && int64(readSize) > bytesRemaining {
 			readSize = int(bytesRemaining)
 		}
+		if mf != nil {
+			// Frames never straddle two files, and each file opens with its index
+			idx, left := mf.locate(offset + totalSent)
+			if idx < len(mf.files) && idx != currentFile {
+				if err := protocol.EncodeHeader(stream, protocol.TypeFileStart, 4); err != nil {
+					return span{}, err
+				}
+				if err := binary.Write(stream, binary.LittleEndian, uint32(idx)); err != nil {
+					return span{}, err
+				}
+				currentFile = idx
+			}
+			if left > 0 && int64(readSize) > left {
+				readSize = int(left)
+			}
+		}
 
 		n, err := dataReader.Read(buf[:readSize])
 		if n > 0 {
-			if err := protocol.EncodeHeader(stream, protocol.TypeData, uint32(n)); err != nil {
-				return false, err
+			frame := buf[:n]
+			if withCRC {
+				frame = appendChunkCRC(frame)
 			}
-			if _, err := stream.Write(buf[:n]); err != nil {
-				return false, err
+			if err := protocol.EncodeHeader(stream, protocol.TypeData, uint32(len(frame))); err != nil {
+				return span{}, err
+			}
+			if _, err := stream.Write(frame); err != nil {
+				return span{}, err
 			}
 			totalSent += int64(n)
 
 			if bytesRemaining > 0 {
 				bytesRemaining -= int64(n)
 			}
+			// Parallel workers each send a range; only a sequential send has a position to show.
+			// Completion is the receiver's to report, once the hash checks out.
+			if byteLimit < 0 && time.Since(lastProgress) >= progressInterval && (unbounded || offset+totalSent < sliceSize) {
+				lastProgress = time.Now()
+				sendProgress(sendMsg, file, currentOffset+offset+totalSent, offset+totalSent, progressTotal, throughput)
+			}
 		}
 		if bytesRemaining == 0 {
 			break // Done with range
@@ -528,50 +1059,106 @@ func handleConnection(
 			break
 		}
 		if err != nil {
-			return false, err
+			sendError(stream, errCodeRead, err)
+			return span{}, err
 		}
 	}
+	// A write may have landed after the last periodic check
+	if checkChanges && fileChanged(file, fileSize, startModTime) {
+		sendCancel(stream, errFileChanged.Error())
+		return span{}, errFileChanged
+	}
 	// Done with this stream
-	return true, nil
+	return span{offset, offset + totalSent}, nil
+}
+
+// CompressOptions tunes how CompressPathWithOptions builds the archive.
+type CompressOptions struct {
+	// Level is the gzip/deflate level: 0 (store) to 9 (smallest), or
+	// flate.DefaultCompression (-1). Use 0 for already-compressed data like video.
+	Level int
+	// FollowSymlinks archives what symlinks point to instead of the links.
+	FollowSymlinks bool
+	// Exclude leaves out files and directories matching these globs, along
+	// with the patterns in the directory's .jendignore. A pattern without a
+	// "/" matches a name at any depth; one with a "/" matches the path
+	// relative to the directory. A trailing "/" matches directories only, a
+	// leading "!" re-includes what an earlier pattern left out.
+	Exclude []string
+	// RespectGitignore also leaves out what the .gitignore files in the
+	// directory, nested ones included, tell git to ignore, and .git itself.
+	RespectGitignore bool
+	// Reproducible records the same mtime, owner and permissions (only the
+	// executable bit is kept) for every entry, so the same files always make
+	// the same archive bytes and hash.
+	Reproducible bool
 }
 
+// DefaultCompressOptions is what CompressPath uses.
+var DefaultCompressOptions = CompressOptions{Level: flate.DefaultCompression}
+
+// CompressPath archives filePath into a temp file with default options.
 func CompressPath(filePath string, format string) (string, error) {
+	return CompressPathWithOptions(filePath, format, DefaultCompressOptions)
+}
+
+// CompressPathWithOptions archives filePath ("tar.gz" or "zip") into a temp file
+// and returns its path.
+func CompressPathWithOptions(filePath string, format string, opts CompressOptions) (string, error) {
+	path, _, err := compressPath(filePath, format, opts)
+	return path, err
+}
+
+// compressPath is CompressPathWithOptions, also returning where each regular
+// file starts in the archive.
+func compressPath(filePath string, format string, opts CompressOptions) (string, []archiveMark, error) {
+	if opts.Level < flate.DefaultCompression || opts.Level > flate.BestCompression {
+		return "", nil, fmt.Errorf("invalid compression level %d (use 0-9, or -1 for the default)", opts.Level)
+	}
+	exclude, err := loadExcludeRules(filePath, opts.Exclude, opts.RespectGitignore)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var marks []archiveMark
 	if format == "tar.gz" {
 		tempFile, err := os.CreateTemp("", "jend-*.tar.gz")
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 
-		gw := gzip.NewWriter(tempFile)
+		cw := &countingWriter{w: tempFile}
+		gw, err := gzip.NewWriterLevel(cw, opts.Level)
+		if err != nil {
+			tempFile.Close()
+			os.Remove(tempFile.Name())
+			return "", nil, err
+		}
 		tw := tar.NewWriter(gw)
 
-		err = filepath.Walk(filePath, func(path string, info os.FileInfo, err error) error {
+		err = walkArchive(filePath, opts.FollowSymlinks, exclude, func(e archiveEntry) error {
+			header, err := tar.FileInfoHeader(e.info, e.link)
 			if err != nil {
 				return err
 			}
-			header, err := tar.FileInfoHeader(info, info.Name())
-			if err != nil {
-				return err
+			// Names start with the base name of what's being compressed:
+			// send "testdir" -> archive contains "testdir/file1", not just "file1"
+			header.Name = e.name
+			if opts.Reproducible {
+				header.Mode = int64(reproducibleMode(e.info.Mode()).Perm())
+				header.ModTime, header.AccessTime, header.ChangeTime = reproducibleModTime, time.Time{}, time.Time{}
+				header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
 			}
 
-			// Use filepath.Dir(filePath) to ensure we include the base name of the file/folder being compressed
-			// e.g. send "testdir" -> archive contains "testdir/file1", not just "file1"
-			base := filepath.Dir(filePath)
-			if base == "." {
-				base = "" // handle current dir case
+			if e.info.Mode().IsRegular() {
+				marks = append(marks, archiveMark{offset: cw.n, name: e.name})
 			}
-			relPath, err := filepath.Rel(base, path)
-			if err != nil {
-				return err
-			}
-			header.Name = filepath.ToSlash(relPath)
-
 			if err := tw.WriteHeader(header); err != nil {
 				return err
 			}
 
-			if !info.IsDir() {
-				f, err := os.Open(path)
+			if e.info.Mode().IsRegular() {
+				f, err := os.Open(e.path)
 				if err != nil {
 					return err
 				}
@@ -589,49 +1176,55 @@ func CompressPath(filePath string, format string) (string, error) {
 
 		if err != nil {
 			os.Remove(tempFile.Name())
-			return "", err
+			return "", nil, err
 		}
-		return tempFile.Name(), nil
+		return tempFile.Name(), marks, nil
 	} else if format == "zip" {
 		tempFile, err := os.CreateTemp("", "jend-*.zip")
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 
-		zw := zip.NewWriter(tempFile)
-
-		err = filepath.Walk(filePath, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
+		cw := &countingWriter{w: tempFile}
+		zw := zip.NewWriter(cw)
+		zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, opts.Level)
+		})
 
-			header, err := zip.FileInfoHeader(info)
+		err = walkArchive(filePath, opts.FollowSymlinks, exclude, func(e archiveEntry) error {
+			header, err := zip.FileInfoHeader(e.info)
 			if err != nil {
 				return err
 			}
-			base := filepath.Dir(filePath)
-			if base == "." {
-				base = ""
-			}
-			relPath, err := filepath.Rel(base, path)
-			if err != nil {
-				return err
+			header.Name = e.name
+			if opts.Reproducible {
+				header.Modified = reproducibleModTime
+				header.SetMode(reproducibleMode(e.info.Mode()))
 			}
-			header.Name = filepath.ToSlash(relPath)
 
-			if info.IsDir() {
+			if e.info.IsDir() {
 				header.Name += "/"
+			} else if e.link != "" || opts.Level == flate.NoCompression {
+				header.Method = zip.Store
 			} else {
 				header.Method = zip.Deflate
 			}
 
+			if e.info.Mode().IsRegular() {
+				marks = append(marks, archiveMark{offset: cw.n, name: e.name})
+			}
 			writer, err := zw.CreateHeader(header)
 			if err != nil {
 				return err
 			}
 
-			if !info.IsDir() {
-				f, err := os.Open(path)
+			if e.link != "" {
+				// By convention a zip symlink's content is its target
+				_, err := io.WriteString(writer, e.link)
+				return err
+			}
+			if e.info.Mode().IsRegular() {
+				f, err := os.Open(e.path)
 				if err != nil {
 					return err
 				}
@@ -648,9 +1241,9 @@ func CompressPath(filePath string, format string) (string, error) {
 
 		if err != nil {
 			os.Remove(tempFile.Name())
-			return "", err
+			return "", nil, err
 		}
-		return tempFile.Name(), nil
+		return tempFile.Name(), marks, nil
 	}
-	return "", fmt.Errorf("unsupported format")
+	return "", nil, fmt.Errorf("unsupported format")
 }
@@ -0,0 +1,523 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/darkprince558/jend/internal/discovery"
+	"github.com/darkprince558/jend/internal/signaling"
+	"github.com/darkprince558/jend/internal/transport"
+	"github.com/darkprince558/jend/internal/ui"
+	"github.com/darkprince558/jend/pkg/protocol"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestHandleConnection_SinceOffset(t *testing.T) {
+	content := "0123456789"
+	file := strings.NewReader(content)
+
+	r, w := io.Pipe()
+	r2, w2 := io.Pipe()
+	senderRW := &readWriter{Reader: r2, Writer: w}
+	receiverRW := &readWriter{Reader: r, Writer: w2}
+
+	errChan := make(chan error, 1)
+	go func() {
+		// Base offset 4: the receiver should only ever see "456789"
+		_, err := handleConnection(context.Background(), senderRW, file, "data.bin",
+			4, int64(len(content)), "", time.Now(), time.Time{}, 0, func(tea.Msg) {}, true, &SendOptions{Code: "code", ChunkSize: ChunkSize})
+		w.Close()
+		errChan <- err
+	}()
+
+	pType, length, err := protocol.DecodeHeader(receiverRW)
+	if err != nil || pType != protocol.TypeHandshake {
+		t.Fatalf("Expected handshake, got type %d err %v", pType, err)
+	}
+	metaBytes := make([]byte, length)
+	io.ReadFull(receiverRW, metaBytes)
+	var meta FileMeta
+	json.Unmarshal(metaBytes, &meta)
+
+	if meta.Size != 6 {
+		t.Errorf("Expected size 6, got %d", meta.Size)
+	}
+	if want := fmt.Sprintf("%x", sha256.Sum256([]byte("456789"))); meta.Hash != want {
+		t.Errorf("Hash should cover only the sent slice")
+	}
+
+	// Resume 2 bytes into the slice
+	protocol.EncodeHeader(receiverRW, protocol.TypeAck, 8)
+	binary.Write(receiverRW, binary.LittleEndian, int64(2))
+
+	var got []byte
+	for {
+		pType, length, err := protocol.DecodeHeader(receiverRW)
+		if err != nil {
+			break
+		}
+		buf := make([]byte, length)
+		io.ReadFull(receiverRW, buf)
+		if pType == protocol.TypeData {
+			got = append(got, buf...)
+		}
+	}
+
+	if err := <-errChan; err != nil {
+		t.Fatalf("handleConnection failed: %v", err)
+	}
+	if string(got) != "6789" {
+		t.Errorf("Expected \"6789\", got %q", got)
+	}
+}
+
+func TestHandleConnection_ChunkCRC(t *testing.T) {
+	content := strings.Repeat("jend", 5000) // Several chunks at 4k
+	file := strings.NewReader(content)
+
+	r, w := io.Pipe()
+	r2, w2 := io.Pipe()
+	senderRW := &readWriter{Reader: r2, Writer: w}
+	receiverRW := &readWriter{Reader: r, Writer: w2}
+
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := handleConnection(context.Background(), senderRW, file, "data.bin",
+			0, int64(len(content)), "", time.Now(), time.Time{}, 0, func(tea.Msg) {}, true, &SendOptions{Code: "code", ChunkSize: MinChunkSize})
+		w.Close()
+		errChan <- err
+	}()
+
+	_, length, err := protocol.DecodeHeader(receiverRW)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metaBytes := make([]byte, length)
+	io.ReadFull(receiverRW, metaBytes)
+	var meta FileMeta
+	json.Unmarshal(metaBytes, &meta)
+	if !meta.ChunkCRC {
+		t.Fatal("Sender should offer chunk_crc")
+	}
+
+	// Opt in: [offset int64][flags uint8]
+	protocol.EncodeHeader(receiverRW, protocol.TypeAck, 9)
+	binary.Write(receiverRW, binary.LittleEndian, int64(0))
+	binary.Write(receiverRW, binary.LittleEndian, uint8(ackFlagChunkCRC))
+
+	var got []byte
+	for {
+		pType, length, err := protocol.DecodeHeader(receiverRW)
+		if err != nil {
+			break
+		}
+		buf := make([]byte, length)
+		io.ReadFull(receiverRW, buf)
+		if pType != protocol.TypeData {
+			continue
+		}
+		data, err := verifyChunkCRC(buf)
+		if err != nil {
+			t.Fatalf("Chunk at %d: %v", len(got), err)
+		}
+		got = append(got, data...)
+	}
+
+	if err := <-errChan; err != nil {
+		t.Fatalf("handleConnection failed: %v", err)
+	}
+	if string(got) != content {
+		t.Errorf("Received %d bytes, content mismatch", len(got))
+	}
+}
+
+func TestHandleConnection_UnknownSize(t *testing.T) {
+	content := "piped from stdin"
+	// Plain io.Reader, like the sender's stdin wrapper: no ReaderAt, no Seeker
+	file := struct{ io.Reader }{strings.NewReader(content)}
+
+	r, w := io.Pipe()
+	r2, w2 := io.Pipe()
+	senderRW := &readWriter{Reader: r2, Writer: w}
+	receiverRW := &readWriter{Reader: r, Writer: w2}
+
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := handleConnection(context.Background(), senderRW, file, "stdin",
+			0, -1, "", time.Now(), time.Time{}, 0, func(tea.Msg) {}, true, &SendOptions{Code: "code", ChunkSize: ChunkSize})
+		w.Close()
+		errChan <- err
+	}()
+
+	_, length, err := protocol.DecodeHeader(receiverRW)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metaBytes := make([]byte, length)
+	io.ReadFull(receiverRW, metaBytes)
+	var meta FileMeta
+	json.Unmarshal(metaBytes, &meta)
+	if meta.Type != "stream" || meta.Size != -1 || meta.Hash != "" || !meta.NoResume {
+		t.Fatalf("Unexpected handshake for unknown size: %+v", meta)
+	}
+
+	protocol.EncodeHeader(receiverRW, protocol.TypeAck, 8)
+	binary.Write(receiverRW, binary.LittleEndian, int64(0))
+
+	var got []byte
+	for {
+		pType, length, err := protocol.DecodeHeader(receiverRW)
+		if err != nil {
+			break
+		}
+		buf := make([]byte, length)
+		io.ReadFull(receiverRW, buf)
+		if pType == protocol.TypeData {
+			got = append(got, buf...)
+		}
+	}
+
+	if err := <-errChan; err != nil {
+		t.Fatalf("handleConnection failed: %v", err)
+	}
+	if string(got) != content {
+		t.Errorf("Expected %q, got %q", content, got)
+	}
+}
+
+func TestHandleConnection_FileChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	content := "original content"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	info, _ := file.Stat()
+	// As if someone saved the file after the sender captured its modtime
+	startModTime := info.ModTime().Add(-time.Hour)
+
+	r, w := io.Pipe()
+	r2, w2 := io.Pipe()
+	senderRW := &readWriter{Reader: r2, Writer: w}
+	receiverRW := &readWriter{Reader: r, Writer: w2}
+
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := handleConnection(context.Background(), senderRW, file, "data.bin",
+			0, int64(len(content)), "precomputed", time.Now(), startModTime, 0, func(tea.Msg) {}, true, &SendOptions{Code: "code", ChunkSize: ChunkSize})
+		w.Close()
+		errChan <- err
+	}()
+
+	_, length, err := protocol.DecodeHeader(receiverRW)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.CopyN(io.Discard, receiverRW, int64(length))
+	protocol.EncodeHeader(receiverRW, protocol.TypeAck, 8)
+	binary.Write(receiverRW, binary.LittleEndian, int64(0))
+
+	var cancelErr error
+	for {
+		pType, length, err := protocol.DecodeHeader(receiverRW)
+		if err != nil {
+			break
+		}
+		if pType == protocol.TypeCancel {
+			cancelErr = cancelError(receiverRW, length)
+			continue
+		}
+		io.CopyN(io.Discard, receiverRW, int64(length))
+	}
+
+	if err := <-errChan; !errors.Is(err, errFileChanged) {
+		t.Errorf("Expected errFileChanged from sender, got %v", err)
+	}
+	if cancelErr == nil || !strings.Contains(cancelErr.Error(), "sender's file changed during transfer") {
+		t.Errorf("Expected receiver to see the change reason, got %v", cancelErr)
+	}
+	// Still fatal for the receiver's retry loop
+	if cancelErr != nil && !errors.Is(cancelErr, errSenderCancelled) {
+		t.Errorf("Cancel reason must keep the receiver from retrying: %v", cancelErr)
+	}
+}
+
+// TestHandleConnection_MaxDuration: once the transfer deadline passes, the
+// receiver gets a TypeCancel that says why.
+func TestHandleConnection_MaxDuration(t *testing.T) {
+	file := strings.NewReader("0123456789")
+
+	r, w := io.Pipe()
+	r2, w2 := io.Pipe()
+	senderRW := &readWriter{Reader: r2, Writer: w}
+	receiverRW := &readWriter{Reader: r, Writer: w2}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := handleConnection(ctx, senderRW, file, "data.bin",
+			0, 10, "", time.Now(), time.Time{}, 0, func(tea.Msg) {}, true, &SendOptions{Code: "code", ChunkSize: ChunkSize})
+		w.Close()
+		errChan <- err
+	}()
+
+	pType, length, err := protocol.DecodeHeader(receiverRW)
+	if err != nil || pType != protocol.TypeHandshake {
+		t.Fatalf("Expected handshake, got type %d err %v", pType, err)
+	}
+	io.CopyN(io.Discard, receiverRW, int64(length))
+
+	// A receiver that stalls until the deadline has passed
+	<-ctx.Done()
+	protocol.EncodeHeader(receiverRW, protocol.TypeAck, 8)
+	binary.Write(receiverRW, binary.LittleEndian, int64(0))
+
+	pType, length, err = protocol.DecodeHeader(receiverRW)
+	if err != nil || pType != protocol.TypeCancel {
+		t.Fatalf("Expected TypeCancel, got type %d err %v", pType, err)
+	}
+	if cerr := cancelError(receiverRW, length); !strings.Contains(cerr.Error(), "--max-duration") {
+		t.Errorf("Expected the cancel to name --max-duration, got %v", cerr)
+	}
+	if err := <-errChan; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+// TestHandleConnection_Declined answers the handshake with confirmOffer's "no".
+func TestHandleConnection_Declined(t *testing.T) {
+	file := strings.NewReader("0123456789")
+
+	r, w := io.Pipe()
+	r2, w2 := io.Pipe()
+	senderRW := &readWriter{Reader: r2, Writer: w}
+	receiverRW := &readWriter{Reader: r, Writer: w2}
+
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := handleConnection(context.Background(), senderRW, file, "data.bin",
+			0, 10, "", time.Now(), time.Time{}, 0, func(tea.Msg) {}, true, &SendOptions{Code: "code", ChunkSize: ChunkSize})
+		w.Close()
+		errChan <- err
+	}()
+
+	pType, length, err := protocol.DecodeHeader(receiverRW)
+	if err != nil || pType != protocol.TypeHandshake {
+		t.Fatalf("Expected handshake, got type %d err %v", pType, err)
+	}
+	metaBytes := make([]byte, length)
+	io.ReadFull(receiverRW, metaBytes)
+	var meta FileMeta
+	json.Unmarshal(metaBytes, &meta)
+
+	var prompt string
+	no := func(msg tea.Msg) {
+		if c, ok := msg.(ui.ConfirmMsg); ok {
+			prompt = c.Prompt
+			c.Reply <- false
+		}
+	}
+	if err := confirmOffer(nil, receiverRW, meta, "data.bin", no); !errors.Is(err, errDeclined) {
+		t.Errorf("Expected errDeclined from the receiver, got %v", err)
+	}
+	if !strings.Contains(prompt, "data.bin") || !strings.Contains(prompt, meta.Hash) {
+		t.Errorf("Expected the prompt to show the name and hash, got %q", prompt)
+	}
+	if err := <-errChan; !errors.Is(err, errDeclined) {
+		t.Errorf("Expected errDeclined from the sender, got %v", err)
+	}
+}
+
+// msgLog is a Notifier that keeps everything it is sent.
+type msgLog []tea.Msg
+
+func (l *msgLog) Send(msg tea.Msg) { *l = append(*l, msg) }
+
+// pipeSession runs one session, PAKE included, over a pipe: handleConnection
+// offers size bytes from file as name, with sendOpts, to handleReceiveSession
+// with recvOpts. It returns both sides' errors and the sender's status lines.
+func pipeSession(t *testing.T, file io.Reader, name string, size int64, modTime time.Time, sendOpts *SendOptions, recvOpts *ReceiveOptions) (sendErr, recvErr error, status []string) {
+	t.Helper()
+	sender, receiver := net.Pipe()
+	defer sender.Close()
+	defer receiver.Close()
+
+	var mu sync.Mutex
+	sent := make(chan error, 1)
+	go func() {
+		_, err := handleConnection(context.Background(), sender, file, name,
+			0, size, "", time.Now(), modTime, 0644, func(msg tea.Msg) {
+				if s, ok := msg.(ui.StatusMsg); ok {
+					mu.Lock()
+					status = append(status, string(s))
+					mu.Unlock()
+				}
+			}, false, sendOpts)
+		sender.Close()
+		sent <- err
+	}()
+
+	var saved receivedFile
+	_, _, _, recvErr = handleReceiveSession(context.Background(), nil, receiver, recvOpts, func(tea.Msg) {}, nil, "test", &saved)
+	receiver.Close()
+	sendErr = <-sent
+	mu.Lock()
+	defer mu.Unlock()
+	return sendErr, recvErr, status
+}
+
+func TestRunSenderDryRun(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp) // Where the archive goes
+	dir := filepath.Join(t.TempDir(), "project")
+	os.Mkdir(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644)
+
+	var log msgLog
+	err := RunSender(context.Background(), &log, SendOptions{
+		Paths:     []string{dir},
+		Code:      "code",
+		Timeout:   time.Second,
+		Compress:  DefaultCompressOptions,
+		ChunkSize: ChunkSize,
+		NoHistory: true,
+		LANOnly:   true,
+		DryRun:    true,
+	})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	var status []string
+	for _, msg := range log {
+		if s, ok := msg.(ui.StatusMsg); ok {
+			status = append(status, string(s))
+		}
+	}
+	out := strings.Join(status, "\n")
+	for _, want := range []string{"project.tar.gz", "SHA-256: ", "Compressed: yes, as tar.gz"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("dry run output missing %q:\n%s", want, out)
+		}
+	}
+	if left, _ := os.ReadDir(tmp); len(left) != 0 {
+		t.Errorf("temp archive left behind: %v", left)
+	}
+}
+
+// A followed file never completes, so --once would never retire the code.
+func TestRunSenderOnceFollow(t *testing.T) {
+	var log msgLog
+	err := RunSender(context.Background(), &log, SendOptions{
+		Paths:     []string{filepath.Join(t.TempDir(), "app.log")},
+		Code:      "code",
+		Follow:    true,
+		Once:      true,
+		NoHistory: true,
+		LANOnly:   true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "--once") {
+		t.Fatalf("Expected --once with --follow to be refused, got %v", err)
+	}
+}
+
+func TestAddrInUse(t *testing.T) {
+	pc, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		t.Skip("no UDP:", err)
+	}
+	defer pc.Close()
+	port := pc.LocalAddr().(*net.UDPAddr).Port
+
+	l, err := transport.NewQUICTransport().Listen(":" + strconv.Itoa(port))
+	if err == nil {
+		l.Close()
+		t.Skip("platform allows a second bind to the same UDP port")
+	}
+	if !addrInUse(err) {
+		t.Errorf("addrInUse(%v) = false", err)
+	}
+	if addrInUse(errors.New("permission denied")) {
+		t.Error("addrInUse matched an unrelated error")
+	}
+}
+
+// The broker sees every peer's MQTT client ID (AWS IoT logs them), so the
+// CONNECT packet must not carry the transfer code.
+func TestSignalingHidesCode(t *testing.T) {
+	const code = "secret-otter-pizza"
+	run := map[string]func(ctx context.Context) error{
+		"sender": func(ctx context.Context) error {
+			return RunSender(ctx, &Printer{W: io.Discard}, SendOptions{Text: "hi", IsText: true, Code: code, Timeout: time.Minute, NoHistory: true, NoTCP: true})
+		},
+		"receiver": func(ctx context.Context) error {
+			return RunReceiver(ctx, &Printer{W: io.Discard}, ReceiveOptions{Code: code, OutputDir: t.TempDir(), NoClipboard: true, NoHistory: true, MaxAttempts: 1})
+		},
+	}
+	for role, run := range run {
+		t.Run(role, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			t.Setenv(discovery.EnvDiscovery, "none") // Straight to signaling
+
+			// A broker that only records the CONNECT packet
+			broker, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer broker.Close()
+			t.Setenv(signaling.EnvMQTTBroker, "tcp://"+broker.Addr().String())
+			connect := make(chan []byte, 1)
+			go func() {
+				c, err := broker.Accept()
+				if err != nil {
+					return
+				}
+				defer c.Close()
+				c.SetReadDeadline(time.Now().Add(5 * time.Second))
+				buf := make([]byte, 1024)
+				n, _ := c.Read(buf)
+				connect <- buf[:n]
+			}()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				run(ctx)
+			}()
+			var packet []byte
+			select {
+			case packet = <-connect:
+			case <-time.After(10 * time.Second):
+				t.Fatal("Never connected to the broker")
+			}
+			cancel()
+			<-done
+
+			if !strings.Contains(string(packet), role+"-") {
+				t.Errorf("Expected a %s client ID in the CONNECT packet, got %q", role, packet)
+			}
+			if strings.Contains(string(packet), code) {
+				t.Errorf("CONNECT packet carries the code: %q", packet)
+			}
+		})
+	}
+}
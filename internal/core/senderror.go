@@ -0,0 +1,67 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/darkprince558/jend/pkg/protocol"
+)
+
+// Codes carried by TypeError, for receivers that want to tell failures apart.
+const (
+	errCodeRead   = "read_failed"        // Reading the source failed mid-transfer
+	errCodeSource = "source_unavailable" // The source can't be seeked or watched from the requested offset
+)
+
+// maxErrorPayload bounds the JSON body of a TypeError packet.
+const maxErrorPayload = 4096
+
+// senderError is a fatal error the sender reported in a TypeError packet before
+// hanging up, instead of leaving the receiver with a bare EOF.
+type senderError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *senderError) Error() string {
+	return fmt.Sprintf("sender failed: %s (%s)", e.Message, e.Code)
+}
+
+// sendError tells the receiver why the sender is giving up. Paths are left out
+// of the message: the receiver only needs to know what went wrong, not where
+// the file lives.
+func sendError(w io.Writer, code string, err error) error {
+	msg := err.Error()
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		msg = pe.Op + ": " + pe.Err.Error()
+	}
+	body, _ := json.Marshal(senderError{Code: code, Message: msg})
+	if len(body) > maxErrorPayload {
+		body, _ = json.Marshal(senderError{Code: code, Message: msg[:maxErrorPayload/2]})
+	}
+	if err := protocol.EncodeHeader(w, protocol.TypeError, uint32(len(body))); err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+// readSenderError reads a TypeError payload and turns it into the receiver's error.
+func readSenderError(r io.Reader, length uint32) error {
+	if length == 0 || length > maxErrorPayload {
+		return &senderError{Code: "unknown", Message: "the sender hit an error"}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return err
+	}
+	var e senderError
+	if err := json.Unmarshal(body, &e); err != nil || e.Message == "" {
+		return &senderError{Code: "unknown", Message: "the sender hit an error"}
+	}
+	return &e
+}
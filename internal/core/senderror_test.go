@@ -0,0 +1,43 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/darkprince558/jend/pkg/protocol"
+)
+
+func TestSenderErrorRoundTrip(t *testing.T) {
+	_, readErr := os.Open("/nonexistent/secret/report.pdf")
+
+	var buf bytes.Buffer
+	if err := sendError(&buf, errCodeRead, readErr); err != nil {
+		t.Fatal(err)
+	}
+	pType, length, err := protocol.DecodeHeader(&buf)
+	if err != nil || pType != protocol.TypeError {
+		t.Fatalf("Header = %d, %v; want TypeError", pType, err)
+	}
+
+	got := readSenderError(&buf, length)
+	var se *senderError
+	if !errors.As(got, &se) {
+		t.Fatalf("Got %T (%v), want *senderError", got, got)
+	}
+	if se.Code != errCodeRead || !strings.Contains(se.Message, "no such file") {
+		t.Errorf("Got %+v", se)
+	}
+	if strings.Contains(se.Message, "secret") {
+		t.Errorf("Message leaks the sender's path: %q", se.Message)
+	}
+}
+
+func TestSenderErrorMalformed(t *testing.T) {
+	var se *senderError
+	if err := readSenderError(strings.NewReader("not json"), 8); !errors.As(err, &se) || se.Message == "" {
+		t.Errorf("Malformed body gave %v, want a generic senderError", err)
+	}
+}
@@ -0,0 +1,200 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SenderSession is what `send --save-session` keeps in ~/.jend/sessions: the
+// code and what it offers, so that after a crash `send --resume <code>` serves
+// the same files under the same code and receivers resume their downloads.
+// The file only outlives a sender that died without cleaning up; any ordinary
+// exit, Ctrl-C included, removes it.
+type SenderSession struct {
+	Code  string   `json:"code"`
+	Files []string `json:"files"` // Absolute
+
+	// What decides the bytes offered; a resume must offer the same ones
+	Tar              bool     `json:"tar,omitempty"`
+	Zip              bool     `json:"zip,omitempty"`
+	CompressLevel    int      `json:"compress_level"`
+	FollowSymlinks   bool     `json:"follow_symlinks,omitempty"`
+	Exclude          []string `json:"exclude,omitempty"`
+	RespectGitignore bool     `json:"respect_gitignore,omitempty"`
+	Reproducible     bool     `json:"reproducible,omitempty"`
+	SinceOffset      int64    `json:"since_offset,omitempty"`
+
+	Port int  `json:"port"` // Receivers' links point at it
+	Once bool `json:"once,omitempty"`
+
+	// Size and Hash are the payload's as first offered; a resume refuses files
+	// that no longer match
+	Size int64  `json:"size"`
+	Hash string `json:"hash,omitempty"`
+
+	// Served is every byte range sent so far, for --once across restarts
+	Served  [][2]int64 `json:"served,omitempty"`
+	Created time.Time  `json:"created"`
+}
+
+var sessionsDirOverride string
+
+// sessionsDir is ~/.jend/sessions, private to the user: a session holds its code.
+func sessionsDir() (string, error) {
+	if sessionsDirOverride != "" {
+		return sessionsDirOverride, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(home, ".jend", "sessions")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// sessionPath names the file by a hash of the code: a custom code may hold
+// anything, including path separators.
+func sessionPath(code string) (string, error) {
+	dir, err := sessionsDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(code))
+	return filepath.Join(dir, fmt.Sprintf("%x.json", sum[:8])), nil
+}
+
+// NewSenderSession starts a session for code offering paths. Text, stdin and
+// --follow can't be offered again after a restart, so they are refused.
+func NewSenderSession(code string, paths []string, isText, follow bool) (*SenderSession, error) {
+	if isText || follow {
+		return nil, errors.New("only files can be resumed, not --text or --follow")
+	}
+	s := &SenderSession{Code: code, Created: time.Now()}
+	for _, p := range paths {
+		if p == "-" {
+			return nil, errors.New("stdin can't be resumed")
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		s.Files = append(s.Files, abs)
+	}
+	return s, nil
+}
+
+// LoadSenderSession reads the saved session for code.
+func LoadSenderSession(code string) (*SenderSession, error) {
+	path, err := sessionPath(code)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if codes := SavedSessionCodes(); len(codes) > 0 {
+			return nil, fmt.Errorf("no saved session for %q (saved: %s)", code, strings.Join(codes, ", "))
+		}
+		return nil, fmt.Errorf("no saved session for %q", code)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s SenderSession
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("corrupt session file %s: %w", path, err)
+	}
+	if s.Code != code || len(s.Files) == 0 {
+		return nil, fmt.Errorf("session file %s is not for %q", path, code)
+	}
+	return &s, nil
+}
+
+// SavedSessionCodes lists the codes with a saved session, oldest first.
+func SavedSessionCodes() []string {
+	dir, err := sessionsDir()
+	if err != nil {
+		return nil
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	var sessions []SenderSession
+	for _, m := range matches {
+		data, err := os.ReadFile(m)
+		if err != nil {
+			continue
+		}
+		var s SenderSession
+		if json.Unmarshal(data, &s) == nil && s.Code != "" {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Created.Before(sessions[j].Created) })
+	codes := make([]string, len(sessions))
+	for i, s := range sessions {
+		codes[i] = s.Code
+	}
+	return codes
+}
+
+// save writes the session, write-then-rename so a crash mid-save leaves the
+// previous one.
+func (s *SenderSession) save() error {
+	path, err := sessionPath(s.Code)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// RemoveSenderSession deletes the saved session for code, if there is one.
+func RemoveSenderSession(code string) error {
+	path, err := sessionPath(code)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// start checks a resumed session still offers the same payload, restores
+// what it had served into served, and saves it.
+func (s *SenderSession) start(size int64, hash string, served *coverage) error {
+	if s.Hash != "" && (s.Size != size || s.Hash != hash) {
+		return fmt.Errorf("the files changed since session %q was saved; receivers couldn't resume it, so send them again under a new code", s.Code)
+	}
+	s.Size, s.Hash = size, hash
+	for _, r := range s.Served {
+		served.add(span{r[0], r[1]})
+	}
+	return s.save()
+}
+
+// recordServed saves what served covers now.
+func (s *SenderSession) recordServed(served *coverage) error {
+	served.mu.Lock()
+	s.Served = s.Served[:0]
+	for _, sp := range served.spans {
+		s.Served = append(s.Served, [2]int64{sp.start, sp.end})
+	}
+	served.mu.Unlock()
+	return s.save()
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSenderSession(t *testing.T) {
+	sessionsDirOverride = t.TempDir()
+	defer func() { sessionsDirOverride = "" }()
+
+	if _, err := NewSenderSession("code", []string{"-"}, false, false); err == nil {
+		t.Error("Expected stdin to be refused")
+	}
+	if _, err := NewSenderSession("code", nil, true, false); err == nil {
+		t.Error("Expected --text to be refused")
+	}
+
+	// A custom code may hold path separators; it must not escape the directory
+	code := "../odd/code-with-slashes"
+	s, err := NewSenderSession(code, []string{"data.bin"}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filepath.IsAbs(s.Files[0]) {
+		t.Errorf("Saved a relative path %q", s.Files[0])
+	}
+	var served coverage
+	if err := s.start(1000, "abc", &served); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	served.add(span{0, 400})
+	if err := s.recordServed(&served); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(sessionsDirOverride); len(entries) != 1 {
+		t.Fatalf("Expected one session file, got %d", len(entries))
+	}
+
+	// The restarted sender picks up the code, files and what was served
+	loaded, err := LoadSenderSession(code)
+	if err != nil {
+		t.Fatalf("LoadSenderSession: %v", err)
+	}
+	if loaded.Files[0] != s.Files[0] || loaded.Hash != "abc" {
+		t.Errorf("Loaded %+v", loaded)
+	}
+	var resumed coverage
+	if err := loaded.start(1000, "abc", &resumed); err != nil {
+		t.Fatalf("start after restart: %v", err)
+	}
+	resumed.add(span{400, 1000})
+	if !resumed.complete(1000) {
+		t.Error("Bytes served before the restart were forgotten")
+	}
+
+	// Changed files would fail every receiver's integrity check
+	changed, _ := LoadSenderSession(code)
+	if err := changed.start(1000, "def", &coverage{}); err == nil {
+		t.Error("Expected a changed payload to be refused")
+	}
+
+	if _, err := LoadSenderSession("other-code"); err == nil {
+		t.Error("Loaded a session that was never saved")
+	}
+	if codes := SavedSessionCodes(); len(codes) != 1 || codes[0] != code {
+		t.Errorf("SavedSessionCodes = %q", codes)
+	}
+	if err := RemoveSenderSession(code); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSenderSession(code); err == nil {
+		t.Error("Session survived RemoveSenderSession")
+	}
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/darkprince558/jend/internal/audit"
+)
+
+// DefaultMaxSize is the receiver's --max-size: the largest offer it takes
+// without being told otherwise. The sender's claimed size is otherwise
+// trusted for preallocation (parallel downloads truncate to it).
+const DefaultMaxSize int64 = 1 << 40 // 1TB
+
+// DefaultTextLimit is the receiver's --text-limit: the largest text snippet it
+// takes. Text is held in memory until it is shown or saved.
+const DefaultTextLimit int64 = 1 << 20 // 1MB
+
+// errRefused marks an offer the receiver turned down on its own; retrying
+// would only be refused again.
+var errRefused = errors.New("offer refused")
+
+// checkOffer refuses an offer over opts.MaxSize, a text snippet over
+// opts.TextLimit, or one that won't fit in the output directory's free space,
+// before anything is written. Live streams have no size yet; their limit is
+// enforced as the bytes arrive.
+func checkOffer(meta FileMeta, safeName string, opts *ReceiveOptions) error {
+	if meta.Type == "stream" {
+		return nil
+	}
+	if meta.Size < 0 {
+		return fmt.Errorf("%w: invalid size %d", errRefused, meta.Size)
+	}
+	if meta.Type == "text" {
+		if opts.TextLimit > 0 && meta.Size > opts.TextLimit {
+			return fmt.Errorf("%w: text of %s is over the --text-limit of %s", errRefused, audit.FormatBytes(meta.Size), audit.FormatBytes(opts.TextLimit))
+		}
+		return nil
+	}
+	if opts.MaxSize > 0 && meta.Size > opts.MaxSize {
+		return fmt.Errorf("%w: %s is over the --max-size of %s", errRefused, audit.FormatBytes(meta.Size), audit.FormatBytes(opts.MaxSize))
+	}
+	if opts.Stdout {
+		return nil
+	}
+	outputDir := opts.OutputDir
+
+	free, err := freeSpace(outputDir)
+	if err != nil {
+		return nil // Can't tell here; a full disk still fails the write
+	}
+	need := meta.Size - onDisk(meta, outputDir, safeName)
+	if !opts.Hardlink {
+		need += copiedBytes(meta) // Duplicates in a manifest are sent once but saved twice
+	}
+	if need > free {
+		return fmt.Errorf("%w: not enough disk space in %s (need %s, %s free)", errRefused, outputDir, audit.FormatBytes(need), audit.FormatBytes(free))
+	}
+	return nil
+}
+
+// onDisk is how much of the offer partial downloads already hold; resuming
+// only needs the rest.
+func onDisk(meta FileMeta, outputDir, safeName string) int64 {
+	size := func(path string, limit int64) int64 {
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0
+		}
+		return min(info.Size(), limit)
+	}
+	if meta.Type == "multi" {
+		var n int64
+		for _, e := range meta.Files {
+			n += size(filepath.Join(outputDir, e.Name+partialSuffix), e.Size)
+		}
+		return n
+	}
+	// Parallel downloads preallocate, so their partial counts in full
+	return max(size(filepath.Join(outputDir, safeName+partialSuffix), meta.Size),
+		size(filepath.Join(outputDir, safeName+parallelPartSuffix), meta.Size))
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckOffer(t *testing.T) {
+	dir := t.TempDir()
+	file := FileMeta{Name: "big.bin", Size: 10 << 20, Type: "file"}
+	opts := &ReceiveOptions{OutputDir: dir, TextLimit: DefaultTextLimit}
+
+	if err := checkOffer(file, "big.bin", opts); err != nil {
+		t.Errorf("Expected 10MB to fit with no limit, got %v", err)
+	}
+	if err := checkOffer(file, "big.bin", &ReceiveOptions{OutputDir: dir, MaxSize: 1 << 20}); !errors.Is(err, errRefused) {
+		t.Errorf("Expected an offer over --max-size to be refused, got %v", err)
+	}
+	if err := checkOffer(FileMeta{Size: -5, Type: "file"}, "x", opts); !errors.Is(err, errRefused) {
+		t.Errorf("Expected a negative size to be refused, got %v", err)
+	}
+	if err := checkOffer(FileMeta{Size: DefaultTextLimit + 1, Type: "text"}, "x", opts); !errors.Is(err, errRefused) {
+		t.Errorf("Expected text over --text-limit to be refused, got %v", err)
+	}
+	if err := checkOffer(FileMeta{Size: DefaultTextLimit + 1, Type: "text"}, "x", &ReceiveOptions{OutputDir: dir}); err != nil {
+		t.Errorf("Expected a zero TextLimit to mean no limit, got %v", err)
+	}
+	// Live streams don't know their size up front
+	if err := checkOffer(FileMeta{Size: -1, Type: "stream"}, "x", &ReceiveOptions{OutputDir: dir, MaxSize: 1}); err != nil {
+		t.Errorf("Expected streams to pass, got %v", err)
+	}
+
+	free, err := freeSpace(dir)
+	if err != nil {
+		t.Skipf("freeSpace unsupported: %v", err)
+	}
+	huge := FileMeta{Name: "huge.bin", Size: free + 1<<30, Type: "file"}
+	if err := checkOffer(huge, "huge.bin", opts); !errors.Is(err, errRefused) {
+		t.Errorf("Expected an offer bigger than the disk to be refused, got %v", err)
+	}
+	if err := checkOffer(huge, "huge.bin", &ReceiveOptions{OutputDir: dir, Stdout: true}); err != nil {
+		t.Errorf("Expected --stdout to skip the disk check, got %v", err)
+	}
+}
+
+func TestOnDisk(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.bin"+partialSuffix), make([]byte, 30), 0644)
+	if got := onDisk(FileMeta{Size: 100, Type: "file"}, dir, "a.bin"); got != 30 {
+		t.Errorf("Expected 30 bytes on disk, got %d", got)
+	}
+	if got := onDisk(FileMeta{Size: 20, Type: "file"}, dir, "a.bin"); got != 20 {
+		t.Errorf("Expected the partial to count at most the offer size, got %d", got)
+	}
+	multi := FileMeta{Type: "multi", Files: []ManifestEntry{{Name: "a.bin", Size: 50}, {Name: "b.bin", Size: 50}}}
+	if got := onDisk(multi, dir, ""); got != 30 {
+		t.Errorf("Expected 30 bytes on disk for the manifest, got %d", got)
+	}
+}
+
+// textSession sends text, PAKE included, to a receiver with the given
+// --text-limit, and returns both sides' errors and what it saved.
+func textSession(t *testing.T, text string, limit int64) (sendErr, recvErr error, got string) {
+	t.Helper()
+	outDir := t.TempDir()
+	sendOpts := &SendOptions{Code: "code", IsText: true, ChunkSize: ChunkSize}
+	recvOpts := &ReceiveOptions{Code: "code", OutputDir: outDir, OutputName: "out.txt", NoClipboard: true, Concurrency: 1, TextLimit: limit}
+	sendErr, recvErr, _ = pipeSession(t, strings.NewReader(text), "text", int64(len(text)), time.Time{}, sendOpts, recvOpts)
+	data, _ := os.ReadFile(filepath.Join(outDir, "out.txt"))
+	return sendErr, recvErr, string(data)
+}
+
+func TestTextLimit(t *testing.T) {
+	t.Setenv("HOME", t.TempDir()) // The sender signs with its identity key
+
+	// Refused before the Ack, with the reason on both sides
+	sendErr, recvErr, got := textSession(t, strings.Repeat("x", 101), 100)
+	if !errors.Is(recvErr, errRefused) || !strings.Contains(recvErr.Error(), "--text-limit") {
+		t.Errorf("Receiver error = %v, want a refusal naming --text-limit", recvErr)
+	}
+	if !errors.Is(sendErr, errDeclined) || !strings.Contains(sendErr.Error(), "--text-limit") {
+		t.Errorf("Sender error = %v, want the receiver's reason", sendErr)
+	}
+	if got != "" {
+		t.Errorf("Refused text was saved: %q", got)
+	}
+
+	text := strings.Repeat("y", 100)
+	if sendErr, recvErr, got = textSession(t, text, 100); sendErr != nil || recvErr != nil || got != text {
+		t.Errorf("Text at the limit: sender %v, receiver %v, saved %d bytes", sendErr, recvErr, len(got))
+	}
+}
@@ -0,0 +1,149 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/darkprince558/jend/internal/transport"
+	"github.com/quic-go/quic-go"
+)
+
+// tcpFallbackAfter is how many QUIC dials in a row may fail before the
+// receiver tries the sender's TCP listener on the same address instead.
+const tcpFallbackAfter = 3
+
+// peerConn is one receiver's connection as RunSender serves it: QUIC with its
+// streams (direct or over ICE), or a TCP fallback connection carrying exactly
+// one stream. The same packets flow over either, PAKE and encryption included.
+type peerConn interface {
+	AcceptStream(ctx context.Context) (io.ReadWriteCloser, error)
+	CloseWithError(code quic.ApplicationErrorCode, reason string) error
+	RemoteAddr() net.Addr
+	Context() context.Context
+}
+
+type quicPeer struct{ *quic.Conn }
+
+func (p quicPeer) AcceptStream(ctx context.Context) (io.ReadWriteCloser, error) {
+	return p.Conn.AcceptStream(ctx)
+}
+
+// tcpPeer serves a TCP connection as a peerConn. Its one stream is the
+// connection itself; once that is done the connection ends, since TCP has no
+// further streams to open.
+type tcpPeer struct {
+	conn   net.Conn
+	ctx    context.Context
+	cancel context.CancelFunc
+	stream chan io.ReadWriteCloser
+	once   sync.Once
+}
+
+func newTCPPeer(conn net.Conn) *tcpPeer {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &tcpPeer{conn: conn, ctx: ctx, cancel: cancel, stream: make(chan io.ReadWriteCloser, 1)}
+	p.stream <- &tcpStream{Conn: conn, peer: p}
+	return p
+}
+
+func (p *tcpPeer) AcceptStream(ctx context.Context) (io.ReadWriteCloser, error) {
+	select {
+	case s := <-p.stream:
+		return s, nil
+	case <-p.ctx.Done():
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// CloseWithError closes the connection. TCP can't carry the reason; a
+// receiver on the fallback treats a hang-up during the PAKE as a wrong code.
+func (p *tcpPeer) CloseWithError(quic.ApplicationErrorCode, string) error {
+	var err error
+	p.once.Do(func() {
+		p.cancel()
+		err = p.conn.Close()
+	})
+	return err
+}
+
+func (p *tcpPeer) RemoteAddr() net.Addr     { return p.conn.RemoteAddr() }
+func (p *tcpPeer) Context() context.Context { return p.ctx }
+
+// tcpStream closes like a QUIC stream: only our side, so the receiver still
+// reads everything sent (a full close with unread input would reset the
+// connection and drop it). The connection goes once the receiver hangs up.
+type tcpStream struct {
+	net.Conn
+	peer *tcpPeer
+}
+
+func (s *tcpStream) Close() error {
+	var err error
+	if tc, ok := s.Conn.(*net.TCPConn); ok {
+		err = tc.CloseWrite()
+	}
+	go func() {
+		s.Conn.SetReadDeadline(time.Now().Add(cancelGracePeriod))
+		io.Copy(io.Discard, s.Conn)
+		s.peer.CloseWithError(0, "done")
+	}()
+	return err
+}
+
+// acceptPeers feeds every receiver that connects, over QUIC or TCP, to one
+// channel for RunSender's accept loop. tcp may be nil (--no-tcp, or the port
+// was taken). It stops when ctx is done.
+func acceptPeers(ctx context.Context, quicConns *transport.MultiListener, tcp net.Listener) <-chan peerConn {
+	peers := make(chan peerConn)
+	offer := func(p peerConn) bool {
+		select {
+		case peers <- p:
+			return true
+		case <-ctx.Done():
+			p.CloseWithError(0, "sender stopped")
+			return false
+		}
+	}
+	go func() {
+		for {
+			conn, err := quicConns.Accept(ctx)
+			if err != nil || !offer(quicPeer{conn}) {
+				return
+			}
+		}
+	}()
+	if tcp != nil {
+		context.AfterFunc(ctx, func() { tcp.Close() })
+		go func() {
+			for {
+				conn, err := tcp.Accept()
+				if err != nil || !offer(newTCPPeer(conn)) {
+					return
+				}
+			}
+		}()
+	}
+	return peers
+}
+
+// dialTCP tries the sender's TCP listener at each address, for when QUIC
+// (UDP) doesn't get through. It returns the connection and the address that
+// answered.
+func dialTCP(ctx context.Context, addrs []string) (net.Conn, string, error) {
+	lastErr := fmt.Errorf("no address to dial")
+	for _, addr := range addrs {
+		d := net.Dialer{Timeout: discoveryDialTimeout}
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			return conn, addr, nil
+		}
+		lastErr = err
+	}
+	return nil, "", lastErr
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darkprince558/jend/internal/transport"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// TestTCPFallbackTransfer runs a whole session over the sender's TCP listener:
+// the same PAKE and packets as QUIC, on the one stream TCP gives us.
+func TestTCPFallbackTransfer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	quicConns := transport.NewMultiListener()
+	defer quicConns.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	peers := acceptPeers(ctx, quicConns, ln)
+
+	content := strings.Repeat("over tcp ", 20000)
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+
+	sent := make(chan error, 1)
+	var peer peerConn
+	go func() {
+		peer = <-peers
+		stream, err := peer.AcceptStream(ctx)
+		if err != nil {
+			sent <- err
+			return
+		}
+		_, err = handleConnection(ctx, stream, strings.NewReader(content), "data.txt",
+			0, int64(len(content)), hash, time.Now(), time.Time{}, 0, func(tea.Msg) {}, false, &SendOptions{Code: "code", ChunkSize: ChunkSize})
+		stream.Close()
+		sent <- err
+	}()
+
+	conn, addr, err := dialTCP(ctx, []string{"127.0.0.1:1", ln.Addr().String()})
+	if err != nil {
+		t.Fatalf("dialTCP: %v", err)
+	}
+	if addr != ln.Addr().String() {
+		t.Errorf("Expected %s to answer, got %s", ln.Addr(), addr)
+	}
+
+	// Parallel is asked for, but the one stream means sequential
+	outDir := t.TempDir()
+	var saved receivedFile
+	opts := &ReceiveOptions{Code: "code", OutputDir: outDir, NoClipboard: true, Concurrency: 4}
+	done, _, _, err := handleReceiveSession(ctx, nil, conn, opts, func(tea.Msg) {}, nil, "TCP fallback", &saved)
+	if err != nil || !done {
+		t.Fatalf("Receive over TCP: done=%v err=%v", done, err)
+	}
+	if err := <-sent; err != nil {
+		t.Fatalf("Send over TCP: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(outDir, "data.txt"))
+	if err != nil || string(got) != content {
+		t.Fatalf("Received file differs (err %v)", err)
+	}
+
+	// The sender lets go of the connection once the receiver hangs up
+	conn.Close()
+	select {
+	case <-peer.Context().Done():
+	case <-time.After(cancelGracePeriod + time.Second):
+		t.Error("Sender kept the TCP connection after the receiver hung up")
+	}
+}
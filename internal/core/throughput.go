@@ -0,0 +1,71 @@
+package core
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// throughputWindow is how far back the progress speed looks, so a stall or
+	// a faster link shows within seconds instead of being averaged away.
+	throughputWindow = 5 * time.Second
+	// throughputTau is the time constant of the moving average within the
+	// window: a bucket's weight falls to 37% after this long, so the last
+	// couple of seconds count most and a change in rate shows without waiting
+	// for the whole window to turn over.
+	throughputTau = 2 * time.Second
+	// throughputBucket is the shortest span measured on its own; progress can
+	// arrive once per chunk, far too often for a meaningful rate.
+	throughputBucket = 100 * time.Millisecond
+)
+
+type throughputSample struct {
+	at    time.Time
+	total int64
+}
+
+// throughputEstimator turns a running byte count into the current speed, an
+// exponentially-weighted moving average of the rate over the buckets in the
+// last throughputWindow, and an ETA from it. Bytes already there when it
+// starts (a resume) never count as speed. Sender and receiver progress both
+// use it.
+type throughputEstimator struct {
+	samples []throughputSample // Bucket ends, oldest first; samples[0] is at or before the window's start
+	rate    float64            // Speed as of the last bucket
+}
+
+// newThroughputEstimator starts measuring at now, with total bytes already done.
+func newThroughputEstimator(total int64, now time.Time) *throughputEstimator {
+	return &throughputEstimator{samples: []throughputSample{{at: now, total: total}}}
+}
+
+// update records the running total at now and returns the speed in bytes per
+// second, and the time left for the bytes up to size at that speed (0 when
+// size is unknown, < 0, or nothing moved lately).
+func (e *throughputEstimator) update(total, size int64, now time.Time) (float64, time.Duration) {
+	if now.Sub(e.samples[len(e.samples)-1].at) >= throughputBucket {
+		e.samples = append(e.samples, throughputSample{at: now, total: total})
+		// Keep one sample at or before the window's start to measure from
+		edge := now.Add(-throughputWindow)
+		drop := 0
+		for drop+1 < len(e.samples) && !e.samples[drop+1].at.After(edge) {
+			drop++
+		}
+		e.samples = e.samples[drop:]
+
+		// Bytes and seconds are both discounted by the bucket's age, so uneven
+		// sampling doesn't skew the average
+		var bytes, secs float64
+		for i := 1; i < len(e.samples); i++ {
+			prev, s := e.samples[i-1], e.samples[i]
+			w := math.Exp(-now.Sub(s.at).Seconds() / throughputTau.Seconds())
+			bytes += w * float64(s.total-prev.total)
+			secs += w * s.at.Sub(prev.at).Seconds()
+		}
+		e.rate = bytes / secs
+	}
+	if size < 0 || e.rate <= 0 || total >= size {
+		return e.rate, 0
+	}
+	return e.rate, time.Duration(float64(size-total) / e.rate * float64(time.Second))
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+// feedThroughput adds rate bytes/s to total in 100ms steps for d and returns
+// the last speed and ETA.
+func feedThroughput(e *throughputEstimator, now *time.Time, total *int64, size, rate int64, d time.Duration) (float64, time.Duration) {
+	var speed float64
+	var eta time.Duration
+	for step := time.Duration(0); step < d; step += 100 * time.Millisecond {
+		*now = now.Add(100 * time.Millisecond)
+		*total += rate / 10
+		speed, eta = e.update(*total, size, *now)
+	}
+	return speed, eta
+}
+
+// TestThroughputResumeAndWindow checks that resumed bytes never count as speed
+// and that an early burst is forgotten once it leaves the window.
+func TestThroughputResumeAndWindow(t *testing.T) {
+	start := time.Unix(0, 0)
+	e := newThroughputEstimator(9000, start) // Resumed at 9000 of 20000
+
+	speed, eta := e.update(10000, 20000, start.Add(time.Second))
+	if speed != 1000 {
+		t.Errorf("Expected 1000 B/s right after resuming, got %v", speed)
+	}
+	if eta != 10*time.Second {
+		t.Errorf("Expected 10s left, got %v", eta)
+	}
+	if speed, _ := e.update(10000, 20000, start.Add(time.Second+time.Millisecond)); speed != 1000 {
+		t.Errorf("Expected a sample within the bucket to keep the speed, got %v", speed)
+	}
+
+	// Slow down to 100 B/s, sampled every 100ms for 10s
+	now := start.Add(time.Second)
+	total := int64(10000)
+	speed, eta = feedThroughput(e, &now, &total, 20000, 100, 10*time.Second)
+	if speed < 99 || speed > 101 {
+		t.Errorf("Expected the speed to settle at 100 B/s, got %v", speed)
+	}
+	if eta < 89*time.Second || eta > 91*time.Second {
+		t.Errorf("Expected about 90s left, got %v", eta)
+	}
+	if len(e.samples) > int(throughputWindow/throughputBucket)+2 {
+		t.Errorf("Expected old samples to be dropped, have %d", len(e.samples))
+	}
+
+	// Unknown size: speed only
+	if _, eta := e.update(total+10, -1, now.Add(100*time.Millisecond)); eta != 0 {
+		t.Errorf("Expected no ETA for an unknown size, got %v", eta)
+	}
+}
+
+// TestThroughputStepChange checks that the speed follows a drop and a rise in
+// rate within a few time constants, where a cumulative average would lag.
+func TestThroughputStepChange(t *testing.T) {
+	now := time.Unix(0, 0)
+	var total int64
+	const size = 1 << 30
+	e := newThroughputEstimator(0, now)
+
+	speed, _ := feedThroughput(e, &now, &total, size, 10000, 10*time.Second)
+	if speed < 9900 || speed > 10100 {
+		t.Fatalf("Expected a steady 10000 B/s, got %v", speed)
+	}
+
+	// Drop to 1000 B/s: partly there after one time constant, settled once the
+	// window has turned over
+	speed, _ = feedThroughput(e, &now, &total, size, 1000, throughputTau)
+	if speed < 3500 || speed > 5000 {
+		t.Errorf("Expected about 3800 B/s one time constant after the drop, got %v", speed)
+	}
+	speed, eta := feedThroughput(e, &now, &total, size, 1000, 2*throughputTau)
+	if speed < 950 || speed > 1050 {
+		t.Errorf("Expected the speed within 5%% of the step after 3 time constants, got %v", speed)
+	}
+	if want := time.Duration(float64(size-total) / speed * float64(time.Second)); eta != want {
+		t.Errorf("Expected the ETA to follow the current speed (%v), got %v", want, eta)
+	}
+	// The cumulative average would still claim over 6000 B/s here
+	if cumulative := float64(total) / 16; speed > cumulative/4 {
+		t.Errorf("Expected the speed (%v) to be well below the cumulative average (%v)", speed, cumulative)
+	}
+
+	// A stall and a recovery
+	speed, _ = feedThroughput(e, &now, &total, size, 0, 3*throughputTau)
+	if speed > 100 {
+		t.Errorf("Expected the speed to fall towards 0 during a stall, got %v", speed)
+	}
+	speed, _ = feedThroughput(e, &now, &total, size, 20000, 3*throughputTau)
+	if speed < 18000 || speed > 20000 {
+		t.Errorf("Expected the speed to recover to about 20000 B/s, got %v", speed)
+	}
+}
@@ -1,45 +1,144 @@
 package discovery
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"net"
+	"sync"
+	"time"
 
 	"github.com/grandcat/zeroconf"
 )
 
-// StartAdvertising announces the JEND service on the local network.
+// StartAdvertising announces the JEND service on the local network and, unless
+// lanOnly is set, registers with the cloud registry. Callers that want a specific
+// set of backends should use Backends() instead.
 // It returns a shutdown function that should be called when advertising is no longer needed.
-func StartAdvertising(port int, code string) (func(), error) {
-	// Instance name: "JendSender-<Hash[:8]>"
-	codeHash := ComputeHash(code)
-	instanceName := fmt.Sprintf("JendSender-%s", codeHash[:8])
-
-	// TXT record holds the full hash for the receiver to verify
-	txt := []string{fmt.Sprintf("hash=%s", codeHash)}
-
-	server, err := zeroconf.Register(
-		instanceName,
-		ServiceType,
-		"local.",
-		port,
-		txt,
-		nil, // Check all interfaces (IPv4 and IPv6)
-	)
+func StartAdvertising(port int, code string, lanOnly bool) (func(), error) {
+	stop, err := advertiseMDNS(port, code, "", nil)
 	if err != nil {
 		return nil, err
 	}
+	if lanOnly {
+		return stop, nil
+	}
 
-	// Register with Cloud Registry (AWS) in parallel
 	// Register with Cloud Registry (AWS) in parallel
 	// Log errors but do not block execution.
-	if err := RegisterWithCloud(code, "", port); err != nil {
+	stopCloud, err := advertiseCloud(code, "", port, nil)
+	if err != nil {
 		fmt.Printf("Warning: Cloud registration failed: %v\n", err)
+		return stop, nil
+	}
+
+	return func() {
+		stopCloud()
+		stop()
+	}, nil
+}
+
+// advertiseMDNS announces the JEND service over mDNS only, with the sender's
+// key pub if set (see Identity). An ip (the sender's --bind address) is
+// announced alone, on its own interface; otherwise zeroconf announces every
+// address of every multicast interface.
+func advertiseMDNS(port int, code string, ip string, pub ed25519.PublicKey) (func(), error) {
+	ifaces, err := multicastInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	if ip != "" {
+		ifaces = interfacesWithIP(ifaces, net.ParseIP(ip))
+		if len(ifaces) == 0 {
+			return nil, fmt.Errorf("%w: no multicast interface has %s", ErrNoMulticast, ip)
+		}
+	}
+
+	// Instance name: "JendSender-<Hash[:8]>-<Nonce>". The per-session nonce keeps
+	// two senders whose hashes collide (or a squatter copying ours) from
+	// clashing on one name; receivers then tell them apart with the PAKE.
+	nonce := make([]byte, 4)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	codeHash := ComputeHash(code)
+	instanceName := fmt.Sprintf("JendSender-%s-%x", codeHash[:8], nonce)
+
+	// TXT record holds the full hash for the receiver to match on
+	txt := []string{fmt.Sprintf("hash=%s", codeHash), fmt.Sprintf("nonce=%x", nonce)}
+	if len(pub) > 0 {
+		txt = append(txt, "key="+base64.RawStdEncoding.EncodeToString(pub))
+	}
+
+	var server *zeroconf.Server
+	if ip == "" {
+		server, err = zeroconf.Register(instanceName, ServiceType, "local.", port, txt, ifaces)
+	} else {
+		// Register would announce every address the host has
+		server, err = zeroconf.RegisterProxy(instanceName, ServiceType, "local.", port, instanceName, []string{ip}, txt, ifaces)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoMulticast, err)
 	}
 
 	return server.Shutdown, nil
 }
 
-// RegisterWithCloud registers the instance with the global AWS registry.
-func RegisterWithCloud(code string, ip string, port int) error {
-	client := NewRegistryClient()
-	return client.Register(code, ip, port)
+// cloudRefreshInterval re-registers an advertised session well within the
+// registry's 10-minute TTL, so a sender that waits longer stays findable.
+var cloudRefreshInterval = 4 * time.Minute
+
+// Registration attempts per registration or refresh, with doubling backoff.
+const cloudRegisterAttempts = 3
+
+var cloudRegisterBackoff = 500 * time.Millisecond
+
+// advertiseCloud registers with the global AWS registry under the code's
+// discovery ID (the registry never sees the code), and keeps the entry alive
+// until the returned function is called. One client, and so one nonce, serves
+// the whole session: retries and refreshes update our own entry instead of
+// being refused as another sender's. The entry carries pub, if set.
+func advertiseCloud(code string, ip string, port int, pub ed25519.PublicKey) (func(), error) {
+	client := NewRegistryClient(RegistryURL())
+	client.publicKey = pub
+	id := ComputeHash(code)
+	interval, backoff := cloudRefreshInterval, cloudRegisterBackoff
+	if err := registerWithRetry(client, id, ip, port, backoff); err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// Best effort: the entry outlives one missed refresh
+				registerWithRetry(client, id, ip, port, backoff)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }, nil
+}
+
+// registerWithRetry registers id with client, retrying failures other than
+// the code being taken after backoff, doubled each time.
+func registerWithRetry(client *RegistryClient, id, ip string, port int, backoff time.Duration) error {
+	var err error
+	for attempt := 0; attempt < cloudRegisterAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = client.Register(id, ip, port); err == nil || errors.Is(err, ErrCodeTaken) {
+			return err
+		}
+	}
+	return err
 }
@@ -0,0 +1,153 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Discoverer is a mechanism for a sender to announce itself and for a receiver to
+// find it by code. mDNS and the cloud registry are the built-ins; other
+// environments (Kubernetes DNS, Consul, a shared file) can plug in their own.
+// Backends that contact a service outside the local network should also have a
+// `Remote() bool` method returning true, so --lan-only leaves them out.
+type Discoverer interface {
+	// Name identifies the backend, e.g. for JEND_DISCOVERY and status messages.
+	Name() string
+	// Advertise announces the sender for code at addr ("host:port", host may be empty).
+	// The returned stop function withdraws the announcement.
+	Advertise(code string, addr string) (stop func(), err error)
+	// Find looks up the sender for code and returns its "host:port" candidates,
+	// in the order they should be dialed.
+	Find(code string, timeout time.Duration) (addrs []string, err error)
+}
+
+// EnvDiscovery selects and orders backends by name, e.g. "mdns" or "cloud,mdns".
+// Unset means every registered backend, in registration order.
+const EnvDiscovery = "JEND_DISCOVERY"
+
+var (
+	backendsMu sync.Mutex
+	backends   []Discoverer
+)
+
+func init() {
+	RegisterBackend(MDNS{})
+	RegisterBackend(Cloud{})
+}
+
+// RegisterBackend adds a discoverer. A backend with the same name is replaced.
+func RegisterBackend(d Discoverer) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	for i, existing := range backends {
+		if existing.Name() == d.Name() {
+			backends[i] = d
+			return
+		}
+	}
+	backends = append(backends, d)
+}
+
+// Backends returns the discoverers to use, in the order they should be tried.
+func Backends() []Discoverer {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	selected := os.Getenv(EnvDiscovery)
+	if strings.TrimSpace(selected) == "" {
+		return append([]Discoverer(nil), backends...)
+	}
+
+	var out []Discoverer
+	for _, name := range strings.Split(selected, ",") {
+		name = strings.TrimSpace(name)
+		for _, d := range backends {
+			if d.Name() == name {
+				out = append(out, d)
+			}
+		}
+	}
+	return out
+}
+
+// LANBackends is Backends without the ones that reach outside the local network,
+// for --lan-only.
+func LANBackends() []Discoverer {
+	var out []Discoverer
+	for _, d := range Backends() {
+		if r, ok := d.(interface{ Remote() bool }); ok && r.Remote() {
+			continue
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// splitPort extracts the port from an Advertise addr.
+func splitPort(addr string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port %q", portStr)
+	}
+	return host, port, nil
+}
+
+// MDNS advertises and browses on the local network via zeroconf.
+type MDNS struct{ Identity }
+
+func (MDNS) Name() string { return "mdns" }
+
+func (m MDNS) WithIdentity(id Identity) Discoverer {
+	m.Identity = id
+	return m
+}
+
+func (m MDNS) Advertise(code string, addr string) (func(), error) {
+	host, port, err := splitPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	return advertiseMDNS(port, code, host, m.PublicKey)
+}
+
+func (m MDNS) Find(code string, timeout time.Duration) ([]string, error) {
+	return browseMDNS(code, timeout, m.Identity)
+}
+
+// Cloud registers with and looks up from the global JEND registry.
+type Cloud struct{ Identity }
+
+func (Cloud) Name() string { return "cloud" }
+
+func (Cloud) Remote() bool { return true }
+
+func (c Cloud) WithIdentity(id Identity) Discoverer {
+	c.Identity = id
+	return c
+}
+
+func (c Cloud) Advertise(code string, addr string) (func(), error) {
+	host, port, err := splitPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	// Refreshed until stopped, then the entry expires on its own (registry TTL)
+	return advertiseCloud(code, host, port, c.PublicKey)
+}
+
+func (c Cloud) Find(code string, timeout time.Duration) ([]string, error) {
+	addr, err := LookupCloud(code, c.Identity)
+	if err != nil {
+		return nil, err
+	}
+	return []string{addr}, nil
+}
@@ -4,18 +4,39 @@ import (
 	"context"
 	"fmt"
 	"net"
-	"strings"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/grandcat/zeroconf"
 )
 
+// mdnsCollectWindow is how long FindSender keeps listening after the first match,
+// to pick up other senders advertising the same discovery ID.
+const mdnsCollectWindow = 300 * time.Millisecond
+
 // FindSender scans the network for a JEND sender matching the code.
-// It returns the IP:Port string if found, or an error if timed out.
-func FindSender(code string, timeout time.Duration) (string, error) {
-	resolver, err := zeroconf.NewResolver(nil)
+// It returns every advertised "host:port" (see OrderAddrs for the order), or an
+// error if timed out. Without a usable multicast interface it fails at once
+// with ErrNoMulticast.
+// The hash only narrows the search: anyone who saw it can advertise it too. If
+// several senders match, all their addresses are returned, one sender after the
+// other, and the PAKE decides which one really knows the code. Whatever key a
+// sender publishes, it is returned; MDNS.Find can filter on it.
+func FindSender(code string, timeout time.Duration) ([]string, error) {
+	return browseMDNS(code, timeout, Identity{})
+}
+
+// browseMDNS is FindSender, leaving out senders that publish a key other than
+// the one id expects.
+func browseMDNS(code string, timeout time.Duration, id Identity) ([]string, error) {
+	ifaces, err := multicastInterfaces()
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	resolver, err := zeroconf.NewResolver(zeroconf.SelectIfaces(ifaces))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoMulticast, err)
 	}
 
 	entries := make(chan *zeroconf.ServiceEntry)
@@ -26,54 +47,103 @@ func FindSender(code string, timeout time.Duration) (string, error) {
 	targetHash := ComputeHash(code)
 
 	if err := resolver.Browse(ctx, ServiceType, "local.", entries); err != nil {
-		return "", err
+		return nil, err
 	}
 
+	var (
+		addrs   []string
+		seen    = make(map[string]bool) // Instances already collected
+		collect <-chan time.Time        // Starts at the first match
+	)
 	for {
 		select {
 		case <-ctx.Done():
-			return "", fmt.Errorf("sender not found (timeout)")
+			if len(addrs) > 0 {
+				return OrderAddrs(addrs, PreferAny), nil
+			}
+			return nil, fmt.Errorf("sender not found (timeout)")
+		case <-collect:
+			return OrderAddrs(addrs, PreferAny), nil
 		case entry := <-entries:
-			if entry == nil {
+			if entry == nil || seen[entry.Instance] || !hasTXT(entry.Text, "hash", targetHash) {
 				continue
 			}
-			// Check TXT record
-			// Format: "hash=<hash>"
-			for _, txt := range entry.Text {
-				if strings.HasPrefix(txt, "hash=") {
-					h := strings.TrimPrefix(txt, "hash=")
-					if h == targetHash {
-						// Match Found!
-						// Match Found!
-						// Prefer IPv6 for local link (usually better for P2P/AirDrop-like behavior)
-						// But for now, let's just return the first available address.
-						var ip net.IP
-						if len(entry.AddrIPv6) > 0 {
-							ip = entry.AddrIPv6[0]
-						} else if len(entry.AddrIPv4) > 0 {
-							ip = entry.AddrIPv4[0]
-						}
+			if !id.allows(txtKey(entry.Text)) {
+				continue // Not the sender --expect-sender names
+			}
+			seen[entry.Instance] = true
 
-						if ip != nil {
-							port := entry.Port
-							// Format IPv6 address correctly [::1]:port
-							// internal/transport/quic.go Dial function expects "host:port" or "[host]:port"
-							// net.JoinHostPort handles this.
-							return net.JoinHostPort(ip.String(), fmt.Sprintf("%d", port)), nil
-						}
-					}
-				}
+			// Every address: an advertised IPv6 address is often not
+			// routable, so the receiver tries them in turn.
+			found := false
+			for _, ip := range append(entry.AddrIPv4, entry.AddrIPv6...) {
+				// JoinHostPort brackets IPv6: [::1]:port
+				addrs = append(addrs, net.JoinHostPort(ip.String(), strconv.Itoa(entry.Port)))
+				found = true
+			}
+			if found && collect == nil {
+				collect = time.After(mdnsCollectWindow)
 			}
 		}
 	}
 }
 
-// LookupCloud queries the global registry for the sender.
-func LookupCloud(code string) (string, error) {
-	client := NewRegistryClient()
-	item, err := client.Lookup(code)
+// hasTXT reports whether a TXT record "key=value" is present.
+func hasTXT(records []string, key, value string) bool {
+	for _, txt := range records {
+		if txt == key+"="+value {
+			return true
+		}
+	}
+	return false
+}
+
+// IPPreference orders a sender's addresses before dialing.
+type IPPreference int
+
+const (
+	PreferAny  IPPreference = iota // Discovery order (mDNS lists IPv4 first)
+	PreferIPv4                     // --prefer-ipv4
+	PreferIPv6                     // --prefer-ipv6
+)
+
+// OrderAddrs sorts "host:port" candidates for dialing: the preferred family
+// first, and IPv6 link-local addresses, which need a zone we don't know, last.
+// The order within each group is kept.
+func OrderAddrs(addrs []string, pref IPPreference) []string {
+	rank := func(addr string) int {
+		host, _, err := net.SplitHostPort(addr)
+		ip := net.ParseIP(host)
+		if err != nil || ip == nil {
+			return 1 // Hostnames: between the families
+		}
+		switch {
+		case ip.To4() == nil && ip.IsLinkLocalUnicast():
+			return 3
+		case pref == PreferAny:
+			return 0
+		case (ip.To4() != nil) == (pref == PreferIPv4):
+			return 0
+		default:
+			return 2
+		}
+	}
+	out := append([]string(nil), addrs...)
+	sort.SliceStable(out, func(i, j int) bool { return rank(out[i]) < rank(out[j]) })
+	return out
+}
+
+// LookupCloud queries the global registry for the sender, by the code's
+// discovery ID. A sender publishing a key other than the one id expects is an
+// error.
+func LookupCloud(code string, id Identity) (string, error) {
+	client := NewRegistryClient(RegistryURL())
+	item, err := client.Lookup(ComputeHash(code))
 	if err != nil {
 		return "", err
 	}
+	if !id.allows(item.PublicKey) {
+		return "", fmt.Errorf("the registered sender is not the expected one")
+	}
 	return fmt.Sprintf("%s:%d", item.IP, item.Port), nil
 }
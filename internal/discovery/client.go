@@ -2,47 +2,87 @@ package discovery
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
 	"time"
-)
 
-const (
-	// In a real app, this might be configurable via flags or env vars.
-	// For this PoC, we use the deployed endpoint.
-	apiEndpoint = "https://k4fa8k5sjg.execute-api.us-east-1.amazonaws.com"
+	"github.com/darkprince558/jend/internal/config"
 )
 
+// DefaultRegistryURL is the public JEND registry.
+const DefaultRegistryURL = "https://k4fa8k5sjg.execute-api.us-east-1.amazonaws.com"
+
+// EnvRegistryURL points the client at a self-hosted registry.
+const EnvRegistryURL = "JEND_REGISTRY_URL"
+
+// RegistryURL returns the registry base URL, with precedence
+// JEND_REGISTRY_URL > config file > DefaultRegistryURL.
+func RegistryURL() string {
+	if u := strings.TrimSpace(os.Getenv(EnvRegistryURL)); u != "" {
+		return u
+	}
+	if cfg, err := config.Load(); err == nil && cfg.RegistryURL != "" {
+		return cfg.RegistryURL
+	}
+	return DefaultRegistryURL
+}
+
+// ErrCodeTaken is returned by Register when another sender session holds the code.
+var ErrCodeTaken = errors.New("code is already registered by another sender")
+
+// ErrPeerNotFound is returned by Lookup when no sender is registered under the code.
+var ErrPeerNotFound = errors.New("peer not found")
+
 // RegistryClient handles interaction with the global JEND Registry Service.
 type RegistryClient struct {
-	client *http.Client
+	baseURL string
+	client  *http.Client
+	nonce   string // Identifies this sender session, so retried registrations update our own entry
+
+	publicKey ed25519.PublicKey // Registered with the address (see Identity)
 }
 
-// NewRegistryClient creates a new client with a default timeout.
-func NewRegistryClient() *RegistryClient {
+// NewRegistryClient creates a client for the registry at baseURL with a default timeout.
+func NewRegistryClient(baseURL string) *RegistryClient {
+	nonceBytes := make([]byte, 16)
+	rand.Read(nonceBytes)
 	return &RegistryClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		nonce: hex.EncodeToString(nonceBytes),
 	}
 }
 
 // RegistryItem represents the data structure stored/retrieved.
 type RegistryItem struct {
-	Code      string `json:"code"`
+	Code      string `json:"code"` // The transfer code's discovery ID (ComputeHash), never the code
 	IP        string `json:"ip"`
 	Port      int    `json:"port"`
-	PublicKey []byte `json:"public_key,omitempty"` // For future PAKE/Noise use
+	PublicKey []byte `json:"public_key,omitempty"` // Sender's identity key (see Identity)
+	Nonce     string `json:"nonce,omitempty"`      // Sender session nonce (register only)
 }
 
-// Register sends a POST request to register this peer.
+// Register sends a POST request to register this peer, with the sender's key
+// when advertiseCloud gave the client one.
+// Calling it again on the same client is idempotent: the registry matches our nonce.
 func (c *RegistryClient) Register(code, ip string, port int) error {
 	item := RegistryItem{
-		Code: code,
-		IP:   ip,
-		Port: port,
+		Code:      code,
+		IP:        ip,
+		Port:      port,
+		PublicKey: c.publicKey,
+		Nonce:     c.nonce,
 	}
 
 	body, err := json.Marshal(item)
@@ -50,13 +90,16 @@ func (c *RegistryClient) Register(code, ip string, port int) error {
 		return fmt.Errorf("marshal failed: %w", err)
 	}
 
-	url := fmt.Sprintf("%s/register", apiEndpoint)
+	url := fmt.Sprintf("%s/register", c.baseURL)
 	resp, err := c.client.Post(url, "application/json", bytes.NewBuffer(body))
 	if err != nil {
 		return fmt.Errorf("register request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusConflict {
+		return ErrCodeTaken
+	}
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		return fmt.Errorf("register failed with status %d: %s", resp.StatusCode, string(bodyBytes))
@@ -67,15 +110,15 @@ func (c *RegistryClient) Register(code, ip string, port int) error {
 
 // Lookup sends a GET request to find a peer by code.
 func (c *RegistryClient) Lookup(code string) (*RegistryItem, error) {
-	url := fmt.Sprintf("%s/lookup/%s", apiEndpoint, code)
-	resp, err := c.client.Get(url)
+	reqURL := fmt.Sprintf("%s/lookup/%s", c.baseURL, url.PathEscape(code))
+	resp, err := c.client.Get(reqURL)
 	if err != nil {
 		return nil, fmt.Errorf("lookup request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusNotFound {
-		return nil, fmt.Errorf("peer not found")
+		return nil, ErrPeerNotFound
 	}
 
 	if resp.StatusCode != http.StatusOK {
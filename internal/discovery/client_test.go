@@ -0,0 +1,440 @@
+package discovery
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/darkprince558/jend/internal/config"
+	"github.com/darkprince558/jend/internal/identity"
+)
+
+func TestRegistryURL(t *testing.T) {
+	t.Setenv("HOME", t.TempDir()) // No config file
+	t.Setenv(EnvRegistryURL, "")
+	if got := RegistryURL(); got != DefaultRegistryURL {
+		t.Errorf("Expected default %s, got %s", DefaultRegistryURL, got)
+	}
+
+	if err := config.Save(&config.Config{RegistryURL: "https://cfg.example"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := RegistryURL(); got != "https://cfg.example" {
+		t.Errorf("Expected config URL, got %s", got)
+	}
+
+	t.Setenv(EnvRegistryURL, "https://env.example")
+	if got := RegistryURL(); got != "https://env.example" {
+		t.Errorf("Env should beat the config file, got %s", got)
+	}
+}
+
+// mockRegistry implements the registry API (/register and /lookup/{code}) in memory,
+// with the same nonce rule as the real lambda: a code can only be re-registered by
+// the sender session that owns it.
+type mockRegistry struct {
+	mu    sync.Mutex
+	items map[string]RegistryItem
+
+	// Captured from the last /register call
+	lastMethod      string
+	lastContentType string
+	lastBody        []byte
+
+	// When non-zero, every request fails with this status and failBody
+	failStatus int
+	failBody   string
+}
+
+func newMockRegistry(t *testing.T) (*mockRegistry, *httptest.Server) {
+	m := &mockRegistry{items: make(map[string]RegistryItem)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", m.register)
+	mux.HandleFunc("GET /lookup/{code}", m.lookup)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return m, srv
+}
+
+func (m *mockRegistry) register(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	m.lastMethod = r.Method
+	m.lastContentType = r.Header.Get("Content-Type")
+	m.lastBody = body
+
+	if m.failStatus != 0 {
+		http.Error(w, m.failBody, m.failStatus)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var item RegistryItem
+	if err := json.Unmarshal(body, &item); err != nil || item.Code == "" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if existing, ok := m.items[item.Code]; ok && existing.Nonce != item.Nonce {
+		http.Error(w, "conflict", http.StatusConflict)
+		return
+	}
+	m.items[item.Code] = item
+	w.WriteHeader(http.StatusOK)
+}
+
+func (m *mockRegistry) lookup(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.failStatus != 0 {
+		http.Error(w, m.failBody, m.failStatus)
+		return
+	}
+	item, ok := m.items[r.PathValue("code")]
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	item.Nonce = "" // Never returned by lookup
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
+
+func TestRegistryClient_Register(t *testing.T) {
+	tests := []struct {
+		name       string
+		failStatus int
+		failBody   string
+		wantErr    string
+	}{
+		{name: "ok"},
+		{name: "created", failStatus: http.StatusCreated},
+		{name: "conflict", failStatus: http.StatusConflict, wantErr: "already registered by another sender"},
+		{name: "server error", failStatus: http.StatusInternalServerError, failBody: "dynamo down", wantErr: "status 500: dynamo down"},
+		{name: "bad request", failStatus: http.StatusBadRequest, failBody: "missing ip", wantErr: "status 400: missing ip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, srv := newMockRegistry(t)
+			m.failStatus, m.failBody = tt.failStatus, tt.failBody
+
+			client := NewRegistryClient(srv.URL)
+			err := client.Register("happy-delta-seven", "203.0.113.7", 9000)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+
+			// The request itself is the same whatever the server answers
+			if m.lastMethod != http.MethodPost {
+				t.Errorf("Expected POST, got %s", m.lastMethod)
+			}
+			if m.lastContentType != "application/json" {
+				t.Errorf("Expected application/json, got %q", m.lastContentType)
+			}
+			var sent map[string]interface{}
+			if err := json.Unmarshal(m.lastBody, &sent); err != nil {
+				t.Fatalf("Body is not JSON: %v (%s)", err, m.lastBody)
+			}
+			if sent["code"] != "happy-delta-seven" || sent["ip"] != "203.0.113.7" || sent["port"] != float64(9000) {
+				t.Errorf("Unexpected body: %s", m.lastBody)
+			}
+			if nonce, _ := sent["nonce"].(string); len(nonce) != 32 {
+				t.Errorf("Expected a 16-byte hex nonce, got %v", sent["nonce"])
+			}
+			if _, ok := sent["public_key"]; ok {
+				t.Errorf("Empty public_key should be omitted: %s", m.lastBody)
+			}
+		})
+	}
+}
+
+func TestRegistryClient_RegisterIsIdempotentPerSession(t *testing.T) {
+	_, srv := newMockRegistry(t)
+
+	owner := NewRegistryClient(srv.URL)
+	if err := owner.Register("same-code", "10.0.0.1", 9000); err != nil {
+		t.Fatal(err)
+	}
+	// A retry from the same session updates its own entry
+	if err := owner.Register("same-code", "10.0.0.2", 9000); err != nil {
+		t.Errorf("Retried registration should succeed, got %v", err)
+	}
+
+	other := NewRegistryClient(srv.URL)
+	if err := other.Register("same-code", "10.0.0.3", 9000); err == nil || !strings.Contains(err.Error(), "already registered") {
+		t.Errorf("Expected conflict for another session, got %v", err)
+	}
+
+	item, err := owner.Lookup("same-code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.IP != "10.0.0.2" {
+		t.Errorf("Expected the owner's latest address, got %s", item.IP)
+	}
+}
+
+func TestRegistryClient_Lookup(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       string
+		stored     *RegistryItem
+		failStatus int
+		failBody   string
+		rawBody    string // Served verbatim instead of the stored item
+		want       *RegistryItem
+		wantErr    string
+	}{
+		{
+			name:   "found",
+			code:   "happy-delta-seven",
+			stored: &RegistryItem{Code: "happy-delta-seven", IP: "203.0.113.7", Port: 9000, Nonce: "secret"},
+			want:   &RegistryItem{Code: "happy-delta-seven", IP: "203.0.113.7", Port: 9000},
+		},
+		{
+			name:   "ipv6",
+			code:   "v6-code",
+			stored: &RegistryItem{Code: "v6-code", IP: "2001:db8::1", Port: 9443},
+			want:   &RegistryItem{Code: "v6-code", IP: "2001:db8::1", Port: 9443},
+		},
+		{
+			name:   "public key round-trips",
+			code:   "pk-code",
+			stored: &RegistryItem{Code: "pk-code", IP: "10.0.0.1", Port: 9000, PublicKey: []byte{1, 2, 3}},
+			want:   &RegistryItem{Code: "pk-code", IP: "10.0.0.1", Port: 9000, PublicKey: []byte{1, 2, 3}},
+		},
+		{
+			name:    "not found",
+			code:    "missing-code",
+			wantErr: "peer not found",
+		},
+		{
+			name:       "server error",
+			code:       "any-code",
+			failStatus: http.StatusInternalServerError,
+			failBody:   "internal error",
+			wantErr:    "status 500: internal error",
+		},
+		{
+			name:       "throttled",
+			code:       "any-code",
+			failStatus: http.StatusTooManyRequests,
+			failBody:   "slow down",
+			wantErr:    "status 429: slow down",
+		},
+		{
+			name:    "malformed body",
+			code:    "bad-json",
+			rawBody: "{not json",
+			wantErr: "decode failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, srv := newMockRegistry(t)
+			m.failStatus, m.failBody = tt.failStatus, tt.failBody
+			if tt.stored != nil {
+				m.items[tt.stored.Code] = *tt.stored
+			}
+
+			base := srv.URL
+			if tt.rawBody != "" {
+				raw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					io.WriteString(w, tt.rawBody)
+				}))
+				defer raw.Close()
+				base = raw.URL
+			}
+
+			item, err := NewRegistryClient(base).Lookup(tt.code)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v (item %+v)", tt.wantErr, err, item)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(item, tt.want) {
+				t.Errorf("Got %+v, want %+v", item, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryClient_URLHandling(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		base, code, wantPath string
+	}{
+		{srv.URL, "plain-code", "/lookup/plain-code"},
+		{srv.URL + "/", "plain-code", "/lookup/plain-code"}, // Trailing slash doesn't double up
+		{srv.URL + "/prod", "plain-code", "/prod/lookup/plain-code"},
+		{srv.URL, "a/b?c", "/lookup/a%2Fb%3Fc"}, // Codes can't escape the path
+	}
+	for _, tt := range tests {
+		NewRegistryClient(tt.base).Lookup(tt.code)
+		if gotPath != tt.wantPath {
+			t.Errorf("base %q code %q: requested %q, want %q", tt.base, tt.code, gotPath, tt.wantPath)
+		}
+	}
+}
+
+func TestRegistryClient_Unreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	base := srv.URL
+	srv.Close()
+
+	client := NewRegistryClient(base)
+	if err := client.Register("code", "10.0.0.1", 9000); err == nil || !strings.Contains(err.Error(), "register request failed") {
+		t.Errorf("Expected a transport error from Register, got %v", err)
+	}
+	if _, err := client.Lookup("code"); err == nil || !strings.Contains(err.Error(), "lookup request failed") {
+		t.Errorf("Expected a transport error from Lookup, got %v", err)
+	}
+}
+
+func TestCloudBackend_MockRegistry(t *testing.T) {
+	m, srv := newMockRegistry(t)
+	t.Setenv(EnvRegistryURL, srv.URL)
+
+	stop, err := Cloud{}.Advertise("cloud-code", "198.51.100.4:9000")
+	if err != nil {
+		t.Fatalf("Advertise failed: %v", err)
+	}
+	defer stop()
+	m.mu.Lock()
+	_, byCode := m.items["cloud-code"]
+	_, byID := m.items[ComputeHash("cloud-code")]
+	m.mu.Unlock()
+	if byCode || !byID {
+		t.Errorf("Expected the registry to get the discovery ID, not the code (by code %v, by ID %v)", byCode, byID)
+	}
+
+	addrs, err := Cloud{}.Find("cloud-code", time.Second)
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	if len(addrs) != 1 || addrs[0] != "198.51.100.4:9000" {
+		t.Errorf("Expected [198.51.100.4:9000], got %v", addrs)
+	}
+
+	if _, err := (Cloud{}).Find("unknown-code", time.Second); err == nil {
+		t.Error("Expected an error for an unregistered code")
+	}
+}
+
+func TestCloudBackend_PublicKey(t *testing.T) {
+	_, srv := newMockRegistry(t)
+	t.Setenv(EnvRegistryURL, srv.URL)
+	pub, _, _ := ed25519.GenerateKey(nil)
+	other, _, _ := ed25519.GenerateKey(nil)
+	if _, err := (Cloud{Identity{PublicKey: pub}}).Advertise("keyed-code", "198.51.100.4:9000"); err != nil {
+		t.Fatalf("Advertise failed: %v", err)
+	}
+	item, err := NewRegistryClient(srv.URL).Lookup(ComputeHash("keyed-code"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(item.PublicKey, []byte(pub)) {
+		t.Errorf("Registered key %x, want %x", item.PublicKey, pub)
+	}
+
+	if _, err := (Cloud{Identity{Expect: identity.Fingerprint(pub)}}).Find("keyed-code", time.Second); err != nil {
+		t.Errorf("Expected sender not found: %v", err)
+	}
+	if _, err := (Cloud{Identity{Expect: identity.Fingerprint(other)}}).Find("keyed-code", time.Second); err == nil {
+		t.Error("Found a sender publishing another key")
+	}
+}
+
+// TestCloudBackend_OneNoncePerSession checks that a failed registration is
+// retried and the entry refreshed with the session's own nonce, so neither is
+// refused as another sender's, and that refreshing stops with the session.
+func TestCloudBackend_OneNoncePerSession(t *testing.T) {
+	m, _ := newMockRegistry(t)
+	var mu sync.Mutex
+	var nonces []string
+	failures := 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var item RegistryItem
+		json.Unmarshal(body, &item)
+		mu.Lock()
+		nonces = append(nonces, item.Nonce)
+		fail := failures > 0
+		failures--
+		mu.Unlock()
+		if fail {
+			http.Error(w, "throttled", http.StatusServiceUnavailable)
+			return
+		}
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+		m.register(w, r)
+	}))
+	defer srv.Close()
+	t.Setenv(EnvRegistryURL, srv.URL)
+
+	savedRefresh, savedBackoff := cloudRefreshInterval, cloudRegisterBackoff
+	cloudRefreshInterval, cloudRegisterBackoff = 20*time.Millisecond, time.Millisecond
+	defer func() { cloudRefreshInterval, cloudRegisterBackoff = savedRefresh, savedBackoff }()
+
+	stop, err := Cloud{}.Advertise("refresh-code", "198.51.100.4:9000")
+	if err != nil {
+		t.Fatalf("Expected the retry to succeed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	stop()
+	stop() // Safe to call twice
+
+	mu.Lock()
+	seen := append([]string(nil), nonces...)
+	mu.Unlock()
+	if len(seen) < 4 {
+		t.Fatalf("Expected a retry and refreshes, got %d registrations", len(seen))
+	}
+	for _, n := range seen {
+		if n != seen[0] {
+			t.Fatalf("Expected one nonce for the session, got %v", seen)
+		}
+	}
+	m.mu.Lock()
+	_, ok := m.items[ComputeHash("refresh-code")]
+	m.mu.Unlock()
+	if !ok {
+		t.Error("Expected the session to be registered")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	mu.Lock()
+	after := len(nonces)
+	mu.Unlock()
+	if after > len(seen)+1 {
+		t.Errorf("Expected refreshes to stop with the session, got %d more", after-len(seen))
+	}
+}
@@ -1,15 +1,92 @@
 package discovery
 
 import (
-	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
 )
 
 // ServiceType is the mDNS service type for JEND
 const ServiceType = "_jend._udp"
 
-// ComputeHash returns the SHA256 hash of the code for broadcast verification.
+// ErrNoMulticast means mDNS can't work here: no interface is up with multicast
+// (corporate networks, Docker bridges, some VPNs). Callers should move on to
+// the next discovery method instead of waiting out a browse timeout.
+var ErrNoMulticast = errors.New("mDNS unavailable: no multicast-capable network interface")
+
+// netInterfaces is swapped out in tests.
+var netInterfaces = net.Interfaces
+
+// multicastInterfaces returns the interfaces mDNS can use, the same ones
+// zeroconf would pick, or ErrNoMulticast if there are none.
+func multicastInterfaces() ([]net.Interface, error) {
+	ifaces, err := netInterfaces()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoMulticast, err)
+	}
+	var usable []net.Interface
+	for _, ifi := range ifaces {
+		if ifi.Flags&net.FlagUp != 0 && ifi.Flags&net.FlagMulticast != 0 {
+			usable = append(usable, ifi)
+		}
+	}
+	if len(usable) == 0 {
+		return nil, ErrNoMulticast
+	}
+	return usable, nil
+}
+
+// interfacesWithIP keeps the interfaces that have ip among their addresses.
+func interfacesWithIP(ifaces []net.Interface, ip net.IP) []net.Interface {
+	var out []net.Interface
+	for _, ifi := range ifaces {
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				out = append(out, ifi)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// Argon2id cost for the discovery ID, the same as for the signaling key: it
+// runs once per session on each side, and makes every guess at a code from a
+// published ID cost an Argon2 run.
+const (
+	hashArgonTime    = 2
+	hashArgonMemory  = 19 * 1024 // KiB
+	hashArgonThreads = 1
+)
+
+// hashSalt is fixed: sender and receiver must derive the same ID from the code
+// alone. It keeps the IDs apart from the signaling topic and from other apps.
+var hashSalt = []byte("jend-discovery-v1")
+
+var (
+	hashMu    sync.Mutex
+	hashCache = make(map[string]string) // Code -> ID; every backend asks for the same one
+)
+
+// ComputeHash derives the discovery ID of a code: what mDNS TXT records and
+// the registry carry instead of the code. It is a salted Argon2id of the code,
+// so anyone who sees it can still test guesses offline, but each guess costs
+// an Argon2 run instead of a SHA-256.
 func ComputeHash(code string) string {
-	sum := sha256.Sum256([]byte(code))
-	return fmt.Sprintf("%x", sum)
+	hashMu.Lock()
+	defer hashMu.Unlock()
+	if id, ok := hashCache[code]; ok {
+		return id
+	}
+	id := hex.EncodeToString(argon2.IDKey([]byte(code), hashSalt, hashArgonTime, hashArgonMemory, hashArgonThreads, 32))
+	hashCache[code] = id
+	return id
 }
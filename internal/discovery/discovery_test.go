@@ -2,23 +2,36 @@ package discovery
 
 import (
 	"context"
+	"crypto/ed25519"
 	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"net"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/darkprince558/jend/internal/identity"
 	"github.com/grandcat/zeroconf"
+	"golang.org/x/crypto/argon2"
 )
 
 func TestHashComputation(t *testing.T) {
 	code := "test-code-123"
-	expectedSum := sha256.Sum256([]byte(code))
-	expected := fmt.Sprintf("%x", expectedSum)
+	expected := hex.EncodeToString(argon2.IDKey([]byte(code), []byte("jend-discovery-v1"), 2, 19*1024, 1, 32))
 
 	result := ComputeHash(code)
 	if result != expected {
 		t.Errorf("ComputeHash(%q) = %q, want %q", code, result, expected)
 	}
+	// A plain SHA-256 would let anyone reverse a short code in seconds
+	if plain := sha256.Sum256([]byte(code)); result == hex.EncodeToString(plain[:]) {
+		t.Error("Expected the discovery ID not to be the code's SHA-256")
+	}
+	if ComputeHash("test-code-124") == result {
+		t.Error("Expected different codes to get different IDs")
+	}
 }
 
 func TestAdvertiseAndBrowse(t *testing.T) {
@@ -30,7 +43,7 @@ func TestAdvertiseAndBrowse(t *testing.T) {
 	code := "unit-test-code-discovery"
 
 	// 1. Start Advertising
-	stop, err := StartAdvertising(port, code)
+	stop, err := StartAdvertising(port, code, true) // mDNS only, no registry call
 	if err != nil {
 		t.Fatalf("Failed to start advertising: %v", err)
 	}
@@ -41,7 +54,7 @@ func TestAdvertiseAndBrowse(t *testing.T) {
 
 	// 2. Try to Find it
 	// Reduce timeout for test speed
-	foundAddr, err := FindSender(code, 2*time.Second)
+	found, err := FindSender(code, 2*time.Second)
 	if err != nil {
 		// Diagnostic: check if we can find ANY jend service
 		resolver, _ := zeroconf.NewResolver(nil)
@@ -60,12 +73,17 @@ func TestAdvertiseAndBrowse(t *testing.T) {
 	}
 
 	// 3. Verify
-	// IP might vary (IPv4 vs IPv6), but port should match
+	// IPs vary (IPv4 and/or IPv6), but every candidate should carry our port
 	// Format is ip:port
 	// We expect port 9999
+	if len(found) == 0 {
+		t.Fatal("FindSender returned no addresses")
+	}
 	expectedSuffix := fmt.Sprintf(":%d", port)
-	if len(foundAddr) <= len(expectedSuffix) || foundAddr[len(foundAddr)-len(expectedSuffix):] != expectedSuffix {
-		t.Errorf("Found address %q, expected port %d", foundAddr, port)
+	for _, foundAddr := range found {
+		if len(foundAddr) <= len(expectedSuffix) || foundAddr[len(foundAddr)-len(expectedSuffix):] != expectedSuffix {
+			t.Errorf("Found address %q, expected port %d", foundAddr, port)
+		}
 	}
 }
 
@@ -86,3 +104,187 @@ func TestBrowseNotFound(t *testing.T) {
 		t.Error("Returned too early, didn't wait for timeout")
 	}
 }
+
+type fakeDiscoverer struct{ name, addr string }
+
+func (f fakeDiscoverer) Name() string { return f.name }
+func (f fakeDiscoverer) Advertise(code, addr string) (func(), error) {
+	return func() {}, nil
+}
+func (f fakeDiscoverer) Find(code string, timeout time.Duration) ([]string, error) {
+	return []string{f.addr}, nil
+}
+
+func TestBackendSelection(t *testing.T) {
+	backendsMu.Lock()
+	saved := append([]Discoverer(nil), backends...)
+	backendsMu.Unlock()
+	defer func() {
+		backendsMu.Lock()
+		backends = saved
+		backendsMu.Unlock()
+	}()
+
+	RegisterBackend(fakeDiscoverer{name: "file", addr: "10.0.0.5:9000"})
+
+	t.Setenv(EnvDiscovery, "")
+	names := []string{}
+	for _, d := range Backends() {
+		names = append(names, d.Name())
+	}
+	if fmt.Sprint(names) != "[mdns cloud file]" {
+		t.Errorf("Expected all backends in registration order, got %v", names)
+	}
+
+	t.Setenv(EnvDiscovery, "file, mdns, bogus")
+	got := Backends()
+	if len(got) != 2 || got[0].Name() != "file" || got[1].Name() != "mdns" {
+		t.Fatalf("Expected [file mdns], got %v", got)
+	}
+	if addrs, _ := got[0].Find("any-code", time.Second); len(addrs) != 1 || addrs[0] != "10.0.0.5:9000" {
+		t.Errorf("Unexpected addrs %v", addrs)
+	}
+}
+
+type remoteDiscoverer struct{ fakeDiscoverer }
+
+func (remoteDiscoverer) Remote() bool { return true }
+
+func TestLANBackends(t *testing.T) {
+	backendsMu.Lock()
+	saved := append([]Discoverer(nil), backends...)
+	backendsMu.Unlock()
+	defer func() {
+		backendsMu.Lock()
+		backends = saved
+		backendsMu.Unlock()
+	}()
+
+	RegisterBackend(fakeDiscoverer{name: "file", addr: "10.0.0.5:9000"})
+	RegisterBackend(remoteDiscoverer{fakeDiscoverer{name: "consul", addr: "198.51.100.1:9000"}})
+
+	t.Setenv(EnvDiscovery, "")
+	names := []string{}
+	for _, d := range LANBackends() {
+		names = append(names, d.Name())
+	}
+	if fmt.Sprint(names) != "[mdns file]" {
+		t.Errorf("Expected only local backends, got %v", names)
+	}
+
+	t.Setenv(EnvDiscovery, "cloud")
+	if got := LANBackends(); len(got) != 0 {
+		t.Errorf("Selecting only cloud should leave nothing in LAN-only mode, got %v", got)
+	}
+}
+
+func TestNoMulticastFailsFast(t *testing.T) {
+	defer func(orig func() ([]net.Interface, error)) { netInterfaces = orig }(netInterfaces)
+	netInterfaces = func() ([]net.Interface, error) {
+		return []net.Interface{
+			{Name: "lo", Flags: net.FlagUp | net.FlagLoopback},
+			{Name: "docker0", Flags: net.FlagMulticast}, // Down
+		}, nil
+	}
+
+	start := time.Now()
+	_, err := FindSender("no-multicast-code", 5*time.Second)
+	if !errors.Is(err, ErrNoMulticast) {
+		t.Fatalf("Expected ErrNoMulticast, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("Should fail at once instead of waiting for the browse timeout")
+	}
+
+	if _, err := StartAdvertising(9999, "no-multicast-code", true); !errors.Is(err, ErrNoMulticast) {
+		t.Errorf("Expected ErrNoMulticast from advertising, got %v", err)
+	}
+}
+
+func TestOrderAddrs(t *testing.T) {
+	found := []string{"192.168.1.20:9000", "[fe80::1]:9000", "[2001:db8::20]:9000", "10.0.0.20:9000"}
+
+	for _, tc := range []struct {
+		pref IPPreference
+		want string
+	}{
+		{PreferAny, "[192.168.1.20:9000 [2001:db8::20]:9000 10.0.0.20:9000 [fe80::1]:9000]"},
+		{PreferIPv4, "[192.168.1.20:9000 10.0.0.20:9000 [2001:db8::20]:9000 [fe80::1]:9000]"},
+		{PreferIPv6, "[[2001:db8::20]:9000 192.168.1.20:9000 10.0.0.20:9000 [fe80::1]:9000]"},
+	} {
+		if got := fmt.Sprint(OrderAddrs(found, tc.pref)); got != tc.want {
+			t.Errorf("OrderAddrs(%v) = %s, want %s", tc.pref, got, tc.want)
+		}
+	}
+	if fmt.Sprint(found) != "[192.168.1.20:9000 [fe80::1]:9000 [2001:db8::20]:9000 10.0.0.20:9000]" {
+		t.Error("OrderAddrs must not reorder its input")
+	}
+}
+
+func TestFindSenderReturnsEveryMatchingSender(t *testing.T) {
+	code := "unit-test-code-squatted"
+
+	// Same code hash, e.g. the real sender and a squatter that copied the hash
+	for _, port := range []int{9997, 9998} {
+		stop, err := StartAdvertising(port, code, true)
+		if err != nil {
+			t.Fatalf("Failed to start advertising: %v", err)
+		}
+		defer stop()
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	found, err := FindSender(code, 3*time.Second)
+	if err != nil {
+		t.Fatalf("FindSender failed: %v", err)
+	}
+	ports := map[string]bool{}
+	for _, addr := range found {
+		_, port, _ := net.SplitHostPort(addr)
+		ports[port] = true
+	}
+	if !ports["9997"] || !ports["9998"] {
+		t.Errorf("Expected addresses of both senders, got %v", found)
+	}
+}
+
+func TestInterfacesWithIP(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skip("no lo interface:", err)
+	}
+	ifaces := []net.Interface{*lo}
+	if got := interfacesWithIP(ifaces, net.ParseIP("127.0.0.1")); len(got) != 1 {
+		t.Errorf("loopback address not found on lo: %v", got)
+	}
+	if got := interfacesWithIP(ifaces, net.ParseIP("192.0.2.1")); len(got) != 0 {
+		t.Errorf("documentation address matched lo: %v", got)
+	}
+}
+
+func TestFindSenderSkipsOtherKeys(t *testing.T) {
+	code := "unit-test-code-keyed"
+
+	// The real sender and a squatter publishing its own key
+	var keys []ed25519.PublicKey
+	for _, port := range []int{9995, 9996} {
+		pub, _, _ := ed25519.GenerateKey(nil)
+		keys = append(keys, pub)
+		stop, err := MDNS{Identity{PublicKey: pub}}.Advertise(code, net.JoinHostPort("", strconv.Itoa(port)))
+		if err != nil {
+			t.Fatalf("Failed to start advertising: %v", err)
+		}
+		defer stop()
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	found, err := MDNS{Identity{Expect: identity.Fingerprint(keys[0])}}.Find(code, 3*time.Second)
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	for _, addr := range found {
+		if _, port, _ := net.SplitHostPort(addr); port != "9995" {
+			t.Errorf("Found the sender with another key at %s", addr)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package discovery
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+
+	"github.com/darkprince558/jend/internal/identity"
+)
+
+// Identity ties an announcement to the sender's identity key. Anyone can
+// publish any key, so it only lets a receiver skip the wrong senders early;
+// the handshake signature is what proves it.
+type Identity struct {
+	// PublicKey is the sender's key, published by Advertise alongside its
+	// address: in the mDNS TXT record and the registry entry.
+	PublicKey ed25519.PublicKey
+	// Expect makes Find skip senders that publish a key other than the one
+	// with this fingerprint (receive --expect-sender). Senders that publish
+	// none (older ones) are kept for the handshake to decide. Empty accepts any.
+	Expect string
+}
+
+// allows reports whether a sender publishing pub may be the expected one.
+func (id Identity) allows(pub []byte) bool {
+	return id.Expect == "" || len(pub) == 0 || identity.Fingerprint(pub) == id.Expect
+}
+
+// WithIdentity returns backends set up to use id. Backends opt in with a
+// `WithIdentity(Identity) Discoverer` method, as the built-ins do; the others
+// are returned unchanged.
+func WithIdentity(backends []Discoverer, id Identity) []Discoverer {
+	out := make([]Discoverer, len(backends))
+	for i, d := range backends {
+		if w, ok := d.(interface{ WithIdentity(Identity) Discoverer }); ok {
+			d = w.WithIdentity(id)
+		}
+		out[i] = d
+	}
+	return out
+}
+
+// txtKey decodes the "key=" TXT record, nil if there is none.
+func txtKey(records []string) []byte {
+	for _, txt := range records {
+		if v, ok := strings.CutPrefix(txt, "key="); ok {
+			pub, err := base64.RawStdEncoding.DecodeString(v)
+			if err != nil || len(pub) != ed25519.PublicKeySize {
+				return nil
+			}
+			return pub
+		}
+	}
+	return nil
+}
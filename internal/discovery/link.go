@@ -0,0 +1,117 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LinkScheme prefixes a transfer code in a shareable link or QR code.
+const LinkScheme = "jend://"
+
+// Link is the shareable form of a transfer code: jend://<code>, optionally with
+// the sender's address as ?ip=<ip>&port=<port> so the receiver can dial it
+// before (or without) discovery.
+type Link struct {
+	Code string
+	IP   string // Empty when the link carries no address hint
+	Port int
+}
+
+// NewLink builds the link for a sender listening on addr ("host:port", host
+// may be empty for every interface). An empty host is replaced by the address
+// of the interface that routes outbound traffic; if there is none the link
+// carries the code only.
+func NewLink(code, addr string) Link {
+	l := Link{Code: code}
+	host, port, err := splitPort(addr)
+	if err != nil {
+		return l
+	}
+	if host == "" {
+		host = outboundIP()
+	}
+	if host == "" {
+		return l
+	}
+	l.IP, l.Port = host, port
+	return l
+}
+
+// Addr is the hinted "host:port", or "" if the link has none.
+func (l Link) Addr() string {
+	if l.IP == "" {
+		return ""
+	}
+	return net.JoinHostPort(l.IP, strconv.Itoa(l.Port))
+}
+
+func (l Link) String() string {
+	if l.IP == "" {
+		return LinkScheme + l.Code
+	}
+	q := url.Values{"ip": {l.IP}, "port": {strconv.Itoa(l.Port)}}
+	return LinkScheme + l.Code + "?" + q.Encode()
+}
+
+// ParseLink accepts a bare code or a jend:// link. Address hints must come as
+// a valid ip and port pair.
+func ParseLink(arg string) (Link, error) {
+	arg = strings.TrimSpace(arg)
+	if len(arg) < len(LinkScheme) || !strings.EqualFold(arg[:len(LinkScheme)], LinkScheme) {
+		if arg == "" {
+			return Link{}, fmt.Errorf("empty code")
+		}
+		return Link{Code: arg}, nil
+	}
+
+	u, err := url.Parse(arg)
+	if err != nil || u.Host == "" || strings.Trim(u.Path, "/") != "" || u.User != nil {
+		return Link{}, fmt.Errorf("invalid link %q: want %s<code>[?ip=<ip>&port=<port>]", arg, LinkScheme)
+	}
+	l := Link{Code: u.Host}
+	q := u.Query()
+	ip, port := q.Get("ip"), q.Get("port")
+	if ip == "" && port == "" {
+		return l, nil
+	}
+	if net.ParseIP(ip) == nil {
+		return Link{}, fmt.Errorf("invalid link: ip %q is not an IP address", ip)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 1 || p > 65535 {
+		return Link{}, fmt.Errorf("invalid link: port %q out of range", port)
+	}
+	l.IP, l.Port = ip, p
+	return l, nil
+}
+
+// outboundIP is the local address the default route would use. No packet is
+// sent: connecting a UDP socket only picks the source address.
+func outboundIP() string {
+	conn, err := net.Dial("udp4", "192.0.2.1:9")
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok && !addr.IP.IsUnspecified() {
+		return addr.IP.String()
+	}
+	return ""
+}
+
+// Hint is a Discoverer that "finds" the sender at the address a link carried.
+// It is tried before the real backends; a stale hint fails the probe and
+// discovery carries on as usual.
+type Hint string
+
+func (Hint) Name() string { return "link" }
+
+func (Hint) Advertise(code string, addr string) (func(), error) { return func() {}, nil }
+
+func (h Hint) Find(code string, timeout time.Duration) ([]string, error) {
+	return []string{string(h)}, nil
+}
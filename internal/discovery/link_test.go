@@ -0,0 +1,57 @@
+package discovery
+
+import "testing"
+
+func TestParseLink(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    Link
+		wantErr bool
+	}{
+		{arg: "happy-delta-seven", want: Link{Code: "happy-delta-seven"}},
+		{arg: "jend://happy-delta-seven", want: Link{Code: "happy-delta-seven"}},
+		{arg: "JEND://happy-delta-seven/", want: Link{Code: "happy-delta-seven"}},
+		{arg: " jend://happy-delta-seven\n", want: Link{Code: "happy-delta-seven"}},
+		{arg: "jend://happy-delta-seven?ip=192.168.1.20&port=9000", want: Link{Code: "happy-delta-seven", IP: "192.168.1.20", Port: 9000}},
+		{arg: "jend://happy-delta-seven?ip=fe80%3A%3A1&port=9100", want: Link{Code: "happy-delta-seven", IP: "fe80::1", Port: 9100}},
+		{arg: "jend://happy-delta-seven?ip=192.168.1.20", wantErr: true},
+		{arg: "jend://happy-delta-seven?ip=nope&port=9000", wantErr: true},
+		{arg: "jend://happy-delta-seven?ip=192.168.1.20&port=70000", wantErr: true},
+		{arg: "jend://", wantErr: true},
+		{arg: "jend://a/b", wantErr: true},
+		{arg: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLink(tt.arg)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLink(%q) = %+v, %v; want %+v (error %v)", tt.arg, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	// String round-trips, with and without hints
+	for _, l := range []Link{{Code: "fast-happy-sloth"}, {Code: "fast-happy-sloth", IP: "2001:db8::7", Port: 9000}} {
+		if got, err := ParseLink(l.String()); err != nil || got != l {
+			t.Errorf("Round trip %s: got %+v, %v", l, got, err)
+		}
+	}
+	if got := (Link{Code: "c", IP: "2001:db8::7", Port: 9000}).Addr(); got != "[2001:db8::7]:9000" {
+		t.Errorf("Addr: got %q", got)
+	}
+}
+
+func TestNewLink(t *testing.T) {
+	if l := NewLink("c", "10.0.0.5:9100"); l != (Link{Code: "c", IP: "10.0.0.5", Port: 9100}) {
+		t.Errorf("Bound address: got %+v", l)
+	}
+	if l := NewLink("c", "garbage"); l != (Link{Code: "c"}) {
+		t.Errorf("Bad address: got %+v", l)
+	}
+	// Every interface: the outbound address if there is a route, else no hint
+	want := Link{Code: "c"}
+	if ip := outboundIP(); ip != "" {
+		want.IP, want.Port = ip, 9000
+	}
+	if l := NewLink("c", ":9000"); l != want {
+		t.Errorf("Any interface: got %+v, want %+v", l, want)
+	}
+}
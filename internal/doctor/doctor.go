@@ -0,0 +1,261 @@
+// Package doctor runs the connectivity checks behind `jend doctor`: each way a
+// sender can be found and reached, from the local listen port out to the cloud
+// registry, STUN, TURN and signaling.
+package doctor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/darkprince558/jend/internal/discovery"
+	"github.com/darkprince558/jend/internal/signaling"
+	"github.com/darkprince558/jend/internal/transport"
+	"github.com/pion/ice/v2"
+)
+
+// checkTimeout bounds each network check.
+const checkTimeout = 10 * time.Second
+
+// Options are the settings the checks run with, as a transfer would use them.
+type Options struct {
+	Port    int                  // Direct listen port
+	ICE     *transport.ICEConfig // STUN and relay choice; nil means defaults
+	LANOnly bool                 // Skip everything that leaves the local network
+	AuthURL string               // TURN credential API (transport.TurnAuthURL)
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Name    string
+	Detail  string // What was found, on success
+	Err     error  // Why it failed; nil on success or skip
+	Skipped bool
+	Hint    string // What to do about a failure
+}
+
+// OK reports whether the check passed or didn't apply.
+func (r Result) OK() bool { return r.Err == nil }
+
+// Run performs every check in order, passing each result to report as soon as
+// it is known. It returns false if any check failed.
+func Run(ctx context.Context, opts Options, report func(Result)) bool {
+	ok := true
+	emit := func(r Result) {
+		if !r.OK() {
+			ok = false
+		}
+		report(r)
+	}
+
+	emit(checkListen(opts.Port))
+	emit(checkMDNS(opts.Port))
+
+	if opts.LANOnly {
+		for _, name := range []string{"Cloud registry", "STUN", "TURN relay", signalingName()} {
+			emit(Result{Name: name, Skipped: true, Detail: "--lan-only"})
+		}
+		return ok
+	}
+	emit(CheckRegistry(discovery.RegistryURL()))
+	for _, server := range transport.STUNServers(opts.ICE) {
+		emit(CheckSTUN(ctx, server))
+	}
+	for _, r := range checkTURN(ctx, opts) {
+		emit(r)
+	}
+	emit(checkSignaling(ctx))
+	return ok
+}
+
+func checkListen(port int) Result {
+	r := Result{Name: fmt.Sprintf("Listen on UDP port %d", port)}
+	l, err := transport.NewQUICTransport().Listen(":" + strconv.Itoa(port))
+	if err != nil {
+		r.Err = err
+		r.Hint = "Another program holds the port; send with --port <N>, or --port 0 for any free one."
+		return r
+	}
+	l.Close()
+	r.Detail = "bound and released"
+	return r
+}
+
+// checkMDNS advertises a throwaway code and browses for it, the loopback
+// discovery_test does.
+func checkMDNS(port int) Result {
+	r := Result{Name: "mDNS (local network discovery)"}
+	code := "doctor-" + randomHex(4)
+	stop, err := discovery.StartAdvertising(port, code, true)
+	if err != nil {
+		r.Err = err
+		r.Hint = "Receivers on this network can't find you by mDNS; they fall back to the cloud registry. VPNs, Docker bridges and guest Wi-Fi often block multicast."
+		return r
+	}
+	defer stop()
+	addrs, err := discovery.FindSender(code, 3*time.Second)
+	if err != nil {
+		r.Err = err
+		r.Hint = "Advertising works but browsing doesn't see it: a firewall may drop UDP 5353 (multicast DNS)."
+		return r
+	}
+	r.Detail = "found own advertisement at " + strings.Join(addrs, ", ")
+	return r
+}
+
+// CheckRegistry looks up a code nobody registered at url: "not found" proves
+// the registry answered.
+func CheckRegistry(url string) Result {
+	r := Result{Name: "Cloud registry"}
+	_, err := discovery.NewRegistryClient(url).Lookup("doctor-" + randomHex(8))
+	if err != nil && !errors.Is(err, discovery.ErrPeerNotFound) {
+		r.Err = err
+		r.Hint = fmt.Sprintf("Receivers on other networks can't look you up. Check outbound HTTPS to %s (set with %s or registry_url in the config).", url, discovery.EnvRegistryURL)
+		return r
+	}
+	r.Detail = url + " reachable"
+	return r
+}
+
+// CheckSTUN asks server for this host's public address.
+func CheckSTUN(ctx context.Context, server string) Result {
+	r := Result{Name: "STUN " + server}
+	u, err := ice.ParseURL(server)
+	if err != nil {
+		r.Err = err
+		r.Hint = "Use a URL like stun:stun.example.com:3478 (--stun, JEND_STUN_SERVERS or stun_servers in the config)."
+		return r
+	}
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	if err := transport.CheckSTUN(ctx, net.JoinHostPort(u.Host, strconv.Itoa(u.Port))); err != nil {
+		r.Err = err
+		r.Hint = "Without STUN only LAN and relayed P2P connections work. Outbound UDP may be blocked; try another server with --stun."
+		return r
+	}
+	r.Detail = "binding response received"
+	return r
+}
+
+// checkTURN fetches relay credentials (unless a relay is configured) and checks
+// each relay URI accepts them.
+func checkTURN(ctx context.Context, opts Options) []Result {
+	var uris []string
+	var creds *transport.TurnCredentials
+	var results []Result
+	if opts.ICE != nil && opts.ICE.Turn != nil && opts.ICE.Turn.URL != "" {
+		uris = []string{opts.ICE.Turn.URL}
+		creds = &transport.TurnCredentials{Username: opts.ICE.Turn.Username, Password: opts.ICE.Turn.Password}
+	} else {
+		r := Result{Name: "TURN credentials"}
+		ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+		creds, err := transport.TurnCredentialsFrom(ctx, opts.AuthURL)
+		cancel()
+		if err != nil {
+			r.Err = err
+			r.Hint = fmt.Sprintf("Peers behind strict NATs won't connect without a relay. Check outbound HTTPS to %s, or bring your own with --relay-url.", opts.AuthURL)
+			return []Result{r}
+		}
+		r.Detail = fmt.Sprintf("%d relay URIs", len(creds.URIs))
+		results = append(results, r)
+		uris = creds.URIs
+	}
+
+	for _, uri := range uris {
+		results = append(results, CheckRelay(ctx, uri, creds))
+	}
+	return results
+}
+
+// CheckRelay checks the TURN relay at uri answers and, given creds with a
+// username, that it accepts them: it allocates a relayed address as ICE would.
+// With nil creds only reachability is checked.
+func CheckRelay(ctx context.Context, uri string, creds *transport.TurnCredentials) Result {
+	r := Result{Name: "TURN relay " + uri}
+	u, err := ice.ParseURL(uri)
+	if err != nil {
+		r.Err = err
+		r.Hint = "Use a URL like turn:relay.example.com:3478?transport=udp."
+		return r
+	}
+	addr := net.JoinHostPort(u.Host, strconv.Itoa(u.Port))
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	if u.Proto == ice.ProtoTypeTCP {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			r.Err = err
+			r.Hint = "Outbound TCP to the relay is blocked; a UDP relay URI may still work."
+			return r
+		}
+		conn.Close()
+		r.Detail = "TCP connection accepted"
+	} else {
+		if err := transport.CheckSTUN(ctx, addr); err != nil {
+			r.Err = err
+			r.Hint = "Outbound UDP to the relay is blocked; a TCP or TLS (turns:) relay URI may still work."
+			return r
+		}
+		r.Detail = "binding response received"
+	}
+	if creds == nil || creds.Username == "" {
+		return r
+	}
+
+	if err := transport.CheckTURN(ctx, uri, creds); err != nil {
+		r.Err = err
+		r.Hint = "The relay answers but refused a relay allocation: check the username and password (--relay-user, --relay-pass), or the relay's quota."
+		return r
+	}
+	r.Detail = "relay address allocated"
+	return r
+}
+
+// signalingName names the configured signaling backend.
+func signalingName() string {
+	if signaling.BrokerURL() != "" {
+		return "Signaling (MQTT broker)"
+	}
+	return "Signaling (AWS Cognito + IoT)"
+}
+
+// checkSignaling connects to the signaling backend: a plain MQTT broker if one
+// is configured, otherwise Cognito credentials exchanged for an AWS IoT
+// connection. Either way, everything ICE signaling needs.
+func checkSignaling(ctx context.Context) Result {
+	r := Result{Name: signalingName()}
+	ctx, cancel := context.WithTimeout(ctx, 2*checkTimeout)
+	defer cancel()
+	broker := signaling.BrokerURL()
+	client, err := signaling.Connect(ctx, "doctor-"+randomHex(8))
+	if err != nil {
+		r.Err = err
+		r.Hint = fmt.Sprintf("P2P across networks needs signaling. Check outbound HTTPS to AWS, or %s/%s for a self-hosted stack.", signaling.EnvIoTEndpoint, signaling.EnvIdentityPoolID)
+		if broker != "" {
+			r.Hint = fmt.Sprintf("P2P across networks needs signaling. Check the broker is up and reachable, or fix %s / mqtt_broker in the config.", signaling.EnvMQTTBroker)
+		} else if errors.Is(err, context.DeadlineExceeded) {
+			r.Hint = "AWS didn't answer in time; outbound HTTPS (443) may be filtered."
+		}
+		return r
+	}
+	client.Disconnect()
+	if broker != "" {
+		r.Detail = "connected to " + broker
+	} else {
+		r.Detail = "connected to " + signaling.ResolveEndpoint().IoTEndpoint
+	}
+	return r
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,134 @@
+package doctor
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/darkprince558/jend/internal/transport"
+	"github.com/pion/turn/v2"
+)
+
+func TestCheckRegistry(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "unknown code", status: http.StatusNotFound},
+		{name: "server error", status: http.StatusInternalServerError, wantErr: true},
+		{name: "forbidden", status: http.StatusForbidden, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !strings.HasPrefix(r.URL.Path, "/lookup/doctor-") {
+					t.Errorf("Unexpected request %s", r.URL.Path)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			r := CheckRegistry(srv.URL)
+			if tt.wantErr {
+				if r.OK() || r.Hint == "" {
+					t.Errorf("Expected a failure with a hint, got %+v", r)
+				}
+			} else if !r.OK() {
+				t.Errorf("Expected \"not found\" to prove the registry answered, got %v", r.Err)
+			}
+		})
+	}
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	if r := CheckRegistry(srv.URL); r.OK() {
+		t.Error("Expected an unreachable registry to fail")
+	}
+}
+
+// turnServer runs a TURN relay on loopback UDP that accepts user/pass and
+// returns its turn: URI.
+func turnServer(t *testing.T) string {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := turn.NewServer(turn.ServerConfig{
+		Realm: "jend.test",
+		AuthHandler: func(username, realm string, _ net.Addr) ([]byte, bool) {
+			if username != "user" {
+				return nil, false
+			}
+			return turn.GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{{
+			PacketConn: conn,
+			RelayAddressGenerator: &turn.RelayAddressGeneratorStatic{
+				RelayAddress: net.ParseIP("127.0.0.1"),
+				Address:      "127.0.0.1",
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return "turn:" + conn.LocalAddr().String() + "?transport=udp"
+}
+
+func TestCheckRelay(t *testing.T) {
+	uri := turnServer(t)
+	ctx := context.Background()
+
+	if r := CheckRelay(ctx, uri, nil); !r.OK() || r.Detail != "binding response received" {
+		t.Errorf("Expected a reachability check only without credentials, got %+v", r)
+	}
+	good := &transport.TurnCredentials{Username: "user", Password: "pass"}
+	if r := CheckRelay(ctx, uri, good); !r.OK() || r.Detail != "relay address allocated" {
+		t.Errorf("Expected the login to succeed, got %+v", r)
+	}
+	for _, creds := range []*transport.TurnCredentials{
+		{Username: "user", Password: "wrong"},
+		{Username: "nobody", Password: "pass"},
+	} {
+		r := CheckRelay(ctx, uri, creds)
+		if r.OK() || !strings.Contains(r.Hint, "--relay-user") {
+			t.Errorf("Expected %s/%s to be refused with a hint, got %+v", creds.Username, creds.Password, r)
+		}
+	}
+
+	if r := CheckRelay(ctx, "not a url", good); r.OK() {
+		t.Error("Expected a malformed URI to fail")
+	}
+}
+
+func TestCheckTURNUsesConfiguredRelay(t *testing.T) {
+	uri := turnServer(t)
+	opts := Options{ICE: &transport.ICEConfig{
+		Turn: &transport.CustomTurnConfig{URL: uri, Username: "user", Password: "wrong"},
+	}}
+	results := checkTURN(context.Background(), opts)
+	if len(results) != 1 || results[0].OK() {
+		t.Errorf("Expected one failed relay check with the configured credentials, got %+v", results)
+	}
+	opts.ICE.Turn.Password = "pass"
+	if results := checkTURN(context.Background(), opts); len(results) != 1 || !results[0].OK() {
+		t.Errorf("Expected the configured relay to pass, got %+v", results)
+	}
+}
+
+func TestRunLANOnlySkipsRemoteChecks(t *testing.T) {
+	var skipped []string
+	Run(context.Background(), Options{Port: 0, LANOnly: true}, func(r Result) {
+		if r.Skipped {
+			skipped = append(skipped, r.Name)
+		}
+	})
+	if len(skipped) != 4 || skipped[0] != "Cloud registry" {
+		t.Errorf("Expected the registry, STUN, TURN and signaling skipped, got %v", skipped)
+	}
+}
@@ -0,0 +1,85 @@
+// Package identity is this device's long-lived Ed25519 key. A sender signs its
+// handshakes with it and publishes the public half through discovery; a
+// receiver proves itself with it to senders that only accept known receivers
+// (send --allow). Either side is named by the key's Fingerprint.
+package identity
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/darkprince558/jend/internal/config"
+)
+
+var (
+	loadOnce sync.Once
+	loaded   ed25519.PrivateKey
+	loadErr  error
+)
+
+// Path is where the key lives: ~/.jend/identity.key, the hex seed, private to the user.
+func Path() (string, error) {
+	cfgPath, err := config.GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(cfgPath), "identity.key"), nil
+}
+
+// Load returns this device's key, creating it on first use.
+func Load() (ed25519.PrivateKey, error) {
+	loadOnce.Do(func() {
+		var path string
+		if path, loadErr = Path(); loadErr == nil {
+			loaded, loadErr = loadOrCreate(path)
+		}
+	})
+	return loaded, loadErr
+}
+
+func loadOrCreate(path string) (ed25519.PrivateKey, error) {
+	if data, err := os.ReadFile(path); err == nil {
+		seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("corrupt identity key %s", path)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key.Seed())+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Fingerprint names a public key the way `jend identity` prints it:
+// "SHA256:" and the unpadded base64 of its SHA-256, like OpenSSH.
+func Fingerprint(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// ParseFingerprint checks a fingerprint typed by a user and returns it as
+// Fingerprint prints it; the "SHA256:" prefix is optional.
+func ParseFingerprint(fp string) (string, error) {
+	b64 := strings.TrimPrefix(strings.TrimSpace(fp), "SHA256:")
+	raw, err := base64.RawStdEncoding.DecodeString(b64)
+	if err != nil || len(raw) != sha256.Size {
+		return "", fmt.Errorf("invalid fingerprint %q (want SHA256:<43 base64 characters>, see jend identity)", fp)
+	}
+	return "SHA256:" + b64, nil
+}
@@ -0,0 +1,53 @@
+package identity
+
+import (
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadOrCreate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity")
+	key, err := loadOrCreate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Key file mode %v, want 0600", info.Mode().Perm())
+	}
+
+	// The next run is the same device
+	again, err := loadOrCreate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(again) {
+		t.Error("Reloading created a different key")
+	}
+
+	os.WriteFile(path, []byte("not hex\n"), 0600)
+	if _, err := loadOrCreate(path); err == nil {
+		t.Error("Loaded a corrupt key")
+	}
+}
+
+func TestParseFingerprint(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(nil)
+	fp := Fingerprint(pub)
+	for _, in := range []string{fp, strings.TrimPrefix(fp, "SHA256:"), " " + fp + "\n"} {
+		if got, err := ParseFingerprint(in); err != nil || got != fp {
+			t.Errorf("ParseFingerprint(%q) = %q, %v", in, got, err)
+		}
+	}
+	for _, in := range []string{"", "SHA256:nope", fp[:len(fp)-2]} {
+		if _, err := ParseFingerprint(in); err == nil {
+			t.Errorf("Accepted %q", in)
+		}
+	}
+}
@@ -1,5 +1,14 @@
 package signaling
 
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
 // MessageType defines the type of signaling message
 type MessageType string
 
@@ -9,12 +18,79 @@ const (
 	TypeCandidate MessageType = "candidate"
 )
 
+// maxBatchSize caps a decompressed candidate batch so a hostile peer can't zip-bomb us.
+const maxBatchSize = 64 * 1024
+
 // SignalMessage represents a P2P signaling message exchanged via MQTT.
 type SignalMessage struct {
 	Type MessageType `json:"type"`
 	// Session description (ICE Ufrag/Pwd)
 	Ufrag string `json:"ufrag,omitempty"`
 	Pwd   string `json:"pwd,omitempty"`
+	// Restart marks Ufrag/Pwd as a new ICE generation after a connection failure
+	Restart bool `json:"restart,omitempty"`
 	// Candidates (one per message or bundled)
 	Candidate string `json:"candidate,omitempty"`
+	// Batch carries several candidates at once, see EncodeCandidateBatch
+	Batch string `json:"batch,omitempty"`
+}
+
+// EncodeCandidateBatch packs candidates into one compact string:
+// newline-joined, gzipped, then base64 so it stays valid JSON.
+// Candidate lines are very repetitive (same foundation/ip/"typ host" tokens),
+// so a batch compresses far better than candidates sent one by one.
+func EncodeCandidateBatch(candidates []string) (string, error) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := zw.Write([]byte(strings.Join(candidates, "\n"))); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecodeCandidateBatch reverses EncodeCandidateBatch.
+func DecodeCandidateBatch(batch string) ([]string, error) {
+	raw, err := base64.RawStdEncoding.DecodeString(batch)
+	if err != nil {
+		return nil, fmt.Errorf("invalid candidate batch: %w", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid candidate batch: %w", err)
+	}
+	defer zr.Close()
+
+	data, err := io.ReadAll(io.LimitReader(zr, maxBatchSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid candidate batch: %w", err)
+	}
+	if len(data) > maxBatchSize {
+		return nil, fmt.Errorf("candidate batch too large")
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return strings.Split(string(data), "\n"), nil
+}
+
+// Candidates returns every candidate carried by the message, single or batched.
+func (m SignalMessage) Candidates() ([]string, error) {
+	var out []string
+	if m.Candidate != "" {
+		out = append(out, m.Candidate)
+	}
+	if m.Batch != "" {
+		batch, err := DecodeCandidateBatch(m.Batch)
+		if err != nil {
+			return out, err
+		}
+		out = append(out, batch...)
+	}
+	return out, nil
 }
@@ -0,0 +1,54 @@
+package signaling
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCandidateBatchRoundTrip(t *testing.T) {
+	cands := []string{
+		"candidate:1 1 udp 2130706431 192.168.1.10 50000 typ host",
+		"candidate:2 1 udp 1694498815 203.0.113.7 50001 typ srflx raddr 192.168.1.10 rport 50000",
+		"candidate:3 1 tcp 1518280447 192.168.1.10 9 typ host tcptype active",
+	}
+
+	batch, err := EncodeCandidateBatch(cands)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batch) >= len(strings.Join(cands, "\n")) {
+		t.Logf("Warning: batch (%d) not smaller than raw (%d)", len(batch), len(strings.Join(cands, "\n")))
+	}
+
+	msg := SignalMessage{Type: TypeOffer, Candidate: "candidate:0 1 udp 1 10.0.0.1 1 typ host", Batch: batch}
+	got, err := msg.Candidates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 4 || got[1] != cands[0] || got[3] != cands[2] {
+		t.Errorf("Unexpected candidates: %v", got)
+	}
+}
+
+func TestCandidateBatchRejectsGarbage(t *testing.T) {
+	if _, err := DecodeCandidateBatch("not-base64!!"); err == nil {
+		t.Error("Expected error for invalid batch")
+	}
+}
+
+func TestRestartFlagOmittedByDefault(t *testing.T) {
+	initial, _ := json.Marshal(SignalMessage{Type: TypeOffer, Ufrag: "abc", Pwd: "secret"})
+	if strings.Contains(string(initial), "restart") {
+		t.Errorf("First exchange should not carry the restart flag: %s", initial)
+	}
+
+	restart, _ := json.Marshal(SignalMessage{Type: TypeAnswer, Ufrag: "def", Pwd: "secret2", Restart: true})
+	var got SignalMessage
+	if err := json.Unmarshal(restart, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Restart || got.Ufrag != "def" {
+		t.Errorf("Restart message did not round-trip: %+v", got)
+	}
+}
@@ -10,14 +10,58 @@ import (
 	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/darkprince558/jend/internal/auth"
+	jendconfig "github.com/darkprince558/jend/internal/config"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
+// Public JEND infrastructure, used when nothing overrides it.
 const (
-	iotEndpoint = "a10ofg7qwmr003-ats.iot.us-east-1.amazonaws.com"
-	region      = "us-east-1"
+	defaultIoTEndpoint    = "a10ofg7qwmr003-ats.iot.us-east-1.amazonaws.com"
+	defaultRegion         = "us-east-1"
+	defaultIdentityPoolID = "us-east-1:63825811-2a43-4a2b-893c-ce78d256819d"
 )
 
+// Environment overrides for a self-hosted stack.
+const (
+	EnvIoTEndpoint    = "JEND_IOT_ENDPOINT"
+	EnvAWSRegion      = "JEND_AWS_REGION"
+	EnvIdentityPoolID = "JEND_IDENTITY_POOL_ID"
+)
+
+// Endpoint identifies the AWS IoT signaling network to connect to.
+type Endpoint struct {
+	IoTEndpoint    string
+	Region         string
+	IdentityPoolID string
+}
+
+// ResolveEndpoint picks each value independently, with precedence
+// environment > config file > built-in defaults.
+func ResolveEndpoint() Endpoint {
+	cfg, err := jendconfig.Load()
+	if err != nil {
+		cfg = &jendconfig.Config{}
+	}
+	return resolveEndpoint(cfg, os.Getenv)
+}
+
+func resolveEndpoint(cfg *jendconfig.Config, getenv func(string) string) Endpoint {
+	pick := func(env, saved, def string) string {
+		if v := getenv(env); v != "" {
+			return v
+		}
+		if saved != "" {
+			return saved
+		}
+		return def
+	}
+	return Endpoint{
+		IoTEndpoint:    pick(EnvIoTEndpoint, cfg.IoTEndpoint, defaultIoTEndpoint),
+		Region:         pick(EnvAWSRegion, cfg.AWSRegion, defaultRegion),
+		IdentityPoolID: pick(EnvIdentityPoolID, cfg.IdentityPoolID, defaultIdentityPoolID),
+	}
+}
+
 // IoTClient handles MQTT connections to AWS IoT Core.
 type IoTClient struct {
 	client mqtt.Client
@@ -25,25 +69,21 @@ type IoTClient struct {
 
 // NewIoTClient creates a new authenticated MQTT client.
 func NewIoTClient(ctx context.Context, clientID string) (*IoTClient, error) {
-	// 1. Get AWS Credentials via Cognito
-	// TODO: Externalize IdentityPoolID configuration.
-	identityPoolID := os.Getenv("JEND_IDENTITY_POOL_ID")
-	if identityPoolID == "" {
-		identityPoolID = "us-east-1:63825811-2a43-4a2b-893c-ce78d256819d"
-	}
+	ep := ResolveEndpoint()
 
+	// 1. Get AWS Credentials via Cognito
 	// Initial config to get region/defaults
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(ep.Region))
 	if err != nil {
 		return nil, fmt.Errorf("failed to load base aws config: %w", err)
 	}
 
 	// Use Cognito Provider
-	credsProvider := auth.NewCognitoProvider(cfg, identityPoolID)
+	credsProvider := auth.NewCognitoProvider(cfg, ep.IdentityPoolID)
 
 	// Reload config with credentials provider
 	cfg, err = config.LoadDefaultConfig(ctx,
-		config.WithRegion(region),
+		config.WithRegion(ep.Region),
 		config.WithCredentialsProvider(credsProvider),
 	)
 	if err != nil {
@@ -58,13 +98,13 @@ func NewIoTClient(ctx context.Context, clientID string) (*IoTClient, error) {
 	// 2. Sign the Websocket URL
 	// AWS IoT Core supports WSS on port 443 with SigV4
 	signer := v4.NewSigner()
-	req, _ := http.NewRequest("GET", fmt.Sprintf("wss://%s/mqtt", iotEndpoint), nil)
+	req, _ := http.NewRequest("GET", fmt.Sprintf("wss://%s/mqtt", ep.IoTEndpoint), nil)
 
 	// Sign the request
 	// We need to sign with service "iotdevicegateway"
 	// Payload hash for GET is empty string hash
 	emptyHash := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
-	err = signer.SignHTTP(ctx, creds, req, emptyHash, "iotdevicegateway", region, time.Now())
+	err = signer.SignHTTP(ctx, creds, req, emptyHash, "iotdevicegateway", ep.Region, time.Now())
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign websocket request: %w", err)
 	}
@@ -76,7 +116,7 @@ func NewIoTClient(ctx context.Context, clientID string) (*IoTClient, error) {
 	opts.SetCleanSession(true)
 	opts.SetAutoReconnect(true)
 	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
-		fmt.Printf("MQTT Connection lost: %v\n", err)
+		fmt.Fprintf(os.Stderr, "MQTT Connection lost: %v\n", err)
 	})
 
 	client := mqtt.NewClient(opts)
@@ -88,19 +128,13 @@ func NewIoTClient(ctx context.Context, clientID string) (*IoTClient, error) {
 }
 
 // Subscribe listens to a topic.
-func (c *IoTClient) Subscribe(topic string, handler mqtt.MessageHandler) error {
-	if token := c.client.Subscribe(topic, 1, handler); token.Wait() && token.Error() != nil {
-		return fmt.Errorf("subscribe failed: %w", token.Error())
-	}
-	return nil
+func (c *IoTClient) Subscribe(topic string, handler Handler) error {
+	return subscribe(c.client, topic, handler)
 }
 
 // Publish sends a message to a topic.
 func (c *IoTClient) Publish(topic string, payload []byte) error {
-	if token := c.client.Publish(topic, 1, false, payload); token.Wait() && token.Error() != nil {
-		return fmt.Errorf("publish failed: %w", token.Error())
-	}
-	return nil
+	return publish(c.client, topic, payload)
 }
 
 // Disconnect closes the connection.
@@ -109,3 +143,19 @@ func (c *IoTClient) Disconnect() {
 		c.client.Disconnect(250)
 	}
 }
+
+// subscribe and publish are shared by both MQTT backends, at QoS 1.
+func subscribe(client mqtt.Client, topic string, handler Handler) error {
+	cb := func(_ mqtt.Client, msg mqtt.Message) { handler(msg.Payload()) }
+	if token := client.Subscribe(topic, 1, cb); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("subscribe failed: %w", token.Error())
+	}
+	return nil
+}
+
+func publish(client mqtt.Client, topic string, payload []byte) error {
+	if token := client.Publish(topic, 1, false, payload); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("publish failed: %w", token.Error())
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package signaling
+
+import (
+	"context"
+	"testing"
+
+	jendconfig "github.com/darkprince558/jend/internal/config"
+)
+
+func TestResolveEndpoint(t *testing.T) {
+	env := map[string]string{}
+	getenv := func(k string) string { return env[k] }
+
+	// Nothing set: the public infrastructure
+	ep := resolveEndpoint(&jendconfig.Config{}, getenv)
+	want := Endpoint{IoTEndpoint: defaultIoTEndpoint, Region: defaultRegion, IdentityPoolID: defaultIdentityPoolID}
+	if ep != want {
+		t.Errorf("Defaults: got %+v, want %+v", ep, want)
+	}
+
+	// Config file overrides defaults
+	cfg := &jendconfig.Config{IoTEndpoint: "cfg-ats.iot.eu-west-1.amazonaws.com", AWSRegion: "eu-west-1"}
+	ep = resolveEndpoint(cfg, getenv)
+	if ep.IoTEndpoint != cfg.IoTEndpoint || ep.Region != "eu-west-1" || ep.IdentityPoolID != defaultIdentityPoolID {
+		t.Errorf("Config: got %+v", ep)
+	}
+
+	// Environment beats the config file, value by value
+	env[EnvAWSRegion] = "ap-south-1"
+	env[EnvIdentityPoolID] = "ap-south-1:pool"
+	ep = resolveEndpoint(cfg, getenv)
+	if ep.IoTEndpoint != cfg.IoTEndpoint || ep.Region != "ap-south-1" || ep.IdentityPoolID != "ap-south-1:pool" {
+		t.Errorf("Env: got %+v", ep)
+	}
+}
+
+func TestBrokerURL(t *testing.T) {
+	env := map[string]string{}
+	getenv := func(k string) string { return env[k] }
+
+	// Nothing set: AWS IoT
+	if got := brokerURL(&jendconfig.Config{}, getenv); got != "" {
+		t.Errorf("Defaults: got %q, want AWS IoT", got)
+	}
+
+	cfg := &jendconfig.Config{MQTTBroker: "tcp://cfg:1883"}
+	if got := brokerURL(cfg, getenv); got != cfg.MQTTBroker {
+		t.Errorf("Config: got %q", got)
+	}
+
+	env[EnvMQTTBroker] = "wss://env/mqtt"
+	if got := brokerURL(cfg, getenv); got != "wss://env/mqtt" {
+		t.Errorf("Env: got %q", got)
+	}
+}
+
+func TestNewPlainMQTTClientInvalidURL(t *testing.T) {
+	for _, broker := range []string{"localhost:1883", "tcp://", "::"} {
+		if _, err := NewPlainMQTTClient(context.Background(), broker, "test"); err == nil {
+			t.Errorf("%q: expected an error", broker)
+		}
+	}
+}
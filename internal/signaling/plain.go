@@ -0,0 +1,64 @@
+package signaling
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// PlainMQTTClient signals through any MQTT 3.1.1 broker (Mosquitto, EMQX, ...),
+// for self-hosters without an AWS stack.
+type PlainMQTTClient struct {
+	client mqtt.Client
+}
+
+// NewPlainMQTTClient connects to broker, a URL such as tcp://host:1883,
+// ssl://host:8883 or wss://host/mqtt. Credentials go in the URL's user info.
+func NewPlainMQTTClient(ctx context.Context, broker, clientID string) (*PlainMQTTClient, error) {
+	u, err := url.Parse(broker)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid MQTT broker URL %q (want e.g. tcp://host:1883)", broker)
+	}
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(broker)
+	opts.SetClientID(clientID)
+	opts.SetCleanSession(true)
+	opts.SetAutoReconnect(true)
+	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
+		fmt.Fprintf(os.Stderr, "MQTT Connection lost: %v\n", err)
+	})
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	select {
+	case <-token.Done():
+	case <-ctx.Done():
+		client.Disconnect(0)
+		return nil, fmt.Errorf("mqtt connect to %s: %w", u.Host, ctx.Err())
+	}
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("mqtt connect to %s failed: %w", u.Host, err)
+	}
+	return &PlainMQTTClient{client: client}, nil
+}
+
+// Subscribe listens to a topic.
+func (c *PlainMQTTClient) Subscribe(topic string, handler Handler) error {
+	return subscribe(c.client, topic, handler)
+}
+
+// Publish sends a message to a topic.
+func (c *PlainMQTTClient) Publish(topic string, payload []byte) error {
+	return publish(c.client, topic, payload)
+}
+
+// Disconnect closes the connection.
+func (c *PlainMQTTClient) Disconnect() {
+	if c.client != nil {
+		c.client.Disconnect(250)
+	}
+}
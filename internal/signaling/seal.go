@@ -0,0 +1,82 @@
+package signaling
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2id cost for the signaling key. Lighter than the PAKE's: it runs once per
+// session on both sides, and only has to make guessing codes from a sniffed
+// topic expensive, not resist a peer.
+const (
+	sealArgonTime    = 2
+	sealArgonMemory  = 19 * 1024 // KiB
+	sealArgonThreads = 1
+)
+
+// sealSalt is fixed: both peers must derive the same topic from the code alone.
+var sealSalt = []byte("jend-signal-v1")
+
+// errUnauthenticated marks a payload that wasn't sealed with this session's key.
+var errUnauthenticated = errors.New("signal message failed authentication")
+
+// Session is the signaling channel of one transfer. Its topic and key are both
+// derived from the transfer code, so the broker (and anyone subscribed to it)
+// is sent neither the code nor the peers' candidates, and can't forge messages.
+// The topic still lets them test guesses at the code, one Argon2 run each.
+type Session struct {
+	Topic string
+	aead  cipher.AEAD
+}
+
+// NewSession derives the topic and AES-256-GCM key for code.
+func NewSession(code string) (*Session, error) {
+	k := argon2.IDKey([]byte(code), sealSalt, sealArgonTime, sealArgonMemory, sealArgonThreads, 48)
+	block, err := aes.NewCipher(k[:32])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{Topic: "jend/signal/" + hex.EncodeToString(k[32:]), aead: aead}, nil
+}
+
+// Seal encodes msg as nonce || AES-GCM(JSON), bound to the topic.
+func (s *Session) Seal(msg SignalMessage) ([]byte, error) {
+	plain, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(plain)+s.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, plain, []byte(s.Topic)), nil
+}
+
+// Open reverses Seal. Anything not sealed by a holder of the code fails with
+// errUnauthenticated.
+func (s *Session) Open(payload []byte) (SignalMessage, error) {
+	var msg SignalMessage
+	n := s.aead.NonceSize()
+	if len(payload) < n+s.aead.Overhead() {
+		return msg, errUnauthenticated
+	}
+	plain, err := s.aead.Open(nil, payload[:n], payload[n:], []byte(s.Topic))
+	if err != nil {
+		return msg, errUnauthenticated
+	}
+	if err := json.Unmarshal(plain, &msg); err != nil {
+		return msg, fmt.Errorf("invalid signal message: %w", err)
+	}
+	return msg, nil
+}
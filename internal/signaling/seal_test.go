@@ -0,0 +1,59 @@
+package signaling
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSessionSealOpen(t *testing.T) {
+	a, err := NewSession("1234-alpha-bravo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewSession("1234-alpha-bravo")
+	other, _ := NewSession("1234-alpha-charlie")
+
+	if a.Topic != b.Topic {
+		t.Fatalf("Same code, different topics: %s vs %s", a.Topic, b.Topic)
+	}
+	if a.Topic == other.Topic {
+		t.Fatal("Different codes share a topic")
+	}
+	if strings.Contains(a.Topic, "alpha") {
+		t.Errorf("Topic leaks the code: %s", a.Topic)
+	}
+
+	msg := SignalMessage{Type: TypeOffer, Ufrag: "ufrag", Pwd: "secret-pwd", Candidate: "candidate:1 1 udp 1 192.0.2.1 5000 typ host"}
+	sealed, err := a.Seal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("192.0.2.1")) || bytes.Contains(sealed, []byte("secret-pwd")) {
+		t.Error("Sealed payload contains plaintext")
+	}
+
+	got, err := b.Open(sealed)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if got != msg {
+		t.Errorf("Round trip: got %+v, want %+v", got, msg)
+	}
+
+	// Wrong code, tampering, plaintext JSON and short payloads are all rejected
+	if _, err := other.Open(sealed); err != errUnauthenticated {
+		t.Errorf("Other code: got %v", err)
+	}
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := b.Open(tampered); err != errUnauthenticated {
+		t.Errorf("Tampered: got %v", err)
+	}
+	if _, err := b.Open([]byte(`{"type":"offer","ufrag":"evil"}`)); err != errUnauthenticated {
+		t.Errorf("Plaintext: got %v", err)
+	}
+	if _, err := b.Open(nil); err != errUnauthenticated {
+		t.Errorf("Empty: got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package signaling
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+
+	jendconfig "github.com/darkprince558/jend/internal/config"
+)
+
+// EnvMQTTBroker selects a plain MQTT broker instead of AWS IoT.
+const EnvMQTTBroker = "JEND_MQTT_BROKER"
+
+// Handler receives the payload of each message published to a subscribed topic.
+type Handler func(payload []byte)
+
+// Signaling is the pub/sub channel peers exchange ICE offers and candidates over.
+type Signaling interface {
+	Subscribe(topic string, handler Handler) error
+	Publish(topic string, payload []byte) error
+	Disconnect()
+}
+
+var (
+	_ Signaling = (*IoTClient)(nil)
+	_ Signaling = (*PlainMQTTClient)(nil)
+)
+
+// BrokerURL is the plain MQTT broker to signal through, if one is configured.
+// Precedence: JEND_MQTT_BROKER > mqtt_broker in the config file. Empty means AWS IoT.
+func BrokerURL() string {
+	cfg, err := jendconfig.Load()
+	if err != nil {
+		cfg = &jendconfig.Config{}
+	}
+	return brokerURL(cfg, os.Getenv)
+}
+
+func brokerURL(cfg *jendconfig.Config, getenv func(string) string) string {
+	if v := getenv(EnvMQTTBroker); v != "" {
+		return v
+	}
+	return cfg.MQTTBroker
+}
+
+// ClientID returns a fresh MQTT client ID for role ("sender" or "receiver").
+// It is random rather than derived from the transfer code: brokers see, and AWS
+// IoT logs, the ID of every connection, and each peer needs its own.
+func ClientID(role string) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return role + "-" + hex.EncodeToString(b)
+}
+
+// Connect opens the configured signaling backend: a plain MQTT broker if
+// BrokerURL is set, AWS IoT otherwise.
+func Connect(ctx context.Context, clientID string) (Signaling, error) {
+	if broker := BrokerURL(); broker != "" {
+		return NewPlainMQTTClient(ctx, broker, clientID)
+	}
+	return NewIoTClient(ctx, clientID)
+}
@@ -3,17 +3,18 @@ package transport
 import (
 	"context"
 	"fmt"
-
-	"encoding/json"
-	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/darkprince558/jend/internal/config"
 	"github.com/pion/ice/v2"
 )
 
 const (
 	StunServer = "stun:stun.l.google.com:19302"
-	AuthAPI    = "https://k4fa8k5sjg.execute-api.us-east-1.amazonaws.com/turn-auth"
+	AuthAPI    = "https://k4fa8k5sjg.execute-api.us-east-1.amazonaws.com/turn-auth" // Default TURN credential API
 )
 
 // TurnCredentials represents the ephemeral credentials returned by the TURN Auth API.
@@ -22,6 +23,9 @@ type TurnCredentials struct {
 	Password string   `json:"password"`
 	TTL      int      `json:"ttl"`
 	URIs     []string `json:"uris"`
+	// Fingerprint is the SHA-256 of the relay's TLS certificate, which its
+	// turns: URIs are pinned to. Without it they are not used.
+	Fingerprint string `json:"fingerprint,omitempty"`
 }
 
 // CustomTurnConfig holds user-provided TURN credentials
@@ -31,21 +35,137 @@ type CustomTurnConfig struct {
 	Password string
 }
 
+// ICEConfig is the user's choice of ICE servers, already resolved from flags and
+// the config file by the caller. Zero fields fall back to JEND_* env, then defaults.
+type ICEConfig struct {
+	STUNServers []string          // Replaces the default STUN server
+	Turn        *CustomTurnConfig // Explicit relay; the auth API is not contacted
+	RelayOnly   bool              // Only gather relay candidates (also set by JEND_RELAY_ONLY)
+}
+
+// Environment variables for CI/containers.
+// Precedence everywhere: flags > env > config file > compiled defaults.
+const (
+	EnvStunServers   = "JEND_STUN_SERVERS" // Comma-separated, replaces the default STUN server
+	EnvTurnURI       = "JEND_TURN_URI"
+	EnvTurnUser      = "JEND_TURN_USER"
+	EnvTurnPass      = "JEND_TURN_PASS"
+	EnvRelayOnly     = "JEND_RELAY_ONLY"         // Any strconv.ParseBool true value: only gather relay candidates
+	EnvGatherTimeout = "JEND_ICE_GATHER_TIMEOUT" // Duration, how long relay setup may hold up ICE
+	EnvTurnAuthURL   = "JEND_TURN_AUTH_URL"      // TURN credential API of a self-hosted stack
+	EnvMaxRestarts   = "JEND_ICE_MAX_RESTARTS"   // How often a failed connection is renegotiated
+)
+
+// TurnAuthURL returns the TURN credential API, with precedence
+// JEND_TURN_AUTH_URL > config file > AuthAPI.
+func TurnAuthURL() string {
+	if u := strings.TrimSpace(os.Getenv(EnvTurnAuthURL)); u != "" {
+		return u
+	}
+	if cfg, err := config.Load(); err == nil && cfg.TurnAuthURL != "" {
+		return cfg.TurnAuthURL
+	}
+	return AuthAPI
+}
+
+// TurnConfigFromEnv returns the TURN relay set via JEND_TURN_*, or nil if JEND_TURN_URI is unset.
+func TurnConfigFromEnv() *CustomTurnConfig {
+	uri := strings.TrimSpace(os.Getenv(EnvTurnURI))
+	if uri == "" {
+		return nil
+	}
+	return &CustomTurnConfig{
+		URL:      uri,
+		Username: os.Getenv(EnvTurnUser),
+		Password: os.Getenv(EnvTurnPass),
+	}
+}
+
+// STUNServers returns the STUN servers ICE will use with cfg (which may be nil):
+// its own, else JEND_STUN_SERVERS, else the compiled default.
+func STUNServers(cfg *ICEConfig) []string {
+	if cfg != nil && len(cfg.STUNServers) > 0 {
+		return cfg.STUNServers
+	}
+	return stunServersFromEnv()
+}
+
+// stunServersFromEnv returns JEND_STUN_SERVERS, or the compiled default.
+func stunServersFromEnv() []string {
+	var servers []string
+	for _, s := range strings.Split(os.Getenv(EnvStunServers), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			servers = append(servers, s)
+		}
+	}
+	if len(servers) == 0 {
+		return []string{StunServer}
+	}
+	return servers
+}
+
+// relayOnlyFromEnv reports whether JEND_RELAY_ONLY is set to a true value.
+func relayOnlyFromEnv() bool {
+	v, err := strconv.ParseBool(os.Getenv(EnvRelayOnly))
+	return err == nil && v
+}
+
+// iceFailedTimeout is how long a disconnected agent waits before declaring the
+// connection failed and triggering an ICE restart. pion's 25s default would
+// outlast the QUIC idle timeout.
+var iceFailedTimeout = 5 * time.Second
+
 // NewICEAgent creates a new ICE agent configured with our STUN/TURN servers.
-// It fetches ephemeral credentials from the AuthAPI if custom config is nil.
-// If custom config is provided, it uses that instead.
-func NewICEAgent(ctx context.Context, isControlling bool, customTurn *CustomTurnConfig) (*ice.Agent, error) {
+// cfg carries the flag/config-file choice already resolved by the caller; it may be nil.
+// ctx bounds the relay credential fetch: if it expires we go on without a relay
+// rather than hold up host/srflx candidates.
+// Without an explicit relay, JEND_TURN_* is used, and failing that ephemeral credentials
+// are fetched from authURL (see TurnAuthURL).
+// status, if not nil, is told which relay is used, or that there is none.
+func NewICEAgent(ctx context.Context, isControlling bool, cfg *ICEConfig, authURL string, status func(string)) (*ice.Agent, error) {
+	agentCfg, err := iceAgentConfig(ctx, cfg, authURL, status)
+	if err != nil {
+		return nil, err
+	}
+	agent, err := ice.NewAgent(agentCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ice agent: %w", err)
+	}
+
+	return agent, nil
+}
+
+// iceAgentConfig builds the pion agent config for NewICEAgent.
+func iceAgentConfig(ctx context.Context, cfg *ICEConfig, authURL string, status func(string)) (*ice.AgentConfig, error) {
+	if cfg == nil {
+		cfg = &ICEConfig{}
+	}
+	if status == nil {
+		status = func(string) {}
+	}
+
 	// 1. Configure ICE Servers
 	urls := []*ice.URL{}
 
 	// STUN
-	stunURL, err := ice.ParseURL(StunServer)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse stun url: %w", err)
+	for _, server := range STUNServers(cfg) {
+		stunURL, err := ice.ParseURL(server)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse stun url %q: %w", server, err)
+		}
+		urls = append(urls, stunURL)
+	}
+
+	customTurn := cfg.Turn
+	if customTurn == nil {
+		customTurn = TurnConfigFromEnv()
 	}
-	urls = append(urls, stunURL)
 
 	// TURN Configuration
+	// Custom relays are verified by pion against the system roots. Our own relay
+	// is reached by IP with a self-signed cert, so its turns: URIs go through a
+	// dialer pinned to the fingerprint that came with the credentials.
+	var relayDialer *pinnedRelayDialer
 	if customTurn != nil && customTurn.URL != "" {
 		// Use User-Provided Relay
 		turnURL, err := ice.ParseURL(customTurn.URL)
@@ -55,45 +175,57 @@ func NewICEAgent(ctx context.Context, isControlling bool, customTurn *CustomTurn
 		turnURL.Username = customTurn.Username
 		turnURL.Password = customTurn.Password
 		urls = append(urls, turnURL)
-		fmt.Printf("Using Custom Relay: %s\n", customTurn.URL)
+		status("Using custom relay: " + customTurn.URL)
 	} else {
-		// Use Default (Dynamic Auth)
-		client := &http.Client{Timeout: 5 * time.Second}
-		resp, err := client.Get(AuthAPI)
+		// Use Default (Dynamic Auth), cached until shortly before the TTL runs out
+		creds, err := turnCreds.get(ctx, authURL)
 		if err != nil {
-			fmt.Printf("Warning: Failed to fetch TURN credentials: %v\n", err)
+			status(fmt.Sprintf("Warning: no TURN relay available (could not get credentials: %v). "+
+				"Continuing with direct and STUN connectivity only; peers behind strict NATs or firewalls may not connect.", err))
 		} else {
-			defer resp.Body.Close()
-			var creds TurnCredentials
-			if err := json.NewDecoder(resp.Body).Decode(&creds); err == nil {
-				for _, uri := range creds.URIs {
-					turnURL, err := ice.ParseURL(uri)
-					if err == nil {
-						turnURL.Username = creds.Username
-						turnURL.Password = creds.Password
-						urls = append(urls, turnURL)
+			fp, fpErr := parseCertFingerprint(creds.Fingerprint)
+			for _, uri := range creds.URIs {
+				turnURL, err := ice.ParseURL(uri)
+				if err != nil {
+					continue
+				}
+				if turnURL.Scheme == ice.SchemeTypeTURNS {
+					if fpErr != nil || turnURL.Proto != ice.ProtoTypeTCP {
+						continue // Can't be verified
+					}
+					if relayDialer == nil {
+						relayDialer = &pinnedRelayDialer{}
 					}
+					relayDialer.pin(turnURL, fp)
 				}
-			} else {
-				fmt.Printf("Warning: Failed to decode TURN credentials: %v\n", err)
+				turnURL.Username = creds.Username
+				turnURL.Password = creds.Password
+				urls = append(urls, turnURL)
 			}
 		}
 	}
 
-	// 2. Create Agent
-	agent, err := ice.NewAgent(&ice.AgentConfig{
+	candidateTypes := []ice.CandidateType{ice.CandidateTypeHost, ice.CandidateTypeServerReflexive, ice.CandidateTypeRelay}
+	if cfg.RelayOnly || relayOnlyFromEnv() {
+		// Hide local/public addresses from the peer; everything goes through TURN
+		candidateTypes = []ice.CandidateType{ice.CandidateTypeRelay}
+		status("Relay-only mode: gathering TURN candidates only")
+	}
+
+	// 2. Agent settings
+	agentCfg := &ice.AgentConfig{
 		Urls:           urls,
-		CandidateTypes: []ice.CandidateType{ice.CandidateTypeHost, ice.CandidateTypeServerReflexive, ice.CandidateTypeRelay},
+		CandidateTypes: candidateTypes,
+		FailedTimeout:  &iceFailedTimeout,
 		NetworkTypes:   []ice.NetworkType{ice.NetworkTypeUDP4, ice.NetworkTypeTCP4}, // Try both
 		Lite:           false,
 		InterfaceFilter: func(name string) bool {
 			// Ignore docker interfaces if needed, but safer to try all
 			return true
 		},
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create ice agent: %w", err)
 	}
-
-	return agent, nil
+	if relayDialer != nil {
+		agentCfg.ProxyDialer = relayDialer
+	}
+	return agentCfg, nil
 }
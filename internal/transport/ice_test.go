@@ -0,0 +1,158 @@
+package transport
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darkprince558/jend/internal/config"
+	"github.com/pion/ice/v2"
+)
+
+func TestICEConfigFromEnv(t *testing.T) {
+	t.Setenv(EnvStunServers, "")
+	t.Setenv(EnvTurnURI, "")
+	t.Setenv(EnvRelayOnly, "")
+
+	if got := stunServersFromEnv(); len(got) != 1 || got[0] != StunServer {
+		t.Errorf("Expected default STUN server, got %v", got)
+	}
+	if TurnConfigFromEnv() != nil {
+		t.Error("Expected no TURN config without JEND_TURN_URI")
+	}
+	if relayOnlyFromEnv() {
+		t.Error("Relay-only should default to off")
+	}
+
+	t.Setenv(EnvStunServers, "stun:a.example:3478, stun:b.example:3478,")
+	t.Setenv(EnvTurnURI, "turn:relay.example:3478")
+	t.Setenv(EnvTurnUser, "user")
+	t.Setenv(EnvTurnPass, "pass")
+	t.Setenv(EnvRelayOnly, "true")
+
+	if got := stunServersFromEnv(); len(got) != 2 || got[1] != "stun:b.example:3478" {
+		t.Errorf("Expected two STUN servers, got %v", got)
+	}
+	cfg := TurnConfigFromEnv()
+	if cfg == nil || cfg.URL != "turn:relay.example:3478" || cfg.Username != "user" || cfg.Password != "pass" {
+		t.Errorf("Unexpected TURN config: %+v", cfg)
+	}
+	if !relayOnlyFromEnv() {
+		t.Error("Expected relay-only mode")
+	}
+}
+
+func TestParseTurnsURL(t *testing.T) {
+	u, err := ice.ParseURL("turns:203.0.113.7:5349?transport=tcp")
+	if err != nil {
+		t.Fatalf("Failed to parse turns URL: %v", err)
+	}
+	if u.Scheme != ice.SchemeTypeTURNS || u.Proto != ice.ProtoTypeTCP || u.Port != 5349 {
+		t.Errorf("Unexpected parse result: %+v", u)
+	}
+}
+
+func TestTurnAuthURL(t *testing.T) {
+	t.Setenv("HOME", t.TempDir()) // No config file
+	t.Setenv(EnvTurnAuthURL, "")
+	if got := TurnAuthURL(); got != AuthAPI {
+		t.Errorf("Expected default %s, got %s", AuthAPI, got)
+	}
+
+	cfg := &config.Config{TurnAuthURL: "https://cfg.example/turn-auth"}
+	if err := config.Save(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := TurnAuthURL(); got != cfg.TurnAuthURL {
+		t.Errorf("Expected config URL, got %s", got)
+	}
+
+	t.Setenv(EnvTurnAuthURL, "https://env.example/turn-auth")
+	if got := TurnAuthURL(); got != "https://env.example/turn-auth" {
+		t.Errorf("Env should beat the config file, got %s", got)
+	}
+}
+
+func TestICEAgentRelayOnlyConfig(t *testing.T) {
+	t.Setenv(EnvStunServers, "")
+	t.Setenv(EnvTurnURI, "")
+	t.Setenv(EnvRelayOnly, "")
+
+	cfg := &ICEConfig{
+		STUNServers: []string{"stun:stun.example:3478"},
+		Turn:        &CustomTurnConfig{URL: "turn:relay.example:3478", Username: "u", Password: "p"},
+		RelayOnly:   true,
+	}
+	var status []string
+	agentCfg, err := iceAgentConfig(context.Background(), cfg, "http://127.0.0.1:1/unused", func(s string) { status = append(status, s) })
+	if err != nil {
+		t.Fatalf("iceAgentConfig: %v", err)
+	}
+	if want := []string{"Using custom relay: turn:relay.example:3478", "Relay-only mode: gathering TURN candidates only"}; !slices.Equal(status, want) {
+		t.Errorf("Expected status %q, got %q", want, status)
+	}
+	if len(agentCfg.CandidateTypes) != 1 || agentCfg.CandidateTypes[0] != ice.CandidateTypeRelay {
+		t.Errorf("Expected relay candidates only, got %v", agentCfg.CandidateTypes)
+	}
+	if len(agentCfg.Urls) != 2 || agentCfg.Urls[0].Host != "stun.example" || agentCfg.Urls[1].Username != "u" {
+		t.Errorf("Expected the configured STUN and TURN servers, got %v", agentCfg.Urls)
+	}
+	if agentCfg.InsecureSkipVerify {
+		t.Error("Custom relays must keep certificate verification")
+	}
+
+	agent, err := NewICEAgent(context.Background(), true, cfg, "http://127.0.0.1:1/unused", nil)
+	if err != nil {
+		t.Fatalf("NewICEAgent: %v", err)
+	}
+	agent.Close()
+}
+
+func TestICEAgentDefaultRelayPinsTURNS(t *testing.T) {
+	t.Setenv(EnvTurnURI, "")
+	t.Setenv(EnvRelayOnly, "")
+	saved := turnCreds
+	t.Cleanup(func() { turnCreds = saved })
+
+	creds := &TurnCredentials{
+		Username: "u",
+		Password: "p",
+		TTL:      300,
+		URIs:     []string{"turn:203.0.113.7:3478?transport=udp", "turns:203.0.113.7:5349?transport=tcp"},
+	}
+	turnCreds = &turnCredCache{nowFunc: time.Now, fetch: func(context.Context, string) (*TurnCredentials, error) {
+		return creds, nil
+	}}
+
+	agentCfg, err := iceAgentConfig(context.Background(), nil, "http://auth.example", nil)
+	if err != nil {
+		t.Fatalf("iceAgentConfig: %v", err)
+	}
+	if agentCfg.InsecureSkipVerify {
+		t.Error("Relay certificates must never be accepted unverified")
+	}
+	for _, u := range agentCfg.Urls {
+		if u.Scheme == ice.SchemeTypeTURNS {
+			t.Errorf("Expected turns: to be dropped without a fingerprint, got %v", u)
+		}
+	}
+	if agentCfg.ProxyDialer != nil {
+		t.Error("Expected no relay dialer without a fingerprint")
+	}
+
+	creds.Fingerprint = strings.Repeat("AB:", 31) + "AB"
+	turnCreds.creds = nil
+	agentCfg, err = iceAgentConfig(context.Background(), nil, "http://auth.example", nil)
+	if err != nil {
+		t.Fatalf("iceAgentConfig: %v", err)
+	}
+	dialer, ok := agentCfg.ProxyDialer.(*pinnedRelayDialer)
+	if !ok || len(dialer.pins) != 1 || dialer.pins["203.0.113.7:5349"] == nil {
+		t.Fatalf("Expected turns: pinned through the relay dialer, got %+v", agentCfg.ProxyDialer)
+	}
+	if n := len(agentCfg.Urls); n != 3 || agentCfg.Urls[2].Scheme != ice.SchemeTypeTURNS {
+		t.Errorf("Expected STUN, turn: and turns:, got %v", agentCfg.Urls)
+	}
+}
@@ -0,0 +1,82 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/darkprince558/jend/internal/simulation"
+)
+
+// TestMultiListenerAcceptsPacketConn mirrors the sender's dual mode: a direct
+// listener plus a listener on a packet conn (standing in for the ICE tunnel,
+// with simulated latency). A dial over the packet conn must reach Accept.
+func TestMultiListenerAcceptsPacketConn(t *testing.T) {
+	tr := NewQUICTransport()
+
+	direct, err := tr.Listen(":0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	serverPC, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tunnel, err := tr.ListenPacket(simulation.NewLossyPacketConn(serverPC, 0, 5*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to listen on packet conn: %v", err)
+	}
+
+	multi := NewMultiListener()
+	multi.Add(direct)
+	multi.Add(tunnel)
+	defer multi.Close()
+
+	clientPC, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientPC.Close()
+
+	dialErr := make(chan error, 1)
+	go func() {
+		conn, err := tr.DialPacket(simulation.NewLossyPacketConn(clientPC, 0, 5*time.Millisecond), serverPC.LocalAddr())
+		if err != nil {
+			dialErr <- err
+			return
+		}
+		stream, err := conn.OpenStreamSync(context.Background())
+		if err != nil {
+			dialErr <- err
+			return
+		}
+		stream.Write([]byte("HELLO"))
+		stream.Close()
+		dialErr <- nil
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := multi.Accept(ctx)
+	if err != nil {
+		t.Fatalf("Accept error: %v", err)
+	}
+	if err := <-dialErr; err != nil {
+		t.Fatalf("Dial over packet conn failed: %v", err)
+	}
+	if conn.RemoteAddr().String() != clientPC.LocalAddr().String() {
+		t.Errorf("Expected the connection from %s via the packet conn, got %s", clientPC.LocalAddr(), conn.RemoteAddr())
+	}
+
+	stream, err := conn.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("AcceptStream error: %v", err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(stream, buf); err != nil || string(buf) != "HELLO" {
+		t.Errorf("Expected HELLO, got %q (%v)", buf, err)
+	}
+}
@@ -2,56 +2,128 @@ package transport
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/darkprince558/jend/internal/signaling"
-	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/pion/ice/v2"
 )
 
-// P2PManager handles the establishment of a P2P connection via ICE & MQTT
+// candidateBatchWindow is how long we collect local candidates before publishing
+// them as one compressed batch. Short enough to keep trickle ICE responsive.
+const candidateBatchWindow = 150 * time.Millisecond
+
+// DefaultGatherTimeout caps how long relay setup (TURN credential fetch) may delay
+// the start of ICE. Override with JEND_ICE_GATHER_TIMEOUT.
+const DefaultGatherTimeout = 3 * time.Second
+
+// DefaultMaxICERestarts is how often a failed connection is renegotiated before
+// giving up. Override with JEND_ICE_MAX_RESTARTS.
+const DefaultMaxICERestarts = 3
+
+// P2PManager handles the establishment of a P2P connection via ICE & signaling
 type P2PManager struct {
-	Signaling  *signaling.IoTClient
-	Code       string
-	Agent      *ice.Agent
-	TurnConfig *CustomTurnConfig
+	Signaling signaling.Signaling
+	Code      string
+	Agent     *ice.Agent
+	ICEConfig *ICEConfig
+	// TurnAuthURL issues credentials for the default relay when ICEConfig has none.
+	TurnAuthURL string
+	// GatherTimeout bounds the slow relay setup; host/srflx checks never wait longer.
+	GatherTimeout time.Duration
+	// MaxICERestarts bounds how often a failed connection is renegotiated; 0 disables restarts.
+	MaxICERestarts int
+	// OnStatus, if set, receives progress messages such as "reconnecting".
+	OnStatus func(string)
+
+	session   *signaling.Session
+	isOfferer bool
+
+	// ICE restart state
+	restarter      restartableAgent // Agent, or a fake in tests
+	restartMu      sync.Mutex
+	restarts       int
+	remoteUfrag    string // Current remote credentials; repeats are ignored
+	awaitingRemote bool   // Restarted locally, peer's new credentials not seen yet
+	interrupted    bool
+
+	// Candidate types seen on each side, for the attempt report
+	typesMu     sync.Mutex
+	localTypes  map[string]bool
+	remoteTypes map[string]bool
+}
+
+// restartableAgent is the part of the ICE agent a restart uses.
+type restartableAgent interface {
+	Restart(ufrag, pwd string) error
+	GetLocalUserCredentials() (ufrag, pwd string, err error)
+	SetRemoteCredentials(ufrag, pwd string) error
+	GatherCandidates() error
 }
 
 // NewP2PManager creates a manager for a specific transfer session
-func NewP2PManager(sig *signaling.IoTClient, code string, turnCfg *CustomTurnConfig) *P2PManager {
+func NewP2PManager(sig signaling.Signaling, code string, iceCfg *ICEConfig) *P2PManager {
+	gatherTimeout := DefaultGatherTimeout
+	if d, err := time.ParseDuration(os.Getenv(EnvGatherTimeout)); err == nil && d > 0 {
+		gatherTimeout = d
+	}
+	maxRestarts := DefaultMaxICERestarts
+	if n, err := strconv.Atoi(os.Getenv(EnvMaxRestarts)); err == nil && n >= 0 {
+		maxRestarts = n
+	}
 	return &P2PManager{
-		Signaling:  sig,
-		Code:       code,
-		TurnConfig: turnCfg,
+		Signaling:      sig,
+		Code:           code,
+		ICEConfig:      iceCfg,
+		TurnAuthURL:    TurnAuthURL(),
+		GatherTimeout:  gatherTimeout,
+		MaxICERestarts: maxRestarts,
 	}
 }
 
 // EstablishConnection performs the ICE handshake to setup a P2P connection.
 // It acts as the Offerer if isOfferer is true (Receiver role), otherwise as Answerer (Sender role).
+// Signaling must stay connected while the returned conn is in use: if the ICE
+// connection fails later, both sides renegotiate over the same topic (see MaxICERestarts).
 func (m *P2PManager) EstablishConnection(ctx context.Context, isOfferer bool) (net.PacketConn, error) {
 	// 1. Create ICE Agent
-	agent, err := NewICEAgent(ctx, isOfferer, m.TurnConfig) // Defined in ice.go
+	// Relay credentials are the slow part; don't let them hold up a direct connection.
+	relayCtx, cancelRelay := context.WithTimeout(ctx, m.GatherTimeout)
+	agent, err := NewICEAgent(relayCtx, isOfferer, m.ICEConfig, m.TurnAuthURL, m.status) // Defined in ice.go
+	cancelRelay()
 	if err != nil {
 		return nil, err
 	}
 	m.Agent = agent
+	m.restarter = agent
 
-	// 2. Setup Signaling Topic
-	topic := fmt.Sprintf("jend/signal/%s", m.Code)
+	// 2. Setup Signaling Topic and key, both derived from the code
+	session, err := signaling.NewSession(m.Code)
+	if err != nil {
+		agent.Close()
+		return nil, err
+	}
+	m.session, m.isOfferer = session, isOfferer
 
 	// Channels for signaling flow
-	remoteCandidates := make(chan string, 10)
+	// Buffered generously: candidates can arrive before we are ready to add them,
+	// and a full channel would stall the MQTT callback.
+	remoteCandidates := make(chan string, 64)
 	remoteUfrag := make(chan string, 1)
 	remotePwd := make(chan string, 1)
 
 	// 3. Subscribe to Signaling
-	err = m.Signaling.Subscribe(topic, func(client mqtt.Client, msg mqtt.Message) {
-		var sigMsg signaling.SignalMessage
-		if err := json.Unmarshal(msg.Payload(), &sigMsg); err != nil {
-			fmt.Printf("Invalid signal msg: %v\n", err)
-			return
+	// Messages that fail authentication (forged, or from another code) are dropped.
+	err = m.Signaling.Subscribe(session.Topic, func(payload []byte) {
+		sigMsg, err := session.Open(payload)
+		if err != nil {
+			return // Anyone can publish here, so this isn't worth a word on screen
 		}
 
 		// Filter own messages (simple logic: check type vs role)
@@ -62,10 +134,19 @@ func (m *P2PManager) EstablishConnection(ctx context.Context, isOfferer bool) (n
 			return
 		}
 
-		if sigMsg.Candidate != "" {
-			remoteCandidates <- sigMsg.Candidate
+		cands, err := sigMsg.Candidates()
+		if err != nil {
+			m.status(fmt.Sprintf("Invalid signal message from the peer: %v", err))
+		}
+		if sigMsg.Restart {
+			// Handled before this message's successors are queued, so the new
+			// generation's candidates are never wiped by our own restart
+			m.remoteRestart(sigMsg.Ufrag, sigMsg.Pwd)
 		}
-		if sigMsg.Ufrag != "" {
+		for _, c := range cands {
+			remoteCandidates <- c
+		}
+		if sigMsg.Ufrag != "" && !sigMsg.Restart {
 			select {
 			case remoteUfrag <- sigMsg.Ufrag:
 			default:
@@ -79,29 +160,75 @@ func (m *P2PManager) EstablishConnection(ctx context.Context, isOfferer bool) (n
 		}
 	})
 	if err != nil {
-		return nil, fmt.Errorf("mqtt subscribe failed: %w", err)
+		return nil, fmt.Errorf("signaling subscribe failed: %w", err)
 	}
 
+	// 3b. Add remote candidates as soon as they arrive (trickle ICE).
+	// Checks start on the first host/srflx pair instead of waiting for the peer's
+	// relay allocation; pion adds candidates received before the remote credentials.
+	go func() {
+		for {
+			select {
+			case c := <-remoteCandidates:
+				candidate, err := ice.UnmarshalCandidate(c)
+				if err == nil {
+					m.noteType(false, candidate)
+					agent.AddRemoteCandidate(candidate)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
 	// 4. OnCandidate: Send to peer
-	agent.OnCandidate(func(c ice.Candidate) {
-		if c == nil {
+	// Candidates are batched for a short window and sent as one compressed message,
+	// which saves IoT message quota compared to one publish per candidate.
+	var (
+		pendingMu  sync.Mutex
+		pending    []string
+		flushTimer *time.Timer
+	)
+	flush := func() {
+		pendingMu.Lock()
+		batch := pending
+		pending = nil
+		flushTimer = nil
+		pendingMu.Unlock()
+
+		if len(batch) == 0 {
 			return
 		}
-		msg := signaling.SignalMessage{
-			Type:      signaling.TypeCandidate,
-			Candidate: c.Marshal(),
-		}
-		if isOfferer {
-			msg.Type = signaling.TypeOffer
+		msg := signaling.SignalMessage{Type: m.ownType()}
+		if len(batch) == 1 {
+			msg.Candidate = batch[0] // Not worth the gzip header
+		} else if encoded, err := signaling.EncodeCandidateBatch(batch); err == nil {
+			msg.Batch = encoded
 		} else {
-			msg.Type = signaling.TypeAnswer
+			m.status(fmt.Sprintf("Failed to encode candidates: %v", err))
+			return
 		}
 
-		payload, _ := json.Marshal(msg)
-		m.Signaling.Publish(topic, payload)
+		m.publish(msg)
+	}
+	agent.OnCandidate(func(c ice.Candidate) {
+		if c == nil {
+			// Gathering finished: send whatever is left right away
+			flush()
+			return
+		}
+		m.noteType(true, c)
+		pendingMu.Lock()
+		pending = append(pending, c.Marshal())
+		if flushTimer == nil {
+			flushTimer = time.AfterFunc(candidateBatchWindow, flush)
+		}
+		pendingMu.Unlock()
 	})
 
 	// 5. Gather Candidates
+	// Non-blocking: host candidates trickle out first, relay ones whenever the
+	// TURN allocation completes.
 	if err := agent.GatherCandidates(); err != nil {
 		return nil, err
 	}
@@ -109,20 +236,14 @@ func (m *P2PManager) EstablishConnection(ctx context.Context, isOfferer bool) (n
 	// 6. Send Initial Credentials (Offer/Answer)
 	ufrag, pwd, _ := agent.GetLocalUserCredentials()
 	initMsg := signaling.SignalMessage{
+		Type:  m.ownType(),
 		Ufrag: ufrag,
 		Pwd:   pwd,
 	}
-	if isOfferer {
-		initMsg.Type = signaling.TypeOffer
-	} else {
-		// Answerer (Sender) waits for Offer first.
-		initMsg.Type = signaling.TypeAnswer
-	}
 
-	// If Offerer, send immediately. If Answerer, wait for Offer.
+	// If Offerer, send immediately. If Answerer (Sender), wait for Offer.
 	if isOfferer {
-		payload, _ := json.Marshal(initMsg)
-		m.Signaling.Publish(topic, payload)
+		m.publish(initMsg)
 	}
 
 	// 7. Wait for Remote Credentials
@@ -135,10 +256,12 @@ func (m *P2PManager) EstablishConnection(ctx context.Context, isOfferer bool) (n
 
 		if !isOfferer {
 			// Answerer: Now send our credentials
-			payload, _ := json.Marshal(initMsg)
-			m.Signaling.Publish(topic, payload)
+			m.publish(initMsg)
 		}
 		// Set Remote
+		m.restartMu.Lock()
+		m.remoteUfrag = u
+		m.restartMu.Unlock()
 		if err := agent.SetRemoteCredentials(u, p); err != nil {
 			return nil, err
 		}
@@ -146,20 +269,9 @@ func (m *P2PManager) EstablishConnection(ctx context.Context, isOfferer bool) (n
 		return nil, ctx.Err()
 	}
 
-	// 8. Add Candidates
-	go func() {
-		for {
-			select {
-			case c := <-remoteCandidates:
-				candidate, err := ice.UnmarshalCandidate(c)
-				if err == nil {
-					agent.AddRemoteCandidate(candidate)
-				}
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
+	// 8. Watch for failures: a dropped connection is renegotiated rather than
+	// left to time out (flaky mobile networks, NAT rebinding)
+	agent.OnConnectionStateChange(m.onConnectionState)
 
 	// 9. Start Connectivity Checks
 	// Agent automatically starts when remote candidates interacting
@@ -177,11 +289,201 @@ func (m *P2PManager) EstablishConnection(ctx context.Context, isOfferer bool) (n
 	return &IcePacketConn{Conn: conn}, nil
 }
 
+func (m *P2PManager) ownType() signaling.MessageType {
+	if m.isOfferer {
+		return signaling.TypeOffer
+	}
+	return signaling.TypeAnswer
+}
+
+func (m *P2PManager) publish(msg signaling.SignalMessage) {
+	payload, err := m.session.Seal(msg)
+	if err != nil {
+		return
+	}
+	m.Signaling.Publish(m.session.Topic, payload)
+}
+
+func (m *P2PManager) status(s string) {
+	if m.OnStatus != nil {
+		m.OnStatus(s)
+	}
+}
+
+func (m *P2PManager) onConnectionState(state ice.ConnectionState) {
+	switch state {
+	case ice.ConnectionStateDisconnected:
+		m.restartMu.Lock()
+		m.interrupted = true
+		m.restartMu.Unlock()
+		m.status("P2P connection interrupted, reconnecting...")
+	case ice.ConnectionStateFailed:
+		// Restart touches the agent, which must not happen on its callback goroutine
+		go m.localRestart()
+	case ice.ConnectionStateConnected:
+		m.restartMu.Lock()
+		restored := m.interrupted
+		m.interrupted = false
+		m.restartMu.Unlock()
+		if restored {
+			m.status("P2P connection restored")
+		}
+	}
+}
+
+// localRestart renegotiates after our agent declared the connection failed.
+func (m *P2PManager) localRestart() {
+	m.restartMu.Lock()
+	m.interrupted = true
+	announce, err := m.restartLocked()
+	m.restartMu.Unlock()
+	if err == nil {
+		err = announce()
+	}
+	if err != nil {
+		m.status(fmt.Sprintf("P2P connection failed: %v", err))
+	}
+}
+
+// remoteRestart applies the peer's new ICE credentials, restarting our side too
+// unless we already did. It runs on the MQTT callback, so publishing (which waits
+// for the broker's ack) happens on its own goroutine.
+func (m *P2PManager) remoteRestart(ufrag, pwd string) {
+	m.restartMu.Lock()
+	defer m.restartMu.Unlock()
+	if m.remoteUfrag == "" || ufrag == m.remoteUfrag {
+		// Before the first exchange, or a duplicate delivery
+		return
+	}
+	if !m.awaitingRemote {
+		announce, err := m.restartLocked()
+		if err != nil {
+			m.status(fmt.Sprintf("P2P reconnect failed: %v", err))
+			return
+		}
+		go func() {
+			if err := announce(); err != nil {
+				m.status(fmt.Sprintf("P2P reconnect failed: %v", err))
+			}
+		}()
+	}
+	m.awaitingRemote = false
+	m.remoteUfrag = ufrag
+	if err := m.restarter.SetRemoteCredentials(ufrag, pwd); err != nil {
+		m.status(fmt.Sprintf("P2P reconnect failed: %v", err))
+	}
+}
+
+// restartLocked starts a new ICE generation with fresh credentials. The returned
+// announce sends them to the peer and gathers new candidates. The caller holds restartMu.
+func (m *P2PManager) restartLocked() (announce func() error, err error) {
+	if m.restarts >= m.MaxICERestarts {
+		return nil, fmt.Errorf("gave up after %d ICE restarts", m.restarts)
+	}
+	m.restarts++
+	m.status(fmt.Sprintf("P2P connection lost, reconnecting (ICE restart %d/%d)...", m.restarts, m.MaxICERestarts))
+
+	if err := m.restarter.Restart("", ""); err != nil {
+		return nil, fmt.Errorf("ice restart: %w", err)
+	}
+	ufrag, pwd, err := m.restarter.GetLocalUserCredentials()
+	if err != nil {
+		return nil, err
+	}
+	m.awaitingRemote = true
+	return func() error {
+		// Credentials go out before any new candidate, so the peer restarts
+		// before it sees them
+		m.publish(signaling.SignalMessage{Type: m.ownType(), Ufrag: ufrag, Pwd: pwd, Restart: true})
+		return m.restarter.GatherCandidates()
+	}, nil
+}
+
+func (m *P2PManager) noteType(local bool, c ice.Candidate) {
+	m.typesMu.Lock()
+	defer m.typesMu.Unlock()
+	if m.localTypes == nil {
+		m.localTypes = make(map[string]bool)
+		m.remoteTypes = make(map[string]bool)
+	}
+	if local {
+		m.localTypes[c.Type().String()] = true
+	} else {
+		m.remoteTypes[c.Type().String()] = true
+	}
+}
+
+// SelectedPath describes the candidate pair ICE settled on, e.g.
+// "relay/udp4 -> srflx/udp4". Empty if no pair has been selected.
+func (m *P2PManager) SelectedPath() string {
+	if m.Agent == nil {
+		return ""
+	}
+	pair, err := m.Agent.GetSelectedCandidatePair()
+	if err != nil || pair == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s -> %s/%s",
+		pair.Local.Type(), pair.Local.NetworkType(),
+		pair.Remote.Type(), pair.Remote.NetworkType())
+}
+
+// PathType classifies the selected pair: "relay" if either side is a TURN
+// relay, "srflx" if either is reflexive (a NAT mapping learned through STUN or
+// from the peer), otherwise "host". Empty if no pair has been selected.
+func (m *P2PManager) PathType() string {
+	if m.Agent == nil {
+		return ""
+	}
+	pair, err := m.Agent.GetSelectedCandidatePair()
+	if err != nil || pair == nil {
+		return ""
+	}
+	return pathType(pair.Local.Type(), pair.Remote.Type())
+}
+
+func pathType(local, remote ice.CandidateType) string {
+	switch {
+	case local == ice.CandidateTypeRelay || remote == ice.CandidateTypeRelay:
+		return "relay"
+	case local == ice.CandidateTypeServerReflexive || remote == ice.CandidateTypeServerReflexive,
+		local == ice.CandidateTypePeerReflexive || remote == ice.CandidateTypePeerReflexive:
+		return "srflx"
+	default:
+		return "host"
+	}
+}
+
+// CandidateSummary lists the candidate types gathered locally and received from
+// the peer, e.g. "local host,srflx; remote host". Useful when checks fail: a
+// missing relay or srflx type points at TURN or STUN rather than the peer.
+func (m *P2PManager) CandidateSummary() string {
+	m.typesMu.Lock()
+	defer m.typesMu.Unlock()
+	return fmt.Sprintf("local %s; remote %s", joinTypes(m.localTypes), joinTypes(m.remoteTypes))
+}
+
+func joinTypes(set map[string]bool) string {
+	if len(set) == 0 {
+		return "none"
+	}
+	types := make([]string, 0, len(set))
+	for t := range set {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return strings.Join(types, ",")
+}
+
 // IcePacketConn wraps *ice.Conn to satisfy net.PacketConn.
+// The conn is bound to the selected candidate pair, so every datagram comes
+// from and goes to the peer regardless of addr; QUIC only needs a stable one.
 type IcePacketConn struct {
 	*ice.Conn
 }
 
+var _ net.PacketConn = (*IcePacketConn)(nil)
+
 func (c *IcePacketConn) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
 	n, err = c.Conn.Read(p)
 	return n, c.Conn.RemoteAddr(), err
@@ -0,0 +1,296 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/darkprince558/jend/internal/signaling"
+	"github.com/pion/ice/v2"
+)
+
+// connectLocalAgents wires two host-only agents together in-process, standing
+// in for the MQTT exchange, and returns the controlling and controlled conns.
+func connectLocalAgents(t *testing.T, ctx context.Context) (*ice.Conn, *ice.Conn) {
+	t.Helper()
+	newAgent := func() *ice.Agent {
+		a, err := ice.NewAgent(&ice.AgentConfig{
+			NetworkTypes:   []ice.NetworkType{ice.NetworkTypeUDP4},
+			CandidateTypes: []ice.CandidateType{ice.CandidateTypeHost},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { a.Close() })
+		return a
+	}
+	offerer, answerer := newAgent(), newAgent()
+
+	link := func(from, to *ice.Agent) {
+		from.OnCandidate(func(c ice.Candidate) {
+			if c != nil {
+				to.AddRemoteCandidate(c)
+			}
+		})
+		if err := from.GatherCandidates(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link(offerer, answerer)
+	link(answerer, offerer)
+
+	oUfrag, oPwd, _ := offerer.GetLocalUserCredentials()
+	aUfrag, aPwd, _ := answerer.GetLocalUserCredentials()
+
+	type result struct {
+		conn *ice.Conn
+		err  error
+	}
+	accepted := make(chan result, 1)
+	go func() {
+		c, err := answerer.Accept(ctx, oUfrag, oPwd)
+		accepted <- result{c, err}
+	}()
+	dialed, err := offerer.Dial(ctx, aUfrag, aPwd)
+	if err != nil {
+		t.Fatalf("ice dial: %v", err)
+	}
+	r := <-accepted
+	if r.err != nil {
+		t.Fatalf("ice accept: %v", r.err)
+	}
+	return dialed, r.conn
+}
+
+// TestIcePacketConnCarriesQUIC runs a QUIC session over two ICE conns wrapped
+// in IcePacketConn, as the sender and receiver do after EstablishConnection.
+func TestIcePacketConnCarriesQUIC(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	receiverConn, senderConn := connectLocalAgents(t, ctx)
+
+	tr := NewQUICTransport()
+	listener, err := tr.ListenPacket(&IcePacketConn{Conn: senderConn})
+	if err != nil {
+		t.Fatalf("Failed to listen on ICE: %v", err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept(ctx)
+		if err != nil {
+			received <- "accept: " + err.Error()
+			return
+		}
+		stream, err := conn.AcceptStream(ctx)
+		if err != nil {
+			received <- "stream: " + err.Error()
+			return
+		}
+		buf := make([]byte, 5)
+		io.ReadFull(stream, buf)
+		received <- string(buf)
+	}()
+
+	pc := &IcePacketConn{Conn: receiverConn}
+	conn, err := tr.DialPacket(pc, pc.RemoteAddr())
+	if err != nil {
+		t.Fatalf("QUIC dial over ICE failed: %v", err)
+	}
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatalf("OpenStreamSync error: %v", err)
+	}
+	stream.Write([]byte("HELLO"))
+	stream.Close()
+
+	select {
+	case got := <-received:
+		if got != "HELLO" {
+			t.Errorf("Expected HELLO, got %q", got)
+		}
+	case <-ctx.Done():
+		t.Fatal("Test timed out")
+	}
+}
+
+func TestPathType(t *testing.T) {
+	cases := []struct {
+		local, remote ice.CandidateType
+		want          string
+	}{
+		{ice.CandidateTypeHost, ice.CandidateTypeHost, "host"},
+		{ice.CandidateTypeServerReflexive, ice.CandidateTypeHost, "srflx"},
+		{ice.CandidateTypeHost, ice.CandidateTypePeerReflexive, "srflx"},
+		{ice.CandidateTypeRelay, ice.CandidateTypeServerReflexive, "relay"},
+		{ice.CandidateTypeHost, ice.CandidateTypeRelay, "relay"},
+	}
+	for _, c := range cases {
+		if got := pathType(c.local, c.remote); got != c.want {
+			t.Errorf("pathType(%s, %s) = %q, want %q", c.local, c.remote, got, c.want)
+		}
+	}
+}
+
+// fakeAgent counts restarts and hands out a new ufrag for each generation.
+type fakeAgent struct {
+	mu       sync.Mutex
+	restarts int
+	remote   []string // Remote ufrags set, in order
+}
+
+func (a *fakeAgent) Restart(ufrag, pwd string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.restarts++
+	return nil
+}
+
+func (a *fakeAgent) GetLocalUserCredentials() (string, string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return fmt.Sprintf("local-%d", a.restarts), "pwd", nil
+}
+
+func (a *fakeAgent) SetRemoteCredentials(ufrag, pwd string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.remote = append(a.remote, ufrag)
+	return nil
+}
+
+func (a *fakeAgent) GatherCandidates() error { return nil }
+
+// fakeSignaling hands every published payload to a channel.
+type fakeSignaling struct{ published chan []byte }
+
+func (s *fakeSignaling) Subscribe(string, signaling.Handler) error { return nil }
+func (s *fakeSignaling) Publish(_ string, payload []byte) error {
+	s.published <- payload
+	return nil
+}
+func (s *fakeSignaling) Disconnect() {}
+
+// newRestartManager returns a manager in the state EstablishConnection leaves
+// it in, with a fake agent and signaling, and a channel of its status lines.
+func newRestartManager(t *testing.T, maxRestarts int) (*P2PManager, *fakeAgent, *fakeSignaling, chan string) {
+	t.Helper()
+	session, err := signaling.NewSession("restart-test-code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := &fakeAgent{}
+	sig := &fakeSignaling{published: make(chan []byte, 10)}
+	statuses := make(chan string, 10)
+	m := &P2PManager{
+		Signaling:      sig,
+		MaxICERestarts: maxRestarts,
+		OnStatus:       func(s string) { statuses <- s },
+		session:        session,
+		restarter:      agent,
+		remoteUfrag:    "remote-0", // The first exchange is done
+	}
+	return m, agent, sig, statuses
+}
+
+// lastStatus drains statuses and returns the last one.
+func lastStatus(statuses chan string) string {
+	var last string
+	for {
+		select {
+		case s := <-statuses:
+			last = s
+		default:
+			return last
+		}
+	}
+}
+
+func TestLocalRestartBound(t *testing.T) {
+	m, agent, sig, statuses := newRestartManager(t, 2)
+
+	for i := 1; i <= 2; i++ {
+		m.localRestart()
+		if agent.restarts != i {
+			t.Fatalf("Restart %d: agent restarted %d times", i, agent.restarts)
+		}
+		payload := <-sig.published
+		msg, err := m.session.Open(payload)
+		if err != nil || !msg.Restart || msg.Ufrag != fmt.Sprintf("local-%d", i) {
+			t.Errorf("Restart %d announced %+v, %v", i, msg, err)
+		}
+		if got := lastStatus(statuses); !strings.Contains(got, fmt.Sprintf("ICE restart %d/2", i)) {
+			t.Errorf("Restart %d status: %q", i, got)
+		}
+	}
+
+	// The bound is reached: no third restart, and the failure is reported
+	m.localRestart()
+	if agent.restarts != 2 {
+		t.Errorf("Expected MaxICERestarts to stop at 2 restarts, got %d", agent.restarts)
+	}
+	if len(sig.published) != 0 {
+		t.Error("Announced a restart past MaxICERestarts")
+	}
+	if got := lastStatus(statuses); !strings.Contains(got, "gave up after 2 ICE restarts") {
+		t.Errorf("Expected the give-up status, got %q", got)
+	}
+}
+
+func TestLocalRestartDisabled(t *testing.T) {
+	m, agent, _, statuses := newRestartManager(t, 0)
+	m.localRestart()
+	if agent.restarts != 0 {
+		t.Errorf("Expected MaxICERestarts 0 to disable restarts, got %d", agent.restarts)
+	}
+	if got := lastStatus(statuses); !strings.Contains(got, "P2P connection failed") {
+		t.Errorf("Expected a failure status, got %q", got)
+	}
+}
+
+func TestRemoteRestart(t *testing.T) {
+	m, agent, sig, _ := newRestartManager(t, 2)
+
+	// A duplicate of the current credentials changes nothing
+	m.remoteRestart("remote-0", "pwd")
+	if agent.restarts != 0 || len(agent.remote) != 0 {
+		t.Fatalf("Duplicate credentials restarted the agent (%d) or set %v", agent.restarts, agent.remote)
+	}
+
+	// The peer restarted first: restart our side too and announce it
+	m.remoteRestart("remote-1", "pwd")
+	if agent.restarts != 1 {
+		t.Errorf("Expected the peer's restart to restart ours, got %d", agent.restarts)
+	}
+	select {
+	case payload := <-sig.published:
+		if msg, err := m.session.Open(payload); err != nil || !msg.Restart {
+			t.Errorf("Announced %+v, %v", msg, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Our restart was never announced")
+	}
+
+	// We restarted first: the peer's answer only sets its credentials
+	m.localRestart()
+	<-sig.published
+	m.remoteRestart("remote-2", "pwd")
+	if agent.restarts != 2 {
+		t.Errorf("Expected the answer to our restart not to restart again, got %d", agent.restarts)
+	}
+	if want := []string{"remote-1", "remote-2"}; !reflect.DeepEqual(agent.remote, want) {
+		t.Errorf("Remote credentials set %v, want %v", agent.remote, want)
+	}
+
+	// Past the bound, the peer's restart is refused
+	m.remoteRestart("remote-3", "pwd")
+	if agent.restarts != 2 || len(agent.remote) != 2 {
+		t.Errorf("Restarted past MaxICERestarts: %d restarts, remote %v", agent.restarts, agent.remote)
+	}
+}
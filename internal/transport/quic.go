@@ -9,6 +9,7 @@ import (
 	"encoding/pem"
 	"math/big"
 	"net"
+	"sync"
 
 	"time"
 
@@ -17,7 +18,7 @@ import (
 
 // Transport defines the interface for our networking layer
 type Transport interface {
-	Listen(port string) (QUICListener, error)
+	Listen(addr string) (QUICListener, error)
 	Dial(addr string) (*quic.Conn, error)
 	ListenPacket(conn net.PacketConn) (QUICListener, error)
 	DialPacket(conn net.PacketConn, addr net.Addr) (*quic.Conn, error)
@@ -38,25 +39,26 @@ func NewQUICTransport() *QUICTransport {
 	return &QUICTransport{}
 }
 
-// Listen starts a QUIC listener on the specified port.
-// It creates a UDP PacketConn internally.
-func (t *QUICTransport) Listen(port string) (QUICListener, error) {
-	tlsConf, err := generateTLSConfig()
+// Listen starts a QUIC listener on addr, e.g. ":9000" for every interface or
+// "192.168.1.10:9000" for one address. It creates a UDP PacketConn internally.
+// The listener accepts 0-RTT so a reconnecting receiver can skip the full TLS handshake.
+func (t *QUICTransport) Listen(addr string) (QUICListener, error) {
+	tlsConf, err := getServerTLSConfig()
 	if err != nil {
 		return nil, err
 	}
 	quicConfig := getQuicConfig()
-	return quic.ListenAddr(":"+port, tlsConf, quicConfig)
+	return quic.ListenAddrEarly(addr, tlsConf, quicConfig)
 }
 
 // ListenPacket starts a QUIC listener on an existing PacketConn (e.g. from ICE).
 func (t *QUICTransport) ListenPacket(conn net.PacketConn) (QUICListener, error) {
-	tlsConf, err := generateTLSConfig()
+	tlsConf, err := getServerTLSConfig()
 	if err != nil {
 		return nil, err
 	}
 	quicConfig := getQuicConfig()
-	return quic.Listen(conn, tlsConf, quicConfig)
+	return quic.ListenEarly(conn, tlsConf, quicConfig)
 }
 
 func getQuicConfig() *quic.Config {
@@ -64,29 +66,59 @@ func getQuicConfig() *quic.Config {
 		MaxIdleTimeout:     10 * time.Second, // Increased timeout for P2P stability
 		KeepAlivePeriod:    2 * time.Second,
 		MaxIncomingStreams: 100,
+		// Safe to accept replayable early data: the first thing on every stream is
+		// the PAKE, which is bound to a fresh sender nonce.
+		Allow0RTT: true,
 	}
 }
 
 // Dial connects to a QUIC listener.
+// Uses 0-RTT when we hold a session ticket from an earlier connection to the same sender.
 func (t *QUICTransport) Dial(addr string) (*quic.Conn, error) {
+	return t.DialContext(context.Background(), addr)
+}
+
+// DialContext is Dial with a deadline, for probing addresses that may not answer.
+func (t *QUICTransport) DialContext(ctx context.Context, addr string) (*quic.Conn, error) {
 	tlsConf := getTLSConfig()
-	return quic.DialAddr(context.Background(), addr, tlsConf, nil)
+	return quic.DialAddrEarly(ctx, addr, tlsConf, nil)
 }
 
 // DialPacket connects via an existing PacketConn (e.g. ICE).
 // The addr arg is technically unused for routing if conn is bound, but required by API.
 func (t *QUICTransport) DialPacket(conn net.PacketConn, addr net.Addr) (*quic.Conn, error) {
 	tlsConf := getTLSConfig()
-	return quic.Dial(context.Background(), conn, addr, tlsConf, nil)
+	return quic.DialEarly(context.Background(), conn, addr, tlsConf, nil)
 }
 
+// clientSessionCache holds TLS session tickets for the lifetime of the process,
+// so reconnects after a drop resume instead of redoing the full handshake.
+var clientSessionCache = tls.NewLRUClientSessionCache(32)
+
 func getTLSConfig() *tls.Config {
 	return &tls.Config{
 		InsecureSkipVerify: true, // Self-signed certs for P2P
 		NextProtos:         []string{"jend-protocol"},
+		ClientSessionCache: clientSessionCache,
 	}
 }
 
+var (
+	serverTLSOnce sync.Once
+	serverTLSConf *tls.Config
+	serverTLSErr  error
+)
+
+// getServerTLSConfig returns one TLS config per process. Sharing it (and its
+// session ticket keys) between the direct and ICE listeners lets a ticket issued
+// on one path be resumed on the other.
+func getServerTLSConfig() (*tls.Config, error) {
+	serverTLSOnce.Do(func() {
+		serverTLSConf, serverTLSErr = generateTLSConfig()
+	})
+	return serverTLSConf, serverTLSErr
+}
+
 // generateTLSConfig generates a self-signed certificate for QUIC
 func generateTLSConfig() (*tls.Config, error) {
 	key, err := rsa.GenerateKey(rand.Reader, 2048)
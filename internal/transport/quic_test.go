@@ -12,7 +12,7 @@ func TestQUICConnection(t *testing.T) {
 	port := "9999"
 
 	// Start Listener
-	listener, err := tr.Listen(port)
+	listener, err := tr.Listen(":" + port)
 	if err != nil {
 		t.Fatalf("Failed to listen: %v", err)
 	}
@@ -0,0 +1,93 @@
+package transport
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"testing"
+)
+
+// tlsEchoServer accepts TLS connections with a fresh self-signed cert and
+// returns its address and the cert's fingerprint.
+func tlsEchoServer(t *testing.T) (string, []byte) {
+	conf, err := generateTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 4)
+				if n, err := conn.Read(buf); err == nil {
+					conn.Write(buf[:n])
+				}
+			}()
+		}
+	}()
+	sum := sha256.Sum256(conf.Certificates[0].Certificate[0])
+	return ln.Addr().String(), sum[:]
+}
+
+func TestPinnedRelayDialer(t *testing.T) {
+	addr, fp := tlsEchoServer(t)
+
+	d := &pinnedRelayDialer{pins: map[string][]byte{addr: fp}}
+	conn, err := d.Dial("tcp4", addr)
+	if err != nil {
+		t.Fatalf("Expected the pinned cert to be accepted: %v", err)
+	}
+	defer conn.Close()
+	if _, ok := conn.(*tls.Conn); !ok {
+		t.Fatalf("Expected a TLS connection, got %T", conn)
+	}
+	if _, ok := conn.LocalAddr().(*net.TCPAddr); !ok {
+		t.Errorf("pion needs a TCP local address, got %T", conn.LocalAddr())
+	}
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := conn.Read(buf); err != nil || string(buf) != "ping" {
+		t.Errorf("Expected echo over TLS, got %q (%v)", buf, err)
+	}
+
+	wrong := make([]byte, sha256.Size)
+	d = &pinnedRelayDialer{pins: map[string][]byte{addr: wrong}}
+	if conn, err := d.Dial("tcp4", addr); err == nil {
+		conn.Close()
+		t.Fatal("Expected a cert that doesn't match the pin to be rejected")
+	}
+}
+
+func TestParseCertFingerprint(t *testing.T) {
+	sum := sha256.Sum256([]byte("cert"))
+	hexSum := hex.EncodeToString(sum[:])
+
+	var colons string
+	for i := 0; i < len(hexSum); i += 2 {
+		if i > 0 {
+			colons += ":"
+		}
+		colons += hexSum[i : i+2]
+	}
+	for _, s := range []string{hexSum, colons, " " + colons + "\n"} {
+		fp, err := parseCertFingerprint(s)
+		if err != nil || hex.EncodeToString(fp) != hexSum {
+			t.Errorf("parseCertFingerprint(%q) = %x, %v", s, fp, err)
+		}
+	}
+	for _, s := range []string{"", "abcd", "zz" + hexSum[2:]} {
+		if _, err := parseCertFingerprint(s); err == nil {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+}
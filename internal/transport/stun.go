@@ -0,0 +1,64 @@
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+// stunCheckTimeout bounds CheckSTUN when ctx has no earlier deadline.
+const stunCheckTimeout = 5 * time.Second
+
+// stunMagicCookie is fixed by RFC 5389; with it a reply is told apart from
+// other UDP traffic.
+const stunMagicCookie = 0x2112A442
+
+// CheckSTUN sends a STUN Binding Request to addr (host:port) over UDP and waits
+// for a success response carrying the same transaction ID. TURN servers answer
+// it too, so it checks either kind of server is reachable.
+func CheckSTUN(ctx context.Context, addr string) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(stunCheckTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	// Binding Request: type 0x0001, no attributes, cookie, 12-byte transaction ID
+	req := make([]byte, 20)
+	binary.BigEndian.PutUint16(req[0:], 0x0001)
+	binary.BigEndian.PutUint32(req[4:], stunMagicCookie)
+	if _, err := rand.Read(req[8:]); err != nil {
+		return err
+	}
+	if _, err := conn.WriteToUDP(req, udpAddr); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return fmt.Errorf("no response from %s: %w", addr, err)
+		}
+		if n < 20 || binary.BigEndian.Uint32(buf[4:]) != stunMagicCookie || string(buf[8:20]) != string(req[8:20]) {
+			continue // Not our reply
+		}
+		if t := binary.BigEndian.Uint16(buf[0:]); t != 0x0101 {
+			return fmt.Errorf("%s answered with STUN message type %#04x, not a binding success", addr, t)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,60 @@
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeSTUN answers every request with noise first, then a reply of type respType
+// carrying the request's transaction ID.
+func fakeSTUN(t *testing.T, respType uint16) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < 20 {
+				continue
+			}
+			pc.WriteTo([]byte("not stun"), addr)
+			resp := make([]byte, 20)
+			binary.BigEndian.PutUint16(resp[0:], respType)
+			copy(resp[4:20], buf[4:20]) // Cookie and transaction ID
+			pc.WriteTo(resp, addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestCheckSTUN(t *testing.T) {
+	if err := CheckSTUN(context.Background(), fakeSTUN(t, 0x0101)); err != nil {
+		t.Errorf("binding success: %v", err)
+	}
+	if err := CheckSTUN(context.Background(), fakeSTUN(t, 0x0111)); err == nil {
+		t.Error("binding error response should fail")
+	}
+
+	// Nobody listening: fails by the context deadline, not the 5s default
+	pc, _ := net.ListenPacket("udp", "127.0.0.1:0")
+	addr := pc.LocalAddr().String()
+	pc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := CheckSTUN(ctx, addr); err == nil {
+		t.Error("silent server should fail")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("deadline ignored, took %v", time.Since(start))
+	}
+}
@@ -12,7 +12,16 @@ import (
 	"github.com/darkprince558/jend/pkg/protocol"
 )
 
-const ChunkSize = 1024 // 1KB chunks for testing
+// ChunkSize is StartSender's default chunk size: small, so tests exercise many chunks.
+const ChunkSize = 1024
+
+// DefaultAckWindow is how many chunks StartSender keeps in flight before it
+// waits for an ACK. Stop-and-wait (1) caps throughput at one chunk per RTT.
+const DefaultAckWindow = 16
+
+// The TCP transport below is the original prototype: a plain, unencrypted
+// file transfer over one connection. jend itself sends over QUIC (quic.go);
+// nothing in cmd/jend uses StartSender or StartReceiver.
 
 // Metadata represents the initial handshake payload
 type Metadata struct {
@@ -40,9 +49,14 @@ func StartReceiver(port string) {
 		fmt.Println("Listen error:", err)
 		return
 	}
-	defer listener.Close()
-
 	fmt.Printf("Listening on port %s...\n", port)
+	receiveOne(listener)
+}
+
+// receiveOne accepts a single sender on listener, saves its file and closes
+// the listener.
+func receiveOne(listener net.Listener) {
+	defer listener.Close()
 
 	conn, err := listener.Accept()
 	if err != nil {
@@ -135,7 +149,30 @@ func StartReceiver(port string) {
 	}
 }
 
-func StartSender(address string, filePath string) {
+// readAck waits for the receiver's ACK of the oldest chunk in flight.
+// ACKs come back in order, one per chunk, as TCP delivered them.
+func readAck(conn net.Conn) error {
+	ackType, _, err := protocol.DecodeHeader(conn)
+	if err != nil {
+		return fmt.Errorf("Ack receive error: %v", err)
+	}
+	if ackType != protocol.TypeAck {
+		return fmt.Errorf("Error: Expected ACK, got %d", ackType)
+	}
+	return nil
+}
+
+// StartSender sends filePath to a StartReceiver at address in chunkSize chunks
+// (ChunkSize if <= 0), with up to window of them unacknowledged at a time
+// (DefaultAckWindow if <= 0).
+func StartSender(address string, filePath string, window int, chunkSize int) {
+	if window <= 0 {
+		window = DefaultAckWindow
+	}
+	if chunkSize <= 0 {
+		chunkSize = ChunkSize
+	}
+
 	file, err := os.Open(filePath)
 	if err != nil {
 		fmt.Println("File error:", err)
@@ -178,14 +215,24 @@ func StartSender(address string, filePath string) {
 	}
 
 	// 2. Start Chunk Loop
-	buffer := make([]byte, ChunkSize)
+	buffer := make([]byte, chunkSize)
 	var totalSent int64
+	inFlight := 0 // Chunks sent but not yet ACKed
 
-	fmt.Printf("Sending %s in %d byte chunks...\n", meta.Name, ChunkSize)
+	fmt.Printf("Sending %s in %d byte chunks, %d in flight...\n", meta.Name, chunkSize, window)
 
 	for {
 		n, readErr := file.Read(buffer)
 		if n > 0 {
+			// Window full: the oldest chunk must be ACKed before another goes out
+			if inFlight == window {
+				if err := readAck(conn); err != nil {
+					fmt.Println(err)
+					return
+				}
+				inFlight--
+			}
+
 			// Send Header
 			if err := protocol.EncodeHeader(conn, protocol.TypeData, uint32(n)); err != nil {
 				fmt.Println("Header send error:", err)
@@ -197,17 +244,7 @@ func StartSender(address string, filePath string) {
 				return
 			}
 
-			// Wait for ACK
-			// We expect a header of TypeAck (length 0)
-			ackType, _, err := protocol.DecodeHeader(conn)
-			if err != nil {
-				fmt.Println("Ack receive error:", err)
-				return
-			}
-			if ackType != protocol.TypeAck {
-				fmt.Println("Error: Expected ACK, got", ackType)
-				return
-			}
+			inFlight++
 
 			totalSent += int64(n)
 			fmt.Printf("\rSent: %d / %d bytes", totalSent, meta.Size)
@@ -221,5 +258,13 @@ func StartSender(address string, filePath string) {
 			return
 		}
 	}
+
+	// Everything is out; wait until the receiver has all of it
+	for ; inFlight > 0; inFlight-- {
+		if err := readAck(conn); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
 	fmt.Println("\nFile sent successfully.")
 }
@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTCPWindowedTransfer(t *testing.T) {
+	for _, chunk := range []int{0, 64 * 1024} {
+		t.Run(strconv.Itoa(chunk), func(t *testing.T) { testTCPTransfer(t, chunk) })
+	}
+}
+
+func testTCPTransfer(t *testing.T, chunkSize int) {
+	dir := t.TempDir()
+	t.Chdir(dir) // StartReceiver writes received_<name> to the working directory
+
+	data := make([]byte, 100*ChunkSize+123) // Ends on a partial chunk
+	rand.Read(data)
+	src := filepath.Join(dir, "payload.bin")
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Bound up front, so the sender can't dial before the receiver listens
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		receiveOne(l)
+	}()
+
+	StartSender("127.0.0.1:"+strconv.Itoa(port), src, 4, chunkSize)
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Receiver never finished")
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, "received_payload.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Received %d bytes, differing from the %d sent", len(got), len(data))
+	}
+}
@@ -0,0 +1,88 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/pion/ice/v2"
+	"github.com/pion/turn/v2"
+)
+
+// CheckTURN logs in to the TURN relay at uri with creds and allocates a relayed
+// address, the first thing the ICE agent does with a relay, so wrong or expired
+// credentials fail here too. A turns: relay's certificate is pinned to
+// creds.Fingerprint when set, else verified against the system roots.
+func CheckTURN(ctx context.Context, uri string, creds *TurnCredentials) error {
+	u, err := ice.ParseURL(uri)
+	if err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(u.Host, strconv.Itoa(u.Port))
+
+	var conn net.PacketConn
+	switch {
+	case u.Proto == ice.ProtoTypeUDP && u.Scheme == ice.SchemeTypeTURN:
+		conn, err = net.ListenPacket("udp4", "0.0.0.0:0")
+	case u.Proto == ice.ProtoTypeTCP:
+		var c net.Conn
+		if c, err = dialRelay(ctx, u, addr, creds.Fingerprint); err == nil {
+			conn = turn.NewSTUNConn(c)
+		}
+	default:
+		return fmt.Errorf("%s over %s can't be checked", u.Scheme, u.Proto)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	client, err := turn.NewClient(&turn.ClientConfig{
+		STUNServerAddr: addr,
+		TURNServerAddr: addr,
+		Conn:           conn,
+		Username:       creds.Username,
+		Password:       creds.Password,
+	})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if err := client.Listen(); err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, client.Close)
+	defer stop()
+
+	relayConn, err := client.Allocate()
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("allocation failed: %w", err)
+	}
+	relayConn.Close()
+	return nil
+}
+
+// dialRelay opens the TCP connection to a turn: or turns: relay at addr,
+// TLS-wrapped for turns:.
+func dialRelay(ctx context.Context, u *ice.URL, addr, fingerprint string) (net.Conn, error) {
+	if u.Scheme != ice.SchemeTypeTURNS {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", addr)
+	}
+	if fingerprint == "" {
+		d := tls.Dialer{Config: &tls.Config{ServerName: u.Host}}
+		return d.DialContext(ctx, "tcp", addr)
+	}
+	fp, err := parseCertFingerprint(fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	d := &pinnedRelayDialer{}
+	d.pin(u, fp)
+	return d.Dial("tcp", addr)
+}
@@ -0,0 +1,120 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// turnCredRefreshMargin renews credentials this long before their TTL runs out,
+	// so a relay allocation never starts with credentials about to expire.
+	turnCredRefreshMargin = 30 * time.Second
+	turnCredAttempts      = 3
+	turnCredBackoff       = 250 * time.Millisecond
+	turnCredTimeout       = 5 * time.Second
+)
+
+// turnCredCache reuses ephemeral TURN credentials across ICE agents, so a sender
+// accepting many receivers asks the auth API once per TTL instead of once per peer.
+type turnCredCache struct {
+	mu      sync.Mutex
+	url     string
+	creds   *TurnCredentials
+	expires time.Time
+
+	nowFunc func() time.Time
+	fetch   func(ctx context.Context, url string) (*TurnCredentials, error)
+}
+
+var turnCreds = &turnCredCache{nowFunc: time.Now, fetch: fetchTurnCredentials}
+
+// TurnCredentialsFrom returns ephemeral TURN credentials from the auth API at
+// url (see TurnAuthURL), from the same cache ICE agents use.
+func TurnCredentialsFrom(ctx context.Context, url string) (*TurnCredentials, error) {
+	return turnCreds.get(ctx, url)
+}
+
+// get returns cached credentials for url, or fetches fresh ones with retries.
+// Credentials without a TTL are never cached.
+func (c *turnCredCache) get(ctx context.Context, url string) (*TurnCredentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.creds != nil && c.url == url && c.nowFunc().Before(c.expires) {
+		return c.creds, nil
+	}
+
+	var lastErr error
+	backoff := turnCredBackoff
+	for attempt := 0; attempt < turnCredAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("%w (last error: %v)", ctx.Err(), lastErr)
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		creds, err := c.fetch(ctx, url)
+		if err == nil {
+			c.url, c.creds = url, creds
+			c.expires = c.nowFunc().Add(time.Duration(creds.TTL)*time.Second - turnCredRefreshMargin)
+			return creds, nil
+		}
+		lastErr = err
+		if !isTransient(err) || ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// turnAuthError is a non-2xx answer from the auth API.
+type turnAuthError struct {
+	status int
+}
+
+func (e *turnAuthError) Error() string {
+	return fmt.Sprintf("turn auth API returned status %d", e.status)
+}
+
+// isTransient reports whether retrying may help: network errors, throttling and
+// server errors do; other HTTP statuses and malformed responses don't.
+func isTransient(err error) bool {
+	var authErr *turnAuthError
+	if errors.As(err, &authErr) {
+		return authErr.status == http.StatusTooManyRequests || authErr.status >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func fetchTurnCredentials(ctx context.Context, url string) (*TurnCredentials, error) {
+	client := &http.Client{Timeout: turnCredTimeout}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &turnAuthError{status: resp.StatusCode}
+	}
+	var creds TurnCredentials
+	if err := json.NewDecoder(resp.Body).Decode(&creds); err != nil {
+		return nil, err
+	}
+	if len(creds.URIs) == 0 {
+		return nil, fmt.Errorf("turn auth API returned no relay URIs")
+	}
+	return &creds, nil
+}
@@ -0,0 +1,129 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// turnAuthServer answers with the given statuses in order, then with credentials.
+func turnAuthServer(t *testing.T, ttl int, statuses ...int) (*httptest.Server, *int32) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		if int(n) <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		json.NewEncoder(w).Encode(TurnCredentials{
+			Username: "1700000000:jend",
+			Password: "secret",
+			TTL:      ttl,
+			URIs:     []string{"turn:203.0.113.1:3478?transport=udp"},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func newTestCredCache(now *time.Time) *turnCredCache {
+	return &turnCredCache{nowFunc: func() time.Time { return *now }, fetch: fetchTurnCredentials}
+}
+
+func TestTurnCredCache_ReusesUntilNearExpiry(t *testing.T) {
+	srv, hits := turnAuthServer(t, 300)
+	now := time.Now()
+	cache := newTestCredCache(&now)
+
+	for i := 0; i < 3; i++ {
+		creds, err := cache.get(context.Background(), srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if creds.Username != "1700000000:jend" || len(creds.URIs) != 1 {
+			t.Fatalf("Unexpected creds %+v", creds)
+		}
+	}
+	if *hits != 1 {
+		t.Errorf("Expected 1 fetch for 3 agents within the TTL, got %d", *hits)
+	}
+
+	// Inside the refresh margin: fetch again rather than hand out nearly-expired creds
+	now = now.Add(300*time.Second - turnCredRefreshMargin + time.Second)
+	if _, err := cache.get(context.Background(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if *hits != 2 {
+		t.Errorf("Expected a refresh near expiry, got %d fetches", *hits)
+	}
+
+	// A different auth API never gets another stack's credentials
+	other, otherHits := turnAuthServer(t, 300)
+	cache.get(context.Background(), other.URL)
+	if *otherHits != 1 {
+		t.Error("Expected a fetch for a different auth URL")
+	}
+}
+
+func TestTurnCredCache_NoTTLIsNotCached(t *testing.T) {
+	srv, hits := turnAuthServer(t, 0)
+	now := time.Now()
+	cache := newTestCredCache(&now)
+
+	cache.get(context.Background(), srv.URL)
+	cache.get(context.Background(), srv.URL)
+	if *hits != 2 {
+		t.Errorf("Expected credentials without a TTL to be fetched every time, got %d fetches", *hits)
+	}
+}
+
+func TestTurnCredCache_Retries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		wantHits int32
+		wantErr  string
+	}{
+		{"transient then ok", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}, 3, ""},
+		{"gives up after attempts", []int{500, 502, 503, 504}, turnCredAttempts, "status 503"},
+		{"no retry on client error", []int{http.StatusForbidden}, 1, "status 403"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, hits := turnAuthServer(t, 300, tt.statuses...)
+			now := time.Now()
+			cache := newTestCredCache(&now)
+
+			_, err := cache.get(context.Background(), srv.URL)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if *hits != tt.wantHits {
+				t.Errorf("Expected %d requests, got %d", tt.wantHits, *hits)
+			}
+		})
+	}
+}
+
+func TestTurnCredCache_StopsOnContextDone(t *testing.T) {
+	srv, hits := turnAuthServer(t, 300, 503, 503, 503)
+	now := time.Now()
+	cache := newTestCredCache(&now)
+
+	ctx, cancel := context.WithTimeout(context.Background(), turnCredBackoff/2)
+	defer cancel()
+	if _, err := cache.get(ctx, srv.URL); err == nil {
+		t.Fatal("Expected an error once the context expired")
+	}
+	if *hits != 1 {
+		t.Errorf("Expected no retries after the context expired, got %d requests", *hits)
+	}
+}
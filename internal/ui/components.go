@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
+	qrcode "github.com/skip2/go-qrcode"
 )
 
 // ViewCode renders the code display block
@@ -15,6 +16,16 @@ func ViewCode(code string) string {
 	)
 }
 
+// ViewQR renders content as a QR code of Unicode half-blocks, light modules
+// drawn in the foreground colour so it scans on a dark terminal.
+func ViewQR(content string) (string, error) {
+	q, err := qrcode.New(content, qrcode.Low)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(q.ToSmallString(false), "\n"), nil
+}
+
 // ViewProgress renders a simple progress bar
 func ViewProgress(percent float64, width int) string {
 	barWidth := width - 10
@@ -0,0 +1,165 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Field is one question of a Form.
+type Field struct {
+	Label  string
+	Help   string // One line under the label
+	Value  string // Shown to start with; the answer once the Form is done
+	Secret bool   // Mask what is typed, for passwords
+
+	// Check validates a non-empty answer when Enter is pressed. It runs off the
+	// UI goroutine, so it may take a while (a network check, say); nil accepts
+	// anything.
+	Check func(string) error
+}
+
+// Form asks its Fields one at a time, like `jend config init`. An answer that
+// fails its Check can be fixed, or kept by pressing Enter again.
+type Form struct {
+	Title  string
+	Fields []Field
+	Done   bool // Every field answered; false if the user quit with Esc or Ctrl-C
+
+	current  int
+	input    textinput.Model
+	spinner  spinner.Model
+	checking bool
+	err      error
+	failed   string // The answer err is about; Enter on it again keeps it
+}
+
+// checkedMsg is the result of a Field's Check.
+type checkedMsg struct {
+	field int
+	value string
+	err   error
+}
+
+func NewForm(title string, fields []Field) Form {
+	s := spinner.New()
+	s.Spinner = spinner.Dot
+	s.Style = lipgloss.NewStyle().Foreground(ColorSecondary)
+
+	f := Form{Title: title, Fields: fields, input: textinput.New(), spinner: s}
+	f.input.Width = 56
+	f.load(0)
+	return f
+}
+
+// load shows field i in the input.
+func (f *Form) load(i int) {
+	f.current = i
+	f.err, f.failed = nil, ""
+	f.input.SetValue(f.Fields[i].Value)
+	f.input.CursorEnd()
+	f.input.EchoMode = textinput.EchoNormal
+	if f.Fields[i].Secret {
+		f.input.EchoMode = textinput.EchoPassword
+	}
+	f.input.Focus()
+}
+
+// next stores value as the current field's answer and moves on.
+func (f *Form) next(value string) tea.Cmd {
+	f.Fields[f.current].Value = value
+	if f.current == len(f.Fields)-1 {
+		f.Done = true
+		return tea.Quit
+	}
+	f.load(f.current + 1)
+	return nil
+}
+
+func (f Form) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (f Form) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.Type {
+		case tea.KeyCtrlC, tea.KeyEsc:
+			return f, tea.Quit
+		}
+		if f.checking {
+			return f, nil
+		}
+		switch msg.Type {
+		case tea.KeyEnter:
+			value := strings.TrimSpace(f.input.Value())
+			check := f.Fields[f.current].Check
+			if check == nil || value == "" || value == f.failed {
+				return f, f.next(value)
+			}
+			f.checking, f.err = true, nil
+			field := f.current
+			return f, tea.Batch(f.spinner.Tick, func() tea.Msg {
+				return checkedMsg{field: field, value: value, err: check(value)}
+			})
+		case tea.KeyShiftTab, tea.KeyUp:
+			if f.current > 0 {
+				f.Fields[f.current].Value = f.input.Value()
+				f.load(f.current - 1)
+			}
+			return f, nil
+		}
+	case checkedMsg:
+		f.checking = false
+		if msg.field != f.current {
+			return f, nil
+		}
+		if msg.err != nil {
+			f.err, f.failed = msg.err, msg.value
+			return f, nil
+		}
+		return f, f.next(msg.value)
+	case spinner.TickMsg:
+		if !f.checking {
+			return f, nil
+		}
+		var cmd tea.Cmd
+		f.spinner, cmd = f.spinner.Update(msg)
+		return f, cmd
+	}
+
+	var cmd tea.Cmd
+	f.input, cmd = f.input.Update(msg)
+	return f, cmd
+}
+
+func (f Form) View() string {
+	if f.Done {
+		return ""
+	}
+	field := f.Fields[f.current]
+	var b strings.Builder
+	b.WriteString(TitleStyle.Render(f.Title) + "\n\n")
+	b.WriteString(StatusStyle.Render(fmt.Sprintf("Step %d of %d", f.current+1, len(f.Fields))) + "\n\n")
+	b.WriteString(lipgloss.NewStyle().Foreground(ColorText).Bold(true).Render(field.Label) + "\n")
+	if field.Help != "" {
+		b.WriteString(StatusStyle.Render(field.Help) + "\n")
+	}
+	b.WriteString("\n" + f.input.View() + "\n\n")
+
+	switch {
+	case f.checking:
+		b.WriteString(f.spinner.View() + " Checking...\n")
+	case f.err != nil:
+		b.WriteString(lipgloss.NewStyle().Foreground(ColorError).Render("✘ "+f.err.Error()) + "\n")
+		b.WriteString(StatusStyle.Render("Fix it, or press Enter again to keep it anyway.") + "\n")
+	default:
+		b.WriteString("\n")
+	}
+	b.WriteString("\n" + StatusStyle.Render("Enter: next • Empty: default • Shift+Tab: back • Esc: quit without saving"))
+	return lipgloss.NewStyle().Padding(1, 2).Render(b.String())
+}
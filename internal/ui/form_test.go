@@ -0,0 +1,162 @@
+package ui
+
+import (
+	"errors"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// press sends msg to f and returns the updated form and command.
+func press(t *testing.T, f Form, msg tea.Msg) (Form, tea.Cmd) {
+	t.Helper()
+	m, cmd := f.Update(msg)
+	return m.(Form), cmd
+}
+
+// typeText replaces the current answer with s.
+func typeText(t *testing.T, f Form, s string) Form {
+	t.Helper()
+	f.input.SetValue("")
+	f, _ = press(t, f, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)})
+	return f
+}
+
+// checked runs the commands of an Enter that started a Check and returns the
+// checkedMsg among their results.
+func checked(t *testing.T, cmd tea.Cmd) checkedMsg {
+	t.Helper()
+	if cmd == nil {
+		t.Fatal("Expected a command running the check")
+	}
+	batch, ok := cmd().(tea.BatchMsg)
+	if !ok {
+		t.Fatal("Expected a batch of the spinner and the check")
+	}
+	for _, c := range batch {
+		if c == nil {
+			continue
+		}
+		if msg, ok := c().(checkedMsg); ok {
+			return msg
+		}
+	}
+	t.Fatal("No check among the commands")
+	return checkedMsg{}
+}
+
+func isQuit(cmd tea.Cmd) bool {
+	if cmd == nil {
+		return false
+	}
+	_, ok := cmd().(tea.QuitMsg)
+	return ok
+}
+
+func TestFormEnter(t *testing.T) {
+	f := NewForm("Setup", []Field{{Label: "Name", Value: "default"}, {Label: "Port"}})
+
+	f, cmd := press(t, f, tea.KeyMsg{Type: tea.KeyEnter})
+	if cmd != nil || f.current != 1 {
+		t.Fatalf("Expected Enter to move to the second field, at %d", f.current)
+	}
+	if f.Fields[0].Value != "default" {
+		t.Errorf("Expected the shown value to be kept, got %q", f.Fields[0].Value)
+	}
+
+	f = typeText(t, f, " 8080 ")
+	f, cmd = press(t, f, tea.KeyMsg{Type: tea.KeyEnter})
+	if !f.Done || !isQuit(cmd) {
+		t.Fatal("Expected Enter on the last field to finish the form")
+	}
+	if f.Fields[1].Value != "8080" {
+		t.Errorf("Expected the trimmed answer, got %q", f.Fields[1].Value)
+	}
+	if f.View() != "" {
+		t.Error("Expected a finished form to draw nothing")
+	}
+}
+
+func TestFormCheckFailure(t *testing.T) {
+	var checkedValues []string
+	f := NewForm("Setup", []Field{
+		{Label: "URL", Check: func(v string) error {
+			checkedValues = append(checkedValues, v)
+			if v == "bad" {
+				return errors.New("unreachable")
+			}
+			return nil
+		}},
+		{Label: "Next"},
+	})
+
+	f = typeText(t, f, "bad")
+	f, cmd := press(t, f, tea.KeyMsg{Type: tea.KeyEnter})
+	if !f.checking {
+		t.Fatal("Expected Enter to start the check")
+	}
+	// Keys other than Esc and Ctrl-C wait for the check
+	if f2, _ := press(t, f, tea.KeyMsg{Type: tea.KeyEnter}); f2.current != 0 || !f2.checking {
+		t.Error("Expected Enter to be ignored while checking")
+	}
+	f, _ = press(t, f, checked(t, cmd))
+	if f.checking || f.current != 0 || f.err == nil {
+		t.Fatalf("Expected the failure to keep the field, at %d (err %v)", f.current, f.err)
+	}
+
+	// Enter again on the same answer keeps it without checking again
+	f, cmd = press(t, f, tea.KeyMsg{Type: tea.KeyEnter})
+	if cmd != nil || f.current != 1 || f.Fields[0].Value != "bad" {
+		t.Fatalf("Expected the failed answer to be kept, at %d with %q", f.current, f.Fields[0].Value)
+	}
+	if len(checkedValues) != 1 {
+		t.Errorf("Expected one check, got %v", checkedValues)
+	}
+
+	// A fixed answer is checked and accepted
+	f, _ = press(t, f, tea.KeyMsg{Type: tea.KeyShiftTab})
+	f = typeText(t, f, "good")
+	f, cmd = press(t, f, tea.KeyMsg{Type: tea.KeyEnter})
+	f, _ = press(t, f, checked(t, cmd))
+	if f.current != 1 || f.Fields[0].Value != "good" || f.err != nil {
+		t.Errorf("Expected the fixed answer to pass, at %d with %q (err %v)", f.current, f.Fields[0].Value, f.err)
+	}
+
+	// A result for a field the user has left is dropped
+	f, _ = press(t, f, checkedMsg{field: 0, value: "stale", err: errors.New("late")})
+	if f.err != nil || f.Fields[0].Value != "good" {
+		t.Errorf("Expected a stale check to be ignored, got err %v", f.err)
+	}
+}
+
+func TestFormShiftTab(t *testing.T) {
+	f := NewForm("Setup", []Field{{Label: "A", Value: "a"}, {Label: "B"}})
+
+	// Nowhere to go back to from the first field
+	f, _ = press(t, f, tea.KeyMsg{Type: tea.KeyShiftTab})
+	if f.current != 0 {
+		t.Fatalf("Expected to stay on the first field, at %d", f.current)
+	}
+
+	f, _ = press(t, f, tea.KeyMsg{Type: tea.KeyEnter})
+	f = typeText(t, f, "half")
+	f, _ = press(t, f, tea.KeyMsg{Type: tea.KeyShiftTab})
+	if f.current != 0 || f.input.Value() != "a" {
+		t.Fatalf("Expected the first field's answer back, at %d with %q", f.current, f.input.Value())
+	}
+	if f.Fields[1].Value != "half" {
+		t.Errorf("Expected what was typed in the second field to be kept, got %q", f.Fields[1].Value)
+	}
+}
+
+func TestFormEsc(t *testing.T) {
+	f := NewForm("Setup", []Field{{Label: "A", Check: func(string) error { return nil }}})
+	f = typeText(t, f, "x")
+	f, _ = press(t, f, tea.KeyMsg{Type: tea.KeyEnter})
+
+	// Esc quits even while a check runs
+	f, cmd := press(t, f, tea.KeyMsg{Type: tea.KeyEsc})
+	if !isQuit(cmd) || f.Done {
+		t.Error("Expected Esc to quit without finishing the form")
+	}
+}
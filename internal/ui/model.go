@@ -30,12 +30,47 @@ const (
 // Messages
 type StatusMsg string
 type ErrorMsg error
+type AttemptsMsg string // Receiver's connection fallback chain, shown when it finishes
+type TextMsg string     // Text snippet the receiver got
+type LinkMsg string     // Sender's jend:// link, once its address is known
+
+// ConfirmMsg asks the user to accept an offer; the answer goes to Reply.
+type ConfirmMsg struct {
+	Prompt string
+	Reply  chan<- bool
+}
+
+// SummaryMsg closes a successful receive with what it took.
+type SummaryMsg struct {
+	Bytes     int64
+	Elapsed   time.Duration // From connecting to the sender to the file being saved
+	Protocol  string        // "QUIC direct", "QUIC over ICE relay", ...
+	Integrity bool          // The sender's hash was checked; false for unhashed streams
+}
+
+// String is the one-line summary, in a form scripts can scrape.
+func (s SummaryMsg) String() string {
+	integrity := "not checked"
+	if s.Integrity {
+		integrity = "passed"
+	}
+	var speed float64
+	if secs := s.Elapsed.Seconds(); secs > 0 {
+		speed = float64(s.Bytes) / secs / 1024 / 1024
+	}
+	return fmt.Sprintf("%d bytes in %s (%.2f MB/s) via %s, integrity %s",
+		s.Bytes, s.Elapsed.Round(time.Millisecond), speed, s.Protocol, integrity)
+}
+
 type ProgressMsg struct {
 	SentBytes  int64
 	TotalBytes int64
 	Speed      float64       // bytes per second
 	ETA        time.Duration // estimated time remaining
 	Protocol   string        // "Direct [LAN]" or similar
+	File       string        // File in flight, for a directory or multi-file send
+	FileIndex  int           // 1-based position of File
+	FileCount  int           // 0 for a single file
 }
 
 type Model struct {
@@ -43,6 +78,8 @@ type Model struct {
 	State         State
 	Filename      string
 	Code          string
+	QR            string // Rendered QR code shown under the code; empty to hide
+	Link          string // jend:// link with the sender's address
 	Address       string
 	Spinner       spinner.Model
 	TotalProgress progress.Model
@@ -50,8 +87,13 @@ type Model struct {
 	Speed         string
 	ETA           string
 	Protocol      string
+	CurrentFile   string // "3/10 dir/name.txt"; empty for a single file
 	Status        string
 	Err           error
+	Attempts      string
+	Summary       string
+	Confirm       *ConfirmMsg // Pending y/n question
+	Declined      bool        // The user said no; the receiver is telling the sender
 	Exit          bool
 }
 
@@ -95,6 +137,21 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.Exit = true
 			return m, tea.Quit
 		}
+		if m.Confirm != nil {
+			switch msg.String() {
+			case "y", "Y":
+				m.Confirm.Reply <- true
+				m.Confirm = nil
+			case "n", "N":
+				m.Confirm.Reply <- false
+				m.Confirm = nil
+				m.Declined = true
+				return m, tea.Quit
+			}
+		}
+
+	case ConfirmMsg:
+		m.Confirm = &msg
 
 	case spinner.TickMsg:
 		var cmd tea.Cmd
@@ -109,6 +166,15 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.FileProgress = newFile.(progress.Model)
 		return m, tea.Batch(cmdTotal, cmdFile)
 
+	case LinkMsg:
+		m.Link = string(msg)
+		if m.QR != "" {
+			// Put the address hints in the QR code too
+			if qr, err := ViewQR(m.Link); err == nil {
+				m.QR = qr
+			}
+		}
+
 	case StatusMsg:
 		m.Status = string(msg)
 		if m.State == StateStart {
@@ -117,11 +183,21 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case ProgressMsg:
 		m.State = StateTransferring
+
+		// Unknown size (live stream): nothing to fill, just telemetry
+		if msg.TotalBytes <= 0 {
+			m.Speed = fmt.Sprintf("%.2f MB/s", msg.Speed/1024/1024)
+			m.ETA = "live"
+			m.Protocol = msg.Protocol
+			return m, nil
+		}
+
 		ratio := float64(msg.SentBytes) / float64(msg.TotalBytes)
 
 		if ratio >= 1.0 {
+			// The receiver still checks and saves the file; SummaryMsg follows
 			m.State = StateDone
-			return m, tea.Quit
+			return m, nil
 		}
 
 		cmdTotal := m.TotalProgress.SetPercent(ratio)
@@ -131,9 +207,21 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.Speed = fmt.Sprintf("%.2f MB/s", msg.Speed/1024/1024)
 		m.ETA = msg.ETA.Round(time.Second).String()
 		m.Protocol = msg.Protocol
+		m.CurrentFile = ""
+		if msg.FileCount > 0 {
+			m.CurrentFile = fmt.Sprintf("%d/%d %s", msg.FileIndex, msg.FileCount, msg.File)
+		}
 
 		return m, tea.Batch(cmdTotal, cmdFile)
 
+	case SummaryMsg:
+		m.State = StateDone
+		m.Summary = msg.String()
+		return m, tea.Quit
+
+	case AttemptsMsg:
+		m.Attempts = string(msg)
+
 	case ErrorMsg:
 		m.State = StateError
 		m.Err = msg
@@ -149,6 +237,7 @@ func (m Model) View() string {
 			lipgloss.JoinVertical(lipgloss.Center,
 				ErrorStyle.Render("ERROR"),
 				lipgloss.NewStyle().Foreground(ColorError).Padding(1).Render(fmt.Sprintf("%v", m.Err)),
+				StatusStyle.Render(m.Attempts),
 			),
 		)
 	}
@@ -163,6 +252,12 @@ func (m Model) View() string {
 		info := ""
 		if m.Role == RoleSender {
 			info = ViewCode(m.Code)
+			if m.Link != "" {
+				info = lipgloss.JoinVertical(lipgloss.Center, info, StatusStyle.Render(m.Link))
+			}
+			if m.QR != "" {
+				info = lipgloss.JoinVertical(lipgloss.Center, info, "", m.QR)
+			}
 		} else {
 			info = MatrixTextStyle.Render(">> ESTABLISHING SECURE CONNECTION <<\n>> WAITING FOR PEER... <<")
 		}
@@ -173,6 +268,12 @@ func (m Model) View() string {
 			" ",
 			StatusStyle.Render(m.Status),
 		)
+		if m.Confirm != nil {
+			statusLine = lipgloss.JoinVertical(lipgloss.Center,
+				lipgloss.NewStyle().Foreground(ColorText).Render(m.Confirm.Prompt),
+				StatusStyle.Render("[y/n]"),
+			)
+		}
 
 		content = lipgloss.JoinVertical(lipgloss.Center,
 			header,
@@ -208,6 +309,13 @@ func (m Model) View() string {
 			" ", // spacer
 			lipgloss.JoinHorizontal(lipgloss.Bottom, StatLabelStyle.Render("FILE "), m.FileProgress.View()),
 		)
+		if m.CurrentFile != "" {
+			bars = lipgloss.JoinVertical(lipgloss.Left,
+				bars,
+				" ",
+				lipgloss.JoinHorizontal(lipgloss.Bottom, StatLabelStyle.Render("NOW  "), StatValueStyle.Render(m.CurrentFile)),
+			)
+		}
 
 		content = lipgloss.JoinVertical(lipgloss.Center,
 			header,
@@ -229,6 +337,9 @@ func (m Model) View() string {
 			header,
 			"\n",
 			check+" "+msg,
+			StatusStyle.Render(m.Summary),
+			"\n",
+			StatusStyle.Render(m.Attempts),
 		)
 	}
 
@@ -0,0 +1,371 @@
+// Package jend embeds JEND transfers in other Go programs. Send and Receive run
+// the same code as the CLI, but report through a channel of Events instead of
+// a terminal UI.
+package jend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/darkprince558/jend/internal/core"
+	"github.com/darkprince558/jend/internal/discovery"
+	"github.com/darkprince558/jend/internal/identity"
+	"github.com/darkprince558/jend/internal/transport"
+	"github.com/darkprince558/jend/internal/ui"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// EventKind says which fields of an Event are set.
+type EventKind int
+
+const (
+	EventCode     EventKind = iota // Message: the code the receiver needs (Send only, always first)
+	EventStatus                    // Message: human-readable status line
+	EventProgress                  // Progress
+	EventText                      // Message: the text snippet received
+	EventError                     // Err: the transfer failed
+	EventDone                      // Last event; Err is nil on success
+)
+
+// Progress is a transfer's position; TotalBytes is -1 for live streams.
+type Progress struct {
+	SentBytes  int64
+	TotalBytes int64
+	Speed      float64 // Bytes per second
+	ETA        time.Duration
+	Protocol   string // How the bytes travel, e.g. "QUIC (Direct)"
+	// For a directory or several files: the one in flight, its 1-based
+	// index, and how many there are. FileCount is 0 for a single file.
+	File      string
+	FileIndex int
+	FileCount int
+}
+
+// Event is one thing a transfer has to report.
+type Event struct {
+	Kind     EventKind
+	Message  string
+	Progress Progress
+	Err      error
+}
+
+// Relay points ICE at your own TURN server instead of JEND's.
+type Relay struct {
+	URL      string // e.g. "turn:relay.example.com:3478"
+	Username string
+	Password string
+}
+
+// SendOptions configures Send. Exactly one of Paths and Text must be set.
+type SendOptions struct {
+	Paths []string // Files (several are sent in one session) or one directory, archived as .tar.gz
+	Text  string   // Text snippet, instead of files
+	Code  string   // Generated when empty; a chosen one must pass core.ValidateCode
+	Words int      // Words in a generated code (default 3, see core.CodeEntropy)
+
+	Timeout          time.Duration // How long to wait for a receiver (default 10m)
+	MaxDuration      time.Duration // Abort a transfer still running after this long (0 = no limit)
+	Zip              bool          // Archive directories as .zip instead of .tar.gz
+	FollowSymlinks   bool          // Archive what symlinks point to instead of the links
+	Exclude          []string      // Globs left out of a directory, as with send --exclude (see core.CompressOptions)
+	RespectGitignore bool          // Also leave out .git and what the directory's .gitignore files ignore
+	Reproducible     bool          // Same files, same archive bytes: fixed mtimes, owners and permissions
+	Follow           bool          // Stream a growing file until ctx is cancelled
+	ChunkSize        int           // Data frame size (default core.ChunkSize)
+	NoHistory        bool          // Don't write the transfer to the audit log
+	Rate             int64         // Bandwidth cap in bytes/sec (0 = unlimited)
+	DryRun           bool          // Report name, size and hash as status events, then stop without listening
+	Port             int           // UDP port for direct connections (default 9000, -1 = any free port)
+	Bind             string        // Listen on and advertise only this IP (default: every interface)
+	Once             bool          // Stop after the first complete transfer instead of serving more receivers
+	NoTCP            bool          // Don't also listen on TCP for receivers whose network blocks UDP
+
+	// Cipher is the stream cipher asked for: "auto" (the default), "aes-gcm"
+	// or "chacha20". KDFTime and KDFMemory (in KiB) set the Argon2id cost of
+	// the code check, advertised to receivers; either left 0 keeps its
+	// default, with memory sized to what the host can spare as the CLI does
+	// (see core.AutoArgonParams).
+	Cipher    string
+	KDFTime   uint32
+	KDFMemory uint32
+	// Allow only sends to receivers with these key fingerprints, as shown by
+	// `jend identity`; empty lets anyone who knows the code in.
+	Allow []string
+
+	LANOnly     bool     // mDNS and direct connections only
+	STUNServers []string // Replace the default STUN server
+	Relay       *Relay
+}
+
+// ReceiveOptions configures Receive.
+type ReceiveOptions struct {
+	Code       string // The code, or a jend:// link with the sender's address
+	OutputDir  string // Default "."
+	Output     string // File name to save as instead of the sender's
+	Force      bool   // Overwrite existing files instead of adding " (N)"
+	NoPreserve bool   // Don't restore the sender's permissions and modtime
+	Unzip      bool   // Extract received archives
+	Clipboard  bool   // Copy received text to the clipboard
+	NoHistory  bool
+	Fresh      bool // Discard partial downloads instead of resuming
+	Delta      bool // Fetch only the changes when an older version of the file is in OutputDir
+	Hardlink   bool // Save files the sender marked as duplicates as hard links instead of copies
+
+	Concurrency       int   // Parallel streams for large files (default 4)
+	ParallelThreshold int64 // Files larger than this use Concurrency streams (default 100MB)
+	MaxAttempts       int   // Consecutive failed dials before giving up (default 10)
+	Rate              int64 // Bandwidth cap in bytes/sec (0 = unlimited)
+	MaxSize           int64 // Refuse offers larger than this (default core.DefaultMaxSize, -1 = no limit)
+	TextLimit         int64 // Refuse text snippets larger than this (default core.DefaultTextLimit, -1 = no limit)
+
+	Cipher string // "auto" (the default), "aes-gcm" or "chacha20"
+	// ExpectSender only accepts a sender whose key has this fingerprint, as
+	// shown by `jend identity`; empty accepts any sender that knows the code.
+	ExpectSender string
+
+	LANOnly     bool
+	PreferIPv4  bool
+	PreferIPv6  bool
+	STUNServers []string
+	Relay       *Relay
+}
+
+// Send offers files or text until a receiver has them, the timeout passes or
+// ctx is cancelled. The channel closes after EventDone and must be drained:
+// the transfer blocks while it is full.
+func Send(ctx context.Context, opts SendOptions) (<-chan Event, error) {
+	isText := opts.Text != ""
+	if isText == (len(opts.Paths) > 0) {
+		return nil, errors.New("jend: set exactly one of Paths and Text")
+	}
+	if opts.Words == 0 {
+		opts.Words = core.DefaultCodeWords
+	}
+	if opts.Words < core.MinCodeWords || opts.Words > core.MaxCodeWords {
+		return nil, fmt.Errorf("jend: Words must be between %d and %d", core.MinCodeWords, core.MaxCodeWords)
+	}
+	if opts.Code == "" {
+		opts.Code = core.GenerateCode(opts.Words)
+	} else if err := core.ValidateCode(opts.Code); err != nil {
+		return nil, fmt.Errorf("jend: %w", err)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Minute
+	}
+	if opts.ChunkSize == 0 {
+		opts.ChunkSize = core.ChunkSize
+	}
+	switch {
+	case opts.Port == 0:
+		opts.Port = core.DefaultPort
+	case opts.Port < 0:
+		opts.Port = 0 // Let the OS pick
+	case opts.Port > 65535:
+		return nil, fmt.Errorf("jend: port %d out of range", opts.Port)
+	}
+	if opts.Bind != "" && net.ParseIP(opts.Bind) == nil {
+		return nil, fmt.Errorf("jend: bind address %q is not an IP address", opts.Bind)
+	}
+	if opts.ChunkSize < core.MinChunkSize || opts.ChunkSize > core.MaxChunkSize {
+		return nil, fmt.Errorf("jend: chunk size %d out of range (%d to %d)", opts.ChunkSize, core.MinChunkSize, core.MaxChunkSize)
+	}
+	cipher, err := core.ParseCipher(opts.Cipher)
+	if err != nil {
+		return nil, fmt.Errorf("jend: %w", err)
+	}
+	for _, fp := range opts.Allow {
+		if _, err := identity.ParseFingerprint(fp); err != nil {
+			return nil, fmt.Errorf("jend: %w", err)
+		}
+	}
+	argon, err := argonParams(opts.KDFTime, opts.KDFMemory)
+	if err != nil {
+		return nil, fmt.Errorf("jend: %w", err)
+	}
+
+	n := newNotifier()
+	n.events <- Event{Kind: EventCode, Message: opts.Code}
+	go func() {
+		err := core.RunSender(ctx, n, core.SendOptions{
+			Paths:       opts.Paths,
+			Text:        opts.Text,
+			IsText:      isText,
+			Code:        opts.Code,
+			Timeout:     opts.Timeout,
+			MaxDuration: opts.MaxDuration,
+			ForceZip:    opts.Zip,
+			Compress: core.CompressOptions{
+				Level:            core.DefaultCompressOptions.Level,
+				FollowSymlinks:   opts.FollowSymlinks,
+				Exclude:          opts.Exclude,
+				RespectGitignore: opts.RespectGitignore,
+				Reproducible:     opts.Reproducible,
+			},
+			Follow:    opts.Follow,
+			ChunkSize: opts.ChunkSize,
+			NoHistory: opts.NoHistory,
+			Rate:      opts.Rate,
+			DryRun:    opts.DryRun,
+			Port:      opts.Port,
+			Bind:      opts.Bind,
+			NoTCP:     opts.NoTCP,
+			Once:      opts.Once,
+			ICE:       iceConfig(opts.STUNServers, opts.Relay),
+			LANOnly:   opts.LANOnly,
+			Argon:     argon,
+			Cipher:    cipher,
+			Allow:     opts.Allow,
+		})
+		n.done(err)
+	}()
+	return n.events, nil
+}
+
+// Receive fetches what the sender with opts.Code offers. The channel closes
+// after EventDone and must be drained.
+func Receive(ctx context.Context, opts ReceiveOptions) (<-chan Event, error) {
+	if opts.Code == "" {
+		return nil, errors.New("jend: Code is required")
+	}
+	link, err := discovery.ParseLink(opts.Code)
+	if err != nil {
+		return nil, fmt.Errorf("jend: %w", err)
+	}
+	if opts.PreferIPv4 && opts.PreferIPv6 {
+		return nil, errors.New("jend: PreferIPv4 and PreferIPv6 are mutually exclusive")
+	}
+	if opts.OutputDir == "" {
+		opts.OutputDir = "."
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	if opts.ParallelThreshold <= 0 {
+		opts.ParallelThreshold = core.DefaultParallelThreshold
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 10
+	}
+	switch {
+	case opts.MaxSize == 0:
+		opts.MaxSize = core.DefaultMaxSize
+	case opts.MaxSize < 0:
+		opts.MaxSize = 0
+	}
+	switch {
+	case opts.TextLimit == 0:
+		opts.TextLimit = core.DefaultTextLimit
+	case opts.TextLimit < 0:
+		opts.TextLimit = 0
+	}
+	cipher, err := core.ParseCipher(opts.Cipher)
+	if err != nil {
+		return nil, fmt.Errorf("jend: %w", err)
+	}
+	ipPref := discovery.PreferAny
+	switch {
+	case opts.PreferIPv4:
+		ipPref = discovery.PreferIPv4
+	case opts.PreferIPv6:
+		ipPref = discovery.PreferIPv6
+	}
+
+	n := newNotifier()
+	go func() {
+		err := core.RunReceiver(ctx, n, core.ReceiveOptions{
+			Code:              link.Code,
+			Hint:              link.Addr(),
+			OutputDir:         opts.OutputDir,
+			OutputName:        opts.Output,
+			Force:             opts.Force,
+			NoPreserve:        opts.NoPreserve,
+			Unzip:             opts.Unzip,
+			NoClipboard:       !opts.Clipboard,
+			NoHistory:         opts.NoHistory,
+			Fresh:             opts.Fresh,
+			Delta:             opts.Delta,
+			Hardlink:          opts.Hardlink,
+			Concurrency:       opts.Concurrency,
+			ParallelThreshold: opts.ParallelThreshold,
+			MaxAttempts:       opts.MaxAttempts,
+			Rate:              opts.Rate,
+			MaxSize:           opts.MaxSize,
+			TextLimit:         opts.TextLimit,
+			ICE:               iceConfig(opts.STUNServers, opts.Relay),
+			LANOnly:           opts.LANOnly,
+			IPPref:            ipPref,
+			Cipher:            cipher,
+			ExpectSender:      opts.ExpectSender,
+		})
+		n.done(err)
+	}()
+	return n.events, nil
+}
+
+// argonParams is the Argon2id cost a sender advertises: auto-sized for this
+// host, with kdfTime and kdfMemory (KiB) replacing their part when not 0.
+func argonParams(kdfTime, kdfMemory uint32) (core.ArgonParams, error) {
+	params := core.AutoArgonParams()
+	if kdfTime != 0 {
+		params.Time = kdfTime
+	}
+	if kdfMemory != 0 {
+		params.Memory = kdfMemory
+	}
+	return params, params.Validate()
+}
+
+func iceConfig(stun []string, relay *Relay) *transport.ICEConfig {
+	cfg := &transport.ICEConfig{STUNServers: stun}
+	if relay != nil {
+		cfg.Turn = &transport.CustomTurnConfig{URL: relay.URL, Username: relay.Username, Password: relay.Password}
+	}
+	return cfg
+}
+
+// notifier is the core.Notifier behind Send and Receive.
+type notifier struct {
+	events chan Event
+}
+
+func newNotifier() *notifier {
+	return &notifier{events: make(chan Event, 64)}
+}
+
+func (n *notifier) Send(msg tea.Msg) {
+	switch m := msg.(type) {
+	case ui.StatusMsg:
+		n.events <- Event{Kind: EventStatus, Message: string(m)}
+	case ui.AttemptsMsg:
+		n.events <- Event{Kind: EventStatus, Message: string(m)}
+	case ui.LinkMsg:
+		n.events <- Event{Kind: EventStatus, Message: "Link: " + string(m)}
+	case ui.SummaryMsg:
+		n.events <- Event{Kind: EventStatus, Message: "Summary: " + m.String()}
+	case ui.TextMsg:
+		n.events <- Event{Kind: EventText, Message: string(m)}
+	case ui.ProgressMsg:
+		n.events <- Event{Kind: EventProgress, Progress: Progress{
+			SentBytes:  m.SentBytes,
+			TotalBytes: m.TotalBytes,
+			Speed:      m.Speed,
+			ETA:        m.ETA,
+			Protocol:   m.Protocol,
+			File:       m.File,
+			FileIndex:  m.FileIndex,
+			FileCount:  m.FileCount,
+		}}
+	case ui.ErrorMsg:
+		n.events <- Event{Kind: EventError, Err: m}
+	}
+}
+
+// done reports the outcome and closes the channel.
+func (n *notifier) done(err error) {
+	n.events <- Event{Kind: EventDone, Err: err}
+	close(n.events)
+}
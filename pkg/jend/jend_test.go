@@ -0,0 +1,126 @@
+package jend
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/darkprince558/jend/internal/core"
+	"github.com/darkprince558/jend/internal/ui"
+)
+
+// TestSendReceiveText runs a text transfer over loopback through the library API.
+func TestSendReceiveText(t *testing.T) {
+	t.Setenv("HOME", t.TempDir()) // The sender signs with its identity key
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	sent, err := Send(ctx, SendOptions{Text: "hello from a library", Timeout: time.Minute, NoHistory: true, LANOnly: true, Port: -1})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	first := <-sent
+	if first.Kind != EventCode || first.Message == "" {
+		t.Fatalf("Expected the code first, got %+v", first)
+	}
+
+	received, err := Receive(ctx, ReceiveOptions{Code: first.Message, OutputDir: t.TempDir(), NoHistory: true, LANOnly: true, MaxAttempts: 3})
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	var text string
+	var last Event
+	for ev := range received {
+		if ev.Kind == EventText {
+			text = ev.Message
+		}
+		last = ev
+	}
+	if last.Kind != EventDone || last.Err != nil {
+		t.Fatalf("Expected a clean EventDone, got %+v", last)
+	}
+	if text != "hello from a library" {
+		t.Errorf("Expected the snippet as EventText, got %q", text)
+	}
+
+	cancel() // The sender keeps serving until cancelled
+	for ev := range sent {
+		last = ev
+	}
+	if last.Kind != EventDone {
+		t.Errorf("Expected the send channel to end with EventDone, got %+v", last)
+	}
+}
+
+// TestNotifierEvents checks how core's ui messages map onto Events, and that
+// the error RunSender/RunReceiver return ends up in EventDone.
+func TestNotifierEvents(t *testing.T) {
+	n := newNotifier()
+	n.Send(ui.StatusMsg("Waiting for receiver"))
+	n.Send(ui.ProgressMsg{SentBytes: 5, TotalBytes: 10, Protocol: "QUIC (Direct)"})
+	n.Send(ui.TextMsg("hello"))
+	n.Send(ui.ErrorMsg(errors.New("boom")))
+	n.done(errors.New("boom"))
+
+	var got []Event
+	for ev := range n.events {
+		got = append(got, ev)
+	}
+	want := []EventKind{EventStatus, EventProgress, EventText, EventError, EventDone}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d events, got %+v", len(want), got)
+	}
+	for i, kind := range want {
+		if got[i].Kind != kind {
+			t.Errorf("Event %d: expected kind %d, got %+v", i, kind, got[i])
+		}
+	}
+	if got[1].Progress.SentBytes != 5 || got[1].Progress.TotalBytes != 10 {
+		t.Errorf("Progress not carried over: %+v", got[1].Progress)
+	}
+	if got[2].Message != "hello" {
+		t.Errorf("Expected the received text, got %q", got[2].Message)
+	}
+	if got[4].Err == nil || got[4].Err.Error() != "boom" {
+		t.Errorf("Expected EventDone to carry the error, got %v", got[4].Err)
+	}
+}
+
+func TestOptionsValidation(t *testing.T) {
+	ctx := context.Background()
+	if _, err := Send(ctx, SendOptions{}); err == nil {
+		t.Error("Expected Send without Paths or Text to fail")
+	}
+	if _, err := Send(ctx, SendOptions{Text: "x", Paths: []string{"a"}}); err == nil {
+		t.Error("Expected Send with both Paths and Text to fail")
+	}
+	if _, err := Send(ctx, SendOptions{Text: "x", ChunkSize: 1}); err == nil {
+		t.Error("Expected an out-of-range chunk size to fail")
+	}
+	if _, err := Receive(ctx, ReceiveOptions{}); err == nil {
+		t.Error("Expected Receive without a code to fail")
+	}
+}
+
+// TestArgonParams checks that unset KDF fields get the same host-sized
+// defaults as the CLI, not the fixed 64 MB.
+func TestArgonParams(t *testing.T) {
+	auto := core.AutoArgonParams()
+	tests := []struct {
+		time, memory uint32
+		want         core.ArgonParams
+		wantErr      bool
+	}{
+		{want: auto},
+		{time: 2, want: core.ArgonParams{Time: 2, Memory: auto.Memory}},
+		{memory: 16 * 1024, want: core.ArgonParams{Time: auto.Time, Memory: 16 * 1024}},
+		{memory: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := argonParams(tt.time, tt.memory)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("argonParams(%d, %d) = %+v, %v; want %+v (error %v)", tt.time, tt.memory, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
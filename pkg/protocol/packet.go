@@ -11,9 +11,26 @@ const (
 	TypeHandshake = 1 // Initial metadata (Filename, Size, Hash)
 	TypeData      = 2 // File chunk data
 	TypeAck       = 3 // Acknowledgment of receipt
-	TypeError     = 4 // Error signal
+	TypeError     = 4 // Fatal sender error, sent before hanging up: JSON {"code", "message"}
 	TypeCancel    = 5 // Sender cancellation signal
 	TypeRangeReq  = 6 // Parallel stream range request
+
+	// Fan-out (one-to-many) session, see docs/fanout.md. Reserved, not yet sent.
+	TypeJoin       = 7 // Receiver joins a fan-out session with the ranges it already has
+	TypeJoinAck    = 8 // Sender accepts the join (session id, chunk size, next sequence)
+	TypeFanoutData = 9 // Broadcast chunk: [seq uint64][offset int64][payload]
+
+	TypeKeepAlive = 10 // Liveness ping while the sender is busy (e.g. hashing); empty payload, skipped by receivers
+
+	TypeFileStart = 11 // Multi-file session: the following data starts manifest entry [index uint32]
+
+	// Receiver identity, for senders with an allow-list (send --allow)
+	TypeIdentityReq = 12 // Sender asks the receiver to prove its key: [nonce 32]
+	TypeIdentity    = 13 // Receiver's answer: [ed25519 public key 32][signature 64]
+
+	// Delta sync (receive --delta), see internal/core/delta.go
+	TypeDeltaSig  = 14 // Receiver's answer to a handshake, instead of TypeAck: [block size uint32], then per block of its older version [weak sum uint32][strong sum 16]
+	TypeDeltaCopy = 15 // Copy [offset int64][length int64] from the receiver's older version; new bytes come as TypeData
 )
 
 // PacketHeader represents the fixed-size header for every packet